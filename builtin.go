@@ -3,15 +3,27 @@ package main
 import (
 	_ "github.com/CN-TU/go-flows/modules/exporters/csv"
 	_ "github.com/CN-TU/go-flows/modules/exporters/ipfix"
+	_ "github.com/CN-TU/go-flows/modules/exporters/jsonl"
 	_ "github.com/CN-TU/go-flows/modules/exporters/null"
+	_ "github.com/CN-TU/go-flows/modules/exporters/parquet"
+	_ "github.com/CN-TU/go-flows/modules/features/control"
 	_ "github.com/CN-TU/go-flows/modules/features/custom"
+	_ "github.com/CN-TU/go-flows/modules/features/dns"
 	_ "github.com/CN-TU/go-flows/modules/features/iana"
 	_ "github.com/CN-TU/go-flows/modules/features/nta"
 	_ "github.com/CN-TU/go-flows/modules/features/operations"
 	_ "github.com/CN-TU/go-flows/modules/features/staging"
+	_ "github.com/CN-TU/go-flows/modules/features/tls"
+	_ "github.com/CN-TU/go-flows/modules/filters/bpf"
+	_ "github.com/CN-TU/go-flows/modules/filters/cidr"
+	_ "github.com/CN-TU/go-flows/modules/filters/dedup"
+	_ "github.com/CN-TU/go-flows/modules/filters/sampling"
 	_ "github.com/CN-TU/go-flows/modules/filters/time"
 	_ "github.com/CN-TU/go-flows/modules/keys/header"
 	_ "github.com/CN-TU/go-flows/modules/keys/time"
+	_ "github.com/CN-TU/go-flows/modules/keys/tunnel"
 	_ "github.com/CN-TU/go-flows/modules/labels/csv"
+	_ "github.com/CN-TU/go-flows/modules/labels/flow"
 	_ "github.com/CN-TU/go-flows/modules/sources/libpcap"
+	_ "github.com/CN-TU/go-flows/modules/sources/pcapgo"
 )
@@ -25,12 +25,20 @@ configured from the command line.
 
 source is a packet source, which must provide single packets as []byte sequences and metadata like
 capture time, and dropped/filtered packets. The []byte-buffer can be reused for the next packet.
-For examples look at modules/sources.
+For examples look at modules/sources. The libpcap source needs cgo; the pcapgo source reads pcap and
+pcapng files (also gzip, zstd, or xz compressed) without cgo. A binary without cgo can be built with
+go-flows-build -sources.libpcap build.
 
 filter is a packet filter, which must return true for a given packet if it should be filtered out.
 For examples look at modules/filters.
 
-parse is a fixed step that parses the packet with gopacket.
+parse is a fixed step that parses the packet with gopacket. Tunnels (GRE, VXLAN, GENEVE, IP in IP) can be
+decapsulated with the command line option -tunnel. In this case keys and features use the inner headers;
+the outer addresses and the tunnel id are available with the _tunnel* keys and features.
+With the command line option -defrag, IPv4 and IPv6 fragments are reassembled after parsing (fragments are
+held for at most -defragTimeout seconds, with at most -defragFragments fragments held at the same time).
+The number of fragments, overlapping fragments, and failed reassemblies are available with the
+_fragmentCount, _overlappingFragments, and _reassemblyFailures features.
 
 label is an optional step, that can provide an arbitrary label for every packet. For examples look at
 modules/labels.
@@ -87,7 +95,11 @@ Simpleformat specification:
 		"_filter_features": [...],
 		"_per_packet": <bool>,
 		"_allow_zero": <bool>,
-		"_expire_TCP": <bool>
+		"_expire_TCP": <bool>,
+		"_tcp_timeouts": {...},
+		"_max_flows": <Number>,
+		"_eviction": <String>,
+		"_timeouts": [...]
 	}
 
 V2-formated file:
@@ -112,10 +124,40 @@ Only single pass operations can ever be supported due to design restrictions in
 In addition to the features specified in the nta-meta-analysis, two addional types of features are present:
 Filter features which can exclude packets from a whole flow, and control features which can change flow
 behaviour like exporting the flow before the end, restarting the flow, or discarding the flow.
+Control features with parameters use the same call syntax as features (e.g. {"exportAfterPackets": [1000]}).
 _per_packet allows exporting one flow per packet. If _allow_zero is true, then packets are accepted, where
 one of the parts of the flow key would be zero (e.g. non-IP packets for flow keys that contain IP-Addresses).
 If _expire_TCP is set to false, no TCP-based expiry is carried out (e.g. RST packets). TCP expiry is
-only carried out if at least the five-tuple is part of the flow key.
+only carried out if at least the five-tuple is part of the flow key. TCP expiry follows the connection state
+(handshake including simultaneous open, established, half-closed, closing, time-wait, reset). By default flows
+end as soon as both FINs have been acknowledged or a RST was seen. _tcp_timeouts changes the timeouts per state:
+
+	"_tcp_timeouts": {"handshake": 5, "established": 3600, "half_closed": 120, "closing": 10, "time_wait": 2, "reset": 1}
+
+handshake, established, half_closed, and closing replace the idle timeout while the connection is in this state.
+time_wait and reset delay the export after the connection was closed or reset, so that retransmissions and final
+ACKs still belong to the flow. Missing values keep the idle timeout, or export immediately for time_wait and
+reset. The final connection state can be exported with the _tcpConnState feature, which uses the same names as
+zeek's conn_state (S0, S1, SF, REJ, S2, S3, RSTO, RSTR, RSTOS0, RSTRH, SH, SHR, OTH).
+_max_flows limits the number of concurrent flows per flow table (default 0 = unlimited). If a new flow
+would exceed this limit, an existing flow is exported with flowEndReason lackOfResources (5). Which flow
+gets evicted is specified by _eviction: "oldest" (default; the flow that was created first), "lru" (the flow
+that was idle for the longest time), or "smallest" (the flow with the fewest packets). The number of
+evicted flows is part of the table statistics.
+_timeouts allows different timeouts for different kinds of flows. It is a list of profiles, which are tried in
+order for the first packet of a flow; the first profile where every given condition matches is used:
+
+	"_timeouts": [
+		{"name": "dns", "protocol": 17, "ports": [53], "active_timeout": 10, "idle_timeout": 2},
+		{"name": "long", "protocol": 6, "ports": [22, "3306", "5432-5433"], "idle_timeout": 3600},
+		{"name": "internal", "addresses": ["10.0.0.0/8"], "destination_ports": ["8000-8999"], "idle_timeout": 60}
+	]
+
+protocol is a protocol identifier or a list of those, ports (source or destination port), source_ports, and
+destination_ports are lists of ports or port ranges, and addresses (source or destination address) is a list of
+networks in CIDR notation. Source and destination refer to the first packet of the flow. Missing timeouts are
+taken from active_timeout and idle_timeout, which are also used for flows without matching profile (profile name
+"default"). The profile name of a flow can be exported with the _timeoutProfile feature.
 
 A list of supported features can be queried with "./go-flows features"
 
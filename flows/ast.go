@@ -478,11 +478,17 @@ func (me multiError) Error() string {
 
 func (a *astCall) build(ret FeatureType) error {
 	if a.control {
-		candidates := getFeatures(a.name, ControlFeature, 1)
+		candidates := getFeatures(a.name, ControlFeature, len(a.args))
 		if len(candidates) == 0 {
-			return fmt.Errorf("couldn't find control feature '%s'", a.name)
+			return fmt.Errorf("couldn't find control feature '%s' with %d parameter(s)", a.name, len(a.args)-1)
 		}
-		a.feature = candidates[0]
+		candidate := candidates[0]
+		for i := range a.args {
+			if err := a.args[i].build(candidate.arguments[i]); err != nil {
+				return err
+			}
+		}
+		a.feature = candidate
 		a.ret = ControlFeature
 		return nil
 	}
@@ -654,7 +660,7 @@ type ast struct {
 }
 
 // makeAST builds a basic ast for the given feature specification (no verification done yet)
-func makeAST(features []interface{}, control, filter []string, exporter []Exporter, input, ret FeatureType) (*ast, error) {
+func makeAST(features []interface{}, control []interface{}, filter []string, exporter []Exporter, input, ret FeatureType) (*ast, error) {
 	r := &ast{
 		ret:      ret,
 		input:    input,
@@ -672,11 +678,19 @@ func makeAST(features []interface{}, control, filter []string, exporter []Export
 		r.fragments[i].SetExport(r.fragments[i].MakeExportName())
 	}
 	for i, feature := range control {
+		if call, ok := feature.([]interface{}); ok && len(call) > 0 {
+			// control features with parameters: input is always the first argument
+			source, err := makeASTRaw(input)
+			if err != nil {
+				return r, FeatureError{i + 1, fmt.Sprint(call[0]), err}
+			}
+			feature = append([]interface{}{call[0], source}, call[1:]...)
+		}
 		frag, err := makeASTFragment(feature, input, i+1)
-		frag.SetControl(true)
 		if err != nil {
-			return r, FeatureError{frag.ID(), fmt.Sprint(frag), err}
+			return r, FeatureError{i + 1, fmt.Sprint(feature), err}
 		}
+		frag.SetControl(true)
 		r.fragments = append(r.fragments, frag)
 	}
 
@@ -1019,6 +1033,12 @@ func (a *ast) convert() (features []MakeFeature, filters []MakeFeature, args [][
 		features = append(features, fm.make)
 		if fragment.Control() {
 			ctrl.control = append(ctrl.control, fragment.Register())
+			// control features only get parameters; events are delivered directly from the record
+			for _, arg := range fragment.Arguments() {
+				if !arg.IsRaw() {
+					args[fragment.Register()] = append(args[fragment.Register()], arg.Register())
+				}
+			}
 			continue
 		}
 
@@ -0,0 +1,257 @@
+package flows
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+)
+
+// Snapshotter is implemented by features and flows, whose state can be saved in a checkpoint and restored in a later
+// run (see WriteCheckpoint and ReadCheckpoint). Flows containing a feature without this interface can't be saved and
+// are ended like on EOF instead.
+type Snapshotter interface {
+	// Snapshot writes the state to enc
+	Snapshot(enc *gob.Encoder) error
+	// Restore reads the state written by Snapshot from dec
+	Restore(dec *gob.Decoder) error
+}
+
+// FlowRestorer is responsible for recreating flows from a checkpoint. Supplied values are the flowtable, the flow key,
+// a context holding the time of the checkpoint, and the decoder positioned at the state written by Snapshot of the flow.
+type FlowRestorer func(*FlowTable, string, *EventContext, *gob.Decoder) (Flow, error)
+
+const checkpointVersion = 1
+
+type checkpointHeader struct {
+	Version int
+	Time    DateTimeNanoseconds
+	Fields  [][]string
+	FlowIDs []uint64
+}
+
+type checkpointEntry struct {
+	Key string
+	End bool
+}
+
+type snapshotValue struct {
+	Value interface{}
+}
+
+func init() {
+	gob.Register(DateTimeNanoseconds(0))
+	gob.Register(DateTimeMicroseconds(0))
+	gob.Register(DateTimeMilliseconds(0))
+	gob.Register(DateTimeSeconds(0))
+	gob.Register(FlowEndReason(0))
+	gob.Register(net.IP{})
+	gob.Register(net.HardwareAddr{})
+	gob.Register([]interface{}{})
+}
+
+// EncodeValue writes a feature value (which might be nil) to enc. Types, which are not built in, must be registered
+// with gob.Register.
+func EncodeValue(enc *gob.Encoder, value interface{}) error {
+	return enc.Encode(snapshotValue{value})
+}
+
+// DecodeValue reads a feature value written by EncodeValue from dec.
+func DecodeValue(dec *gob.Decoder) (interface{}, error) {
+	var v snapshotValue
+	err := dec.Decode(&v)
+	return v.Value, err
+}
+
+// fields returns the field names of every record
+func (rl RecordListMaker) fields() [][]string {
+	ret := make([][]string, len(rl.list))
+	for i, record := range rl.list {
+		ret[i] = record.fields
+	}
+	return ret
+}
+
+// checkpoint writes every active flow, which can be saved, to enc. Outstanding timers get expired, and flows, which
+// can't be saved, get terminated with an eof event. Saved flows stay in the table until finishCheckpoint.
+func (tab *FlowTable) checkpoint(enc *gob.Encoder, now DateTimeNanoseconds) (written int, err error) {
+	tab.expiring = true
+	tab.eof = true
+	defer func() {
+		tab.expiring = false
+		tab.eof = false
+	}()
+	context := &EventContext{when: now}
+	for _, v := range tab.flowlist {
+		if v == nil {
+			continue
+		}
+		context.initFlow(v)
+		if now > v.nextEvent() {
+			v.expire(context)
+		}
+		if !v.Active() {
+			continue
+		}
+		s, ok := v.(Snapshotter)
+		if !ok || !v.checkpointable() {
+			v.EOF(context)
+			continue
+		}
+		if err = enc.Encode(checkpointEntry{Key: v.Key()}); err == nil {
+			err = s.Snapshot(enc)
+		}
+		if err != nil {
+			return
+		}
+		written++
+	}
+	return
+}
+
+// finishCheckpoint removes the flows saved by checkpoint from the table, if the checkpoint was committed. Otherwise
+// they are ended like with EOF, since the checkpoint is lost.
+func (tab *FlowTable) finishCheckpoint(now DateTimeNanoseconds, committed bool) {
+	if !committed {
+		tab.EOF(now)
+		return
+	}
+	tab.eof = true
+	for _, v := range tab.flowlist {
+		if v != nil && v.Active() {
+			v.Stop()
+		}
+	}
+	tab.eof = false
+	tab.clear()
+	if tab.SortOutput != SortTypeNone {
+		tab.flushAllExports()
+	}
+}
+
+// restore adds a flow read from a checkpoint to the table
+func (tab *FlowTable) restore(key string, context *EventContext, dec *gob.Decoder, restore FlowRestorer) error {
+	if _, ok := tab.flows[key]; ok {
+		return fmt.Errorf("flow key %x restored twice", key)
+	}
+	elem, err := restore(tab, key, context, dec)
+	if err != nil {
+		return err
+	}
+	var new int
+	freelen := len(tab.freelist)
+	if freelen == 0 {
+		new = len(tab.flowlist)
+		tab.flowlist = append(tab.flowlist, elem)
+	} else {
+		new, tab.freelist = tab.freelist[freelen-1], tab.freelist[:freelen-1]
+		tab.flowlist[new] = elem
+	}
+	tab.flows[key] = new
+	if tab.eviction != nil {
+		tab.eviction.add(new)
+		tab.eviction.touch(new)
+	}
+	if elem.ID() >= tab.flowID {
+		tab.flowID = elem.ID() + 1
+	}
+	tab.schedule(new, elem)
+	return nil
+}
+
+// WriteCheckpoint writes the active flows of all tables to w and calls commit (if not nil), which must make the
+// checkpoint permanent (e.g., flush and rename the file). Afterwards the saved flows are removed from the tables. If
+// writing or commit fails, they are ended like with EOF instead, so no flow is lost. Flows, which can't be saved (see
+// Snapshotter), are ended like with EOF. Exports are flushed. Returns the number of saved flows.
+func WriteCheckpoint(w io.Writer, tables []*FlowTable, now DateTimeNanoseconds, commit func() error) (int, error) {
+	if len(tables) == 0 {
+		return 0, errors.New("no flow tables")
+	}
+	written, err := writeCheckpoint(w, tables, now)
+	if err == nil && commit != nil {
+		err = commit()
+	}
+	for _, table := range tables {
+		table.finishCheckpoint(now, err == nil)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+func writeCheckpoint(w io.Writer, tables []*FlowTable, now DateTimeNanoseconds) (int, error) {
+	enc := gob.NewEncoder(w)
+	header := checkpointHeader{
+		Version: checkpointVersion,
+		Time:    now,
+		Fields:  tables[0].records.fields(),
+		FlowIDs: make([]uint64, len(tables)),
+	}
+	for i, table := range tables {
+		header.FlowIDs[i] = table.flowID
+	}
+	if err := enc.Encode(header); err != nil {
+		return 0, err
+	}
+	written := 0
+	for _, table := range tables {
+		n, err := table.checkpoint(enc, now)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, enc.Encode(checkpointEntry{End: true})
+}
+
+// ReadCheckpoint restores the flows written by WriteCheckpoint into the tables. pick must return the table a flow key
+// belongs to; restore creates the flows. The feature specification must be the same as in the run, which wrote the
+// checkpoint. Returns the number of restored flows.
+func ReadCheckpoint(r io.Reader, tables []*FlowTable, pick func(key string) *FlowTable, restore FlowRestorer) (int, error) {
+	if len(tables) == 0 {
+		return 0, errors.New("no flow tables")
+	}
+	dec := gob.NewDecoder(r)
+	var header checkpointHeader
+	if err := dec.Decode(&header); err != nil {
+		return 0, err
+	}
+	if header.Version != checkpointVersion {
+		return 0, fmt.Errorf("unsupported checkpoint version %d", header.Version)
+	}
+	if !reflect.DeepEqual(header.Fields, tables[0].records.fields()) {
+		return 0, errors.New("checkpoint was written with a different feature specification")
+	}
+	// flow ids must stay unique, even if the number of tables changed
+	var maxID uint64
+	for _, id := range header.FlowIDs {
+		if id > maxID {
+			maxID = id
+		}
+	}
+	for i, table := range tables {
+		if len(header.FlowIDs) == len(tables) {
+			table.flowID = header.FlowIDs[i]
+		} else {
+			table.flowID = maxID
+		}
+	}
+	context := &EventContext{when: header.Time}
+	restored := 0
+	for {
+		var entry checkpointEntry
+		if err := dec.Decode(&entry); err != nil {
+			return restored, err
+		}
+		if entry.End {
+			return restored, nil
+		}
+		if err := pick(entry.Key).restore(entry.Key, context, dec, restore); err != nil {
+			return restored, err
+		}
+		restored++
+	}
+}
@@ -14,6 +14,12 @@ type EventContext struct {
 	keep    bool
 	hard    bool
 	forward bool
+	// started is set if a record was started during the current event
+	started bool
+	// renew is set by a flow, which ended during the current event, if the event belongs to a new flow
+	renew bool
+	// timeouts holds the timeout profile for a flow created by the current event
+	timeouts *TimeoutProfile
 }
 
 // initFlow sets the flow. This must be called in a flow before passing the context to features.
@@ -75,6 +81,17 @@ func (ec *EventContext) Flow() Flow {
 	return ec.flow
 }
 
+// Started returns true, if a record of the flow was started or restarted during the current event
+func (ec *EventContext) Started() bool {
+	return ec.started
+}
+
+// Renew must be called by a flow, which ended itself during the current event, if the event starts a new flow with the
+// same key (e.g., a new tcp connection on the same ports). The table then creates a new flow for the event.
+func (ec *EventContext) Renew() {
+	ec.renew = true
+}
+
 // Forward returns true if the packet is in the same direction as the first packet
 func (ec *EventContext) Forward() bool {
 	return ec.forward
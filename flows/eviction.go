@@ -0,0 +1,216 @@
+package flows
+
+import "fmt"
+
+// EvictionPolicy specifies which flow gets removed from a full flow table
+type EvictionPolicy int
+
+const (
+	// EvictOldest evicts the flow that was created first
+	EvictOldest EvictionPolicy = iota
+	// EvictLRU evicts the flow which did not receive an event for the longest time (least recently used)
+	EvictLRU
+	// EvictSmallest evicts the flow with the least number of events
+	EvictSmallest
+)
+
+func (e EvictionPolicy) String() string {
+	switch e {
+	case EvictOldest:
+		return "oldest"
+	case EvictLRU:
+		return "lru"
+	case EvictSmallest:
+		return "smallest"
+	}
+	return "EvictionPolicy(?)"
+}
+
+// ParseEvictionPolicy returns the eviction policy with the given name (one of oldest, lru, or smallest)
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "oldest":
+		return EvictOldest, nil
+	case "lru":
+		return EvictLRU, nil
+	case "smallest":
+		return EvictSmallest, nil
+	}
+	return EvictOldest, fmt.Errorf("unknown eviction policy '%s' (must be one of oldest, lru, smallest)", name)
+}
+
+// evictionList keeps track of flow table slots for choosing a flow to evict.
+//
+// For oldest and lru, slots are kept in a doubly linked list (indices into the flowlist) ordered by creation time
+// (oldest) or last event (lru). For smallest, slots are kept in a binary min-heap keyed on the number of events per
+// slot; ties are broken by creation order, which evicts the oldest of the smallest flows.
+type evictionList struct {
+	prev, next []int
+	events     []uint64
+	created    []uint64
+	heap       []int
+	pos        []int
+	serial     uint64
+	head, tail int
+	policy     EvictionPolicy
+}
+
+func makeEvictionList(policy EvictionPolicy) *evictionList {
+	return &evictionList{
+		head:   -1,
+		tail:   -1,
+		policy: policy,
+	}
+}
+
+// add adds a new slot to the end of the list
+func (l *evictionList) add(slot int) {
+	for len(l.prev) <= slot {
+		l.prev = append(l.prev, -1)
+		l.next = append(l.next, -1)
+		l.events = append(l.events, 0)
+		l.created = append(l.created, 0)
+		l.pos = append(l.pos, -1)
+	}
+	l.events[slot] = 0
+	if l.policy == EvictSmallest {
+		l.created[slot] = l.serial
+		l.serial++
+		l.pos[slot] = len(l.heap)
+		l.heap = append(l.heap, slot)
+		l.up(len(l.heap) - 1)
+		return
+	}
+	l.link(slot)
+}
+
+// link appends the slot to the end of the list
+func (l *evictionList) link(slot int) {
+	l.prev[slot] = l.tail
+	l.next[slot] = -1
+	if l.tail == -1 {
+		l.head = slot
+	} else {
+		l.next[l.tail] = slot
+	}
+	l.tail = slot
+}
+
+// unlink removes the slot from the linked list
+func (l *evictionList) unlink(slot int) {
+	prev, next := l.prev[slot], l.next[slot]
+	if prev == -1 {
+		l.head = next
+	} else {
+		l.next[prev] = next
+	}
+	if next == -1 {
+		l.tail = prev
+	} else {
+		l.prev[next] = prev
+	}
+	l.prev[slot] = -1
+	l.next[slot] = -1
+}
+
+// remove removes the slot from the list
+func (l *evictionList) remove(slot int) {
+	if l.policy != EvictSmallest {
+		l.unlink(slot)
+		return
+	}
+	i := l.pos[slot]
+	if i == -1 {
+		return
+	}
+	last := len(l.heap) - 1
+	l.pos[slot] = -1
+	if i != last {
+		moved := l.heap[last]
+		l.heap[i] = moved
+		l.pos[moved] = i
+		l.heap = l.heap[:last]
+		l.down(i)
+		l.up(l.pos[moved])
+		return
+	}
+	l.heap = l.heap[:last]
+}
+
+// touch needs to be called for every event belonging to slot
+func (l *evictionList) touch(slot int) {
+	l.events[slot]++
+	switch {
+	case l.policy == EvictSmallest:
+		l.down(l.pos[slot])
+	case l.policy == EvictLRU && l.tail != slot:
+		l.unlink(slot)
+		l.link(slot)
+	}
+}
+
+// victim returns the slot which should be evicted next or -1 if the list is empty
+func (l *evictionList) victim() int {
+	if l.policy != EvictSmallest {
+		return l.head
+	}
+	if len(l.heap) == 0 {
+		return -1
+	}
+	return l.heap[0]
+}
+
+// reset removes all slots from the list
+func (l *evictionList) reset() {
+	l.prev = l.prev[:0]
+	l.next = l.next[:0]
+	l.events = l.events[:0]
+	l.created = l.created[:0]
+	l.heap = l.heap[:0]
+	l.pos = l.pos[:0]
+	l.head = -1
+	l.tail = -1
+}
+
+func (l *evictionList) less(i, j int) bool {
+	a, b := l.heap[i], l.heap[j]
+	if l.events[a] != l.events[b] {
+		return l.events[a] < l.events[b]
+	}
+	return l.created[a] < l.created[b]
+}
+
+func (l *evictionList) swap(i, j int) {
+	l.heap[i], l.heap[j] = l.heap[j], l.heap[i]
+	l.pos[l.heap[i]] = i
+	l.pos[l.heap[j]] = j
+}
+
+func (l *evictionList) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !l.less(i, parent) {
+			return
+		}
+		l.swap(i, parent)
+		i = parent
+	}
+}
+
+func (l *evictionList) down(i int) {
+	n := len(l.heap)
+	for {
+		child := 2*i + 1
+		if child >= n {
+			return
+		}
+		if right := child + 1; right < n && l.less(right, child) {
+			child = right
+		}
+		if !l.less(child, i) {
+			return
+		}
+		l.swap(i, child)
+		i = child
+	}
+}
@@ -0,0 +1,42 @@
+package flows
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestEvictionSmallest(t *testing.T) {
+	l := makeEvictionList(EvictSmallest)
+	r := rand.New(rand.NewSource(1))
+	events := make(map[int]uint64)
+	created := make(map[int]int)
+	for i := 0; i < 10000; i++ {
+		slot := r.Intn(100)
+		_, ok := events[slot]
+		switch {
+		case !ok:
+			l.add(slot)
+			events[slot] = 0
+			created[slot] = i
+		case r.Intn(4) == 0:
+			l.remove(slot)
+			delete(events, slot)
+		default:
+			l.touch(slot)
+			events[slot]++
+		}
+		expected := -1
+		for slot, n := range events {
+			if expected == -1 || n < events[expected] || (n == events[expected] && created[slot] < created[expected]) {
+				expected = slot
+			}
+		}
+		if victim := l.victim(); victim != expected {
+			t.Fatalf("step %d: victim is slot %d; expected %d", i, victim, expected)
+		}
+	}
+	l.reset()
+	if victim := l.victim(); victim != -1 {
+		t.Errorf("victim %d after reset", victim)
+	}
+}
@@ -0,0 +1,114 @@
+package flows
+
+// expiryHeap keeps track of the next timer event of every flow table slot.
+//
+// It is a binary min-heap of slots (indices into the flowlist) keyed on the time of the next event, which allows
+// expiring only the flows with due timers instead of scanning the whole table. pos holds the heap index of every slot
+// (-1 if the slot has no pending timer) and when the key the slot was inserted with.
+type expiryHeap struct {
+	slots []int
+	pos   []int
+	when  []DateTimeNanoseconds
+}
+
+// update sets the time of the next event of slot; 0 removes the slot
+func (h *expiryHeap) update(slot int, when DateTimeNanoseconds) {
+	for len(h.pos) <= slot {
+		h.pos = append(h.pos, -1)
+		h.when = append(h.when, 0)
+	}
+	if when == 0 {
+		h.remove(slot)
+		return
+	}
+	old := h.when[slot]
+	h.when[slot] = when
+	i := h.pos[slot]
+	if i == -1 {
+		h.pos[slot] = len(h.slots)
+		h.slots = append(h.slots, slot)
+		h.up(len(h.slots) - 1)
+		return
+	}
+	if when < old {
+		h.up(i)
+	} else if when > old {
+		h.down(i)
+	}
+}
+
+// remove removes slot from the heap; nothing happens if it is not part of the heap
+func (h *expiryHeap) remove(slot int) {
+	if slot >= len(h.pos) || h.pos[slot] == -1 {
+		return
+	}
+	i := h.pos[slot]
+	last := len(h.slots) - 1
+	h.pos[slot] = -1
+	h.when[slot] = 0
+	if i != last {
+		moved := h.slots[last]
+		h.slots[i] = moved
+		h.pos[moved] = i
+		h.slots = h.slots[:last]
+		h.down(i)
+		h.up(h.pos[moved])
+		return
+	}
+	h.slots = h.slots[:last]
+}
+
+// next returns the slot with the earliest event and its time or -1 if the heap is empty
+func (h *expiryHeap) next() (int, DateTimeNanoseconds) {
+	if len(h.slots) == 0 {
+		return -1, 0
+	}
+	slot := h.slots[0]
+	return slot, h.when[slot]
+}
+
+// reset removes all slots from the heap
+func (h *expiryHeap) reset() {
+	h.slots = h.slots[:0]
+	h.pos = h.pos[:0]
+	h.when = h.when[:0]
+}
+
+func (h *expiryHeap) less(i, j int) bool {
+	return h.when[h.slots[i]] < h.when[h.slots[j]]
+}
+
+func (h *expiryHeap) swap(i, j int) {
+	h.slots[i], h.slots[j] = h.slots[j], h.slots[i]
+	h.pos[h.slots[i]] = i
+	h.pos[h.slots[j]] = j
+}
+
+func (h *expiryHeap) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if !h.less(i, parent) {
+			return
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+func (h *expiryHeap) down(i int) {
+	n := len(h.slots)
+	for {
+		child := 2*i + 1
+		if child >= n {
+			return
+		}
+		if right := child + 1; right < n && h.less(right, child) {
+			child = right
+		}
+		if !h.less(child, i) {
+			return
+		}
+		h.swap(i, child)
+		i = child
+	}
+}
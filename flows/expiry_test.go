@@ -0,0 +1,46 @@
+package flows
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestExpiryHeap(t *testing.T) {
+	var h expiryHeap
+	r := rand.New(rand.NewSource(1))
+	expected := make(map[int]DateTimeNanoseconds)
+	for i := 0; i < 10000; i++ {
+		slot := r.Intn(100)
+		switch r.Intn(3) {
+		case 0:
+			h.remove(slot)
+			delete(expected, slot)
+		default:
+			when := DateTimeNanoseconds(r.Intn(1000) + 1)
+			h.update(slot, when)
+			expected[slot] = when
+		}
+		slot, when := h.next()
+		min := DateTimeNanoseconds(0)
+		for _, v := range expected {
+			if min == 0 || v < min {
+				min = v
+			}
+		}
+		if when != min || (slot == -1) != (len(expected) == 0) || (slot != -1 && expected[slot] != when) {
+			t.Fatalf("step %d: next is slot %d at %d; expected time %d", i, slot, when, min)
+		}
+	}
+	var last DateTimeNanoseconds
+	for n := len(expected); n > 0; n-- {
+		slot, when := h.next()
+		if when < last || expected[slot] != when {
+			t.Fatalf("slot %d at %d returned after %d", slot, when, last)
+		}
+		last = when
+		h.remove(slot)
+	}
+	if slot, _ := h.next(); slot != -1 {
+		t.Errorf("heap not empty after removing every slot")
+	}
+}
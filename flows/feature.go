@@ -1,5 +1,7 @@
 package flows
 
+import "encoding/gob"
+
 // Feature interfaces, which all features need to implement
 type Feature interface {
 	// Event gets called for every event. Data is provided via the first argument and a context providing addional information/control via the second argument.
@@ -141,6 +143,34 @@ func (f *BaseFeature) SetValue(new interface{}, context *EventContext, self inte
 	}
 }
 
+// SnapshotValue writes the current value and the given additional state of the feature to enc. Use this for
+// implementing Snapshotter.
+func (f *BaseFeature) SnapshotValue(enc *gob.Encoder, state ...interface{}) error {
+	if err := EncodeValue(enc, f.value); err != nil {
+		return err
+	}
+	for _, s := range state {
+		if err := enc.Encode(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RestoreValue restores the value written by SnapshotValue without forwarding it to dependent features. state must
+// contain pointers to the additional state in the same order as for SnapshotValue.
+func (f *BaseFeature) RestoreValue(dec *gob.Decoder, state ...interface{}) (err error) {
+	if f.value, err = DecodeValue(dec); err != nil {
+		return
+	}
+	for _, s := range state {
+		if err = dec.Decode(s); err != nil {
+			return
+		}
+	}
+	return
+}
+
 // For speed purposes, features with multiple arguments are split into 3 cathegories:
 // - singleMultiEvent: one non const argument
 // - dualMultiEvent: two non const arguments
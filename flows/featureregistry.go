@@ -160,9 +160,10 @@ func RegisterTemporaryFeature(name string, description string, t ipfix.Type, tl
 	RegisterFeature(ie, description, ret, make, arguments...)
 }
 
-// RegisterControlFeature registers a control feature (i.e. a feature that can manipulate flow behaviour)
-func RegisterControlFeature(name string, description string, make MakeFeature) {
-	RegisterFunction(name, description, ControlFeature, make, RawPacket)
+// RegisterControlFeature registers a control feature (i.e. a feature that can manipulate flow behaviour). Additional
+// arguments (e.g. Const) are parameters that must be provided in the specification with the call syntax.
+func RegisterControlFeature(name string, description string, make MakeFeature, arguments ...FeatureType) {
+	RegisterFunction(name, description, ControlFeature, make, append([]FeatureType{RawPacket}, arguments...)...)
 }
 
 // RegisterFilterFeature registers a filter feature (i.e. a feature that can skip events for a flow)
@@ -230,6 +231,13 @@ func ListFeatures(w io.Writer) {
 				desc[name] = feature.description
 				if feature.ret == ControlFeature {
 					control = append(control, name)
+					tmp := make([]string, len(feature.arguments)-1)
+					for i := range tmp {
+						if feature.arguments[i+1] == Const {
+							tmp[i] = "C"
+						}
+					}
+					args[name] = strings.Join(tmp, ",")
 				} else if feature.ret == RawPacket || feature.ret == RawFlow {
 					filters = append(filters, name)
 					tmp := make([]string, len(feature.arguments))
@@ -381,7 +389,11 @@ func ListFeatures(w io.Writer) {
 		}
 		last = name
 		line := new(bytes.Buffer)
-		fmt.Fprintf(line, "  %1s\t%1s\t%s\t%s\n", " ", " ", name, desc[name])
+		if args[name] != "" {
+			fmt.Fprintf(line, "  %1s\t%1s\t%s(%s)\t%s\n", " ", " ", name, args[name], desc[name])
+		} else {
+			fmt.Fprintf(line, "  %1s\t%1s\t%s\t%s\n", " ", " ", name, desc[name])
+		}
 		t.Write(line.Bytes())
 	}
 	t.Flush()
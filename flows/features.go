@@ -1,6 +1,7 @@
 package flows
 
 import (
+	"encoding/gob"
 	"fmt"
 
 	"github.com/CN-TU/go-ipfix"
@@ -81,11 +82,20 @@ func (f *selectF) Event(new interface{}, context *EventContext, src interface{})
 	}
 }
 
+// Snapshot is a noop, since the selection is only valid during an event
+func (f *selectF) Snapshot(*gob.Encoder) error { return nil }
+
+// Restore is a noop (see Snapshot)
+func (f *selectF) Restore(*gob.Decoder) error { return nil }
+
 type selectS struct {
 	EmptyBaseFeature
 	start, stop, current int64
 }
 
+func (f *selectS) Snapshot(enc *gob.Encoder) error { return enc.Encode(f.current) }
+func (f *selectS) Restore(dec *gob.Decoder) error  { return dec.Decode(&f.current) }
+
 func (f *selectS) SetArguments(arguments []int, features []Feature) {
 	f.start = ToInt(features[arguments[0]].Value())
 	f.stop = ToInt(features[arguments[1]].Value())
@@ -1,5 +1,7 @@
 package flows
 
+import "encoding/gob"
+
 // FlowEndReason holds the flowEndReason as specified by RFC5102
 type FlowEndReason byte
 
@@ -39,6 +41,8 @@ type Flow interface {
 	Export(reason FlowEndReason, context *EventContext, now DateTimeNanoseconds)
 	// ExportWithoutContext exports the features of the flow (see Export). This function can be used from within timers.
 	ExportWithoutContext(reason FlowEndReason, expire, now DateTimeNanoseconds)
+	// Stop removes the flow from the table without exporting it
+	Stop()
 
 	//// Functions for querying flow status
 	//// ------------------------------------------------------------------
@@ -50,6 +54,8 @@ type Flow interface {
 	ID() uint64
 	// Table returns the flow table this flow belongs to
 	Table() *FlowTable
+	// Timeouts returns the timeout profile used for this flow
+	Timeouts() *TimeoutProfile
 
 	//// Functions for flow initialization
 	//// ------------------------------------------------------------------
@@ -62,30 +68,59 @@ type Flow interface {
 	expire(*EventContext)
 	// firstLowToHigh returns the direction of the first packet
 	firstLowToHigh() bool
+	// checkpointable returns true if the state of the flow can be saved in a checkpoint
+	checkpointable() bool
 }
 
-//FlowOptions applying to each flow
+// FlowOptions applying to each flow
 type FlowOptions struct {
 	// ActiveTimeout is the active timeout in nanoseconds
 	ActiveTimeout DateTimeNanoseconds
 	// IdleTimeout is the idle timeout in nanoseconds
 	IdleTimeout DateTimeNanoseconds
+	// TimeoutProfiles holds alternative timeouts for flows chosen by SelectTimeouts
+	TimeoutProfiles []TimeoutProfile
+	// SelectTimeouts chooses the timeout profile of new flows (nil means ActiveTimeout and IdleTimeout for every flow)
+	SelectTimeouts TimeoutSelector
 	// WindowExpiry specifies if all packets should be expired after a window ended
 	WindowExpiry bool
 	// PerPacket specifies single flow per packet
 	PerPacket bool
 	// TCPExpiry specifies if tcp expiry is wanted (only works if the key contains at least the five tuple)
 	TCPExpiry bool
+	// TCPTimeouts holds the timeouts for the connection states used by tcp expiry
+	TCPTimeouts TCPTimeouts
 	// SortOutput specifies how the output should be sorted
 	SortOutput SortType
+	// MaxFlows is the maximum number of concurrent flows per table (0 means unlimited)
+	MaxFlows int
+	// Eviction specifies which flow gets exported with FlowEndReasonLackOfResources if MaxFlows is reached
+	Eviction EvictionPolicy
+	// Sampling describes the packet selection done by the filters; features describing the sampling or scaling up
+	// counts use this value
+	Sampling Sampling
 	// CustomSettings contains a map with all the settings read from the flow specification
 	CustomSettings map[string]interface{}
 }
 
+// TCPTimeouts holds the timeouts for the states of a tcp connection. Handshake, Established, HalfClosed, and Closing
+// replace the idle timeout of the flow while the connection is in this state (0 keeps the idle timeout). TimeWait and
+// Reset are the time after both FINs were acknowledged or a RST was seen, until the flow gets exported with
+// FlowEndReasonEnd (0 exports the flow immediately).
+type TCPTimeouts struct {
+	Handshake   DateTimeNanoseconds
+	Established DateTimeNanoseconds
+	HalfClosed  DateTimeNanoseconds
+	Closing     DateTimeNanoseconds
+	TimeWait    DateTimeNanoseconds
+	Reset       DateTimeNanoseconds
+}
+
 // BaseFlow holds the base information a flow needs. Needs to be embedded into every flow. The actual features are help in one or more records.
 type BaseFlow struct {
 	key          string
 	table        *FlowTable
+	timeouts     *TimeoutProfile
 	timers       funcEntries
 	expireNext   DateTimeNanoseconds
 	records      Record
@@ -113,6 +148,9 @@ func (flow *BaseFlow) Key() string { return flow.key }
 // Table returns the flow table belonging to this flow.
 func (flow *BaseFlow) Table() *FlowTable { return flow.table }
 
+// Timeouts returns the timeout profile used for this flow.
+func (flow *BaseFlow) Timeouts() *TimeoutProfile { return flow.timeouts }
+
 func (flow *BaseFlow) expire(context *EventContext) {
 	if flow.expireNext == 0 {
 		return
@@ -164,6 +202,65 @@ func (flow *BaseFlow) activeEvent(expires, now DateTimeNanoseconds) {
 	flow.ExportWithoutContext(FlowEndReasonActive, expires, now)
 }
 
+type flowState struct {
+	ID      uint64
+	Forward bool
+	Profile string
+	Idle    DateTimeNanoseconds
+	Active  DateTimeNanoseconds
+}
+
+// checkpointable returns true if the flow has only idle and active timers and every record can be saved
+func (flow *BaseFlow) checkpointable() bool {
+	for id := range flow.timers {
+		if TimerID(id) != TimerIdle && TimerID(id) != TimerActive && flow.timers.hasTimer(TimerID(id)) {
+			// callbacks of other timers can't be restored
+			return false
+		}
+	}
+	return flow.records.checkpointable()
+}
+
+// Snapshot writes the flow id, direction, timers, and the state of every feature to enc. Flows with additional state
+// must override this and call it first.
+func (flow *BaseFlow) Snapshot(enc *gob.Encoder) error {
+	state := flowState{
+		ID:      flow.id,
+		Forward: flow.firstForward,
+		Profile: flow.timeouts.Name,
+	}
+	if flow.timers.hasTimer(TimerIdle) {
+		state.Idle = flow.timers[TimerIdle].expires
+	}
+	if flow.timers.hasTimer(TimerActive) {
+		state.Active = flow.timers[TimerActive].expires
+	}
+	if err := enc.Encode(state); err != nil {
+		return err
+	}
+	return flow.records.snapshot(enc)
+}
+
+// Restore reads the state written by Snapshot from dec. The flow must have been initialized with Init before.
+func (flow *BaseFlow) Restore(dec *gob.Decoder) error {
+	var state flowState
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+	flow.id = state.ID
+	flow.firstForward = state.Forward
+	flow.timeouts = flow.table.namedTimeoutProfile(state.Profile)
+	flow.timers = makeFuncEntries()
+	flow.expireNext = 0
+	if state.Idle != 0 {
+		flow.AddTimer(TimerIdle, flow.idleEvent, state.Idle)
+	}
+	if state.Active != 0 {
+		flow.AddTimer(TimerActive, flow.activeEvent, state.Active)
+	}
+	return flow.records.restore(dec, flow.table, 0)
+}
+
 // EOF stops the flow with forced end reason.
 func (flow *BaseFlow) EOF(context *EventContext) {
 	flow.Export(FlowEndReasonForcedEnd, context, context.when)
@@ -172,9 +269,10 @@ func (flow *BaseFlow) EOF(context *EventContext) {
 // Event handles the given event and the active and idle timers.
 func (flow *BaseFlow) Event(event Event, context *EventContext) {
 	context.initFlow(flow)
-	if flow.table.IdleTimeout != 0 {
-		flow.AddTimer(TimerIdle, flow.idleEvent, context.when+flow.table.IdleTimeout)
+	if flow.timeouts.IdleTimeout != 0 {
+		flow.AddTimer(TimerIdle, flow.idleEvent, context.when+flow.timeouts.IdleTimeout)
 	}
+	context.started = false
 	flow.records.Event(event, context, flow.table, 0)
 	if !flow.records.Active() {
 		flow.Stop()
@@ -191,10 +289,15 @@ func (flow *BaseFlow) ID() uint64 {
 }
 
 // Init initializes the flow and correspoding features. The associated table, key, and current time need to be provided.
+// The timeouts are taken from the profile selected by the table for the current event.
 func (flow *BaseFlow) Init(table *FlowTable, key string, forward bool, context *EventContext, id uint64) {
 	flow.key = key
 	flow.table = table
-	if flow.table.ActiveTimeout+flow.table.IdleTimeout != 0 {
+	flow.timeouts = context.timeouts
+	if flow.timeouts == nil {
+		flow.timeouts = &table.defaultTimeouts
+	}
+	if flow.timeouts.ActiveTimeout+flow.timeouts.IdleTimeout != 0 {
 		flow.timers = makeFuncEntries()
 	}
 	flow.active = true
@@ -202,7 +305,7 @@ func (flow *BaseFlow) Init(table *FlowTable, key string, forward bool, context *
 	flow.records = table.records.make()
 	flow.id = id
 	context.initFlow(flow)
-	if flow.table.ActiveTimeout != 0 {
-		flow.AddTimer(TimerActive, flow.activeEvent, context.when+flow.table.ActiveTimeout)
+	if flow.timeouts.ActiveTimeout != 0 {
+		flow.AddTimer(TimerActive, flow.activeEvent, context.when+flow.timeouts.ActiveTimeout)
 	}
 }
@@ -1,6 +1,7 @@
 package flows
 
 import (
+	"encoding/gob"
 	"fmt"
 	"io"
 	"log"
@@ -18,6 +19,12 @@ type Record interface {
 	Export(FlowEndReason, *EventContext, DateTimeNanoseconds, *FlowTable, int)
 	// Returns true if this record is still active
 	Active() bool
+	// checkpointable returns true if every feature can be saved in a checkpoint
+	checkpointable() bool
+	// snapshot writes the state of the features to enc
+	snapshot(*gob.Encoder) error
+	// restore reads the state written by snapshot from dec
+	restore(*gob.Decoder, *FlowTable, int) error
 }
 
 type control struct {
@@ -45,6 +52,7 @@ func (r *record) Destroy() {
 func (r *record) start(data Event, context *EventContext, table *FlowTable, recordID int) {
 	r.active = true
 	context.record = r
+	context.started = true
 	for _, feature := range r.features {
 		feature.Start(context)
 	}
@@ -166,6 +174,7 @@ func (r *record) Export(reason FlowEndReason, context *EventContext, now DateTim
 		return
 	}
 	context.record = r
+	context.stop = false // context might be shared between records or flows (e.g. EOF)
 	r.stop(reason, context, recordID)
 	if context.stop {
 		r.alive = false
@@ -204,6 +213,69 @@ func (r *record) Active() bool {
 	return r.active || r.alive
 }
 
+func (r *record) checkpointable() bool {
+	for _, list := range [][]Feature{r.features, r.filter} {
+		for _, feature := range list {
+			if feature.IsConstant() {
+				continue
+			}
+			if _, ok := feature.(Snapshotter); !ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (r *record) snapshot(enc *gob.Encoder) error {
+	if err := enc.Encode([2]bool{r.active, r.alive}); err != nil {
+		return err
+	}
+	for _, list := range [][]Feature{r.features, r.filter} {
+		for _, feature := range list {
+			if feature.IsConstant() {
+				continue
+			}
+			if err := feature.(Snapshotter).Snapshot(enc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *record) restore(dec *gob.Decoder, table *FlowTable, recordID int) error {
+	var state [2]bool
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+	r.active, r.alive = state[0], state[1]
+	for _, list := range [][]Feature{r.features, r.filter} {
+		for _, feature := range list {
+			if feature.IsConstant() {
+				continue
+			}
+			s, ok := feature.(Snapshotter)
+			if !ok {
+				return fmt.Errorf("feature %T can't be restored", feature)
+			}
+			if err := s.Restore(dec); err != nil {
+				return err
+			}
+		}
+	}
+	if r.active && table.SortOutput != SortTypeNone {
+		// the original packet id is lost -> restored flows come first
+		r.export = &exportRecord{
+			exportKey: exportKey{
+				recordID: recordID,
+			},
+		}
+		table.pushExport(recordID, r.export)
+	}
+	return nil
+}
+
 type recordList []*record
 
 func (r recordList) Destroy() {
@@ -233,6 +305,33 @@ func (r recordList) Active() bool {
 	return false
 }
 
+func (r recordList) checkpointable() bool {
+	for _, record := range r {
+		if !record.checkpointable() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r recordList) snapshot(enc *gob.Encoder) error {
+	for _, record := range r {
+		if err := record.snapshot(enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r recordList) restore(dec *gob.Decoder, table *FlowTable, recordID int) error {
+	for i, record := range r {
+		if err := record.restore(dec, table, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // RecordListMaker holds metadata for instantiating a list of records with included features
 type RecordListMaker struct {
 	list      []RecordMaker
@@ -292,7 +391,7 @@ func (rm *RecordMaker) Init() {
 
 // AppendRecord creates a internal representation needed for instantiating records from a feature
 // specification, a list of exporters and a needed base (only FlowFeature supported so far)
-func (rl *RecordListMaker) AppendRecord(features []interface{}, control, filter []string, exporter *ExportPipeline, verbose bool) error {
+func (rl *RecordListMaker) AppendRecord(features []interface{}, control []interface{}, filter []string, exporter *ExportPipeline, verbose bool) error {
 	tree, err := makeAST(features, control, filter, exporter.exporter, RawPacket, FlowFeature) // only packets -> flows for now
 	if err != nil {
 		return err
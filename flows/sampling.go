@@ -0,0 +1,25 @@
+package flows
+
+// Selector algorithms from the IANA PSAMP registry (RFC 5477) supported by sampling filters
+const (
+	// SelectorSystematicCount selects every Nth packet
+	SelectorSystematicCount uint16 = 1
+	// SelectorUniformProbabilistic selects every packet with probability 1/N
+	SelectorUniformProbabilistic uint16 = 4
+	// SelectorHashBOB selects all the packets of 1/N of the flows with the BOB hash function
+	SelectorHashBOB uint16 = 6
+)
+
+// Sampling describes the packet selection done by sampling filters before flows are metered. The zero value means no
+// sampling.
+type Sampling struct {
+	// Algorithm is the selector algorithm (one of the Selector constants)
+	Algorithm uint16
+	// Rate is N of 1-in-N sampling
+	Rate uint32
+}
+
+// Sampled returns true, if packets are sampled
+func (s Sampling) Sampled() bool {
+	return s.Rate != 0
+}
@@ -13,25 +13,31 @@ type TableStats struct {
 	Flows uint64
 	// Maxflows is the maximum number of concurrent flows processed
 	Maxflows uint64
+	// Evicted is the number of flows exported due to lack of resources (see FlowOptions.MaxFlows)
+	Evicted uint64
 }
 
 // FlowTable holds flows assigned to flow keys and handles expiry, events, and flow creation.
 type FlowTable struct {
 	FlowOptions
-	flows     map[string]int
-	flowlist  []Flow
-	freelist  []int
-	newflow   FlowCreator
-	records   RecordListMaker
-	Stats     TableStats
-	context   *EventContext
-	flowID    uint64
-	window    uint64
-	exports   []*exportRecord
-	id        uint8
-	fivetuple bool
-	eof       bool
-	expiring  bool
+	defaultTimeouts TimeoutProfile
+	flows           map[string]int
+	flowlist        []Flow
+	freelist        []int
+	newflow         FlowCreator
+	records         RecordListMaker
+	Stats           TableStats
+	context         *EventContext
+	flowID          uint64
+	window          uint64
+	exports         []*exportRecord
+	eviction        *evictionList
+	timers          expiryHeap
+	due             []int
+	id              uint8
+	fivetuple       bool
+	eof             bool
+	expiring        bool
 }
 
 // NewFlowTable returns a new flow table utilizing features, the newflow function called for unknown flows, and the active and idle timeout.
@@ -43,6 +49,10 @@ func NewFlowTable(records RecordListMaker, newflow FlowCreator, options FlowOpti
 			exports[i] = makeExportHead()
 		}
 	}
+	var eviction *evictionList
+	if options.MaxFlows > 0 {
+		eviction = makeEvictionList(options.Eviction)
+	}
 	ret := &FlowTable{
 		flows:       make(map[string]int),
 		newflow:     newflow,
@@ -51,7 +61,13 @@ func NewFlowTable(records RecordListMaker, newflow FlowCreator, options FlowOpti
 		fivetuple:   fivetuple,
 		context:     &EventContext{},
 		exports:     exports,
+		eviction:    eviction,
 		id:          id,
+		defaultTimeouts: TimeoutProfile{
+			Name:          DefaultTimeoutProfile,
+			ActiveTimeout: options.ActiveTimeout,
+			IdleTimeout:   options.IdleTimeout,
+		},
 	}
 	return ret
 }
@@ -74,13 +90,25 @@ func (tab *FlowTable) Expire(when DateTimeNanoseconds) {
 	}
 	tab.context.when = when
 	tab.expiring = true
-	for _, elem := range tab.flowlist {
+	// only flows with due timers are touched; each of them at most once
+	tab.due = tab.due[:0]
+	for {
+		slot, next := tab.timers.next()
+		if slot == -1 || when <= next {
+			break
+		}
+		tab.timers.remove(slot)
+		tab.due = append(tab.due, slot)
+	}
+	for _, slot := range tab.due {
+		elem := tab.flowlist[slot]
 		if elem == nil {
 			continue
 		}
 		if when > elem.nextEvent() {
 			elem.expire(tab.context)
 		}
+		tab.schedule(slot, elem)
 	}
 	tab.expiring = false
 	if tab.SortOutput == SortTypeExpiryTime {
@@ -107,24 +135,35 @@ func (tab *FlowTable) Event(event Event) {
 		}
 	}
 
-	elem, ok := tab.flows[key]
+	slot, ok := tab.flows[key]
 	if ok {
-		elem := tab.flowlist[elem]
+		elem := tab.flowlist[slot]
 		if elem != nil {
 			if when > elem.nextEvent() {
 				elem.expire(tab.context)
 				ok = elem.Active()
 			}
 			if ok {
+				if tab.eviction != nil {
+					tab.eviction.touch(slot)
+				}
 				tab.context.forward = lowToHigh == elem.firstLowToHigh()
+				tab.context.renew = false
 				elem.Event(event, tab.context)
+				ok = !tab.context.renew
 			}
+			tab.schedule(slot, elem)
 		} else {
 			ok = false
 		}
 	}
 	if !ok {
+		if tab.eviction != nil {
+			tab.evict(when)
+		}
+		tab.context.timeouts = tab.timeoutProfile(event)
 		elem := tab.newflow(event, tab, key, lowToHigh, tab.context, tab.flowID)
+		tab.context.timeouts = nil
 		tab.flowID++
 		tab.Stats.Flows++
 		var new int
@@ -141,14 +180,47 @@ func (tab *FlowTable) Event(event Event) {
 		if nflows > tab.Stats.Maxflows {
 			tab.Stats.Maxflows = nflows
 		}
+		if tab.eviction != nil {
+			tab.eviction.add(new)
+			tab.eviction.touch(new)
+		}
 		tab.context.forward = true
 		elem.Event(event, tab.context)
+		tab.schedule(new, elem)
 	}
 	if tab.SortOutput == SortTypeStartTime || tab.SortOutput == SortTypeStopTime {
 		tab.flushExports()
 	}
 }
 
+// schedule updates the next timer event of the flow in slot after its timers might have changed
+func (tab *FlowTable) schedule(slot int, elem Flow) {
+	if tab.flowlist[slot] != elem {
+		// flow was removed
+		return
+	}
+	tab.timers.update(slot, elem.nextEvent())
+}
+
+// evict removes flows from the table until there is room for a new flow. Flows with pending timers get expired
+// first; the remaining ones are exported with FlowEndReasonLackOfResources.
+func (tab *FlowTable) evict(when DateTimeNanoseconds) {
+	for len(tab.flows) >= tab.MaxFlows {
+		slot := tab.eviction.victim()
+		if slot == -1 {
+			return
+		}
+		elem := tab.flowlist[slot]
+		if when > elem.nextEvent() {
+			elem.expire(tab.context)
+		}
+		if elem.Active() {
+			elem.ExportWithoutContext(FlowEndReasonLackOfResources, when, when)
+			tab.Stats.Evicted++
+		}
+	}
+}
+
 func (tab *FlowTable) flushExports() {
 	for i, exports := range tab.exports {
 		var head, tail *exportRecord
@@ -216,6 +288,10 @@ func (tab *FlowTable) remove(entry Flow) {
 		tab.flowlist[old] = nil
 		tab.freelist = append(tab.freelist, old)
 		delete(tab.flows, entry.Key())
+		tab.timers.remove(old)
+		if tab.eviction != nil {
+			tab.eviction.remove(old)
+		}
 	}
 }
 
@@ -236,9 +312,7 @@ func (tab *FlowTable) EOF(now DateTimeNanoseconds) {
 			v.EOF(context)
 		}
 	}
-	tab.flows = make(map[string]int)
-	tab.flowlist = nil
-	tab.freelist = nil
+	tab.clear()
 	tab.expiring = false
 	tab.eof = false
 
@@ -247,6 +321,17 @@ func (tab *FlowTable) EOF(now DateTimeNanoseconds) {
 	}
 }
 
+// clear removes all the flows from the table
+func (tab *FlowTable) clear() {
+	tab.flows = make(map[string]int)
+	tab.flowlist = nil
+	tab.freelist = nil
+	tab.timers.reset()
+	if tab.eviction != nil {
+		tab.eviction.reset()
+	}
+}
+
 // expireWindow expires all flows in the table due to end of the window. All outstanding timers get expired, and the rest of the flows terminated with a flowReaonEnd event.
 func (tab *FlowTable) expireWindow() {
 	tab.eof = true
@@ -272,6 +357,10 @@ func (tab *FlowTable) expireWindow() {
 	}
 	tab.flowlist = tab.flowlist[:0]
 	tab.freelist = tab.freelist[:0]
+	tab.timers.reset()
+	if tab.eviction != nil {
+		tab.eviction.reset()
+	}
 	tab.eof = false
 	tab.expiring = false
 	if tab.SortOutput == SortTypeExpiryTime {
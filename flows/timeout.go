@@ -0,0 +1,39 @@
+package flows
+
+// DefaultTimeoutProfile is the name of the profile built from FlowOptions.ActiveTimeout and FlowOptions.IdleTimeout
+const DefaultTimeoutProfile = "default"
+
+// TimeoutProfile holds the timeouts used for a group of flows (e.g., short timeouts for dns)
+type TimeoutProfile struct {
+	// Name identifies the profile (see the _timeoutProfile feature)
+	Name string
+	// ActiveTimeout is the active timeout in nanoseconds
+	ActiveTimeout DateTimeNanoseconds
+	// IdleTimeout is the idle timeout in nanoseconds
+	IdleTimeout DateTimeNanoseconds
+}
+
+// TimeoutSelector is responsible for selecting the timeout profile of new flows. Supplied value is the event, which
+// starts the flow. Must return an index into FlowOptions.TimeoutProfiles, or -1 for the default timeouts.
+type TimeoutSelector func(Event) int
+
+// timeoutProfile returns the timeout profile for a new flow started by event
+func (tab *FlowTable) timeoutProfile(event Event) *TimeoutProfile {
+	if tab.SelectTimeouts == nil {
+		return &tab.defaultTimeouts
+	}
+	if i := tab.SelectTimeouts(event); i >= 0 {
+		return &tab.TimeoutProfiles[i]
+	}
+	return &tab.defaultTimeouts
+}
+
+// namedTimeoutProfile returns the timeout profile with the given name, or the default timeouts if there is none
+func (tab *FlowTable) namedTimeoutProfile(name string) *TimeoutProfile {
+	for i := range tab.TimeoutProfiles {
+		if tab.TimeoutProfiles[i].Name == name {
+			return &tab.TimeoutProfiles[i]
+		}
+	}
+	return &tab.defaultTimeouts
+}
@@ -5,4 +5,6 @@ go 1.12
 require (
 	github.com/CN-TU/go-ipfix v0.0.0-20190607191022-b148a3a1167d
 	github.com/google/gopacket v1.1.17
+	github.com/klauspost/compress v1.15.14
+	github.com/ulikunitz/xz v0.5.10
 )
@@ -5,7 +5,6 @@ import (
 	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
 	"net"
 	"os"
@@ -27,8 +26,9 @@ const writeBufferSize = 64 * 1024
 type csvExporter struct {
 	id      string
 	outfile string
-	f       io.WriteCloser
+	out     *util.Output
 	writer  *bufio.Writer
+	fields  []string
 	flush   bool
 }
 
@@ -89,7 +89,12 @@ func (pe *csvExporter) writeString(field string) {
 }
 
 func (pe *csvExporter) Fields(fields []string) {
-	for i, field := range fields {
+	pe.fields = fields
+	pe.writeHeader()
+}
+
+func (pe *csvExporter) writeHeader() {
+	for i, field := range pe.fields {
 		if i > 0 {
 			err := pe.writer.WriteByte(',')
 			if err != nil {
@@ -107,11 +112,25 @@ func (pe *csvExporter) Fields(fields []string) {
 		if err != nil {
 			panic(err)
 		}
+		err = pe.out.Flush()
+		if err != nil {
+			panic(err)
+		}
 	}
 }
 
 //Export export given features
 func (pe *csvExporter) Export(template flows.Template, features []interface{}, when flows.DateTimeNanoseconds) {
+	if pe.out.Due(int64(when), pe.writer.Buffered()) {
+		// every file gets the header
+		if err := pe.writer.Flush(); err != nil {
+			panic(err)
+		}
+		if err := pe.out.Rotate(); err != nil {
+			panic(err)
+		}
+		pe.writeHeader()
+	}
 	ies := template.InformationElements()[:len(features)]
 	for i, elem := range features {
 		var err error
@@ -226,14 +245,18 @@ func (pe *csvExporter) Export(template flows.Template, features []interface{}, w
 		if err != nil {
 			panic(err)
 		}
+		err = pe.out.Flush()
+		if err != nil {
+			panic(err)
+		}
 	}
 }
 
 //Finish Write outstanding data and wait for completion
 func (pe *csvExporter) Finish() {
 	pe.writer.Flush()
-	if pe.f != os.Stdout {
-		pe.f.Close()
+	if err := pe.out.Close(); err != nil {
+		log.Println("Couldn't close file ", pe.outfile, err)
 	}
 }
 
@@ -242,16 +265,7 @@ func (pe *csvExporter) ID() string {
 }
 
 func (pe *csvExporter) Init() {
-	if pe.outfile == "-" {
-		pe.f = os.Stdout
-	} else {
-		var err error
-		pe.f, err = os.Create(pe.outfile)
-		if err != nil {
-			log.Fatal("Couldn't open file ", pe.outfile, err)
-		}
-	}
-	pe.writer = bufio.NewWriterSize(pe.f, writeBufferSize)
+	pe.writer = bufio.NewWriterSize(pe.out, writeBufferSize)
 }
 
 func newCSVExporter(args []string) (arguments []string, ret util.Module, err error) {
@@ -259,6 +273,7 @@ func newCSVExporter(args []string) (arguments []string, ret util.Module, err err
 	set.Usage = func() { csvhelp("csv") }
 
 	flush := set.Bool("flush", false, "Flush after each line")
+	options := util.AddOutputFlags(set)
 
 	set.Parse(args)
 
@@ -270,7 +285,12 @@ func newCSVExporter(args []string) (arguments []string, ret util.Module, err err
 	outfile := arguments[0]
 	arguments = arguments[1:]
 
-	ret = &csvExporter{id: "CSV|" + outfile, outfile: outfile, flush: *flush}
+	out, err := util.NewOutput(outfile, *options)
+	if err != nil {
+		return nil, nil, fmt.Errorf("CSV exporter: %s", err)
+	}
+
+	ret = &csvExporter{id: "CSV|" + outfile, outfile: outfile, out: out, flush: *flush}
 	return
 }
 
@@ -279,15 +299,16 @@ func csvhelp(name string) {
 The %s exporter writes the output to a csv file with a flow per line and a
 header consisting of the feature description.
 
-As argument, the output file is needed.
+As argument, the output file is needed. Output files can be rotated and
+compressed; every file starts with the header.
 
 Usage:
-  export %s file.csv
+  export %s [-flush] [rotation flags] file.csv
 
 Flags:
 -flush
 	  Flush after each line (default off).
-`, name, name)
+%s`, name, name, util.OutputHelp)
 }
 
 func init() {
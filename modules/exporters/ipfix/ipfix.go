@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/CN-TU/go-flows/flows"
 	"github.com/CN-TU/go-flows/util"
@@ -18,45 +19,127 @@ const pen uint32 = 1234
 const tmpBase uint16 = 0x7000
 
 type ipfixExporter struct {
-	id        string
-	outfile   string
-	specfile  string
-	out       io.WriteCloser
-	spec      io.WriteCloser
-	writer    *ipfix.MessageStream
-	allocated map[string]ipfix.InformationElement
-	templates []int
-	now       flows.DateTimeNanoseconds
+	id          string
+	outfile     string
+	specfile    string
+	domain      uint32
+	sequence    uint32
+	mtu         int
+	refresh     time.Duration
+	retries     int
+	output      util.OutputOptions
+	out         *messageWriter
+	spec        io.WriteCloser
+	writer      *ipfix.MessageStream
+	allocated   map[string]ipfix.InformationElement
+	templates   []int
+	variants    []map[string]int
+	mask        []byte
+	values      []interface{}
+	records     uint32
+	lastRefresh time.Time
+	now         flows.DateTimeNanoseconds
 }
 
 func (pe *ipfixExporter) Fields([]string) {}
 
 //Export export given features
 func (pe *ipfixExporter) Export(template flows.Template, features []interface{}, when flows.DateTimeNanoseconds) {
+	if pe.out.file != nil && pe.out.file.Due(int64(when), 0) {
+		// every file must contain the templates
+		pe.writer.Flush(when)
+		if err := pe.out.file.Rotate(); err != nil {
+			log.Panic(err)
+		}
+		if err := pe.out.sendTemplates(pe.records, uint32(when/flows.SecondsInNanoseconds)); err != nil {
+			log.Panic(err)
+		}
+	}
 	id := template.ID()
 	if id >= len(pe.templates) {
 		pe.templates = append(pe.templates, make([]int, id-len(pe.templates)+1)...)
+		pe.variants = append(pe.variants, make([]map[string]int, id-len(pe.variants)+1)...)
 	}
-	templateID := pe.templates[id]
-	if templateID == 0 {
-		var err error
-		templateID, err = pe.writer.AddTemplate(when, pe.AllocateIE(template.InformationElements())...)
-		if err != nil {
-			log.Panic(err)
+	missing := pe.nilMask(features)
+	if missing == 0 {
+		templateID := pe.templates[id]
+		if templateID == 0 {
+			templateID = pe.addTemplate(when, pe.AllocateIE(template.InformationElements()))
+			pe.templates[id] = templateID
+		}
+		pe.send(when, templateID, features)
+		return
+	}
+	if missing == len(features) {
+		return
+	}
+	// nil values are left out -> use a template with only the present fields
+	variants := pe.variants[id]
+	if variants == nil {
+		variants = make(map[string]int)
+		pe.variants[id] = variants
+	}
+	templateID, ok := variants[string(pe.mask)]
+	if !ok {
+		all := pe.AllocateIE(template.InformationElements())
+		ies := make([]ipfix.InformationElement, 0, len(all)-missing)
+		for i, ie := range all {
+			if i >= len(features) || features[i] != nil {
+				ies = append(ies, ie)
+			}
+		}
+		templateID = pe.addTemplate(when, ies)
+		variants[string(pe.mask)] = templateID
+	}
+	pe.values = pe.values[:0]
+	for _, feature := range features {
+		if feature != nil {
+			pe.values = append(pe.values, feature)
 		}
-		pe.templates[id] = templateID
 	}
-	//TODO make templates for nil features
-	pe.writer.SendData(when, templateID, features...)
+	pe.send(when, templateID, pe.values)
+}
+
+// nilMask marks every nil value of features in pe.mask and returns the number of nil values
+func (pe *ipfixExporter) nilMask(features []interface{}) (missing int) {
+	pe.mask = pe.mask[:0]
+	for i, feature := range features {
+		if i%8 == 0 {
+			pe.mask = append(pe.mask, 0)
+		}
+		if feature == nil {
+			pe.mask[i/8] |= 1 << uint(i%8)
+			missing++
+		}
+	}
+	return
+}
+
+func (pe *ipfixExporter) addTemplate(when flows.DateTimeNanoseconds, ies []ipfix.InformationElement) int {
+	templateID, err := pe.writer.AddTemplate(when, ies...)
+	if err != nil {
+		log.Panic(err)
+	}
+	pe.out.templates = append(pe.out.templates, ies)
+	return templateID
+}
+
+func (pe *ipfixExporter) send(when flows.DateTimeNanoseconds, templateID int, features []interface{}) {
+	if pe.writer.SendData(when, templateID, features...) == nil {
+		pe.records++
+	}
 	pe.now = when
+	if pe.refresh > 0 && time.Since(pe.lastRefresh) >= pe.refresh {
+		pe.writer.Flush(when)
+		pe.out.sendTemplates(pe.records, uint32(when/flows.SecondsInNanoseconds))
+		pe.lastRefresh = time.Now()
+	}
 }
 
 //Finish Write outstanding data and wait for completion
 func (pe *ipfixExporter) Finish() {
 	pe.writer.Flush(pe.now)
-	if pe.out != os.Stdout {
-		pe.out.Close()
-	}
+	pe.out.Close()
 	if pe.spec != nil {
 		pe.writeSpec(pe.spec)
 		if pe.spec != os.Stdout {
@@ -110,14 +193,15 @@ func (pe *ipfixExporter) AllocateIE(ies []ipfix.InformationElement) []ipfix.Info
 func (pe *ipfixExporter) Init() {
 	pe.allocated = make(map[string]ipfix.InformationElement)
 	var err error
-	if pe.outfile == "-" {
-		pe.out = os.Stdout
-	} else {
-		pe.out, err = os.Create(pe.outfile)
-		if err != nil {
-			log.Fatal("Couldn't open file ", pe.outfile, err)
-		}
+	pe.out, err = newMessageWriter(pe.outfile, pe.output)
+	if err != nil {
+		log.Fatal("Couldn't open file ", pe.outfile, err)
 	}
+	pe.out.sequence = pe.sequence
+	pe.out.domain = pe.domain
+	pe.out.mtu = pe.mtu
+	pe.out.retries = pe.retries
+	pe.lastRefresh = time.Now()
 	if pe.specfile == "-" {
 		pe.spec = os.Stdout
 	} else if pe.specfile != "" {
@@ -126,28 +210,69 @@ func (pe *ipfixExporter) Init() {
 			log.Fatal("Couldn't open file ", pe.specfile, err)
 		}
 	}
-	pe.writer, err = ipfix.MakeMessageStream(pe.out, 65535, 0)
+	pe.writer, err = ipfix.MakeMessageStream(pe.out, uint16(pe.mtu), pe.domain)
 	if err != nil {
 		log.Fatal("Couldn't create ipfix message stream: ", err)
 	}
 	pe.templates = make([]int, 1)
+	pe.variants = make([]map[string]int, 1)
 }
 
 func newIPFIXExporter(args []string) (arguments []string, ret util.Module, err error) {
 	set := flag.NewFlagSet("ipfix", flag.ExitOnError)
 	set.Usage = func() { ipfixhelp("ipfix") }
 	flowSpec := set.String("spec", "", "Flowspec file")
+	domain := set.Uint("domain", 0, "Observation domain id")
+	sequence := set.Uint("sequence", 0, "Initial sequence number")
+	mtu := set.Uint("mtu", 0, "Maximum message size (default 1400 for udp, 65535 otherwise)")
+	refresh := set.Uint("refresh", 60, "Template retransmission interval in seconds for udp (0 disables retransmission)")
+	retries := set.Int("retries", 10, "Number of reconnection attempts for tcp (0 retries forever)")
+	output := util.AddOutputFlags(set)
 
 	set.Parse(args)
 	if set.NArg() < 1 {
-		return nil, nil, errors.New("IPFIX exporter needs a filename as argument")
+		return nil, nil, errors.New("IPFIX exporter needs a filename or collector as argument")
 	}
 	outfile := set.Args()[0]
 	specfile := *flowSpec
 	arguments = set.Args()[1:]
 
+	if *mtu > 65535 {
+		return nil, nil, errors.New("IPFIX mtu must be at most 65535")
+	}
+	if *mtu != 0 && *mtu < 28 {
+		return nil, nil, errors.New("IPFIX mtu must be at least 28")
+	}
+	network, _ := splitDestination(outfile)
+	if *mtu == 0 {
+		if network == "udp" {
+			*mtu = defaultUDPMTU
+		} else {
+			*mtu = 65535
+		}
+	}
+	if network != "udp" {
+		*refresh = 0
+	}
+	if network == "" {
+		// check the output options now; the file is created with the first message
+		if _, err := util.NewOutput(outfile, *output); err != nil {
+			return nil, nil, fmt.Errorf("IPFIX exporter: %s", err)
+		}
+	}
+
 	ipfix.LoadIANASpec()
-	ret = &ipfixExporter{id: "IPFIX|" + outfile, outfile: outfile, specfile: specfile}
+	ret = &ipfixExporter{
+		id:       "IPFIX|" + outfile,
+		outfile:  outfile,
+		specfile: specfile,
+		domain:   uint32(*domain),
+		sequence: uint32(*sequence),
+		mtu:      int(*mtu),
+		refresh:  time.Duration(*refresh) * time.Second,
+		retries:  *retries,
+		output:   *output,
+	}
 	return
 }
 
@@ -156,17 +281,39 @@ func ipfixhelp(name string) {
 The %s exporter writes the output to a ipfix file with a flow per line and a
 header consisting of the feature description.
 
-As argument, the output file is needed.
+As argument, the output file is needed. Instead of a file, flows can be sent to
+a collector with udp://host:port or tcp://host:port. For udp, messages are
+limited to the mtu and templates are retransmitted periodically. For tcp, the
+connection is reestablished if it fails and all templates are sent again.
+
+Features with nil values (e.g. ports of icmp flows) are left out of a record.
+Such records use a template containing only the present features.
 
 Usage:
-  export %s [-spec file.iespec] file.ipfix
+  export %s [-spec file.iespec] [-domain id] [-sequence n] [-mtu n] [-refresh s] [-retries n] [rotation flags] file.ipfix|udp://host:port|tcp://host:port
 
 Flags:
   -spec string
     	Write iespec of temporary ies to file
-`, name, name)
+  -domain uint
+    	Observation domain id (default 0)
+  -sequence uint
+    	Initial sequence number (default 0)
+  -mtu uint
+    	Maximum message size (default 1400 for udp, 65535 otherwise)
+  -refresh uint
+    	Template retransmission interval in seconds for udp; 0 disables
+    	retransmission (default 60)
+  -retries int
+    	Number of reconnection attempts for tcp with a delay of one second;
+    	0 retries forever (default 10)
+
+Output files can be rotated and compressed with the following flags. Every
+file starts with all templates.
+
+%s`, name, name, util.OutputHelp)
 }
 
 func init() {
-	flows.RegisterExporter("ipfix", "Exports flows to a ipfix file.", newIPFIXExporter, ipfixhelp)
+	flows.RegisterExporter("ipfix", "Exports flows to a ipfix file or collector.", newIPFIXExporter, ipfixhelp)
 }
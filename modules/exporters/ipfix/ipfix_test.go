@@ -0,0 +1,275 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/util"
+	"github.com/CN-TU/go-ipfix"
+)
+
+type testTemplate struct {
+	flows.Template
+}
+
+func (t testTemplate) ID() int { return 0 }
+func (t testTemplate) InformationElements() []ipfix.InformationElement {
+	octets, err := ipfix.GetInformationElement("octetDeltaCount")
+	if err != nil {
+		panic(err)
+	}
+	return []ipfix.InformationElement{octets, {Name: "_test", Type: ipfix.Unsigned32Type, Length: 4}}
+}
+
+const recordLength = 12
+
+type received struct {
+	templates int
+	records   int
+}
+
+// check verifies the message headers and counts template and data records
+func check(t *testing.T, msgs [][]byte, domain, sequence uint32, mtu int) (ret received) {
+	for i, msg := range msgs {
+		if len(msg) > mtu {
+			t.Errorf("message %d has %d bytes; mtu is %d", i, len(msg), mtu)
+		}
+		if v := binary.BigEndian.Uint16(msg[0:2]); v != 10 {
+			t.Fatalf("message %d has version %d", i, v)
+		}
+		if l := int(binary.BigEndian.Uint16(msg[2:4])); l != len(msg) {
+			t.Fatalf("message %d has length %d; expected %d", i, l, len(msg))
+		}
+		if s := binary.BigEndian.Uint32(msg[8:12]); s != sequence+uint32(ret.records) {
+			t.Errorf("message %d has sequence number %d; expected %d", i, s, sequence+uint32(ret.records))
+		}
+		if d := binary.BigEndian.Uint32(msg[12:16]); d != domain {
+			t.Errorf("message %d has observation domain %d; expected %d", i, d, domain)
+		}
+		for set := msg[16:]; len(set) > 0; {
+			id := binary.BigEndian.Uint16(set[0:2])
+			length := int(binary.BigEndian.Uint16(set[2:4]))
+			switch {
+			case id == templateSetID:
+				if tid := binary.BigEndian.Uint16(set[4:6]); tid != 256 {
+					t.Errorf("message %d contains template %d; expected 256", i, tid)
+				}
+				ret.templates++
+			case id == 256:
+				ret.records += (length - 4) / recordLength
+			default:
+				t.Fatalf("message %d contains unexpected set %d", i, id)
+			}
+			set = set[length:]
+		}
+	}
+	return
+}
+
+func newTestExporter(t *testing.T, dest string) *ipfixExporter {
+	_, module, err := newIPFIXExporter([]string{"-domain", "7", "-sequence", "100", "-mtu", "100", dest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe := module.(*ipfixExporter)
+	pe.Init()
+	return pe
+}
+
+func TestIPFIXUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	pe := newTestExporter(t, "udp://"+conn.LocalAddr().String())
+	for i := 0; i < 20; i++ {
+		if i == 10 {
+			// force template retransmission
+			pe.lastRefresh = time.Time{}
+		}
+		pe.Export(testTemplate{}, []interface{}{uint64(i), uint32(i)}, flows.DateTimeNanoseconds(i)*flows.SecondsInNanoseconds)
+	}
+	pe.Finish()
+
+	var msgs [][]byte
+	buf := make([]byte, 65535)
+	for {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			break
+		}
+		msgs = append(msgs, append([]byte{}, buf[:n]...))
+	}
+	got := check(t, msgs, 7, 100, 100)
+	if got.records != 20 {
+		t.Errorf("received %d records; expected 20", got.records)
+	}
+	if got.templates != 2 {
+		t.Errorf("received %d templates; expected 2 (initial and retransmission)", got.templates)
+	}
+}
+
+func splitMessages(stream []byte) (ret [][]byte) {
+	for len(stream) >= headerLength {
+		length := int(binary.BigEndian.Uint16(stream[2:4]))
+		ret = append(ret, stream[:length])
+		stream = stream[length:]
+	}
+	return
+}
+
+func TestIPFIXTCPReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	streams := make(chan []byte, 2)
+	go func() {
+		// the first connection is closed by the collector after the first message
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		buf := make([]byte, 100)
+		n, _ := conn.Read(buf)
+		conn.Close()
+		streams <- buf[:n]
+
+		conn, err = ln.Accept()
+		if err != nil {
+			return
+		}
+		stream, _ := ioutil.ReadAll(conn)
+		streams <- stream
+	}()
+
+	pe := newTestExporter(t, "tcp://"+ln.Addr().String())
+	for i := 0; i < 10; i++ {
+		pe.Export(testTemplate{}, []interface{}{uint64(i), uint32(i)}, flows.DateTimeNanoseconds(i)*flows.SecondsInNanoseconds)
+	}
+	select {
+	case <-streams:
+	case <-time.After(5 * time.Second):
+		t.Fatal("collector didn't receive anything")
+	}
+	// keep exporting until the exporter notices the closed connection and reconnects
+	reconnected := false
+	for i := 0; i < 10000 && !reconnected; i++ {
+		conn := pe.out.conn
+		pe.Export(testTemplate{}, []interface{}{uint64(i), uint32(i)}, flows.DateTimeNanoseconds(i)*flows.SecondsInNanoseconds)
+		reconnected = conn != nil && pe.out.conn != nil && pe.out.conn != conn
+	}
+	if !reconnected {
+		t.Fatal("exporter didn't reconnect")
+	}
+	pe.Finish()
+
+	second := splitMessages(<-streams)
+	if len(second) == 0 {
+		t.Fatal("no messages after reconnect")
+	}
+	sequence := binary.BigEndian.Uint32(second[0][8:12])
+	got := check(t, second[:1], 7, sequence, 100)
+	if got.templates != 1 || got.records != 0 {
+		t.Errorf("first message after reconnect must only contain the template; got %d templates and %d records", got.templates, got.records)
+	}
+	got = check(t, second, 7, sequence, 100)
+	if got.records == 0 {
+		t.Error("no records after reconnect")
+	}
+}
+
+func TestIPFIXNilFeatures(t *testing.T) {
+	f, err := ioutil.TempFile("", "ipfix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	pe := newTestExporter(t, f.Name())
+	pe.Export(testTemplate{}, []interface{}{nil, uint32(1)}, 0)
+	pe.Export(testTemplate{}, []interface{}{uint64(2), uint32(2)}, 0)
+	pe.Export(testTemplate{}, []interface{}{nil, uint32(3)}, 0)
+	pe.Export(testTemplate{}, []interface{}{nil, nil}, 0)
+	pe.Finish()
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := make(map[uint16]int)
+	var sets []uint16
+	for _, msg := range splitMessages(data) {
+		for set := msg[headerLength:]; len(set) > 0; {
+			id := binary.BigEndian.Uint16(set[0:2])
+			length := int(binary.BigEndian.Uint16(set[2:4]))
+			if id == templateSetID {
+				fields[binary.BigEndian.Uint16(set[4:6])] = int(binary.BigEndian.Uint16(set[6:8]))
+			} else {
+				for records := (length - 4) / (4 + 8*(fields[id]-1)); records > 0; records-- {
+					sets = append(sets, id)
+				}
+			}
+			set = set[length:]
+		}
+	}
+	if len(fields) != 2 || fields[256] != 1 || fields[257] != 2 {
+		t.Errorf("got templates %v; expected a template without the nil feature (256) and the full template (257)", fields)
+	}
+	if len(sets) != 3 || sets[0] != 256 || sets[1] != 257 || sets[2] != 256 {
+		t.Errorf("got records with templates %v; expected [256 257 256]", sets)
+	}
+}
+
+func TestIPFIXRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ipfix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, module, err := newIPFIXExporter([]string{"-domain", "7", "-sequence", "100", "-rotateFlows", "4", "-compress", "gzip", filepath.Join(dir, "flows-%n.ipfix")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe := module.(*ipfixExporter)
+	pe.Init()
+	for i := 0; i < 10; i++ {
+		pe.Export(testTemplate{}, []interface{}{uint64(i), uint32(i)}, flows.DateTimeNanoseconds(i)*flows.SecondsInNanoseconds)
+	}
+	pe.Finish()
+
+	sequence := uint32(100)
+	for i, expected := range []int{4, 4, 2} {
+		f, err := util.OpenFile(filepath.Join(dir, fmt.Sprintf("flows-%d.ipfix.gz", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := check(t, splitMessages(data), 7, sequence, 65535)
+		if got.templates != 1 {
+			t.Errorf("file %d contains %d templates; expected 1", i, got.templates)
+		}
+		if got.records != expected {
+			t.Errorf("file %d contains %d records; expected %d", i, got.records, expected)
+		}
+		sequence += uint32(got.records)
+	}
+}
@@ -0,0 +1,205 @@
+package ipfix
+
+import (
+	"encoding/binary"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/CN-TU/go-flows/util"
+	"github.com/CN-TU/go-ipfix"
+)
+
+const (
+	defaultUDPMTU  = 1400
+	reconnectDelay = time.Second
+	headerLength   = 16
+	setHeader      = 4
+	templateHeader = 4
+	templateSetID  = 2
+)
+
+// splitDestination splits udp://host:port and tcp://host:port into network and address. Everything else is a filename.
+func splitDestination(dest string) (network, address string) {
+	for _, n := range []string{"udp", "tcp"} {
+		if strings.HasPrefix(dest, n+"://") {
+			return n, dest[len(n)+3:]
+		}
+	}
+	return "", dest
+}
+
+// messageWriter receives finished ipfix messages from the message stream (one message per Write call) and writes
+// them to a file or sends them to a collector. Write never fails for collectors, since the message stream can't
+// recover from write errors; tcp connections are reestablished instead and udp messages are dropped.
+type messageWriter struct {
+	file      *util.Output
+	network   string
+	address   string
+	conn      net.Conn
+	retries   int
+	sequence  uint32
+	mtu       int
+	domain    uint32
+	templates [][]ipfix.InformationElement
+	announced int
+	dropped   uint64
+	// header of the last sent message; used for announcing the templates after a reconnect
+	lastSequence uint32
+	lastExport   uint32
+}
+
+func newMessageWriter(dest string, options util.OutputOptions) (*messageWriter, error) {
+	mw := &messageWriter{}
+	mw.network, mw.address = splitDestination(dest)
+	if mw.network != "" {
+		return mw, nil
+	}
+	var err error
+	mw.file, err = util.NewOutput(dest, options)
+	return mw, err
+}
+
+// Write sends a message from the message stream
+func (mw *messageWriter) Write(msg []byte) (int, error) {
+	if mw.sequence != 0 && len(msg) >= headerLength {
+		binary.BigEndian.PutUint32(msg[8:12], binary.BigEndian.Uint32(msg[8:12])+mw.sequence)
+	}
+	if mw.file != nil {
+		return mw.file.Write(msg)
+	}
+	mw.send(msg)
+	// every template added until now was part of this or an earlier message
+	mw.announced = len(mw.templates)
+	return len(msg), nil
+}
+
+func (mw *messageWriter) connect() error {
+	conn, err := net.Dial(mw.network, mw.address)
+	if err != nil {
+		return err
+	}
+	if mw.network == "tcp" && mw.announced > 0 {
+		// a new tcp connection is a new transport session -> the collector needs all the templates again
+		for _, msg := range mw.templateMessages(mw.templates[:mw.announced], mw.lastSequence, mw.lastExport) {
+			if _, err := conn.Write(msg); err != nil {
+				conn.Close()
+				return err
+			}
+		}
+	}
+	mw.conn = conn
+	return nil
+}
+
+func (mw *messageWriter) send(msg []byte) {
+	if len(msg) >= headerLength {
+		mw.lastExport = binary.BigEndian.Uint32(msg[4:8])
+		mw.lastSequence = binary.BigEndian.Uint32(msg[8:12])
+	}
+	for attempt := 1; ; attempt++ {
+		if mw.conn == nil {
+			if err := mw.connect(); err != nil {
+				if mw.retries > 0 && attempt > mw.retries {
+					log.Fatalf("ipfix: couldn't connect to %s://%s: %s\n", mw.network, mw.address, err)
+				}
+				log.Printf("ipfix: couldn't connect to %s://%s (attempt %d): %s\n", mw.network, mw.address, attempt, err)
+				time.Sleep(reconnectDelay)
+				continue
+			}
+		}
+		_, err := mw.conn.Write(msg)
+		if err == nil {
+			return
+		}
+		if mw.network == "udp" {
+			if mw.dropped == 0 {
+				log.Printf("ipfix: couldn't send message to udp://%s: %s\n", mw.address, err)
+			}
+			mw.dropped++
+			return
+		}
+		log.Printf("ipfix: lost connection to tcp://%s: %s\n", mw.address, err)
+		mw.conn.Close()
+		mw.conn = nil
+	}
+}
+
+// sendTemplates sends every template again. The message stream must be flushed before.
+func (mw *messageWriter) sendTemplates(sequence uint32, exportTime uint32) error {
+	for _, msg := range mw.templateMessages(mw.templates, mw.sequence+sequence, exportTime) {
+		if mw.file != nil {
+			if _, err := mw.file.Write(msg); err != nil {
+				return err
+			}
+			continue
+		}
+		mw.send(msg)
+	}
+	mw.announced = len(mw.templates)
+	return nil
+}
+
+// templateMessages serializes the given templates (with ids starting at 256) into messages not larger than the mtu
+func (mw *messageWriter) templateMessages(templates [][]ipfix.InformationElement, sequence uint32, exportTime uint32) (ret [][]byte) {
+	var msg []byte
+	finish := func() {
+		if msg != nil {
+			binary.BigEndian.PutUint16(msg[2:4], uint16(len(msg)))
+			binary.BigEndian.PutUint16(msg[headerLength+2:headerLength+4], uint16(len(msg)-headerLength))
+			ret = append(ret, msg)
+			msg = nil
+		}
+	}
+	for i, template := range templates {
+		length := templateHeader
+		for _, ie := range template {
+			length += 4
+			if ie.Pen != 0 {
+				length += 4
+			}
+		}
+		if headerLength+setHeader+length > mw.mtu {
+			log.Printf("ipfix: template %d doesn't fit into mtu of %d bytes\n", i+256, mw.mtu)
+			continue
+		}
+		if msg != nil && len(msg)+length > mw.mtu {
+			finish()
+		}
+		if msg == nil {
+			msg = make([]byte, headerLength+setHeader, mw.mtu)
+			binary.BigEndian.PutUint16(msg[0:2], 10)
+			binary.BigEndian.PutUint32(msg[4:8], exportTime)
+			binary.BigEndian.PutUint32(msg[8:12], sequence)
+			binary.BigEndian.PutUint32(msg[12:16], mw.domain)
+			binary.BigEndian.PutUint16(msg[headerLength:headerLength+2], templateSetID)
+		}
+		msg = append(msg, byte((i+256)>>8), byte(i+256), byte(len(template)>>8), byte(len(template)))
+		for _, ie := range template {
+			if ie.Pen == 0 {
+				msg = append(msg, byte(ie.ID>>8), byte(ie.ID), byte(ie.Length>>8), byte(ie.Length))
+				continue
+			}
+			id := ie.ID | 0x8000
+			msg = append(msg, byte(id>>8), byte(id), byte(ie.Length>>8), byte(ie.Length),
+				byte(ie.Pen>>24), byte(ie.Pen>>16), byte(ie.Pen>>8), byte(ie.Pen))
+		}
+	}
+	finish()
+	return
+}
+
+// Close closes the file or the connection to the collector
+func (mw *messageWriter) Close() error {
+	if mw.dropped > 0 {
+		log.Printf("ipfix: dropped %d messages to udp://%s\n", mw.dropped, mw.address)
+	}
+	if mw.file != nil {
+		return mw.file.Close()
+	}
+	if mw.conn != nil {
+		return mw.conn.Close()
+	}
+	return nil
+}
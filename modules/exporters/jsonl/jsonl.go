@@ -0,0 +1,322 @@
+package jsonl
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"os"
+	"reflect"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/util"
+	ipfix "github.com/CN-TU/go-ipfix"
+)
+
+const writeBufferSize = 64 * 1024
+
+const hexDigits = "0123456789abcdef"
+
+type jsonlExporter struct {
+	id      string
+	outfile string
+	out     *util.Output
+	writer  *bufio.Writer
+	keys    [][]byte
+	scratch []byte
+	flush   bool
+	hex     bool
+	rfc3339 bool
+}
+
+func (pe *jsonlExporter) write(b []byte) {
+	if _, err := pe.writer.Write(b); err != nil {
+		panic(err)
+	}
+}
+
+// appendString appends s as json string; invalid utf-8 is replaced with U+FFFD
+func appendString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
+
+func (pe *jsonlExporter) Fields(fields []string) {
+	pe.keys = make([][]byte, len(fields))
+	for i, field := range fields {
+		key := appendString(nil, field)
+		pe.keys[i] = append(key, ':')
+	}
+}
+
+// appendTime appends a timestamp given in unit (nanoseconds per tick) according to the ie type or as RFC3339 string
+func (pe *jsonlExporter) appendTime(b []byte, val uint64, unit uint64, ie ipfix.InformationElement) []byte {
+	if pe.rfc3339 {
+		b = append(b, '"')
+		b = time.Unix(0, int64(val*unit)).UTC().AppendFormat(b, time.RFC3339Nano)
+		return append(b, '"')
+	}
+	switch ie.Type {
+	case ipfix.DateTimeNanosecondsType:
+		val = val * unit
+	case ipfix.DateTimeMicrosecondsType:
+		val = val * unit / 1e3
+	case ipfix.DateTimeMillisecondsType:
+		val = val * unit / 1e6
+	case ipfix.DateTimeSecondsType:
+		val = val * unit / 1e9
+	}
+	return strconv.AppendUint(b, val, 10)
+}
+
+func appendFloat(b []byte, val float64, bits int) []byte {
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return append(b, "null"...)
+	}
+	return strconv.AppendFloat(b, val, 'g', -1, bits)
+}
+
+// appendValue appends val as json value. ie is used for timestamps and for the elements of lists
+func (pe *jsonlExporter) appendValue(b []byte, val interface{}, ie ipfix.InformationElement) []byte {
+	switch val := val.(type) {
+	case nil:
+		return append(b, "null"...)
+	case bool:
+		return strconv.AppendBool(b, val)
+	case int:
+		return strconv.AppendInt(b, int64(val), 10)
+	case int8:
+		return strconv.AppendInt(b, int64(val), 10)
+	case int16:
+		return strconv.AppendInt(b, int64(val), 10)
+	case int32:
+		return strconv.AppendInt(b, int64(val), 10)
+	case int64:
+		return strconv.AppendInt(b, val, 10)
+	case uint:
+		return strconv.AppendUint(b, uint64(val), 10)
+	case uint8:
+		return strconv.AppendUint(b, uint64(val), 10)
+	case uint16:
+		return strconv.AppendUint(b, uint64(val), 10)
+	case uint32:
+		return strconv.AppendUint(b, uint64(val), 10)
+	case uint64:
+		return strconv.AppendUint(b, val, 10)
+	case float32:
+		return appendFloat(b, float64(val), 32)
+	case float64:
+		return appendFloat(b, val, 64)
+	case net.IP:
+		return appendString(b, val.String())
+	case net.HardwareAddr:
+		return appendString(b, val.String())
+	case flows.DateTimeNanoseconds:
+		return pe.appendTime(b, uint64(val), 1, ie)
+	case flows.DateTimeMicroseconds:
+		return pe.appendTime(b, uint64(val), 1e3, ie)
+	case flows.DateTimeMilliseconds:
+		return pe.appendTime(b, uint64(val), 1e6, ie)
+	case flows.DateTimeSeconds:
+		return pe.appendTime(b, uint64(val), 1e9, ie)
+	case flows.FlowEndReason:
+		return strconv.AppendUint(b, uint64(val), 10)
+	case string:
+		return appendString(b, val)
+	case []byte:
+		b = append(b, '"')
+		if pe.hex {
+			n := len(b)
+			b = append(b, make([]byte, hex.EncodedLen(len(val)))...)
+			hex.Encode(b[n:], val)
+		} else {
+			n := len(b)
+			b = append(b, make([]byte, base64.StdEncoding.EncodedLen(len(val)))...)
+			base64.StdEncoding.Encode(b[n:], val)
+		}
+		return append(b, '"')
+	case []interface{}:
+		sub, _ := ie.ListElement()
+		b = append(b, '[')
+		for i, elem := range val {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = pe.appendValue(b, elem, sub)
+		}
+		return append(b, ']')
+	}
+	if v := reflect.ValueOf(val); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		sub, _ := ie.ListElement()
+		b = append(b, '[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = pe.appendValue(b, v.Index(i).Interface(), sub)
+		}
+		return append(b, ']')
+	}
+	return appendString(b, fmt.Sprint(val))
+}
+
+// Export export given features
+func (pe *jsonlExporter) Export(template flows.Template, features []interface{}, when flows.DateTimeNanoseconds) {
+	if pe.out.Due(int64(when), pe.writer.Buffered()) {
+		if err := pe.writer.Flush(); err != nil {
+			panic(err)
+		}
+		if err := pe.out.Rotate(); err != nil {
+			panic(err)
+		}
+	}
+	ies := template.InformationElements()[:len(features)]
+	b := append(pe.scratch[:0], '{')
+	for i, elem := range features {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if i < len(pe.keys) {
+			b = append(b, pe.keys[i]...)
+		} else {
+			b = appendString(b, ies[i].Name)
+			b = append(b, ':')
+		}
+		b = pe.appendValue(b, elem, ies[i])
+	}
+	b = append(b, '}', '\n')
+	pe.write(b)
+	pe.scratch = b
+	if pe.flush {
+		if err := pe.writer.Flush(); err != nil {
+			panic(err)
+		}
+		if err := pe.out.Flush(); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Finish Write outstanding data and wait for completion
+func (pe *jsonlExporter) Finish() {
+	pe.writer.Flush()
+	if err := pe.out.Close(); err != nil {
+		log.Println("Couldn't close file ", pe.outfile, err)
+	}
+}
+
+func (pe *jsonlExporter) ID() string {
+	return pe.id
+}
+
+func (pe *jsonlExporter) Init() {
+	pe.writer = bufio.NewWriterSize(pe.out, writeBufferSize)
+}
+
+func newJSONLExporter(args []string) (arguments []string, ret util.Module, err error) {
+	set := flag.NewFlagSet("jsonl", flag.ExitOnError)
+	set.Usage = func() { jsonlhelp("jsonl") }
+
+	flush := set.Bool("flush", false, "Flush after each line")
+	bytes := set.String("bytes", "base64", "Encoding of octet arrays (base64 or hex)")
+	times := set.String("time", "ie", "Encoding of timestamps (ie or rfc3339)")
+	output := util.AddOutputFlags(set)
+
+	set.Parse(args)
+
+	arguments = set.Args()
+
+	if len(arguments) < 1 {
+		return nil, nil, errors.New("JSONL exporter needs a filename as argument")
+	}
+	if *bytes != "base64" && *bytes != "hex" {
+		return nil, nil, fmt.Errorf("JSONL exporter: unknown octet array encoding '%s'", *bytes)
+	}
+	if *times != "ie" && *times != "rfc3339" {
+		return nil, nil, fmt.Errorf("JSONL exporter: unknown timestamp encoding '%s'", *times)
+	}
+	outfile := arguments[0]
+	arguments = arguments[1:]
+	out, err := util.NewOutput(outfile, *output)
+	if err != nil {
+		return nil, nil, fmt.Errorf("JSONL exporter: %s", err)
+	}
+
+	ret = &jsonlExporter{id: "JSONL|" + outfile, outfile: outfile, out: out, flush: *flush, hex: *bytes == "hex", rfc3339: *times == "rfc3339"}
+	return
+}
+
+func jsonlhelp(name string) {
+	fmt.Fprintf(os.Stderr, `
+The %s exporter writes the output to a JSON Lines file with a flow per line.
+Every flow is a json object with the feature descriptions as keys.
+
+Lists are written as json arrays, ip and mac addresses as strings, and octet
+arrays as base64 or hex strings. Timestamps are numbers in the unit of the
+information element type (like in the csv exporter) or RFC3339 strings.
+Missing values are null.
+
+As argument, the output file is needed. Output files can be rotated and
+compressed.
+
+Usage:
+  export %s [-flush] [-bytes base64|hex] [-time ie|rfc3339] [rotation flags] file.jsonl
+
+Flags:
+-flush
+	  Flush after each line (default off).
+-bytes string
+	  Encoding of octet arrays: base64 or hex (default base64).
+-time string
+	  Encoding of timestamps: ie (number in the unit of the information
+	  element) or rfc3339 (string) (default ie).
+%s`, name, name, util.OutputHelp)
+}
+
+func init() {
+	flows.RegisterExporter("jsonl", "Exports flows to a JSON Lines file.", newJSONLExporter, jsonlhelp)
+}
@@ -0,0 +1,98 @@
+package jsonl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+	ipfix "github.com/CN-TU/go-ipfix"
+)
+
+type testTemplate struct {
+	flows.Template
+	ies []ipfix.InformationElement
+}
+
+func (t testTemplate) ID() int                                         { return 0 }
+func (t testTemplate) InformationElements() []ipfix.InformationElement { return t.ies }
+
+func export(t *testing.T, args []string, features ...interface{}) map[string]interface{} {
+	_, module, err := newJSONLExporter(append(args, "-"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	pe := module.(*jsonlExporter)
+	pe.writer = bufio.NewWriter(&buf)
+
+	millis := ipfix.InformationElement{Name: "flowStartMilliseconds", Type: ipfix.DateTimeMillisecondsType, Length: 8}
+	template := testTemplate{ies: []ipfix.InformationElement{
+		{Name: "sourceIPAddress", Type: ipfix.Ipv4AddressType, Length: 4},
+		{Name: "packetTotalCount", Type: ipfix.Unsigned64Type, Length: 8},
+		millis,
+		ipfix.NewBasicList("accumulate", millis, 0),
+		{Name: "payload", Type: ipfix.OctetArrayType, Length: ipfix.VariableLength},
+		{Name: "name", Type: ipfix.StringType, Length: ipfix.VariableLength},
+		{Name: "ratio", Type: ipfix.Float64Type, Length: 8},
+		{Name: "missing", Type: ipfix.Unsigned8Type, Length: 1},
+	}}
+	fields := make([]string, len(template.ies))
+	for i, ie := range template.ies {
+		fields[i] = ie.Name
+	}
+	pe.Fields(fields)
+	pe.Export(template, features, 0)
+	pe.writer.Flush()
+
+	if bytes.Count(buf.Bytes(), []byte{'\n'}) != 1 {
+		t.Fatalf("expected exactly one line; got %q", buf.String())
+	}
+	ret := make(map[string]interface{})
+	if err := json.Unmarshal(buf.Bytes(), &ret); err != nil {
+		t.Fatalf("invalid json %q: %s", buf.String(), err)
+	}
+	return ret
+}
+
+func TestJSONLExport(t *testing.T) {
+	start := flows.DateTimeNanoseconds(1500000000123456789)
+	features := []interface{}{
+		net.IP{10, 0, 0, 1},
+		uint64(3),
+		start,
+		[]interface{}{start, start + 1e9},
+		[]byte{0, 1, 0xff},
+		"a \"b\"\n\x01\xff",
+		float64(0.5),
+		nil,
+	}
+	got := export(t, nil, features...)
+	expected := map[string]interface{}{
+		"sourceIPAddress":       "10.0.0.1",
+		"packetTotalCount":      float64(3),
+		"flowStartMilliseconds": float64(1500000000123),
+		"accumulate":            []interface{}{float64(1500000000123), float64(1500000001123)},
+		"payload":               "AAH/",
+		"name":                  "a \"b\"\n\x01\ufffd",
+		"ratio":                 0.5,
+		"missing":               nil,
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v; expected %v", got, expected)
+	}
+
+	got = export(t, []string{"-bytes", "hex", "-time", "rfc3339"}, features...)
+	if got["payload"] != "0001ff" {
+		t.Errorf("got payload %v; expected hex", got["payload"])
+	}
+	if got["flowStartMilliseconds"] != "2017-07-14T02:40:00.123456789Z" {
+		t.Errorf("got time %v; expected RFC3339", got["flowStartMilliseconds"])
+	}
+	if list := got["accumulate"].([]interface{}); list[1] != "2017-07-14T02:40:01.123456789Z" {
+		t.Errorf("got list %v; expected RFC3339 times", list)
+	}
+}
@@ -18,10 +18,57 @@ type kafkaExporter struct {
 	id       string
 	kafka    string
 	topic    string
+	fields   []string
+	schemas  []map[string][]string
+	mask     []byte
 	producer sarama.AsyncProducer
 }
 
 func (pe *kafkaExporter) Fields(fields []string) {
+	pe.fields = fields
+}
+
+// schema returns the names of the present features, if features contains nil values. Schemas are cached per
+// template and set of present features.
+func (pe *kafkaExporter) schema(id int, ies []ipfix.InformationElement, features []interface{}) []string {
+	pe.mask = pe.mask[:0]
+	missing := false
+	for i, feature := range features {
+		if i%8 == 0 {
+			pe.mask = append(pe.mask, 0)
+		}
+		if feature == nil {
+			pe.mask[i/8] |= 1 << uint(i%8)
+			missing = true
+		}
+	}
+	if !missing {
+		return nil
+	}
+	if id >= len(pe.schemas) {
+		pe.schemas = append(pe.schemas, make([]map[string][]string, id-len(pe.schemas)+1)...)
+	}
+	schemas := pe.schemas[id]
+	if schemas == nil {
+		schemas = make(map[string][]string)
+		pe.schemas[id] = schemas
+	}
+	names, ok := schemas[string(pe.mask)]
+	if !ok {
+		names = make([]string, 0, len(features))
+		for i, feature := range features {
+			if feature == nil {
+				continue
+			}
+			if i < len(pe.fields) {
+				names = append(names, pe.fields[i])
+			} else {
+				names = append(names, ies[i].Name)
+			}
+		}
+		schemas[string(pe.mask)] = names
+	}
+	return names
 }
 
 //Export export given features
@@ -89,7 +136,19 @@ func (pe *kafkaExporter) Export(template flows.Template, features []interface{},
 			features[i] = val
 		}
 	}
-	out, err := bson.Marshal(bson.M{"ts": int(when), "features": features})
+	msg := bson.M{"ts": int(when), "features": features}
+	if names := pe.schema(template.ID(), ies, features); names != nil {
+		// leave out nil features and provide the names of the present ones
+		present := make([]interface{}, 0, len(names))
+		for _, feature := range features {
+			if feature != nil {
+				present = append(present, feature)
+			}
+		}
+		msg["features"] = present
+		msg["fields"] = names
+	}
+	out, err := bson.Marshal(msg)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -136,6 +195,9 @@ func kafkahelp(name string) {
 The %s exporter writes the output to a Kafka topic with a flow per message,
 in BSON format, with keys "features" and "ts", in which "features" are the requested
 features (in order), and "ts" the timestamp that the flow was exported.
+If some features of a flow are nil (e.g. ports of icmp flows), they are left
+out of "features" and the additional key "fields" contains the names of the
+present features (in order).
 
 As argument, the Kafka address (e.g., "localhost:9092"), and a topic name to
 which the producer will write are needed.
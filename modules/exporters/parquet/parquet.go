@@ -0,0 +1,161 @@
+package parquet
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/util"
+)
+
+type parquetExporter struct {
+	id       string
+	outfile  string
+	fields   []string
+	rows     int64
+	codec    int32
+	files    int
+	writers  map[int]*fileWriter // open file per template id
+}
+
+func (pe *parquetExporter) Fields(fields []string) {
+	pe.fields = fields
+}
+
+// filename returns the name of the n-th file; files after the first one get the number inserted before the extension
+func (pe *parquetExporter) filename(n int) string {
+	if n == 0 {
+		return pe.outfile
+	}
+	ext := filepath.Ext(pe.outfile)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(pe.outfile, ext), n, ext)
+}
+
+func (pe *parquetExporter) close() {
+	for id, writer := range pe.writers {
+		if err := writer.Close(); err != nil {
+			log.Fatal("Couldn't write parquet file: ", err)
+		}
+		delete(pe.writers, id)
+	}
+}
+
+// open starts a new file with the schema of the given template
+func (pe *parquetExporter) open(template flows.Template) *fileWriter {
+	ies := template.InformationElements()
+	columns := make([]*column, len(ies))
+	for i, ie := range ies {
+		name := ie.Name
+		if i < len(pe.fields) {
+			name = pe.fields[i]
+		}
+		columns[i] = makeColumn(name, ie)
+	}
+	name := pe.filename(pe.files)
+	f, err := os.Create(name)
+	if err != nil {
+		log.Fatal("Couldn't open file ", name, err)
+	}
+	writer, err := newFileWriter(f, columns, pe.codec)
+	if err != nil {
+		log.Fatal("Couldn't write parquet file ", name, err)
+	}
+	pe.files++
+	pe.writers[template.ID()] = writer
+	return writer
+}
+
+// Export export given features
+func (pe *parquetExporter) Export(template flows.Template, features []interface{}, when flows.DateTimeNanoseconds) {
+	writer, ok := pe.writers[template.ID()]
+	if !ok {
+		// the schema of a parquet file is fixed -> every template gets its own file
+		writer = pe.open(template)
+	}
+	writer.writeRow(features)
+	if writer.rows >= pe.rows {
+		if err := writer.flushRowGroup(); err != nil {
+			log.Fatal("Couldn't write parquet file: ", err)
+		}
+	}
+}
+
+// Finish Write outstanding data and wait for completion
+func (pe *parquetExporter) Finish() {
+	pe.close()
+}
+
+func (pe *parquetExporter) ID() string {
+	return pe.id
+}
+
+func (pe *parquetExporter) Init() {
+}
+
+func newParquetExporter(args []string) (arguments []string, ret util.Module, err error) {
+	set := flag.NewFlagSet("parquet", flag.ExitOnError)
+	set.Usage = func() { parquethelp("parquet") }
+
+	rows := set.Int64("rows", 100000, "Number of rows per row group")
+	codec := set.String("codec", "snappy", "Compression codec (none, snappy, gzip, zstd)")
+
+	set.Parse(args)
+
+	arguments = set.Args()
+
+	if len(arguments) < 1 {
+		return nil, nil, errors.New("Parquet exporter needs a filename as argument")
+	}
+	if *rows < 1 {
+		return nil, nil, errors.New("Parquet exporter needs at least one row per row group")
+	}
+	c, ok := codecs[*codec]
+	if !ok {
+		return nil, nil, fmt.Errorf("Parquet exporter: unknown compression codec '%s'", *codec)
+	}
+	outfile := arguments[0]
+	arguments = arguments[1:]
+
+	ret = &parquetExporter{id: "Parquet|" + outfile, outfile: outfile, rows: *rows, codec: c, writers: make(map[int]*fileWriter)}
+	return
+}
+
+func parquethelp(name string) {
+	fmt.Fprintf(os.Stderr, `
+The %s exporter writes the output to an Apache Parquet file with a column per
+feature. Column names are the feature descriptions.
+
+The column types are derived from the information element types: integers
+become INT32/INT64 with the matching integer logical type, timestamps become
+TIMESTAMP (milliseconds, microseconds, or nanoseconds), octet arrays become
+BYTE_ARRAY, and strings, addresses, and everything else become STRING. Lists
+(e.g. from accumulate) become repeated columns. Every column is optional, and
+missing values are null.
+
+Since a parquet file has a fixed schema, every template (e.g. from multiple
+feature specifications, select, or IPv4 and IPv6 variants of a feature) is
+written to its own file, which stays open until the end. The additional files
+are named like the output file with a number before the extension in the order
+the templates appear (flows.parquet, flows.1.parquet, flows.2.parquet, ...).
+
+As argument, the output file is needed.
+
+Usage:
+  export %s [-rows n] [-codec none|snappy|gzip|zstd] file.parquet
+
+Flags:
+-rows int
+	  Number of rows per row group (default 100000).
+-codec string
+	  Compression codec: none, snappy, gzip, or zstd (default snappy).
+`, name, name)
+}
+
+func init() {
+	flows.RegisterExporter("parquet", "Exports flows to a parquet file.", newParquetExporter, parquethelp)
+}
@@ -0,0 +1,390 @@
+package parquet
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+	ipfix "github.com/CN-TU/go-ipfix"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+type testTemplate struct {
+	flows.Template
+	id  int
+	ies []ipfix.InformationElement
+}
+
+func (t testTemplate) ID() int                                         { return t.id }
+func (t testTemplate) InformationElements() []ipfix.InformationElement { return t.ies }
+
+var (
+	start = ipfix.InformationElement{Name: "flowStartMilliseconds", Type: ipfix.DateTimeMillisecondsType, Length: 8}
+	ies   = []ipfix.InformationElement{
+		{Name: "sourceIPAddress", Type: ipfix.Ipv4AddressType, Length: 4},
+		{Name: "sourceTransportPort", Type: ipfix.Unsigned16Type, Length: 2},
+		{Name: "octetTotalCount", Type: ipfix.Unsigned64Type, Length: 8},
+		start,
+		ipfix.NewBasicList("accumulate", start, 0),
+		{Name: "payload", Type: ipfix.OctetArrayType, Length: ipfix.VariableLength},
+		{Name: "ratio", Type: ipfix.Float64Type, Length: 8},
+		{Name: "flag", Type: ipfix.BooleanType, Length: 1},
+	}
+)
+
+func testRow(i int) []interface{} {
+	ts := flows.DateTimeNanoseconds(1500000000000000000 + i*1000000)
+	row := []interface{}{net.IP{10, 0, 0, byte(i)}, uint16(i), uint64(i) * 100, ts, []interface{}{ts, ts + 1e6}, []byte{byte(i)}, float64(i) / 2, i%2 == 0}
+	if i%3 == 0 {
+		// missing values and empty lists are null
+		row[1] = nil
+		row[4] = []interface{}{}
+	}
+	return row
+}
+
+// footer checks the file structure and returns the encoded file metadata
+func footer(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) < 12 || !bytes.Equal(data[:4], magic) || !bytes.Equal(data[len(data)-4:], magic) {
+		t.Fatalf("%s is not a parquet file", name)
+	}
+	length := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	if length <= 0 || length > len(data)-12 {
+		t.Fatalf("%s has an invalid footer length %d", name, length)
+	}
+	return data[len(data)-8-length : len(data)-8]
+}
+
+// thriftReader decodes the thrift compact protocol into maps of field ids (structs), slices (lists), int64, []byte, and
+// bool. It is independent of thriftWriter to catch encoding errors.
+type thriftReader struct {
+	data []byte
+	err  bool
+}
+
+func (r *thriftReader) byte() byte {
+	if len(r.data) == 0 {
+		r.err = true
+		return 0
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b
+}
+
+func (r *thriftReader) varint() uint64 {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = true
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *thriftReader) int() int64 {
+	v := r.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (r *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case thriftTrue:
+		return true
+	case thriftFalse:
+		return false
+	case thriftByte:
+		return int64(int8(r.byte()))
+	case 4, thriftI32, thriftI64:
+		return r.int()
+	case thriftBinary:
+		n := int(r.varint())
+		if n > len(r.data) {
+			r.err = true
+			return nil
+		}
+		v := r.data[:n]
+		r.data = r.data[n:]
+		return v
+	case thriftList:
+		header := r.byte()
+		n, elem := int(header>>4), header&0xf
+		if n == 15 {
+			n = int(r.varint())
+		}
+		list := make([]interface{}, 0, n)
+		for i := 0; i < n && !r.err; i++ {
+			list = append(list, r.value(elem))
+		}
+		return list
+	case thriftStruct:
+		return r.structure()
+	}
+	r.err = true
+	return nil
+}
+
+func (r *thriftReader) structure() map[int16]interface{} {
+	ret := make(map[int16]interface{})
+	var id int16
+	for !r.err {
+		header := r.byte()
+		if header == 0 {
+			break
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			id += delta
+		} else {
+			id = int16(r.int())
+		}
+		ret[id] = r.value(header & 0xf)
+	}
+	return ret
+}
+
+// readLevels decodes levels of bit width 1 encoded with the RLE/bit-packing hybrid and prefixed by the length
+func readLevels(t *testing.T, data []byte, n int) ([]byte, []byte) {
+	length := int(binary.LittleEndian.Uint32(data))
+	r := thriftReader{data: data[4 : 4+length]}
+	var levels []byte
+	for len(r.data) > 0 && !r.err {
+		header := r.varint()
+		if header&1 == 0 {
+			v := r.byte()
+			for i := uint64(0); i < header>>1; i++ {
+				levels = append(levels, v)
+			}
+		} else {
+			for i := uint64(0); i < header>>1; i++ {
+				b := r.byte()
+				for bit := uint(0); bit < 8; bit++ {
+					levels = append(levels, b>>bit&1)
+				}
+			}
+		}
+	}
+	if r.err || len(levels) < n {
+		t.Fatalf("invalid levels %v", data[:4+length])
+	}
+	return levels[:n], data[4+length:]
+}
+
+// readColumn returns the values of the named column of every row. Lists are returned as []interface{}.
+func readColumn(t *testing.T, name, column string) []interface{} {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := thriftReader{data: footer(t, name)}
+	meta := r.structure()
+	if r.err {
+		t.Fatalf("%s: invalid file metadata", name)
+	}
+	index, repeated := -1, false
+	var physical int64
+	for i, element := range meta[2].([]interface{})[1:] {
+		element := element.(map[int16]interface{})
+		if string(element[4].([]byte)) == column {
+			index, physical, repeated = i, element[1].(int64), element[3].(int64) == repetitionRepeated
+		}
+	}
+	if index == -1 {
+		t.Fatalf("%s: column %s missing", name, column)
+	}
+	var rows []interface{}
+	for _, group := range meta[4].([]interface{}) {
+		chunk := group.(map[int16]interface{})[1].([]interface{})[index].(map[int16]interface{})[3].(map[int16]interface{})
+		r := thriftReader{data: data[chunk[9].(int64):]}
+		header := r.structure()
+		n := int(header[5].(map[int16]interface{})[1].(int64))
+		page := r.data[:header[3].(int64)]
+		switch chunk[4].(int64) {
+		case codecSnappy:
+			page, err = snappy.Decode(nil, page)
+		case codecGzip:
+			var gz *gzip.Reader
+			if gz, err = gzip.NewReader(bytes.NewReader(page)); err == nil {
+				page, err = ioutil.ReadAll(gz)
+			}
+		case codecZstd:
+			var dec *zstd.Decoder
+			if dec, err = zstd.NewReader(nil); err == nil {
+				page, err = dec.DecodeAll(page, nil)
+			}
+		}
+		if r.err || err != nil || int64(len(page)) != header[2].(int64) {
+			t.Fatalf("%s: couldn't read page of column %s: %v", name, column, err)
+		}
+		var rep, def []byte
+		if repeated {
+			rep, page = readLevels(t, page, n)
+		}
+		def, page = readLevels(t, page, n)
+		bit := 0
+		for i := 0; i < n; i++ {
+			var value interface{}
+			if def[i] == 1 {
+				switch physical {
+				case typeBoolean:
+					value = page[bit/8]>>uint(bit%8)&1 == 1
+					bit++
+				case typeInt32:
+					value, page = int32(binary.LittleEndian.Uint32(page)), page[4:]
+				case typeInt64:
+					value, page = int64(binary.LittleEndian.Uint64(page)), page[8:]
+				case typeDouble:
+					value, page = math.Float64frombits(binary.LittleEndian.Uint64(page)), page[8:]
+				case typeByteArray:
+					length := binary.LittleEndian.Uint32(page)
+					value, page = page[4:4+length], page[4+length:]
+				}
+			}
+			switch {
+			case !repeated:
+				rows = append(rows, value)
+			case rep[i] == 0 && value == nil:
+				rows = append(rows, nil)
+			case rep[i] == 0:
+				rows = append(rows, []interface{}{value})
+			default:
+				rows[len(rows)-1] = append(rows[len(rows)-1].([]interface{}), value)
+			}
+		}
+	}
+	return rows
+}
+
+func TestParquetExport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for codec := range codecs {
+		t.Run(codec, func(t *testing.T) {
+			name := filepath.Join(dir, codec+".parquet")
+			_, module, err := newParquetExporter([]string{"-rows", "4", "-codec", codec, name})
+			if err != nil {
+				t.Fatal(err)
+			}
+			pe := module.(*parquetExporter)
+			pe.Init()
+			template := testTemplate{ies: ies}
+			for i := 0; i < 10; i++ {
+				pe.Export(template, testRow(i), 0)
+			}
+			// a different template starts a new file
+			pe.Export(testTemplate{id: 1, ies: ies[:2]}, testRow(0)[:2], 0)
+			pe.Finish()
+
+			meta := footer(t, name)
+			if !bytes.Contains(meta, []byte("octetTotalCount")) || !bytes.Contains(meta, []byte("go-flows")) {
+				t.Error("file metadata is missing the schema")
+			}
+			if len(pe.writers) != 0 {
+				t.Error("writers must be closed after Finish")
+			}
+			for column, expected := range map[string]func(row []interface{}) interface{}{
+				"sourceIPAddress":     func(row []interface{}) interface{} { return []byte(row[0].(net.IP).String()) },
+				"sourceTransportPort": func(row []interface{}) interface{} { return int32(row[1].(uint16)) },
+				"octetTotalCount":     func(row []interface{}) interface{} { return int64(row[2].(uint64)) },
+				"accumulate": func(row []interface{}) interface{} {
+					var list []interface{}
+					for _, ts := range row[4].([]interface{}) {
+						list = append(list, int64(ts.(flows.DateTimeNanoseconds)/1e6))
+					}
+					return list
+				},
+				"payload": func(row []interface{}) interface{} { return row[5] },
+				"ratio":   func(row []interface{}) interface{} { return row[6] },
+				"flag":    func(row []interface{}) interface{} { return row[7] },
+			} {
+				values := readColumn(t, name, column)
+				if len(values) != 10 {
+					t.Fatalf("column %s has %d rows; expected 10", column, len(values))
+				}
+				for i, value := range values {
+					row := testRow(i)
+					var want interface{}
+					if (column != "sourceTransportPort" && column != "accumulate") || i%3 != 0 {
+						want = expected(row)
+					}
+					if !reflect.DeepEqual(value, want) {
+						t.Errorf("column %s row %d is %#v; expected %#v", column, i, value, want)
+					}
+				}
+			}
+			meta = footer(t, filepath.Join(dir, codec+".1.parquet"))
+			if bytes.Contains(meta, []byte("octetTotalCount")) {
+				t.Error("second file must only contain the columns of the second template")
+			}
+		})
+	}
+}
+
+func TestParquetInterleavedTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "flows.parquet")
+	_, module, err := newParquetExporter([]string{"-rows", "4", name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe := module.(*parquetExporter)
+	pe.Init()
+	// e.g. IPv4 and IPv6 flows alternating
+	first, second := testTemplate{ies: ies}, testTemplate{id: 1, ies: ies[:2]}
+	for i := 0; i < 10; i++ {
+		pe.Export(first, testRow(i), 0)
+		pe.Export(second, testRow(i)[:2], 0)
+	}
+	pe.Finish()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.parquet"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("wrote %d files %v; expected 2", len(files), files)
+	}
+	for _, file := range []string{name, filepath.Join(dir, "flows.1.parquet")} {
+		if values := readColumn(t, file, "sourceTransportPort"); len(values) != 10 {
+			t.Errorf("%s has %d rows; expected 10", file, len(values))
+		}
+	}
+}
+
+func TestColumnLevels(t *testing.T) {
+	c := makeColumn("list", ipfix.NewBasicList("accumulate", start, 0))
+	c.append([]interface{}{flows.DateTimeNanoseconds(1e6), flows.DateTimeNanoseconds(2e6)})
+	c.append(nil)
+	c.append([]interface{}{flows.DateTimeNanoseconds(3e6)})
+	if !bytes.Equal(c.rep, []byte{0, 1, 0, 0}) || !bytes.Equal(c.def, []byte{1, 1, 0, 1}) {
+		t.Errorf("got repetition levels %v and definition levels %v", c.rep, c.def)
+	}
+	if len(c.values) != 3*8 || binary.LittleEndian.Uint64(c.values[16:]) != 3 {
+		t.Errorf("expected 3 timestamps in milliseconds; got %v", c.values)
+	}
+	levels := appendLevels(nil, []byte{1, 1, 0, 1})
+	if !bytes.Equal(levels, []byte{6, 0, 0, 0, 4, 1, 2, 0, 2, 1}) {
+		t.Errorf("got encoded levels %v", levels)
+	}
+}
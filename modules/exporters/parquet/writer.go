@@ -0,0 +1,607 @@
+package parquet
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"reflect"
+
+	"github.com/CN-TU/go-flows/flows"
+	ipfix "github.com/CN-TU/go-ipfix"
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+var magic = []byte("PAR1")
+
+// parquet physical types
+const (
+	typeBoolean   = 0
+	typeInt32     = 1
+	typeInt64     = 2
+	typeFloat     = 4
+	typeDouble    = 5
+	typeByteArray = 6
+)
+
+// parquet repetition types
+const (
+	repetitionOptional = 1
+	repetitionRepeated = 2
+)
+
+// parquet converted types (for readers without logical type support)
+const (
+	convertedNone            = -1
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+	convertedTimestampMicros = 10
+	convertedUint8           = 11
+	convertedUint16          = 12
+	convertedUint32          = 13
+	convertedUint64          = 14
+	convertedInt8            = 15
+	convertedInt16           = 16
+	convertedInt32           = 17
+	convertedInt64           = 18
+)
+
+// parquet logical types
+const (
+	logicalNone      = 0
+	logicalString    = 1
+	logicalTimestamp = 8
+	logicalInteger   = 10
+)
+
+const (
+	encodingPlain = 0
+	encodingRLE   = 3
+	pageTypeData  = 0
+)
+
+// parquet compression codecs
+const (
+	codecUncompressed = 0
+	codecSnappy       = 1
+	codecGzip         = 2
+	codecZstd         = 6
+)
+
+var codecs = map[string]int32{
+	"none":   codecUncompressed,
+	"snappy": codecSnappy,
+	"gzip":   codecGzip,
+	"zstd":   codecZstd,
+}
+
+// column holds the schema and the buffered values of a single column for the current row group
+type column struct {
+	name      string
+	physical  int32
+	converted int32
+	logical   int
+	bits      int8 // integer logical type
+	signed    bool
+	unit      int64 // timestamp unit in nanoseconds (logical type timestamp)
+	repeated  bool
+	values    []byte
+	def       []byte
+	rep       []byte
+	nulls     int
+}
+
+// makeColumn derives the parquet type of a column from the information element. basicLists become repeated columns.
+func makeColumn(name string, ie ipfix.InformationElement) *column {
+	c := &column{name: name, converted: convertedNone}
+	if sub, ok := ie.ListElement(); ok {
+		c.repeated = true
+		ie = sub
+	}
+	integer := func(physical int32, bits int8, signed bool, converted int32) {
+		c.physical, c.logical, c.bits, c.signed, c.converted = physical, logicalInteger, bits, signed, converted
+	}
+	timestamp := func(unit int64, converted int32) {
+		c.physical, c.logical, c.unit, c.converted = typeInt64, logicalTimestamp, unit, converted
+	}
+	switch ie.Type {
+	case ipfix.Unsigned8Type:
+		integer(typeInt32, 8, false, convertedUint8)
+	case ipfix.Unsigned16Type:
+		integer(typeInt32, 16, false, convertedUint16)
+	case ipfix.Unsigned32Type:
+		integer(typeInt32, 32, false, convertedUint32)
+	case ipfix.Unsigned64Type:
+		integer(typeInt64, 64, false, convertedUint64)
+	case ipfix.Signed8Type:
+		integer(typeInt32, 8, true, convertedInt8)
+	case ipfix.Signed16Type:
+		integer(typeInt32, 16, true, convertedInt16)
+	case ipfix.Signed32Type:
+		integer(typeInt32, 32, true, convertedInt32)
+	case ipfix.Signed64Type:
+		integer(typeInt64, 64, true, convertedInt64)
+	case ipfix.Float32Type:
+		c.physical = typeFloat
+	case ipfix.Float64Type:
+		c.physical = typeDouble
+	case ipfix.BooleanType:
+		c.physical = typeBoolean
+	case ipfix.DateTimeSecondsType, ipfix.DateTimeMillisecondsType:
+		timestamp(1e6, convertedTimestampMillis)
+	case ipfix.DateTimeMicrosecondsType:
+		timestamp(1e3, convertedTimestampMicros)
+	case ipfix.DateTimeNanosecondsType:
+		timestamp(1, convertedNone)
+	case ipfix.OctetArrayType:
+		c.physical = typeByteArray
+	default:
+		// strings, addresses, and everything unknown is written as string
+		c.physical, c.logical, c.converted = typeByteArray, logicalString, convertedUTF8
+	}
+	return c
+}
+
+func toInt64(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case float32:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case flows.FlowEndReason:
+		return int64(v), true
+	case flows.DateTimeNanoseconds:
+		return int64(v), true
+	case flows.DateTimeMicroseconds:
+		return int64(v), true
+	case flows.DateTimeMilliseconds:
+		return int64(v), true
+	case flows.DateTimeSeconds:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+func toFloat64(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	case uint64:
+		return float64(v), true
+	}
+	i, ok := toInt64(val)
+	return float64(i), ok
+}
+
+// toNanoseconds converts timestamps to nanoseconds
+func toNanoseconds(val interface{}) (int64, bool) {
+	switch v := val.(type) {
+	case flows.DateTimeNanoseconds:
+		return int64(v), true
+	case flows.DateTimeMicroseconds:
+		return int64(v) * 1e3, true
+	case flows.DateTimeMilliseconds:
+		return int64(v) * 1e6, true
+	case flows.DateTimeSeconds:
+		return int64(v) * 1e9, true
+	}
+	return 0, false
+}
+
+// appendValue encodes val (PLAIN encoding) and returns false if val can't be represented in this column
+func (c *column) appendValue(val interface{}) bool {
+	switch c.physical {
+	case typeBoolean:
+		i, ok := toInt64(val)
+		if !ok {
+			return false
+		}
+		if i != 0 {
+			c.values = append(c.values, 1)
+		} else {
+			c.values = append(c.values, 0)
+		}
+	case typeInt32:
+		i, ok := toInt64(val)
+		if !ok {
+			return false
+		}
+		c.values = append(c.values, byte(i), byte(i>>8), byte(i>>16), byte(i>>24))
+	case typeInt64:
+		var i int64
+		var ok bool
+		if c.logical == logicalTimestamp {
+			if i, ok = toNanoseconds(val); ok {
+				i /= c.unit
+			}
+		} else {
+			i, ok = toInt64(val)
+		}
+		if !ok {
+			return false
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(i))
+		c.values = append(c.values, b[:]...)
+	case typeFloat:
+		f, ok := toFloat64(val)
+		if !ok {
+			return false
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], math.Float32bits(float32(f)))
+		c.values = append(c.values, b[:]...)
+	case typeDouble:
+		f, ok := toFloat64(val)
+		if !ok {
+			return false
+		}
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+		c.values = append(c.values, b[:]...)
+	case typeByteArray:
+		var s []byte
+		switch v := val.(type) {
+		case []byte:
+			s = v
+		case string:
+			s = []byte(v)
+		case net.IP:
+			s = []byte(v.String())
+		case net.HardwareAddr:
+			s = []byte(v.String())
+		default:
+			s = []byte(fmt.Sprint(v))
+		}
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], uint32(len(s)))
+		c.values = append(c.values, b[:]...)
+		c.values = append(c.values, s...)
+	}
+	return true
+}
+
+// append adds the value of a single row
+func (c *column) append(val interface{}) {
+	if !c.repeated {
+		if val != nil && c.appendValue(val) {
+			c.def = append(c.def, 1)
+			return
+		}
+		c.def = append(c.def, 0)
+		c.nulls++
+		return
+	}
+	first := len(c.def)
+	if val != nil {
+		if v := reflect.ValueOf(val); v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+			for i := 0; i < v.Len(); i++ {
+				if c.appendValue(v.Index(i).Interface()) {
+					c.def = append(c.def, 1)
+					c.rep = append(c.rep, 1)
+				}
+			}
+		}
+	}
+	if len(c.def) == first {
+		// nil or empty list
+		c.def = append(c.def, 0)
+		c.rep = append(c.rep, 0)
+		c.nulls++
+		return
+	}
+	c.rep[first] = 0
+}
+
+func (c *column) reset() {
+	c.values = c.values[:0]
+	c.def = c.def[:0]
+	c.rep = c.rep[:0]
+	c.nulls = 0
+}
+
+// appendLevels encodes levels with the RLE/bit-packing hybrid (bit width 1, RLE runs only) prefixed by the length
+func appendLevels(b []byte, levels []byte) []byte {
+	start := len(b)
+	b = append(b, 0, 0, 0, 0)
+	var scratch [binary.MaxVarintLen64]byte
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		n := binary.PutUvarint(scratch[:], uint64(j-i)<<1)
+		b = append(b, scratch[:n]...)
+		b = append(b, levels[i])
+		i = j
+	}
+	binary.LittleEndian.PutUint32(b[start:], uint32(len(b)-start-4))
+	return b
+}
+
+// packBooleans bit-packs boolean values (PLAIN encoding of booleans)
+func packBooleans(values []byte) []byte {
+	ret := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		ret[i/8] |= v << uint(i%8)
+	}
+	return ret
+}
+
+type columnChunk struct {
+	offset       int64
+	values       int64
+	uncompressed int64
+	compressed   int64
+}
+
+type rowGroup struct {
+	columns []columnChunk
+	rows    int64
+	size    int64
+}
+
+// fileWriter writes a single parquet file with a fixed schema
+type fileWriter struct {
+	file    io.WriteCloser
+	w       *bufio.Writer
+	offset  int64
+	columns []*column
+	rows    int64
+	total   int64
+	groups  []rowGroup
+	codec   int32
+	zstd    *zstd.Encoder
+	page    []byte
+	thrift  thriftWriter
+}
+
+func newFileWriter(file io.WriteCloser, columns []*column, codec int32) (*fileWriter, error) {
+	fw := &fileWriter{
+		file:    file,
+		w:       bufio.NewWriterSize(file, 64*1024),
+		columns: columns,
+		codec:   codec,
+	}
+	if codec == codecZstd {
+		var err error
+		if fw.zstd, err = zstd.NewWriter(nil); err != nil {
+			return nil, err
+		}
+	}
+	return fw, fw.write(magic)
+}
+
+func (fw *fileWriter) write(b []byte) error {
+	n, err := fw.w.Write(b)
+	fw.offset += int64(n)
+	return err
+}
+
+// writeRow adds a row to the current row group
+func (fw *fileWriter) writeRow(features []interface{}) {
+	for i, c := range fw.columns {
+		if i < len(features) {
+			c.append(features[i])
+		} else {
+			c.append(nil)
+		}
+	}
+	fw.rows++
+}
+
+func (fw *fileWriter) compress(data []byte) ([]byte, error) {
+	switch fw.codec {
+	case codecSnappy:
+		return snappy.Encode(nil, data), nil
+	case codecGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case codecZstd:
+		return fw.zstd.EncodeAll(data, nil), nil
+	}
+	return data, nil
+}
+
+// flushRowGroup writes the buffered rows as row group with one data page per column
+func (fw *fileWriter) flushRowGroup() error {
+	if fw.rows == 0 {
+		return nil
+	}
+	group := rowGroup{rows: fw.rows, columns: make([]columnChunk, len(fw.columns))}
+	for i, c := range fw.columns {
+		page := fw.page[:0]
+		if c.repeated {
+			page = appendLevels(page, c.rep)
+		}
+		page = appendLevels(page, c.def)
+		if c.physical == typeBoolean {
+			page = append(page, packBooleans(c.values)...)
+		} else {
+			page = append(page, c.values...)
+		}
+		fw.page = page
+		data, err := fw.compress(page)
+		if err != nil {
+			return err
+		}
+
+		t := &fw.thrift
+		t.buf = t.buf[:0]
+		t.begin()
+		t.i32(1, pageTypeData)
+		t.i32(2, int32(len(page)))
+		t.i32(3, int32(len(data)))
+		t.structField(5)
+		t.i32(1, int32(len(c.def)))
+		t.i32(2, encodingPlain)
+		t.i32(3, encodingRLE)
+		t.i32(4, encodingRLE)
+		t.end()
+		t.end()
+
+		chunk := &group.columns[i]
+		chunk.offset = fw.offset
+		chunk.values = int64(len(c.def))
+		chunk.uncompressed = int64(len(t.buf) + len(page))
+		chunk.compressed = int64(len(t.buf) + len(data))
+		group.size += chunk.uncompressed
+		if err := fw.write(t.buf); err != nil {
+			return err
+		}
+		if err := fw.write(data); err != nil {
+			return err
+		}
+		c.reset()
+	}
+	fw.groups = append(fw.groups, group)
+	fw.total += fw.rows
+	fw.rows = 0
+	return nil
+}
+
+func (fw *fileWriter) writeSchema(t *thriftWriter) {
+	t.list(2, thriftStruct, len(fw.columns)+1)
+	t.begin()
+	t.binary(4, "schema")
+	t.i32(5, int32(len(fw.columns)))
+	t.end()
+	for _, c := range fw.columns {
+		t.begin()
+		t.i32(1, c.physical)
+		if c.repeated {
+			t.i32(3, repetitionRepeated)
+		} else {
+			t.i32(3, repetitionOptional)
+		}
+		t.binary(4, c.name)
+		if c.converted != convertedNone {
+			t.i32(6, c.converted)
+		}
+		if c.logical != logicalNone {
+			t.structField(10)
+			t.structField(int16(c.logical))
+			switch c.logical {
+			case logicalInteger:
+				t.i8(1, c.bits)
+				t.bool(2, c.signed)
+			case logicalTimestamp:
+				t.bool(1, true)
+				t.structField(2)
+				switch c.unit {
+				case 1e6:
+					t.structField(1)
+				case 1e3:
+					t.structField(2)
+				default:
+					t.structField(3)
+				}
+				t.end()
+				t.end()
+			}
+			t.end()
+			t.end()
+		}
+		t.end()
+	}
+}
+
+// Close writes the remaining rows and the file footer
+func (fw *fileWriter) Close() error {
+	if err := fw.flushRowGroup(); err != nil {
+		return err
+	}
+	t := &fw.thrift
+	t.buf = t.buf[:0]
+	t.begin()
+	t.i32(1, 1)
+	fw.writeSchema(t)
+	t.i64(3, fw.total)
+	t.list(4, thriftStruct, len(fw.groups))
+	for _, group := range fw.groups {
+		t.begin()
+		t.list(1, thriftStruct, len(group.columns))
+		for i, chunk := range group.columns {
+			c := fw.columns[i]
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, c.physical)
+			t.list(2, thriftI32, 2)
+			t.listI32(encodingPlain)
+			t.listI32(encodingRLE)
+			t.list(3, thriftBinary, 1)
+			t.listBinary(c.name)
+			t.i32(4, fw.codec)
+			t.i64(5, chunk.values)
+			t.i64(6, chunk.uncompressed)
+			t.i64(7, chunk.compressed)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, group.size)
+		t.i64(3, group.rows)
+		t.end()
+	}
+	t.binary(6, "go-flows")
+	t.end()
+
+	if err := fw.write(t.buf); err != nil {
+		return err
+	}
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(t.buf)))
+	if err := fw.write(length[:]); err != nil {
+		return err
+	}
+	if err := fw.write(magic); err != nil {
+		return err
+	}
+	if err := fw.w.Flush(); err != nil {
+		return err
+	}
+	if fw.zstd != nil {
+		fw.zstd.Close()
+	}
+	return fw.file.Close()
+}
@@ -0,0 +1,214 @@
+package control
+
+import (
+	"encoding/gob"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/modules/features"
+	"github.com/CN-TU/go-flows/packet"
+)
+
+type exportAfterPackets struct {
+	flows.NoopFeature
+	limit, count uint64
+}
+
+func (f *exportAfterPackets) Snapshot(enc *gob.Encoder) error { return enc.Encode(f.count) }
+func (f *exportAfterPackets) Restore(dec *gob.Decoder) error  { return dec.Decode(&f.count) }
+
+func (f *exportAfterPackets) SetArguments(arguments []int, features []flows.Feature) {
+	f.limit = uint64(flows.ToInt(features[arguments[0]].Value()))
+}
+
+func (f *exportAfterPackets) Start(*flows.EventContext) {
+	f.count = 0
+}
+
+func (f *exportAfterPackets) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	f.count++
+	if f.count >= f.limit {
+		context.Export(false, flows.FlowEndReasonActive)
+		context.Restart(false)
+	}
+}
+
+func init() {
+	flows.RegisterControlFeature("exportAfterPackets", "exports and restarts the flow after the given number of packets", func() flows.Feature { return &exportAfterPackets{} }, flows.Const)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type exportAfterOctets struct {
+	flows.NoopFeature
+	limit, count uint64
+}
+
+func (f *exportAfterOctets) Snapshot(enc *gob.Encoder) error { return enc.Encode(f.count) }
+func (f *exportAfterOctets) Restore(dec *gob.Decoder) error  { return dec.Decode(&f.count) }
+
+func (f *exportAfterOctets) SetArguments(arguments []int, features []flows.Feature) {
+	f.limit = uint64(flows.ToInt(features[arguments[0]].Value()))
+}
+
+func (f *exportAfterOctets) Start(*flows.EventContext) {
+	f.count = 0
+}
+
+func (f *exportAfterOctets) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	f.count += uint64(new.(packet.Buffer).NetworkLayerLength())
+	if f.count >= f.limit {
+		context.Export(false, flows.FlowEndReasonActive)
+		context.Restart(false)
+	}
+}
+
+func init() {
+	flows.RegisterControlFeature("exportAfterOctets", "exports and restarts the flow after the given number of octets (network layer length)", func() flows.Feature { return &exportAfterOctets{} }, flows.Const)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type tcpEnd struct {
+	flows.NoopFeature
+	finSeq   [2]features.Sequence
+	finAcked [2]bool
+}
+
+func (f *tcpEnd) Snapshot(enc *gob.Encoder) error {
+	if err := enc.Encode(f.finSeq); err != nil {
+		return err
+	}
+	return enc.Encode(f.finAcked)
+}
+
+func (f *tcpEnd) Restore(dec *gob.Decoder) error {
+	if err := dec.Decode(&f.finSeq); err != nil {
+		return err
+	}
+	return dec.Decode(&f.finAcked)
+}
+
+func (f *tcpEnd) Start(*flows.EventContext) {
+	f.finSeq[0] = features.InvalidSequence
+	f.finSeq[1] = features.InvalidSequence
+	f.finAcked[0] = false
+	f.finAcked[1] = false
+}
+
+func (f *tcpEnd) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	tcp := features.GetTCP(new)
+	if tcp == nil {
+		return
+	}
+	if tcp.RST {
+		context.Export(false, flows.FlowEndReasonEnd)
+		return
+	}
+	dir, other := 0, 1
+	if !context.Forward() {
+		dir, other = 1, 0
+	}
+	if tcp.FIN && f.finSeq[dir] == features.InvalidSequence {
+		// FIN occupies one sequence number after the payload
+		f.finSeq[dir] = features.Sequence(tcp.Seq).Add(new.(packet.Buffer).PayloadLength() + 1)
+	}
+	if tcp.ACK && f.finSeq[other] != features.InvalidSequence && f.finSeq[other].Difference(features.Sequence(tcp.Ack)) >= 0 {
+		f.finAcked[other] = true
+	}
+	if f.finAcked[0] && f.finAcked[1] {
+		context.Export(false, flows.FlowEndReasonEnd)
+	}
+}
+
+func init() {
+	flows.RegisterControlFeature("tcpEnd", "ends the flow after a RST or after both FINs have been acknowledged", func() flows.Feature { return &tcpEnd{} })
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type minPackets struct {
+	flows.NoopFeature
+	limit, count uint64
+}
+
+func (f *minPackets) Snapshot(enc *gob.Encoder) error { return enc.Encode(f.count) }
+func (f *minPackets) Restore(dec *gob.Decoder) error  { return dec.Decode(&f.count) }
+
+func (f *minPackets) SetArguments(arguments []int, features []flows.Feature) {
+	f.limit = uint64(flows.ToInt(features[arguments[0]].Value()))
+}
+
+func (f *minPackets) Start(*flows.EventContext) {
+	f.count = 0
+}
+
+func (f *minPackets) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	f.count++
+}
+
+func (f *minPackets) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
+	if f.count < f.limit {
+		context.Stop()
+	}
+}
+
+func init() {
+	flows.RegisterControlFeature("minPackets", "discards flows with less than the given number of packets upon export", func() flows.Feature { return &minPackets{} }, flows.Const)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type restartOnNewSYN struct {
+	flows.NoopFeature
+	synSeq     features.Sequence
+	synForward bool
+	packets    bool
+}
+
+func (f *restartOnNewSYN) Snapshot(enc *gob.Encoder) error {
+	if err := enc.Encode(f.synSeq); err != nil {
+		return err
+	}
+	if err := enc.Encode(f.synForward); err != nil {
+		return err
+	}
+	return enc.Encode(f.packets)
+}
+
+func (f *restartOnNewSYN) Restore(dec *gob.Decoder) error {
+	if err := dec.Decode(&f.synSeq); err != nil {
+		return err
+	}
+	if err := dec.Decode(&f.synForward); err != nil {
+		return err
+	}
+	return dec.Decode(&f.packets)
+}
+
+func (f *restartOnNewSYN) Start(*flows.EventContext) {
+	f.synSeq = features.InvalidSequence
+	f.synForward = false
+	f.packets = false
+}
+
+func (f *restartOnNewSYN) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	tcp := features.GetTCP(new)
+	if tcp != nil && tcp.SYN && !tcp.ACK {
+		seq := features.Sequence(tcp.Seq)
+		if f.packets && (f.synSeq == features.InvalidSequence || (context.Forward() == f.synForward && seq != f.synSeq)) {
+			// new connection with the same flow key -> export the old one and replay this packet
+			// (a SYN of the other side belongs to a simultaneous open)
+			context.Export(true, flows.FlowEndReasonEnd)
+			return
+		}
+		if f.synSeq == features.InvalidSequence {
+			f.synSeq = seq
+			f.synForward = context.Forward()
+		}
+	}
+	f.packets = true
+}
+
+func init() {
+	flows.RegisterControlFeature("restartOnNewSYN", "exports the flow and starts a new one, if a SYN of a different connection (i.e. reused five-tuple) is seen", func() flows.Feature { return &restartOnNewSYN{} })
+}
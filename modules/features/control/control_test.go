@@ -0,0 +1,126 @@
+package control
+
+import (
+	"net"
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+	_ "github.com/CN-TU/go-flows/modules/features/iana"
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/CN-TU/go-flows/packet_test"
+	"github.com/google/gopacket/layers"
+)
+
+func TestExportAfterPackets(t *testing.T) {
+	table := packet_test.MakeControlFeatureTest(t, []string{"packetTotalCount"}, []interface{}{[]interface{}{"exportAfterPackets", int64(2)}}, flows.FlowOptions{})
+	for i := 0; i < 5; i++ {
+		table.EventLayers(flows.DateTimeNanoseconds(i), &layers.UDP{SrcPort: 80, DstPort: 80})
+	}
+	table.Finish(10)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 1, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(2)}}},
+		{When: 3, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(2)}}},
+		{When: 10, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(1)}}},
+	})
+}
+
+func TestExportAfterPacketsResume(t *testing.T) {
+	table := packet_test.MakeControlFeatureTest(t, []string{"flowId", "packetTotalCount", "flowStartNanoseconds"}, []interface{}{[]interface{}{"exportAfterPackets", int64(2)}}, flows.FlowOptions{})
+	for i := 0; i < 5; i++ {
+		if i == 3 {
+			table.Resume(3)
+		}
+		table.EventLayers(flows.DateTimeNanoseconds(i), &layers.UDP{SrcPort: 80, DstPort: 80})
+	}
+	table.Finish(10)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 1, Features: []packet_test.FeatureResult{{Name: "flowId", Value: uint64(0)}, {Name: "packetTotalCount", Value: uint64(2)}, {Name: "flowStartNanoseconds", Value: flows.DateTimeNanoseconds(0)}}},
+		{When: 3, Features: []packet_test.FeatureResult{{Name: "flowId", Value: uint64(0)}, {Name: "packetTotalCount", Value: uint64(2)}, {Name: "flowStartNanoseconds", Value: flows.DateTimeNanoseconds(1)}}},
+		{When: 10, Features: []packet_test.FeatureResult{{Name: "flowId", Value: uint64(0)}, {Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowStartNanoseconds", Value: flows.DateTimeNanoseconds(3)}}},
+	})
+}
+
+func TestMinPackets(t *testing.T) {
+	table := packet_test.MakeControlFeatureTest(t, []string{"packetTotalCount"}, []interface{}{[]interface{}{"minPackets", int64(3)}}, flows.FlowOptions{})
+	events := []packet.SerializableLayerType{
+		&layers.UDP{SrcPort: 80, DstPort: 80},
+		&layers.UDP{SrcPort: 80, DstPort: 81},
+		&layers.UDP{SrcPort: 80, DstPort: 80},
+		&layers.UDP{SrcPort: 80, DstPort: 80},
+		&layers.UDP{SrcPort: 80, DstPort: 81},
+	}
+	for _, event := range events {
+		table.EventLayers(0, event)
+	}
+	table.Finish(0)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 0, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(3)}}},
+	})
+}
+
+func TestRestartOnNewSYN(t *testing.T) {
+	table := packet_test.MakeControlFeatureTest(t, []string{"packetTotalCount"}, []interface{}{"restartOnNewSYN"}, flows.FlowOptions{})
+	events := []packet.SerializableLayerType{
+		&layers.TCP{SrcPort: 80, DstPort: 81, SYN: true, Seq: 100},
+		&layers.TCP{SrcPort: 80, DstPort: 81, SYN: true, Seq: 100}, // retransmission
+		&layers.TCP{SrcPort: 80, DstPort: 81, ACK: true, Seq: 101},
+		&layers.TCP{SrcPort: 80, DstPort: 81, SYN: true, Seq: 5000},
+		&layers.TCP{SrcPort: 80, DstPort: 81, ACK: true, Seq: 5001},
+	}
+	for i, event := range events {
+		table.EventLayers(flows.DateTimeNanoseconds(i), event)
+	}
+	table.Finish(10)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 3, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(3)}}},
+		{When: 10, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(2)}}},
+	})
+}
+
+var (
+	clientIP = &layers.IPv4{SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	serverIP = &layers.IPv4{SrcIP: net.IP{10, 0, 0, 2}, DstIP: net.IP{10, 0, 0, 1}}
+)
+
+func TestRestartOnNewSYNSimultaneousOpen(t *testing.T) {
+	table := packet_test.MakeControlFeatureTest(t, []string{"packetTotalCount"}, []interface{}{"restartOnNewSYN"}, flows.FlowOptions{})
+	table.EventLayers(0, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 100})
+	table.EventLayers(1, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, SYN: true, Seq: 500})
+	table.EventLayers(2, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, ACK: true, Seq: 100, Ack: 501})
+	table.EventLayers(3, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, SYN: true, ACK: true, Seq: 500, Ack: 101})
+	table.EventLayers(4, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 7000})
+	table.Finish(10)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 4, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(4)}}},
+		{When: 10, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(1)}}},
+	})
+}
+
+func TestTCPEnd(t *testing.T) {
+	table := packet_test.MakeControlFeatureTest(t, []string{"sourceTransportPort", "packetTotalCount", "flowEndReason"}, []interface{}{"tcpEnd"}, flows.FlowOptions{})
+	// both FINs acknowledged
+	table.EventLayers(0, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 100})
+	table.EventLayers(1, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, SYN: true, ACK: true, Seq: 500, Ack: 101})
+	table.EventLayers(2, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: 101, Ack: 501})
+	table.EventLayers(3, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, FIN: true, ACK: true, Seq: 101, Ack: 501})
+	table.EventLayers(4, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, ACK: true, Seq: 501, Ack: 102})
+	table.EventLayers(5, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, FIN: true, ACK: true, Seq: 501, Ack: 102})
+	table.EventLayers(6, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: 102, Ack: 502})
+	// RST of the client
+	table.EventLayers(10, clientIP, &layers.TCP{SrcPort: 1001, DstPort: 80, SYN: true, Seq: 100})
+	table.EventLayers(11, clientIP, &layers.TCP{SrcPort: 1001, DstPort: 80, RST: true, Seq: 101})
+	// RST of the server
+	table.EventLayers(20, clientIP, &layers.TCP{SrcPort: 1002, DstPort: 80, SYN: true, Seq: 100})
+	table.EventLayers(21, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1002, RST: true, ACK: true, Ack: 101})
+	// only the FIN of the server is acknowledged
+	table.EventLayers(30, clientIP, &layers.TCP{SrcPort: 1003, DstPort: 80, ACK: true, Seq: 101, Ack: 501})
+	table.EventLayers(31, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1003, FIN: true, ACK: true, Seq: 501, Ack: 101})
+	table.EventLayers(32, clientIP, &layers.TCP{SrcPort: 1003, DstPort: 80, ACK: true, Seq: 101, Ack: 502})
+	table.Finish(100)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 6, Features: []packet_test.FeatureResult{{Name: "sourceTransportPort", Value: uint16(1000)}, {Name: "packetTotalCount", Value: uint64(7)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonEnd)}}},
+		{When: 11, Features: []packet_test.FeatureResult{{Name: "sourceTransportPort", Value: uint16(1001)}, {Name: "packetTotalCount", Value: uint64(2)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonEnd)}}},
+		{When: 21, Features: []packet_test.FeatureResult{{Name: "sourceTransportPort", Value: uint16(1002)}, {Name: "packetTotalCount", Value: uint64(2)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonEnd)}}},
+		{When: 100, Features: []packet_test.FeatureResult{{Name: "sourceTransportPort", Value: uint16(1003)}, {Name: "packetTotalCount", Value: uint64(3)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonForcedEnd)}}},
+	})
+}
@@ -0,0 +1,2 @@
+// Package control contains control features, which can be used in _control_features to modify flow behaviour.
+package control
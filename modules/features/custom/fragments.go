@@ -0,0 +1,120 @@
+package custom
+
+import (
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/modules/features"
+	"github.com/CN-TU/go-flows/packet"
+	ipfix "github.com/CN-TU/go-ipfix"
+)
+
+type _fragmentCountFlow struct {
+	flows.BaseFeature
+	count uint64
+}
+
+func (f *_fragmentCountFlow) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.count = 0
+}
+
+func (f *_fragmentCountFlow) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
+	f.SetValue(f.count, context, f)
+}
+
+func (f *_fragmentCountFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	f.count += uint64(new.(packet.Buffer).Fragments())
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_fragmentCount", "count of IP fragments the packets were reassembled from (needs -defrag)", ipfix.Unsigned64Type, 0, flows.FlowFeature, func() flows.Feature { return &_fragmentCountFlow{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type _fragmentCountPacket struct {
+	flows.BaseFeature
+}
+
+func (f *_fragmentCountPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	f.SetValue(uint64(new.(packet.Buffer).Fragments()), context, f)
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_fragmentCount", "count of IP fragments the packet was reassembled from (needs -defrag)", ipfix.Unsigned64Type, 0, flows.PacketFeature, func() flows.Feature { return &_fragmentCountPacket{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type _overlappingFragmentsFlow struct {
+	flows.BaseFeature
+	count uint64
+}
+
+func (f *_overlappingFragmentsFlow) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.count = 0
+}
+
+func (f *_overlappingFragmentsFlow) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
+	f.SetValue(f.count, context, f)
+}
+
+func (f *_overlappingFragmentsFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	f.count += uint64(new.(packet.Buffer).FragmentOverlaps())
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_overlappingFragments", "count of IP fragments that overlapped with other fragments during reassembly (needs -defrag)", ipfix.Unsigned64Type, 0, flows.FlowFeature, func() flows.Feature { return &_overlappingFragmentsFlow{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type _overlappingFragmentsPacket struct {
+	flows.BaseFeature
+}
+
+func (f *_overlappingFragmentsPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	f.SetValue(uint64(new.(packet.Buffer).FragmentOverlaps()), context, f)
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_overlappingFragments", "count of IP fragments that overlapped with other fragments during reassembly (needs -defrag)", ipfix.Unsigned64Type, 0, flows.PacketFeature, func() flows.Feature { return &_overlappingFragmentsPacket{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type _reassemblyFailuresFlow struct {
+	flows.BaseFeature
+	count uint64
+}
+
+func (f *_reassemblyFailuresFlow) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.count = 0
+}
+
+func (f *_reassemblyFailuresFlow) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
+	f.SetValue(f.count, context, f)
+}
+
+func (f *_reassemblyFailuresFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	f.count += features.BoolInt(new.(packet.Buffer).ReassemblyFailed())
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_reassemblyFailures", "count of fragmented packets that couldn't be reassembled (timeout, memory limit, or inconsistent fragments; needs -defrag)", ipfix.Unsigned64Type, 0, flows.FlowFeature, func() flows.Feature { return &_reassemblyFailuresFlow{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type _reassemblyFailuresPacket struct {
+	flows.BaseFeature
+}
+
+func (f *_reassemblyFailuresPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	f.SetValue(features.BoolInt(new.(packet.Buffer).ReassemblyFailed()), context, f)
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_reassemblyFailures", "1 if this is the first fragment of a packet that couldn't be reassembled (needs -defrag)", ipfix.Unsigned64Type, 0, flows.PacketFeature, func() flows.Feature { return &_reassemblyFailuresPacket{} }, flows.RawPacket)
+}
@@ -0,0 +1,386 @@
+package custom
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/CN-TU/go-flows/flows"
+	ipfix "github.com/CN-TU/go-ipfix"
+)
+
+// maxHTTPHeader is the maximum length of a single line in the http header
+const maxHTTPHeader = 64 * 1024
+
+const (
+	httpStart uint8 = iota
+	httpHeader
+	httpBody
+	httpChunkSize
+	httpChunkEnd
+	httpTrailer
+	httpDone
+)
+
+// httpMessage holds the start line and the interesting header fields of a http request or response
+type httpMessage struct {
+	request       bool
+	method        string
+	uri           string
+	version       string
+	status        uint16
+	userAgent     string
+	referer       string
+	contentType   string
+	contentLength int64 // -1 if not present
+	chunked       bool
+}
+
+// parseHTTPStartLine returns the message for a request or status line, or nil if line isn't a http/1.x start line
+func parseHTTPStartLine(line string) *httpMessage {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return nil
+	}
+	msg := &httpMessage{contentLength: -1}
+	if strings.HasPrefix(parts[0], "HTTP/1.") {
+		status, err := strconv.ParseUint(parts[1], 10, 16)
+		if err != nil || len(parts[1]) != 3 {
+			return nil
+		}
+		msg.version = parts[0]
+		msg.status = uint16(status)
+		return msg
+	}
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "HTTP/1.") || parts[0] == "" {
+		return nil
+	}
+	for _, c := range parts[0] {
+		if c < 'A' || c > 'Z' {
+			return nil
+		}
+	}
+	msg.request = true
+	msg.method = parts[0]
+	msg.uri = parts[1]
+	msg.version = parts[2]
+	return msg
+}
+
+func (msg *httpMessage) header(line string) {
+	header := strings.SplitN(line, ":", 2)
+	if len(header) != 2 {
+		return
+	}
+	value := strings.TrimSpace(header[1])
+	switch strings.ToLower(strings.TrimSpace(header[0])) {
+	case "user-agent":
+		msg.userAgent = value
+	case "referer":
+		msg.referer = value
+	case "content-type":
+		msg.contentType = value
+	case "content-length":
+		if length, err := strconv.ParseInt(value, 10, 64); err == nil && length >= 0 {
+			msg.contentLength = length
+		}
+	case "transfer-encoding":
+		codings := strings.Split(value, ",")
+		msg.chunked = strings.EqualFold(strings.TrimSpace(codings[len(codings)-1]), "chunked")
+	}
+}
+
+// httpStream holds the parser state of one direction
+type httpStream struct {
+	buffer    []byte
+	msg       *httpMessage
+	remaining int64 // body bytes left
+	state     uint8
+}
+
+// line returns the next line without line ending, or false if the line isn't complete yet
+func (s *httpStream) line() (string, bool) {
+	i := bytes.IndexByte(s.buffer, '\n')
+	if i < 0 {
+		if len(s.buffer) > maxHTTPHeader {
+			s.state = httpDone
+		}
+		return "", false
+	}
+	line := strings.TrimRight(string(s.buffer[:i]), "\r")
+	s.buffer = s.buffer[i+1:]
+	return line, true
+}
+
+// skip consumes body data and returns true if the body is complete
+func (s *httpStream) skip() bool {
+	n := int64(len(s.buffer))
+	if n > s.remaining {
+		n = s.remaining
+	}
+	s.buffer = s.buffer[n:]
+	s.remaining -= n
+	return s.remaining == 0
+}
+
+type httpParser struct {
+	flows.BaseFeature
+	forward  httpStream
+	backward httpStream
+	methods  []string // methods of the requests waiting for a response
+}
+
+func (f *httpParser) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.forward = httpStream{}
+	f.backward = httpStream{}
+	f.methods = nil
+}
+
+// bodyState returns the state after the header of msg
+func (f *httpParser) bodyState(msg *httpMessage) uint8 {
+	if !msg.request {
+		if msg.status/100 == 1 {
+			if msg.status == 101 {
+				// switching protocols
+				return httpDone
+			}
+			// interim response; the final response follows
+			return httpStart
+		}
+		var method string
+		if len(f.methods) > 0 {
+			method = f.methods[0]
+			f.methods = f.methods[1:]
+		}
+		switch {
+		case method == "HEAD" || msg.status == 204 || msg.status == 304:
+			return httpStart
+		case method == "CONNECT" && msg.status/100 == 2:
+			// tunnel
+			return httpDone
+		}
+	}
+	switch {
+	case msg.chunked:
+		return httpChunkSize
+	case msg.contentLength > 0:
+		return httpBody
+	case msg.contentLength < 0 && !msg.request:
+		// response body ends with the connection
+		return httpDone
+	}
+	return httpStart
+}
+
+func (f *httpParser) parse(s *httpStream, context *flows.EventContext) {
+	for {
+		switch s.state {
+		case httpStart:
+			line, ok := s.line()
+			if !ok {
+				return
+			}
+			if line == "" {
+				// tolerate empty lines between messages
+				continue
+			}
+			if s.msg = parseHTTPStartLine(line); s.msg == nil {
+				s.state = httpDone
+				continue
+			}
+			s.state = httpHeader
+		case httpHeader:
+			line, ok := s.line()
+			if !ok {
+				return
+			}
+			if line != "" {
+				s.msg.header(line)
+				continue
+			}
+			msg := s.msg
+			s.msg = nil
+			if msg.request {
+				f.methods = append(f.methods, msg.method)
+			}
+			s.state = f.bodyState(msg)
+			s.remaining = msg.contentLength
+			f.SetValue(msg, context, f)
+		case httpBody:
+			if !s.skip() {
+				return
+			}
+			s.state = httpStart
+		case httpChunkSize:
+			line, ok := s.line()
+			if !ok {
+				return
+			}
+			if i := strings.IndexByte(line, ';'); i >= 0 {
+				line = line[:i]
+			}
+			size, err := strconv.ParseInt(strings.TrimSpace(line), 16, 64)
+			switch {
+			case err != nil || size < 0:
+				s.state = httpDone
+			case size == 0:
+				s.state = httpTrailer
+			default:
+				s.remaining = size
+				s.state = httpChunkEnd
+			}
+		case httpChunkEnd:
+			if s.remaining > 0 && !s.skip() {
+				return
+			}
+			// CRLF after the chunk data
+			if _, ok := s.line(); !ok {
+				return
+			}
+			s.state = httpChunkSize
+		case httpTrailer:
+			line, ok := s.line()
+			if !ok {
+				return
+			}
+			if line == "" {
+				s.state = httpStart
+			}
+		case httpDone:
+			s.buffer = nil
+			return
+		}
+	}
+}
+
+func (f *httpParser) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	s := &f.forward
+	if !context.Forward() {
+		s = &f.backward
+	}
+	if s.state == httpDone {
+		return
+	}
+	s.buffer = append(s.buffer, new.(string)...)
+	f.parse(s, context)
+	if len(s.buffer) == 0 {
+		// don't keep the backing array around between messages
+		s.buffer = nil
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("__httpParser", "parses http/1.x requests and responses from the tcp payload", ipfix.OctetArrayType, 0, flows.PacketFeature, func() flows.Feature { return &httpParser{} }, flows.PacketFeature)
+	flows.RegisterTemporaryCompositeFeature("__httpMessage", "http/1.x requests and responses of a tcp connection", ipfix.OctetArrayType, 0, "__httpParser", "_tcpReorderPayload")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// httpField is a packet feature, which emits the value computed by get from every http message
+type httpField struct {
+	flows.BaseFeature
+	get func(*httpMessage) interface{}
+}
+
+func (f *httpField) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if value := f.get(new.(*httpMessage)); value != nil {
+		f.SetValue(value, context, f)
+	}
+}
+
+// registerHTTPFeature registers name as a packet feature computed by get from __httpMessage. get must return nil, if
+// the message doesn't contain the field.
+func registerHTTPFeature(name, description string, t ipfix.Type, get func(*httpMessage) interface{}) {
+	flows.RegisterTemporaryFeature("_"+name, description, t, 0, flows.PacketFeature, func() flows.Feature { return &httpField{get: get} }, flows.PacketFeature)
+	flows.RegisterTemporaryCompositeFeature(name, description, t, 0, "_"+name, "__httpMessage")
+}
+
+func httpRequest(get func(*httpMessage) interface{}) func(*httpMessage) interface{} {
+	return func(msg *httpMessage) interface{} {
+		if !msg.request {
+			return nil
+		}
+		return get(msg)
+	}
+}
+
+func httpResponse(get func(*httpMessage) interface{}) func(*httpMessage) interface{} {
+	return func(msg *httpMessage) interface{} {
+		if msg.request {
+			return nil
+		}
+		return get(msg)
+	}
+}
+
+func httpNonEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func httpContentLength(msg *httpMessage) interface{} {
+	if msg.contentLength < 0 {
+		return nil
+	}
+	return uint64(msg.contentLength)
+}
+
+func init() {
+	registerHTTPFeature("_httpMethod", "method of every http request", ipfix.StringType,
+		httpRequest(func(msg *httpMessage) interface{} { return msg.method }))
+	registerHTTPFeature("_httpURI", "uri of every http request", ipfix.StringType,
+		httpRequest(func(msg *httpMessage) interface{} { return msg.uri }))
+	registerHTTPFeature("_httpRequestVersion", "http version of every request (e.g. HTTP/1.1)", ipfix.StringType,
+		httpRequest(func(msg *httpMessage) interface{} { return msg.version }))
+	registerHTTPFeature("_httpResponseVersion", "http version of every response (e.g. HTTP/1.1)", ipfix.StringType,
+		httpResponse(func(msg *httpMessage) interface{} { return msg.version }))
+	registerHTTPFeature("_httpUserAgent", "user agent header of every http request", ipfix.StringType,
+		httpRequest(func(msg *httpMessage) interface{} { return httpNonEmpty(msg.userAgent) }))
+	registerHTTPFeature("_httpReferer", "referer header of every http request", ipfix.StringType,
+		httpRequest(func(msg *httpMessage) interface{} { return httpNonEmpty(msg.referer) }))
+	registerHTTPFeature("_httpRequestContentType", "content type header of every http request", ipfix.StringType,
+		httpRequest(func(msg *httpMessage) interface{} { return httpNonEmpty(msg.contentType) }))
+	registerHTTPFeature("_httpResponseContentType", "content type header of every http response", ipfix.StringType,
+		httpResponse(func(msg *httpMessage) interface{} { return httpNonEmpty(msg.contentType) }))
+	registerHTTPFeature("_httpRequestContentLength", "content length header of every http request", ipfix.Unsigned64Type,
+		httpRequest(httpContentLength))
+	registerHTTPFeature("_httpResponseContentLength", "content length header of every http response", ipfix.Unsigned64Type,
+		httpResponse(httpContentLength))
+	registerHTTPFeature("_httpStatusCode", "status code of every final http response", ipfix.Unsigned16Type,
+		httpResponse(func(msg *httpMessage) interface{} {
+			if msg.status/100 == 1 {
+				return nil
+			}
+			return msg.status
+		}))
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type httpRequestCount struct {
+	flows.BaseFeature
+	count uint64
+}
+
+func (f *httpRequestCount) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.count = 0
+}
+
+func (f *httpRequestCount) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if new.(*httpMessage).request {
+		f.count++
+	}
+}
+
+func (f *httpRequestCount) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
+	f.SetValue(f.count, context, f)
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("__httpRequestCount", "number of http requests in the connection", ipfix.Unsigned64Type, 0, flows.FlowFeature, func() flows.Feature { return &httpRequestCount{} }, flows.PacketFeature)
+	flows.RegisterTemporaryCompositeFeature("_httpRequestCount", "number of http requests in the connection", ipfix.Unsigned64Type, 0, "__httpRequestCount", "__httpMessage")
+}
@@ -0,0 +1,79 @@
+package custom
+
+import (
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+	_ "github.com/CN-TU/go-flows/modules/features/operations"
+	"github.com/CN-TU/go-flows/packet_test"
+	"github.com/google/gopacket/layers"
+)
+
+func TestHTTPPipelined(t *testing.T) {
+	requests := "GET /a HTTP/1.1\r\nHost: example.com\r\nUser-Agent: test/1.0\r\n\r\n" +
+		"HEAD /b HTTP/1.1\r\nHost: example.com\r\nReferer: http://example.com/a\r\n\r\n" +
+		"POST /c HTTP/1.0\r\nHost: example.com\r\nContent-Type: text/plain\r\nContent-Length: 5\r\n\r\nhello"
+	responses := "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n" +
+		"HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n" +
+		"HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok"
+
+	features := []interface{}{"_httpRequestCount", "httpRequestHost"}
+	for _, feature := range []string{
+		"_httpMethod", "_httpURI", "_httpRequestVersion", "_httpUserAgent", "_httpReferer", "_httpRequestContentType",
+		"_httpRequestContentLength", "_httpStatusCode", "_httpResponseVersion", "_httpResponseContentType",
+		"_httpResponseContentLength",
+	} {
+		features = append(features, []interface{}{"accumulate", feature})
+	}
+	table := packet_test.MakeSpecFeatureTest(t, features, flows.FlowOptions{})
+
+	segment := func(when flows.DateTimeNanoseconds, forward bool, seq uint32, data string) {
+		tcp := &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: seq}
+		ip := clientIP
+		if !forward {
+			tcp.SrcPort, tcp.DstPort = 80, 1000
+			ip = serverIP
+		}
+		tcp.Payload = []byte(data)
+		table.EventLayers(when, ip, tcp)
+	}
+	table.EventLayers(0, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 100})
+	table.EventLayers(1, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, SYN: true, ACK: true, Seq: 500, Ack: 101})
+	// the second segment arrives first, the first one is retransmitted
+	segment(2, true, 101+50, requests[50:120])
+	segment(3, true, 101, requests[:50])
+	segment(4, true, 101, requests[:50])
+	segment(5, true, 101+120, requests[120:])
+	segment(6, false, 501, responses[:70])
+	segment(7, false, 501+70, responses[70:])
+	table.Finish(10)
+
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 10, Features: []packet_test.FeatureResult{
+			{Name: "_httpRequestCount", Value: uint64(3)},
+			{Name: "httpRequestHost", Value: "example.com"},
+			{Name: "accumulate(_httpMethod)", Value: []interface{}{"GET", "HEAD", "POST"}},
+			{Name: "accumulate(_httpURI)", Value: []interface{}{"/a", "/b", "/c"}},
+			{Name: "accumulate(_httpRequestVersion)", Value: []interface{}{"HTTP/1.1", "HTTP/1.1", "HTTP/1.0"}},
+			{Name: "accumulate(_httpUserAgent)", Value: []interface{}{"test/1.0"}},
+			{Name: "accumulate(_httpReferer)", Value: []interface{}{"http://example.com/a"}},
+			{Name: "accumulate(_httpRequestContentType)", Value: []interface{}{"text/plain"}},
+			{Name: "accumulate(_httpRequestContentLength)", Value: []interface{}{uint64(5)}},
+			{Name: "accumulate(_httpStatusCode)", Value: []interface{}{uint16(200), uint16(200), uint16(201)}},
+			{Name: "accumulate(_httpResponseVersion)", Value: []interface{}{"HTTP/1.1", "HTTP/1.1", "HTTP/1.1", "HTTP/1.1"}},
+			{Name: "accumulate(_httpResponseContentType)", Value: []interface{}{"text/html"}},
+			{Name: "accumulate(_httpResponseContentLength)", Value: []interface{}{uint64(100), uint64(2)}},
+		}},
+	})
+}
+
+func TestHTTPNotHTTP(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, []string{"_httpRequestCount"}, flows.FlowFeature, flows.FlowOptions{})
+	tcp := &layers.TCP{SrcPort: 1000, DstPort: 22, ACK: true, Seq: 100}
+	tcp.Payload = []byte("SSH-2.0-OpenSSH_8.0\r\nGET / HTTP/1.1\r\n\r\n")
+	table.EventLayers(0, clientIP, tcp)
+	table.Finish(1)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 1, Features: []packet_test.FeatureResult{{Name: "_httpRequestCount", Value: uint64(0)}}},
+	})
+}
@@ -0,0 +1,497 @@
+package custom
+
+import (
+	"encoding/binary"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/modules/features"
+	"github.com/CN-TU/go-flows/packet"
+	ipfix "github.com/CN-TU/go-ipfix"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// tcpRetransmission marks a segment containing data that was already sent
+	tcpRetransmission uint8 = 1 << iota
+	// tcpSpuriousRetransmission marks a retransmission of data that was already acknowledged
+	tcpSpuriousRetransmission
+	// tcpOutOfOrder marks a segment filling a gap shortly after the gap was seen
+	tcpOutOfOrder
+	// tcpLostSegment marks a segment after a gap in the sequence numbers (i.e. the previous segment was not seen)
+	tcpLostSegment
+	// tcpZeroWindow marks a segment advertising a zero window after a non zero window
+	tcpZeroWindow
+)
+
+const (
+	// maxTCPPending is the maximum number of unacknowledged segments and timestamps remembered for rtt estimation
+	maxTCPPending = 256
+	// maxTCPHoles is the maximum number of gaps remembered for out-of-order detection
+	maxTCPHoles = 16
+	// tcpOutOfOrderThreshold is the time within a gap must be filled to count as out-of-order, if no rtt is known
+	tcpOutOfOrderThreshold = 3 * flows.MillisecondsInNanoseconds
+)
+
+// tcpSegment is the analysis result of a single tcp packet
+type tcpSegment struct {
+	forward bool
+	flags   uint8
+	// rtt is a rtt sample for the data sent in direction rttForward; 0 if there is none
+	rtt        int64
+	rttForward bool
+	// synRTT (SYN -> SYN-ACK) and synAckRTT (SYN-ACK -> ACK) are set by the packet completing the step
+	synRTT    int64
+	synAckRTT int64
+	syn       bool
+	// mss and windowScale are the options of a SYN; -1 if not present
+	mss         int
+	windowScale int
+}
+
+type tcpSent struct {
+	end           features.Sequence
+	when          flows.DateTimeNanoseconds
+	retransmitted bool
+}
+
+type tcpTimestamp struct {
+	value uint32
+	when  flows.DateTimeNanoseconds
+}
+
+type tcpHole struct {
+	start, end features.Sequence
+	when       flows.DateTimeNanoseconds
+}
+
+// tcpPerformanceSide holds the state of the data sent in one direction
+type tcpPerformanceSide struct {
+	nextSeq    features.Sequence // end of the highest data sent
+	ack        features.Sequence // highest acknowledgement sent (for the data of the other direction)
+	pending    []tcpSent         // unacknowledged segments
+	timestamps []tcpTimestamp    // timestamp values not echoed yet
+	holes      []tcpHole
+	minRTT     int64
+	lastTSval  uint32
+	timestamp  bool // sends timestamps
+	zeroWindow bool
+}
+
+func (s *tcpPerformanceSide) reset() {
+	*s = tcpPerformanceSide{
+		nextSeq: features.InvalidSequence,
+		ack:     features.InvalidSequence,
+	}
+}
+
+func (s *tcpPerformanceSide) sample(rtt int64) int64 {
+	if s.minRTT == 0 || rtt < s.minRTT {
+		s.minRTT = rtt
+	}
+	return rtt
+}
+
+// fillHoles removes [seq, end) from the known gaps and returns the time the first affected gap was seen and true, or
+// false if [seq, end) didn't fill a gap
+func (s *tcpPerformanceSide) fillHoles(seq, end features.Sequence) (when flows.DateTimeNanoseconds, filled bool) {
+	holes := s.holes[:0]
+	for _, hole := range s.holes {
+		if seq.Difference(hole.end) <= 0 || end.Difference(hole.start) >= 0 {
+			// no overlap
+			holes = append(holes, hole)
+			continue
+		}
+		if !filled {
+			when, filled = hole.when, true
+		}
+		if hole.start.Difference(seq) > 0 {
+			holes = append(holes, tcpHole{hole.start, seq, hole.when})
+		}
+		if end.Difference(hole.end) > 0 {
+			holes = append(holes, tcpHole{end, hole.end, hole.when})
+		}
+	}
+	s.holes = holes
+	return
+}
+
+// tcpOptions returns the mss, window scale (-1 if not present), and the timestamp option
+func tcpOptions(tcp *layers.TCP) (mss, windowScale int, ts []byte) {
+	mss, windowScale = -1, -1
+	for _, o := range tcp.Options {
+		switch o.OptionType {
+		case layers.TCPOptionKindMSS:
+			if len(o.OptionData) == 2 {
+				mss = int(binary.BigEndian.Uint16(o.OptionData))
+			}
+		case layers.TCPOptionKindWindowScale:
+			if len(o.OptionData) == 1 {
+				windowScale = int(o.OptionData[0])
+			}
+		case layers.TCPOptionKindTimestamps:
+			if len(o.OptionData) == 8 {
+				ts = o.OptionData
+			}
+		}
+	}
+	return
+}
+
+// tcpAnalysis emits a *tcpSegment for every tcp packet. The value is reused for the next packet.
+type tcpAnalysis struct {
+	flows.BaseFeature
+	forward, backward tcpPerformanceSide
+	segment           tcpSegment
+	synTime           flows.DateTimeNanoseconds
+	synAckTime        flows.DateTimeNanoseconds
+	syn, synAck       bool // SYN and SYN-ACK seen
+	handshake         bool // handshake completed
+}
+
+func (f *tcpAnalysis) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.forward.reset()
+	f.backward.reset()
+	f.syn = false
+	f.synAck = false
+	f.handshake = false
+}
+
+func (f *tcpAnalysis) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	tcp := features.GetTCP(new)
+	if tcp == nil {
+		return
+	}
+	now := new.(packet.Buffer).Timestamp()
+	side, other := &f.forward, &f.backward
+	if !context.Forward() {
+		side, other = other, side
+	}
+	f.segment = tcpSegment{forward: context.Forward(), mss: -1, windowScale: -1}
+	segment := &f.segment
+	mss, windowScale, ts := tcpOptions(tcp)
+
+	// handshake
+	if tcp.SYN {
+		segment.syn = true
+		segment.mss = mss
+		segment.windowScale = windowScale
+		side.timestamp = ts != nil
+		if !tcp.ACK {
+			f.syn = true
+			f.synTime = now
+		} else {
+			if f.syn && !f.synAck {
+				segment.synRTT = int64(now - f.synTime)
+			}
+			f.synAck = true
+			f.synAckTime = now
+		}
+	} else if tcp.ACK && !tcp.RST && !f.handshake && f.syn && f.synAck {
+		f.handshake = true
+		segment.synAckRTT = int64(now - f.synAckTime)
+	}
+
+	// sequence analysis of the data sent by this side
+	seqLen := len(tcp.LayerPayload())
+	if tcp.SYN {
+		seqLen++
+	}
+	if tcp.FIN {
+		seqLen++
+	}
+	seq := features.Sequence(tcp.Seq)
+	end := seq.Add(seqLen)
+	if seqLen > 0 && !tcp.RST {
+		switch {
+		case side.nextSeq == features.InvalidSequence:
+			side.nextSeq = end
+			side.pending = append(side.pending, tcpSent{end: end, when: now})
+		case side.nextSeq.Difference(seq) > 0:
+			// gap
+			segment.flags |= tcpLostSegment
+			if len(side.holes) < maxTCPHoles {
+				side.holes = append(side.holes, tcpHole{side.nextSeq, seq, now})
+			}
+			side.nextSeq = end
+			side.pending = append(side.pending, tcpSent{end: end, when: now})
+		case side.nextSeq.Difference(end) > 0:
+			if side.nextSeq.Difference(seq) < 0 {
+				// partially new data
+				segment.flags |= tcpRetransmission
+				side.markRetransmitted(seq)
+			}
+			side.nextSeq = end
+			side.pending = append(side.pending, tcpSent{end: end, when: now})
+		case seqLen == 1 && end == side.nextSeq && !tcp.SYN && !tcp.FIN:
+			// keep alive
+		default:
+			threshold := tcpOutOfOrderThreshold
+			if side.minRTT != 0 {
+				threshold = flows.DateTimeNanoseconds(side.minRTT)
+			}
+			if when, filled := side.fillHoles(seq, end); filled && now-when < threshold {
+				segment.flags |= tcpOutOfOrder
+			} else {
+				segment.flags |= tcpRetransmission
+				if other.ack != features.InvalidSequence && end.Difference(other.ack) >= 0 {
+					segment.flags |= tcpSpuriousRetransmission
+				}
+				side.markRetransmitted(seq)
+			}
+		}
+		if len(side.pending) > maxTCPPending {
+			side.pending = side.pending[1:]
+		}
+	}
+
+	// zero window
+	if !tcp.SYN && !tcp.RST {
+		if tcp.Window == 0 && !side.zeroWindow {
+			segment.flags |= tcpZeroWindow
+		}
+		side.zeroWindow = tcp.Window == 0
+	}
+
+	// rtt estimation for the data sent by the other side
+	if side.timestamp && ts != nil {
+		tsval, tsecr := binary.BigEndian.Uint32(ts[:4]), binary.BigEndian.Uint32(ts[4:])
+		if side.lastTSval == 0 || int32(tsval-side.lastTSval) > 0 {
+			side.lastTSval = tsval
+			side.timestamps = append(side.timestamps, tcpTimestamp{tsval, now})
+			if len(side.timestamps) > maxTCPPending {
+				side.timestamps = side.timestamps[1:]
+			}
+		}
+		// timestamps of the other side are only recorded if it uses the option
+		echoed := 0
+		for _, t := range other.timestamps {
+			if int32(tsecr-t.value) < 0 {
+				break
+			}
+			if t.value == tsecr {
+				segment.rtt = other.sample(int64(now - t.when))
+				segment.rttForward = !context.Forward()
+			}
+			echoed++
+		}
+		other.timestamps = other.timestamps[echoed:]
+	}
+	if tcp.ACK {
+		ack := features.Sequence(tcp.Ack)
+		if side.ack == features.InvalidSequence || side.ack.Difference(ack) > 0 {
+			side.ack = ack
+			acked := 0
+			var last *tcpSent
+			for i := range other.pending {
+				if other.pending[i].end.Difference(ack) < 0 {
+					break
+				}
+				last = &other.pending[i]
+				acked++
+			}
+			// Karn's algorithm: no samples from retransmitted segments
+			if last != nil && !last.retransmitted && !(side.timestamp && other.timestamp) {
+				segment.rtt = other.sample(int64(now - last.when))
+				segment.rttForward = !context.Forward()
+			}
+			other.pending = other.pending[acked:]
+		}
+	}
+
+	f.SetValue(segment, context, f)
+}
+
+// markRetransmitted marks the pending segments containing data after seq as retransmitted
+func (s *tcpPerformanceSide) markRetransmitted(seq features.Sequence) {
+	for i := range s.pending {
+		if seq.Difference(s.pending[i].end) > 0 {
+			s.pending[i].retransmitted = true
+		}
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("__tcpAnalysis", "tcp sequence, acknowledgement, and rtt analysis of every packet", ipfix.OctetArrayType, 0, flows.PacketFeature, func() flows.Feature { return &tcpAnalysis{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// registerTCPPerformanceFeature registers name as a flow feature computed from __tcpAnalysis
+func registerTCPPerformanceFeature(name, description string, t ipfix.Type, make flows.MakeFeature) {
+	flows.RegisterTemporaryFeature("_"+name, description, t, 0, flows.FlowFeature, make, flows.PacketFeature)
+	flows.RegisterTemporaryCompositeFeature(name, description, t, 0, "_"+name, "__tcpAnalysis")
+}
+
+// tcpFlagCount counts the segments in one direction with the given analysis flag
+type tcpFlagCount struct {
+	flows.BaseFeature
+	forward bool
+	flag    uint8
+	count   uint64
+}
+
+func (f *tcpFlagCount) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.count = 0
+}
+
+func (f *tcpFlagCount) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	segment := new.(*tcpSegment)
+	if segment.forward == f.forward && segment.flags&f.flag != 0 {
+		f.count++
+	}
+}
+
+func (f *tcpFlagCount) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
+	f.SetValue(f.count, context, f)
+}
+
+const (
+	rttMin = iota
+	rttMean
+	rttMax
+)
+
+// tcpRTT computes the minimum, mean, or maximum of the rtt samples of one direction
+type tcpRTT struct {
+	flows.BaseFeature
+	forward bool
+	mode    int
+	value   int64
+	sum     int64
+	count   int64
+}
+
+func (f *tcpRTT) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.value = 0
+	f.sum = 0
+	f.count = 0
+}
+
+func (f *tcpRTT) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	segment := new.(*tcpSegment)
+	if segment.rtt == 0 || segment.rttForward != f.forward {
+		return
+	}
+	switch {
+	case f.count == 0,
+		f.mode == rttMin && segment.rtt < f.value,
+		f.mode == rttMax && segment.rtt > f.value:
+		f.value = segment.rtt
+	}
+	f.sum += segment.rtt
+	f.count++
+}
+
+func (f *tcpRTT) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
+	if f.count == 0 {
+		return
+	}
+	if f.mode == rttMean {
+		f.value = f.sum / f.count
+	}
+	f.SetValue(uint64(f.value), context, f)
+}
+
+// tcpSegmentField takes the first value computed by get from the segments
+type tcpSegmentField struct {
+	flows.BaseFeature
+	get func(*tcpSegment) interface{}
+}
+
+func (f *tcpSegmentField) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() != nil {
+		return
+	}
+	if value := f.get(new.(*tcpSegment)); value != nil {
+		f.SetValue(value, context, f)
+	}
+}
+
+func tcpSegmentFeature(get func(*tcpSegment) interface{}) flows.MakeFeature {
+	return func() flows.Feature { return &tcpSegmentField{get: get} }
+}
+
+func tcpDuration(value int64) interface{} {
+	if value == 0 {
+		return nil
+	}
+	return uint64(value)
+}
+
+func init() {
+	registerTCPPerformanceFeature("_tcpSynRTTNanoseconds", "time between the SYN and the SYN-ACK", ipfix.Unsigned64Type,
+		tcpSegmentFeature(func(s *tcpSegment) interface{} { return tcpDuration(s.synRTT) }))
+	registerTCPPerformanceFeature("_tcpSynAckRTTNanoseconds", "time between the SYN-ACK and the ACK completing the handshake", ipfix.Unsigned64Type,
+		tcpSegmentFeature(func(s *tcpSegment) interface{} { return tcpDuration(s.synAckRTT) }))
+	registerTCPPerformanceFeature("_tcpHandshakeRTTNanoseconds", "time between the SYN and the ACK completing the handshake", ipfix.Unsigned64Type,
+		func() flows.Feature { return &tcpHandshakeRTT{} })
+
+	for _, direction := range []struct {
+		name    string
+		forward bool
+	}{{"Forward", true}, {"Backward", false}} {
+		forward := direction.forward
+		prefix := "_tcp" + direction.name
+		for _, count := range []struct {
+			name        string
+			description string
+			flag        uint8
+		}{
+			{"RetransmissionCount", "number of retransmitted segments (including spurious retransmissions)", tcpRetransmission},
+			{"SpuriousRetransmissionCount", "number of retransmitted segments, which were already acknowledged", tcpSpuriousRetransmission},
+			{"OutOfOrderCount", "number of segments arriving out of order", tcpOutOfOrder},
+			{"LostSegmentCount", "number of gaps in the sequence numbers (previous segment not seen)", tcpLostSegment},
+			{"ZeroWindowCount", "number of zero window advertisements", tcpZeroWindow},
+		} {
+			flag := count.flag
+			registerTCPPerformanceFeature(prefix+count.name, count.description+" in "+direction.name+" direction", ipfix.Unsigned64Type,
+				func() flows.Feature { return &tcpFlagCount{forward: forward, flag: flag} })
+		}
+		for _, rtt := range []struct {
+			name string
+			mode int
+		}{{"Min", rttMin}, {"Mean", rttMean}, {"Max", rttMax}} {
+			mode := rtt.mode
+			registerTCPPerformanceFeature(prefix+"RTT"+rtt.name+"Nanoseconds", rtt.name+" rtt of the data sent in "+direction.name+" direction (from acknowledgements or timestamps)", ipfix.Unsigned64Type,
+				func() flows.Feature { return &tcpRTT{forward: forward, mode: mode} })
+		}
+		registerTCPPerformanceFeature(prefix+"WindowScale", "window scale option of the SYN in "+direction.name+" direction", ipfix.Unsigned8Type,
+			tcpSegmentFeature(func(s *tcpSegment) interface{} {
+				if !s.syn || s.forward != forward || s.windowScale < 0 {
+					return nil
+				}
+				return uint8(s.windowScale)
+			}))
+		registerTCPPerformanceFeature(prefix+"MSS", "maximum segment size option of the SYN in "+direction.name+" direction", ipfix.Unsigned16Type,
+			tcpSegmentFeature(func(s *tcpSegment) interface{} {
+				if !s.syn || s.forward != forward || s.mss < 0 {
+					return nil
+				}
+				return uint16(s.mss)
+			}))
+	}
+}
+
+// tcpHandshakeRTT sums up the SYN -> SYN-ACK and SYN-ACK -> ACK times
+type tcpHandshakeRTT struct {
+	flows.BaseFeature
+	synRTT int64
+}
+
+func (f *tcpHandshakeRTT) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.synRTT = 0
+}
+
+func (f *tcpHandshakeRTT) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	segment := new.(*tcpSegment)
+	if segment.synRTT != 0 {
+		f.synRTT = segment.synRTT
+	}
+	if segment.synAckRTT != 0 && f.synRTT != 0 && f.Value() == nil {
+		f.SetValue(uint64(f.synRTT+segment.synAckRTT), context, f)
+	}
+}
@@ -0,0 +1,109 @@
+package custom
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/packet_test"
+	"github.com/google/gopacket/layers"
+)
+
+const ms = flows.MillisecondsInNanoseconds
+
+func timestampOption(tsval, tsecr uint32) layers.TCPOption {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, tsval)
+	binary.BigEndian.PutUint32(data[4:], tsecr)
+	return layers.TCPOption{OptionType: layers.TCPOptionKindTimestamps, OptionData: data}
+}
+
+func TestTCPPerformance(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, []string{
+		"_tcpSynRTTNanoseconds", "_tcpSynAckRTTNanoseconds", "_tcpHandshakeRTTNanoseconds",
+		"_tcpForwardMSS", "_tcpBackwardMSS", "_tcpForwardWindowScale", "_tcpBackwardWindowScale",
+		"_tcpForwardRetransmissionCount", "_tcpForwardSpuriousRetransmissionCount", "_tcpForwardOutOfOrderCount",
+		"_tcpForwardLostSegmentCount", "_tcpBackwardZeroWindowCount", "_tcpForwardZeroWindowCount",
+		"_tcpForwardRTTMinNanoseconds", "_tcpForwardRTTMeanNanoseconds", "_tcpForwardRTTMaxNanoseconds",
+		"_tcpBackwardRTTMinNanoseconds", "_tcpBackwardRTTMeanNanoseconds", "_tcpBackwardRTTMaxNanoseconds",
+	}, flows.FlowFeature, flows.FlowOptions{})
+	client := func(when flows.DateTimeNanoseconds, tcp *layers.TCP, payload int) {
+		tcp.SrcPort, tcp.DstPort = 1000, 80
+		tcp.Payload = make([]byte, payload)
+		table.EventLayers(when, clientIP, tcp)
+	}
+	server := func(when flows.DateTimeNanoseconds, tcp *layers.TCP, payload int) {
+		tcp.SrcPort, tcp.DstPort = 80, 1000
+		tcp.Payload = make([]byte, payload)
+		table.EventLayers(when, serverIP, tcp)
+	}
+	client(0, &layers.TCP{SYN: true, Seq: 100, Window: 1000, Options: []layers.TCPOption{
+		{OptionType: layers.TCPOptionKindMSS, OptionData: []byte{0x05, 0xb4}},
+		{OptionType: layers.TCPOptionKindWindowScale, OptionData: []byte{7}},
+	}}, 0)
+	server(10*ms, &layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101, Window: 1000, Options: []layers.TCPOption{
+		{OptionType: layers.TCPOptionKindMSS, OptionData: []byte{0x05, 0x78}},
+	}}, 0)
+	client(15*ms, &layers.TCP{ACK: true, Seq: 101, Ack: 501, Window: 1000}, 0)
+	// segment at 201 is seen after the one at 301
+	client(20*ms, &layers.TCP{ACK: true, Seq: 101, Ack: 501, Window: 1000}, 100)
+	client(21*ms, &layers.TCP{ACK: true, Seq: 301, Ack: 501, Window: 1000}, 100)
+	client(22*ms, &layers.TCP{ACK: true, Seq: 201, Ack: 501, Window: 1000}, 100)
+	server(40*ms, &layers.TCP{ACK: true, Seq: 501, Ack: 401, Window: 1000}, 0)
+	// already acknowledged
+	client(50*ms, &layers.TCP{ACK: true, Seq: 101, Ack: 501, Window: 1000}, 100)
+	// two zero window advertisements count as one
+	server(60*ms, &layers.TCP{ACK: true, Seq: 501, Ack: 401, Window: 0}, 0)
+	server(61*ms, &layers.TCP{ACK: true, Seq: 501, Ack: 401, Window: 0}, 0)
+	server(70*ms, &layers.TCP{ACK: true, Seq: 501, Ack: 401, Window: 1000}, 50)
+	client(80*ms, &layers.TCP{ACK: true, Seq: 401, Ack: 551, Window: 1000}, 0)
+	table.Finish(100 * ms)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 100 * ms, Features: []packet_test.FeatureResult{
+			{Name: "_tcpSynRTTNanoseconds", Value: uint64(10 * ms)},
+			{Name: "_tcpSynAckRTTNanoseconds", Value: uint64(5 * ms)},
+			{Name: "_tcpHandshakeRTTNanoseconds", Value: uint64(15 * ms)},
+			{Name: "_tcpForwardMSS", Value: uint16(1460)},
+			{Name: "_tcpBackwardMSS", Value: uint16(1400)},
+			{Name: "_tcpForwardWindowScale", Value: uint8(7)},
+			{Name: "_tcpBackwardWindowScale", Value: nil},
+			{Name: "_tcpForwardRetransmissionCount", Value: uint64(1)},
+			{Name: "_tcpForwardSpuriousRetransmissionCount", Value: uint64(1)},
+			{Name: "_tcpForwardOutOfOrderCount", Value: uint64(1)},
+			{Name: "_tcpForwardLostSegmentCount", Value: uint64(1)},
+			{Name: "_tcpBackwardZeroWindowCount", Value: uint64(1)},
+			{Name: "_tcpForwardZeroWindowCount", Value: uint64(0)},
+			// SYN acknowledged after 10ms, segment at 301 after 19ms
+			{Name: "_tcpForwardRTTMinNanoseconds", Value: uint64(10 * ms)},
+			{Name: "_tcpForwardRTTMeanNanoseconds", Value: uint64(14*ms + ms/2)},
+			{Name: "_tcpForwardRTTMaxNanoseconds", Value: uint64(19 * ms)},
+			// SYN-ACK acknowledged after 5ms, data after 10ms
+			{Name: "_tcpBackwardRTTMinNanoseconds", Value: uint64(5 * ms)},
+			{Name: "_tcpBackwardRTTMeanNanoseconds", Value: uint64(7*ms + ms/2)},
+			{Name: "_tcpBackwardRTTMaxNanoseconds", Value: uint64(10 * ms)},
+		}},
+	})
+}
+
+func TestTCPPerformanceTimestamps(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, []string{
+		"_tcpForwardRTTMinNanoseconds", "_tcpForwardRTTMaxNanoseconds", "_tcpBackwardRTTMinNanoseconds",
+	}, flows.FlowFeature, flows.FlowOptions{})
+	table.EventLayers(0, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 100, Options: []layers.TCPOption{timestampOption(1, 0)}})
+	table.EventLayers(10*ms, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, SYN: true, ACK: true, Seq: 500, Ack: 101, Options: []layers.TCPOption{timestampOption(100, 1)}})
+	table.EventLayers(15*ms, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: 101, Ack: 501, Options: []layers.TCPOption{timestampOption(2, 100)}})
+	// the acknowledgement is delayed, but the timestamp is echoed immediately
+	data := &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: 101, Ack: 501, Options: []layers.TCPOption{timestampOption(3, 100)}}
+	data.Payload = make([]byte, 100)
+	table.EventLayers(20*ms, clientIP, data)
+	table.EventLayers(45*ms, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, ACK: true, Seq: 501, Ack: 101, Options: []layers.TCPOption{timestampOption(101, 3)}})
+	table.EventLayers(90*ms, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, ACK: true, Seq: 501, Ack: 201, Options: []layers.TCPOption{timestampOption(102, 3)}})
+	table.Finish(100 * ms)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 100 * ms, Features: []packet_test.FeatureResult{
+			{Name: "_tcpForwardRTTMinNanoseconds", Value: uint64(10 * ms)},
+			{Name: "_tcpForwardRTTMaxNanoseconds", Value: uint64(25 * ms)},
+			{Name: "_tcpBackwardRTTMinNanoseconds", Value: uint64(5 * ms)},
+		}},
+	})
+}
@@ -0,0 +1,25 @@
+package custom
+
+import (
+	"encoding/gob"
+
+	"github.com/CN-TU/go-flows/flows"
+	ipfix "github.com/CN-TU/go-ipfix"
+)
+
+type _timeoutProfile struct {
+	flows.BaseFeature
+}
+
+func (f *_timeoutProfile) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *_timeoutProfile) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
+func (f *_timeoutProfile) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() == nil {
+		f.SetValue(context.Flow().Timeouts().Name, context, f)
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_timeoutProfile", "name of the timeout profile (see _timeouts in the flow specification) used for the flow", ipfix.StringType, 0, flows.FlowFeature, func() flows.Feature { return &_timeoutProfile{} }, flows.RawPacket)
+}
@@ -0,0 +1,33 @@
+package custom
+
+import (
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+	_ "github.com/CN-TU/go-flows/modules/features/iana"
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/CN-TU/go-flows/packet_test"
+	"github.com/google/gopacket/layers"
+)
+
+func TestTimeoutProfile(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, []string{"_timeoutProfile", "packetTotalCount", "flowEndReason"}, flows.FlowFeature, flows.FlowOptions{
+		IdleTimeout: 100,
+		TimeoutProfiles: []flows.TimeoutProfile{
+			{Name: "dns", ActiveTimeout: 1000, IdleTimeout: 5},
+		},
+		SelectTimeouts: packet.MakeTimeoutSelector([]packet.TimeoutRule{
+			{Ports: []packet.PortRange{{Low: 53, High: 53}}},
+		}),
+	})
+	table.EventLayers(0, &layers.UDP{SrcPort: 1234, DstPort: 53})
+	table.EventLayers(1, &layers.UDP{SrcPort: 1234, DstPort: 80})
+	table.EventLayers(10, &layers.UDP{SrcPort: 1234, DstPort: 53})
+	table.EventLayers(50, &layers.UDP{SrcPort: 1234, DstPort: 80})
+	table.Finish(60)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 10, Features: []packet_test.FeatureResult{{Name: "_timeoutProfile", Value: "dns"}, {Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonIdle)}}},
+		{When: 60, Features: []packet_test.FeatureResult{{Name: "_timeoutProfile", Value: "dns"}, {Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonIdle)}}},
+		{When: 60, Features: []packet_test.FeatureResult{{Name: "_timeoutProfile", Value: "default"}, {Name: "packetTotalCount", Value: uint64(2)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonForcedEnd)}}},
+	})
+}
@@ -1,6 +1,7 @@
 package custom
 
 import (
+	"encoding/gob"
 	"sort"
 
 	"github.com/CN-TU/go-flows/flows"
@@ -301,6 +302,38 @@ func init() {
 
 ////////////////////////////////////////////////////////////////////////////////
 
+type tcpReorderPayload struct {
+	flows.BaseFeature
+	forward  features.TCPPayload
+	backward features.TCPPayload
+}
+
+func (f *tcpReorderPayload) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.forward.Reset()
+	f.backward.Reset()
+}
+
+func (f *tcpReorderPayload) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	tcp, ok := new.(packet.Buffer).TransportLayer().(*layers.TCP)
+	if !ok {
+		return
+	}
+	stream := &f.forward
+	if !context.Forward() {
+		stream = &f.backward
+	}
+	stream.Push(tcp, func(data []byte) {
+		f.SetValue(string(data), context, f)
+	})
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_tcpReorderPayload", "returns the tcp payload of each direction in sequence order without retransmitted data", ipfix.StringType, 0, flows.PacketFeature, func() flows.Feature { return &tcpReorderPayload{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
 type tcpflags struct {
 	flows.BaseFeature
 }
@@ -390,3 +423,45 @@ func init() {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+
+type _tcpConnState struct {
+	flows.BaseFeature
+	tracker packet.TCPTracker
+}
+
+func (f *_tcpConnState) Snapshot(enc *gob.Encoder) error {
+	if err := f.SnapshotValue(enc); err != nil {
+		return err
+	}
+	return f.tracker.Snapshot(enc)
+}
+
+func (f *_tcpConnState) Restore(dec *gob.Decoder) error {
+	if err := f.RestoreValue(dec); err != nil {
+		return err
+	}
+	return f.tracker.Restore(dec)
+}
+
+func (f *_tcpConnState) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.tracker.Reset()
+}
+
+func (f *_tcpConnState) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	tcp := features.GetTCP(new)
+	if tcp == nil {
+		return
+	}
+	f.tracker.Update(tcp, new.(packet.Buffer).PayloadLength(), context.Forward())
+}
+
+func (f *_tcpConnState) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
+	if state := f.tracker.ConnState(); state != "" {
+		f.SetValue(state, context, f)
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_tcpConnState", "final state of the tcp connection like zeek's conn_state (S0, S1, SF, REJ, S2, S3, RSTO, RSTR, RSTOS0, RSTRH, SH, SHR, OTH)", ipfix.StringType, 0, flows.FlowFeature, func() flows.Feature { return &_tcpConnState{} }, flows.RawPacket)
+}
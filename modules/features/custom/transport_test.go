@@ -0,0 +1,80 @@
+package custom
+
+import (
+	"net"
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+	_ "github.com/CN-TU/go-flows/modules/features/control"
+	"github.com/CN-TU/go-flows/packet_test"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	clientIP = &layers.IPv4{SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	serverIP = &layers.IPv4{SrcIP: net.IP{10, 0, 0, 2}, DstIP: net.IP{10, 0, 0, 1}}
+)
+
+func TestTCPConnState(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, []string{"_tcpConnState", "packetTotalCount", "flowEndReason"}, flows.FlowFeature, flows.FlowOptions{
+		TCPTimeouts: flows.TCPTimeouts{Handshake: 5, TimeWait: 10},
+	})
+	// connection attempt without answer ends after the handshake timeout
+	table.EventLayers(0, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 100})
+	// regular connection; the final ACK still belongs to the flow
+	table.EventLayers(20, clientIP, &layers.TCP{SrcPort: 1001, DstPort: 80, SYN: true, Seq: 100})
+	table.EventLayers(21, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1001, SYN: true, ACK: true, Seq: 500, Ack: 101})
+	table.EventLayers(22, clientIP, &layers.TCP{SrcPort: 1001, DstPort: 80, ACK: true, Seq: 101, Ack: 501})
+	table.EventLayers(23, clientIP, &layers.TCP{SrcPort: 1001, DstPort: 80, ACK: true, FIN: true, Seq: 101, Ack: 501})
+	table.EventLayers(24, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1001, ACK: true, FIN: true, Seq: 501, Ack: 102})
+	table.EventLayers(25, clientIP, &layers.TCP{SrcPort: 1001, DstPort: 80, ACK: true, Seq: 102, Ack: 502})
+	table.EventLayers(30, clientIP, &layers.TCP{SrcPort: 1001, DstPort: 80, ACK: true, Seq: 102, Ack: 502})
+	// rejected connection ends immediately
+	table.EventLayers(40, clientIP, &layers.TCP{SrcPort: 1002, DstPort: 80, SYN: true, Seq: 100})
+	table.EventLayers(41, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1002, RST: true, ACK: true, Ack: 101})
+	table.Finish(100)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 41, Features: []packet_test.FeatureResult{{Name: "_tcpConnState", Value: "REJ"}, {Name: "packetTotalCount", Value: uint64(2)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonEnd)}}},
+		{When: 100, Features: []packet_test.FeatureResult{{Name: "_tcpConnState", Value: "S0"}, {Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonIdle)}}},
+		{When: 100, Features: []packet_test.FeatureResult{{Name: "_tcpConnState", Value: "SF"}, {Name: "packetTotalCount", Value: uint64(7)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonEnd)}}},
+	})
+}
+
+func TestTCPConnStatePortReuse(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, []string{"_tcpConnState", "packetTotalCount", "flowEndReason"}, flows.FlowFeature, flows.FlowOptions{
+		TCPTimeouts: flows.TCPTimeouts{TimeWait: 10},
+	})
+	table.EventLayers(0, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 100})
+	table.EventLayers(1, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, SYN: true, ACK: true, Seq: 500, Ack: 101})
+	table.EventLayers(2, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: 101, Ack: 501})
+	table.EventLayers(3, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, FIN: true, Seq: 101, Ack: 501})
+	table.EventLayers(4, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, ACK: true, FIN: true, Seq: 501, Ack: 102})
+	table.EventLayers(5, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: 102, Ack: 502})
+	// new connection on the same ports during time wait
+	table.EventLayers(7, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 90000})
+	table.EventLayers(8, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, SYN: true, ACK: true, Seq: 7000, Ack: 90001})
+	table.EventLayers(9, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: 90001, Ack: 7001})
+	table.Finish(100)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 7, Features: []packet_test.FeatureResult{{Name: "_tcpConnState", Value: "SF"}, {Name: "packetTotalCount", Value: uint64(6)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonEnd)}}},
+		{When: 100, Features: []packet_test.FeatureResult{{Name: "_tcpConnState", Value: "S1"}, {Name: "packetTotalCount", Value: uint64(3)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonForcedEnd)}}},
+	})
+}
+
+func TestTCPConnStateRestart(t *testing.T) {
+	table := packet_test.MakeControlFeatureTest(t, []string{"_tcpConnState", "packetTotalCount", "flowEndReason"}, []interface{}{"restartOnNewSYN"}, flows.FlowOptions{})
+	table.EventLayers(0, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 100})
+	table.EventLayers(1, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, SYN: true, ACK: true, Seq: 500, Ack: 101})
+	table.EventLayers(2, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, FIN: true, Seq: 101, Ack: 501})
+	// the restarted record must not inherit the FIN of the old connection
+	table.EventLayers(3, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, SYN: true, Seq: 90000})
+	table.EventLayers(4, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, SYN: true, ACK: true, Seq: 7000, Ack: 90001})
+	table.EventLayers(5, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: 90001, Ack: 7001})
+	table.EventLayers(6, serverIP, &layers.TCP{SrcPort: 80, DstPort: 1000, ACK: true, FIN: true, Seq: 7001, Ack: 90001})
+	table.EventLayers(7, clientIP, &layers.TCP{SrcPort: 1000, DstPort: 80, ACK: true, Seq: 90001, Ack: 7002})
+	table.Finish(100)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 3, Features: []packet_test.FeatureResult{{Name: "_tcpConnState", Value: "S2"}, {Name: "packetTotalCount", Value: uint64(3)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonEnd)}}},
+		{When: 100, Features: []packet_test.FeatureResult{{Name: "_tcpConnState", Value: "S3"}, {Name: "packetTotalCount", Value: uint64(5)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonForcedEnd)}}},
+	})
+}
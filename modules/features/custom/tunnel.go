@@ -0,0 +1,209 @@
+package custom
+
+import (
+	"net"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/packet"
+	ipfix "github.com/CN-TU/go-ipfix"
+	"github.com/google/gopacket/layers"
+)
+
+var tunnelSourceIPAddress = []ipfix.InformationElement{
+	ipfix.NewInformationElement("_tunnelSourceIPv4Address", 0, 0, ipfix.Ipv4AddressType, 4),
+	ipfix.NewInformationElement("_tunnelSourceIPv6Address", 0, 0, ipfix.Ipv6AddressType, 16),
+}
+
+var tunnelDestinationIPAddress = []ipfix.InformationElement{
+	ipfix.NewInformationElement("_tunnelDestinationIPv4Address", 0, 0, ipfix.Ipv4AddressType, 4),
+	ipfix.NewInformationElement("_tunnelDestinationIPv6Address", 0, 0, ipfix.Ipv6AddressType, 16),
+}
+
+func ipVariant(val interface{}) int {
+	if val == nil || len(val.(net.IP)) == 4 {
+		return 0
+	}
+	return 1
+}
+
+type tunnelSourceIPAddressFlow struct {
+	flows.BaseFeature
+}
+
+func (f *tunnelSourceIPAddressFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() == nil {
+		network := new.(packet.Buffer).OuterNetworkLayer()
+		if network != nil {
+			f.SetValue(net.IP(network.NetworkFlow().Src().Raw()), context, f)
+		}
+	}
+}
+
+func (f *tunnelSourceIPAddressFlow) Variant() int {
+	return ipVariant(f.Value())
+}
+
+func init() {
+	flows.RegisterVariantFeature("_tunnelSourceIPAddress", "source address of the outer network layer of decapsulated packets", tunnelSourceIPAddress, flows.FlowFeature, func() flows.Feature { return &tunnelSourceIPAddressFlow{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type tunnelSourceIPAddressPacket struct {
+	flows.BaseFeature
+}
+
+func (f *tunnelSourceIPAddressPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	network := new.(packet.Buffer).OuterNetworkLayer()
+	if network != nil {
+		f.SetValue(net.IP(network.NetworkFlow().Src().Raw()), context, f)
+	}
+}
+
+func (f *tunnelSourceIPAddressPacket) Variant() int {
+	return ipVariant(f.Value())
+}
+
+func init() {
+	flows.RegisterVariantFeature("_tunnelSourceIPAddress", "source address of the outer network layer of decapsulated packets", tunnelSourceIPAddress, flows.PacketFeature, func() flows.Feature { return &tunnelSourceIPAddressPacket{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type tunnelDestinationIPAddressFlow struct {
+	flows.BaseFeature
+}
+
+func (f *tunnelDestinationIPAddressFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() == nil {
+		network := new.(packet.Buffer).OuterNetworkLayer()
+		if network != nil {
+			f.SetValue(net.IP(network.NetworkFlow().Dst().Raw()), context, f)
+		}
+	}
+}
+
+func (f *tunnelDestinationIPAddressFlow) Variant() int {
+	return ipVariant(f.Value())
+}
+
+func init() {
+	flows.RegisterVariantFeature("_tunnelDestinationIPAddress", "destination address of the outer network layer of decapsulated packets", tunnelDestinationIPAddress, flows.FlowFeature, func() flows.Feature { return &tunnelDestinationIPAddressFlow{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type tunnelDestinationIPAddressPacket struct {
+	flows.BaseFeature
+}
+
+func (f *tunnelDestinationIPAddressPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	network := new.(packet.Buffer).OuterNetworkLayer()
+	if network != nil {
+		f.SetValue(net.IP(network.NetworkFlow().Dst().Raw()), context, f)
+	}
+}
+
+func (f *tunnelDestinationIPAddressPacket) Variant() int {
+	return ipVariant(f.Value())
+}
+
+func init() {
+	flows.RegisterVariantFeature("_tunnelDestinationIPAddress", "destination address of the outer network layer of decapsulated packets", tunnelDestinationIPAddress, flows.PacketFeature, func() flows.Feature { return &tunnelDestinationIPAddressPacket{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// tunnelID returns the VNI (VXLAN, GENEVE) or key (GRE) of the packet, and true if the packet has a tunnel id
+func tunnelID(buffer packet.Buffer) (uint32, bool) {
+	switch tunnel := buffer.TunnelLayer().(type) {
+	case *layers.VXLAN:
+		return tunnel.VNI, true
+	case *layers.Geneve:
+		return tunnel.VNI, true
+	case *layers.GRE:
+		return tunnel.Key, tunnel.KeyPresent
+	}
+	return 0, false
+}
+
+type tunnelIDFlow struct {
+	flows.BaseFeature
+}
+
+func (f *tunnelIDFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() == nil {
+		if id, ok := tunnelID(new.(packet.Buffer)); ok {
+			f.SetValue(id, context, f)
+		}
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_tunnelID", "VNI (VXLAN, GENEVE) or key (GRE) of decapsulated packets", ipfix.Unsigned32Type, 0, flows.FlowFeature, func() flows.Feature { return &tunnelIDFlow{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type tunnelIDPacket struct {
+	flows.BaseFeature
+}
+
+func (f *tunnelIDPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if id, ok := tunnelID(new.(packet.Buffer)); ok {
+		f.SetValue(id, context, f)
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_tunnelID", "VNI (VXLAN, GENEVE) or key (GRE) of decapsulated packets", ipfix.Unsigned32Type, 0, flows.PacketFeature, func() flows.Feature { return &tunnelIDPacket{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func tunnelType(buffer packet.Buffer) string {
+	if buffer.OuterNetworkLayer() == nil {
+		return ""
+	}
+	switch buffer.TunnelLayer().(type) {
+	case *layers.VXLAN:
+		return "vxlan"
+	case *layers.Geneve:
+		return "geneve"
+	case *layers.GRE:
+		return "gre"
+	}
+	return "ipip"
+}
+
+type tunnelTypeFlow struct {
+	flows.BaseFeature
+}
+
+func (f *tunnelTypeFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() == nil {
+		if t := tunnelType(new.(packet.Buffer)); t != "" {
+			f.SetValue(t, context, f)
+		}
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_tunnelType", "tunnel protocol of decapsulated packets (gre, vxlan, geneve, or ipip)", ipfix.StringType, 0, flows.FlowFeature, func() flows.Feature { return &tunnelTypeFlow{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type tunnelTypePacket struct {
+	flows.BaseFeature
+}
+
+func (f *tunnelTypePacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if t := tunnelType(new.(packet.Buffer)); t != "" {
+		f.SetValue(t, context, f)
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_tunnelType", "tunnel protocol of decapsulated packets (gre, vxlan, geneve, or ipip)", ipfix.StringType, 0, flows.PacketFeature, func() flows.Feature { return &tunnelTypePacket{} }, flows.RawPacket)
+}
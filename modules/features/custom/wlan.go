@@ -0,0 +1,93 @@
+package custom
+
+import (
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/packet"
+	ipfix "github.com/CN-TU/go-ipfix"
+	"github.com/google/gopacket/layers"
+)
+
+func radiotapLayer(new interface{}) *packet.RadioTap {
+	radiotap, _ := new.(packet.Buffer).Layer(layers.LayerTypeRadioTap).(*packet.RadioTap)
+	return radiotap
+}
+
+type wlanFrameType struct {
+	flows.BaseFeature
+}
+
+func (f *wlanFrameType) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if dot11, ok := new.(packet.Buffer).LinkLayer().(*packet.Dot11); ok {
+		f.SetValue(uint8(dot11.Type), context, f)
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_wlanFrameType", "802.11 frame type and subtype (subtype << 2 | type)", ipfix.Unsigned8Type, 0, flows.PacketFeature, func() flows.Feature { return &wlanFrameType{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type wlanSignal struct {
+	flows.BaseFeature
+}
+
+func (f *wlanSignal) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if radiotap := radiotapLayer(new); radiotap != nil && radiotap.Present.DBMAntennaSignal() {
+		f.SetValue(radiotap.DBMAntennaSignal, context, f)
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_wlanSignal", "received signal strength (RSSI) in dBm from the radiotap header", ipfix.Signed8Type, 0, flows.PacketFeature, func() flows.Feature { return &wlanSignal{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type wlanNoise struct {
+	flows.BaseFeature
+}
+
+func (f *wlanNoise) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if radiotap := radiotapLayer(new); radiotap != nil && radiotap.Present.DBMAntennaNoise() {
+		f.SetValue(radiotap.DBMAntennaNoise, context, f)
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_wlanNoise", "noise level in dBm from the radiotap header", ipfix.Signed8Type, 0, flows.PacketFeature, func() flows.Feature { return &wlanNoise{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type wlanRate struct {
+	flows.BaseFeature
+}
+
+func (f *wlanRate) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if radiotap := radiotapLayer(new); radiotap != nil && radiotap.Present.Rate() {
+		f.SetValue(uint32(radiotap.Rate)*500, context, f)
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_wlanRate", "legacy data rate in kbit/s from the radiotap header", ipfix.Unsigned32Type, 0, flows.PacketFeature, func() flows.Feature { return &wlanRate{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type wlanChannelFrequency struct {
+	flows.BaseFeature
+}
+
+func (f *wlanChannelFrequency) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() == nil {
+		if radiotap := radiotapLayer(new); radiotap != nil && radiotap.Present.Channel() {
+			f.SetValue(uint16(radiotap.ChannelFrequency), context, f)
+		}
+	}
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("_wlanChannelFrequency", "channel frequency in MHz from the radiotap header of the first packet", ipfix.Unsigned16Type, 0, flows.FlowFeature, func() flows.Feature { return &wlanChannelFrequency{} }, flows.RawPacket)
+}
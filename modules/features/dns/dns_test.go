@@ -0,0 +1,146 @@
+package dns
+
+import (
+	"net"
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+	_ "github.com/CN-TU/go-flows/modules/features/operations"
+	"github.com/CN-TU/go-flows/packet_test"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	clientIP = &layers.IPv4{SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	serverIP = &layers.IPv4{SrcIP: net.IP{10, 0, 0, 2}, DstIP: net.IP{10, 0, 0, 1}}
+)
+
+func serialize(t *testing.T, msg *layers.DNS) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	if err := msg.SerializeTo(buf, gopacket.SerializeOptions{FixLengths: true}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeQuery(t *testing.T, id uint16) []byte {
+	return serialize(t, &layers.DNS{
+		ID: id,
+		RD: true,
+		Questions: []layers.DNSQuestion{
+			{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+		},
+	})
+}
+
+func makeResponse(t *testing.T, id uint16, tc bool) []byte {
+	return serialize(t, &layers.DNS{
+		ID: id,
+		QR: true,
+		RD: true,
+		RA: true,
+		TC: tc,
+		Questions: []layers.DNSQuestion{
+			{Name: []byte("example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN},
+		},
+		Answers: []layers.DNSResourceRecord{
+			{Name: []byte("example.com"), Type: layers.DNSTypeCNAME, Class: layers.DNSClassIN, TTL: 300, CNAME: []byte("www.example.com")},
+			{Name: []byte("www.example.com"), Type: layers.DNSTypeA, Class: layers.DNSClassIN, TTL: 60, IP: net.IP{93, 184, 216, 34}},
+		},
+	})
+}
+
+var flowFeatures = []string{
+	"_dnsQueryCount", "_dnsResponseCount", "_dnsFirstQueryName", "_dnsFirstQueryType", "_dnsFirstResponseCode",
+	"_dnsTotalAnswerCount", "_dnsMinAnswerTTL", "_dnsAnyTruncated",
+}
+
+func expectedFlow(truncated bool) []packet_test.FeatureResult {
+	return []packet_test.FeatureResult{
+		{Name: "_dnsQueryCount", Value: uint64(1)},
+		{Name: "_dnsResponseCount", Value: uint64(1)},
+		{Name: "_dnsFirstQueryName", Value: "example.com"},
+		{Name: "_dnsFirstQueryType", Value: uint16(layers.DNSTypeA)},
+		{Name: "_dnsFirstResponseCode", Value: uint8(layers.DNSResponseCodeNoErr)},
+		{Name: "_dnsTotalAnswerCount", Value: uint64(2)},
+		{Name: "_dnsMinAnswerTTL", Value: uint32(60)},
+		{Name: "_dnsAnyTruncated", Value: truncated},
+	}
+}
+
+func TestDNSUDP(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, flowFeatures, flows.FlowFeature, flows.FlowOptions{})
+	table.EventLayers(0, clientIP, &layers.UDP{SrcPort: 4321, DstPort: 53, BaseLayer: layers.BaseLayer{Payload: makeQuery(t, 1)}})
+	table.EventLayers(1, serverIP, &layers.UDP{SrcPort: 53, DstPort: 4321, BaseLayer: layers.BaseLayer{Payload: makeResponse(t, 1, true)}})
+	table.Finish(2)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 2, Features: expectedFlow(true)},
+	})
+}
+
+func TestDNSUDPOtherPort(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, flowFeatures, flows.FlowFeature, flows.FlowOptions{})
+	table.EventLayers(0, clientIP, &layers.UDP{SrcPort: 4321, DstPort: 1234, BaseLayer: layers.BaseLayer{Payload: makeQuery(t, 1)}})
+	table.Finish(1)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 1, Features: []packet_test.FeatureResult{
+			{Name: "_dnsQueryCount", Value: uint64(0)},
+			{Name: "_dnsResponseCount", Value: uint64(0)},
+			{Name: "_dnsFirstQueryName", Value: nil},
+			{Name: "_dnsFirstQueryType", Value: nil},
+			{Name: "_dnsFirstResponseCode", Value: nil},
+			{Name: "_dnsTotalAnswerCount", Value: uint64(0)},
+			{Name: "_dnsMinAnswerTTL", Value: nil},
+			{Name: "_dnsAnyTruncated", Value: false},
+		}},
+	})
+}
+
+func TestDNSTCP(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, flowFeatures, flows.FlowFeature, flows.FlowOptions{})
+	// length prefixed messages; the query is split in two segments, which arrive swapped, the response is retransmitted
+	q := makeQuery(t, 2)
+	q = append([]byte{byte(len(q) >> 8), byte(len(q))}, q...)
+	r := makeResponse(t, 2, false)
+	r = append([]byte{byte(len(r) >> 8), byte(len(r))}, r...)
+	table.EventLayers(0, clientIP, &layers.TCP{SrcPort: 4321, DstPort: 53, SYN: true, Seq: 99})
+	table.EventLayers(0, serverIP, &layers.TCP{SrcPort: 53, DstPort: 4321, SYN: true, ACK: true, Seq: 499, Ack: 100})
+	table.EventLayers(1, clientIP, &layers.TCP{SrcPort: 4321, DstPort: 53, ACK: true, Seq: 105, BaseLayer: layers.BaseLayer{Payload: q[5:]}})
+	table.EventLayers(1, clientIP, &layers.TCP{SrcPort: 4321, DstPort: 53, ACK: true, Seq: 100, BaseLayer: layers.BaseLayer{Payload: q[:5]}})
+	table.EventLayers(2, serverIP, &layers.TCP{SrcPort: 53, DstPort: 4321, ACK: true, Seq: 500, BaseLayer: layers.BaseLayer{Payload: r}})
+	table.EventLayers(3, serverIP, &layers.TCP{SrcPort: 53, DstPort: 4321, ACK: true, Seq: 500, BaseLayer: layers.BaseLayer{Payload: r}})
+	table.Finish(4)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 4, Features: expectedFlow(false)},
+	})
+}
+
+func TestDNSPacketFeatures(t *testing.T) {
+	for _, test := range []struct {
+		feature string
+		value   []interface{}
+	}{
+		{"_dnsQueryName", []interface{}{"example.com", "example.com"}},
+		{"_dnsQueryType", []interface{}{uint16(layers.DNSTypeA), uint16(layers.DNSTypeA)}},
+		{"_dnsIsResponse", []interface{}{false, true}},
+		{"_dnsResponseCode", []interface{}{uint8(layers.DNSResponseCodeNoErr)}},
+		{"_dnsAnswerCount", []interface{}{uint16(2)}},
+		{"_dnsTruncated", []interface{}{false}},
+		{"_dnsAnswer", []interface{}{"www.example.com", "93.184.216.34"}},
+		{"_dnsAnswerType", []interface{}{uint16(layers.DNSTypeCNAME), uint16(layers.DNSTypeA)}},
+		{"_dnsAnswerTTL", []interface{}{uint32(300), uint32(60)}},
+	} {
+		t.Run(test.feature, func(t *testing.T) {
+			table := packet_test.MakeSpecFeatureTest(t, []interface{}{
+				[]interface{}{"accumulate", test.feature},
+			}, flows.FlowOptions{})
+			table.EventLayers(0, clientIP, &layers.UDP{SrcPort: 4321, DstPort: 53, BaseLayer: layers.BaseLayer{Payload: makeQuery(t, 3)}})
+			table.EventLayers(1, serverIP, &layers.UDP{SrcPort: 53, DstPort: 4321, BaseLayer: layers.BaseLayer{Payload: makeResponse(t, 3, false)}})
+			table.Finish(2)
+			table.AssertFeatureList([]packet_test.FeatureLine{
+				{When: 2, Features: []packet_test.FeatureResult{{Name: "accumulate(" + test.feature + ")", Value: test.value}}},
+			})
+		})
+	}
+}
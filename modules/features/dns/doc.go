@@ -0,0 +1,11 @@
+// Package dns contains features extracted from DNS messages.
+//
+// Messages are parsed from udp and tcp (length prefixed) payloads, if one of the ports is 53 (or 5353 for mDNS over
+// udp). Per-packet features (e.g. _dnsQueryName) are only emitted for packets containing a DNS message and can be
+// combined with operations like accumulate, set, distinct, or mode. Per-record features (_dnsAnswer, _dnsAnswerTTL,
+// _dnsAnswerType) emit one value per answer record. The flow features (e.g. _dnsQueryCount) summarize all messages of
+// a flow.
+//
+// For tcp, the payload is reassembled like _tcpReorderPayload of the custom feature module does: segments are put in
+// sequence order and retransmitted data is skipped.
+package dns
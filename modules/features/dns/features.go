@@ -0,0 +1,223 @@
+package dns
+
+import (
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/packet"
+	ipfix "github.com/CN-TU/go-ipfix"
+	"github.com/google/gopacket/layers"
+)
+
+// dnsMessage emits every DNS message (*layers.DNS) of both directions
+type dnsMessage struct {
+	flows.BaseFeature
+	forward, backward stream
+}
+
+func (f *dnsMessage) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.forward.reset()
+	f.backward.reset()
+}
+
+func (f *dnsMessage) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	buffer := new.(packet.Buffer)
+	switch transport := buffer.TransportLayer().(type) {
+	case *layers.UDP:
+		if !isDNSPort(transport.SrcPort, transport.DstPort, portDNS) && !isDNSPort(transport.SrcPort, transport.DstPort, portMDNS) {
+			return
+		}
+		if msg := decode(transport.LayerPayload()); msg != nil {
+			f.SetValue(msg, context, f)
+		}
+	case *layers.TCP:
+		if !isDNSPort(layers.UDPPort(transport.SrcPort), layers.UDPPort(transport.DstPort), portDNS) {
+			return
+		}
+		s := &f.forward
+		if !context.Forward() {
+			s = &f.backward
+		}
+		s.push(transport, func(data []byte) {
+			if msg := decode(data); msg != nil {
+				f.SetValue(msg, context, f)
+			}
+		})
+	}
+}
+
+func isDNSPort(src, dst layers.UDPPort, port layers.UDPPort) bool {
+	return src == port || dst == port
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("__dnsMessage", "parsed dns messages", ipfix.OctetArrayType, 0, flows.PacketFeature, func() flows.Feature { return &dnsMessage{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// dnsField is a packet feature, which emits the value computed by get from every DNS message
+type dnsField struct {
+	flows.BaseFeature
+	get func(*layers.DNS) interface{}
+}
+
+func (f *dnsField) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if value := f.get(new.(*layers.DNS)); value != nil {
+		f.SetValue(value, context, f)
+	}
+}
+
+// registerDNSFeature registers name as a packet feature computed by get from __dnsMessage. get must return nil, if the
+// message doesn't contain the field.
+func registerDNSFeature(name, description string, t ipfix.Type, get func(*layers.DNS) interface{}) {
+	flows.RegisterTemporaryFeature("_"+name, description, t, 0, flows.PacketFeature, func() flows.Feature { return &dnsField{get: get} }, flows.PacketFeature)
+	flows.RegisterTemporaryCompositeFeature(name, description, t, 0, "_"+name, "__dnsMessage")
+}
+
+// dnsRecordField is a packet feature, which emits the value computed by get for every answer record
+type dnsRecordField struct {
+	flows.BaseFeature
+	get func(*layers.DNSResourceRecord) interface{}
+}
+
+func (f *dnsRecordField) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	msg := new.(*layers.DNS)
+	for i := range msg.Answers {
+		f.SetValue(f.get(&msg.Answers[i]), context, f)
+	}
+}
+
+// registerDNSRecordFeature registers name as a packet feature computed by get from every answer record of __dnsMessage
+func registerDNSRecordFeature(name, description string, t ipfix.Type, get func(*layers.DNSResourceRecord) interface{}) {
+	flows.RegisterTemporaryFeature("_"+name, description, t, 0, flows.PacketFeature, func() flows.Feature { return &dnsRecordField{get: get} }, flows.PacketFeature)
+	flows.RegisterTemporaryCompositeFeature(name, description, t, 0, "_"+name, "__dnsMessage")
+}
+
+func query(get func(*layers.DNSQuestion) interface{}) func(*layers.DNS) interface{} {
+	return func(msg *layers.DNS) interface{} {
+		if len(msg.Questions) == 0 {
+			return nil
+		}
+		return get(&msg.Questions[0])
+	}
+}
+
+func response(get func(*layers.DNS) interface{}) func(*layers.DNS) interface{} {
+	return func(msg *layers.DNS) interface{} {
+		if !msg.QR {
+			return nil
+		}
+		return get(msg)
+	}
+}
+
+func init() {
+	registerDNSFeature("_dnsID", "transaction id of the dns message", ipfix.Unsigned16Type,
+		func(msg *layers.DNS) interface{} { return msg.ID })
+	registerDNSFeature("_dnsIsResponse", "true if the dns message is a response", ipfix.BooleanType,
+		func(msg *layers.DNS) interface{} { return msg.QR })
+	registerDNSFeature("_dnsQueryName", "name of the first question of the dns message", ipfix.StringType,
+		query(func(q *layers.DNSQuestion) interface{} { return string(q.Name) }))
+	registerDNSFeature("_dnsQueryType", "type of the first question of the dns message (e.g. 1 for A)", ipfix.Unsigned16Type,
+		query(func(q *layers.DNSQuestion) interface{} { return uint16(q.Type) }))
+	registerDNSFeature("_dnsResponseCode", "response code of the dns response (e.g. 3 for NXDOMAIN)", ipfix.Unsigned8Type,
+		response(func(msg *layers.DNS) interface{} { return uint8(msg.ResponseCode) }))
+	registerDNSFeature("_dnsAnswerCount", "number of answer records of the dns response", ipfix.Unsigned16Type,
+		response(func(msg *layers.DNS) interface{} { return msg.ANCount }))
+	registerDNSFeature("_dnsTruncated", "true if the dns response is truncated", ipfix.BooleanType,
+		response(func(msg *layers.DNS) interface{} { return msg.TC }))
+
+	registerDNSRecordFeature("_dnsAnswer", "data of every answer record (e.g. the address for A records)", ipfix.StringType,
+		func(rr *layers.DNSResourceRecord) interface{} { return recordData(rr) })
+	registerDNSRecordFeature("_dnsAnswerType", "type of every answer record", ipfix.Unsigned16Type,
+		func(rr *layers.DNSResourceRecord) interface{} { return uint16(rr.Type) })
+	registerDNSRecordFeature("_dnsAnswerTTL", "ttl of every answer record", ipfix.Unsigned32Type,
+		func(rr *layers.DNSResourceRecord) interface{} { return rr.TTL })
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// dnsFlowField is a flow feature, which combines the current value with every DNS message using fold. fold must return
+// nil, if the value doesn't change.
+type dnsFlowField struct {
+	flows.BaseFeature
+	initial interface{}
+	fold    func(value interface{}, msg *layers.DNS) interface{}
+}
+
+func (f *dnsFlowField) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	if f.initial != nil {
+		f.SetValue(f.initial, context, f)
+	}
+}
+
+func (f *dnsFlowField) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if value := f.fold(f.Value(), new.(*layers.DNS)); value != nil {
+		f.SetValue(value, context, f)
+	}
+}
+
+// registerDNSFlowFeature registers name as a flow feature computed by fold from __dnsMessage, starting with initial
+func registerDNSFlowFeature(name, description string, t ipfix.Type, initial interface{}, fold func(interface{}, *layers.DNS) interface{}) {
+	flows.RegisterTemporaryFeature("_"+name, description, t, 0, flows.FlowFeature, func() flows.Feature { return &dnsFlowField{initial: initial, fold: fold} }, flows.PacketFeature)
+	flows.RegisterTemporaryCompositeFeature(name, description, t, 0, "_"+name, "__dnsMessage")
+}
+
+// first returns a fold function, which keeps the first non nil value of get
+func first(get func(*layers.DNS) interface{}) func(interface{}, *layers.DNS) interface{} {
+	return func(value interface{}, msg *layers.DNS) interface{} {
+		if value != nil {
+			return nil
+		}
+		return get(msg)
+	}
+}
+
+func init() {
+	registerDNSFlowFeature("_dnsQueryCount", "number of dns queries in the flow", ipfix.Unsigned64Type, uint64(0),
+		func(value interface{}, msg *layers.DNS) interface{} {
+			if msg.QR {
+				return nil
+			}
+			return value.(uint64) + 1
+		})
+	registerDNSFlowFeature("_dnsResponseCount", "number of dns responses in the flow", ipfix.Unsigned64Type, uint64(0),
+		func(value interface{}, msg *layers.DNS) interface{} {
+			if !msg.QR {
+				return nil
+			}
+			return value.(uint64) + 1
+		})
+	registerDNSFlowFeature("_dnsFirstQueryName", "name of the first question in the flow", ipfix.StringType, nil,
+		first(query(func(q *layers.DNSQuestion) interface{} { return string(q.Name) })))
+	registerDNSFlowFeature("_dnsFirstQueryType", "type of the first question in the flow", ipfix.Unsigned16Type, nil,
+		first(query(func(q *layers.DNSQuestion) interface{} { return uint16(q.Type) })))
+	registerDNSFlowFeature("_dnsFirstResponseCode", "response code of the first dns response in the flow", ipfix.Unsigned8Type, nil,
+		first(response(func(msg *layers.DNS) interface{} { return uint8(msg.ResponseCode) })))
+	registerDNSFlowFeature("_dnsTotalAnswerCount", "number of answer records of all dns responses in the flow", ipfix.Unsigned64Type, uint64(0),
+		func(value interface{}, msg *layers.DNS) interface{} {
+			if !msg.QR || msg.ANCount == 0 {
+				return nil
+			}
+			return value.(uint64) + uint64(msg.ANCount)
+		})
+	registerDNSFlowFeature("_dnsMinAnswerTTL", "smallest ttl of all answer records in the flow", ipfix.Unsigned32Type, nil,
+		func(value interface{}, msg *layers.DNS) interface{} {
+			var ret interface{}
+			for _, rr := range msg.Answers {
+				if value == nil || rr.TTL < value.(uint32) {
+					value = rr.TTL
+					ret = value
+				}
+			}
+			return ret
+		})
+	registerDNSFlowFeature("_dnsAnyTruncated", "true if any dns response in the flow is truncated", ipfix.BooleanType, false,
+		func(value interface{}, msg *layers.DNS) interface{} {
+			if msg.QR && msg.TC && !value.(bool) {
+				return true
+			}
+			return nil
+		})
+}
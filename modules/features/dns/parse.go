@@ -0,0 +1,87 @@
+package dns
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+
+	"github.com/CN-TU/go-flows/modules/features"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	portDNS  = 53
+	portMDNS = 5353
+)
+
+// decode returns the DNS message contained in data or nil if data isn't a valid message
+func decode(data []byte) *layers.DNS {
+	msg := &layers.DNS{}
+	if err := msg.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+		return nil
+	}
+	return msg
+}
+
+// recordData returns the decoded data of a resource record as string
+func recordData(rr *layers.DNSResourceRecord) string {
+	switch rr.Type {
+	case layers.DNSTypeA, layers.DNSTypeAAAA:
+		return rr.IP.String()
+	case layers.DNSTypeNS:
+		return string(rr.NS)
+	case layers.DNSTypeCNAME:
+		return string(rr.CNAME)
+	case layers.DNSTypePTR:
+		return string(rr.PTR)
+	case layers.DNSTypeMX:
+		return strconv.Itoa(int(rr.MX.Preference)) + " " + string(rr.MX.Name)
+	case layers.DNSTypeSRV:
+		return strings.Join([]string{
+			strconv.Itoa(int(rr.SRV.Priority)),
+			strconv.Itoa(int(rr.SRV.Weight)),
+			strconv.Itoa(int(rr.SRV.Port)),
+			string(rr.SRV.Name),
+		}, " ")
+	case layers.DNSTypeSOA:
+		return string(rr.SOA.MName) + " " + string(rr.SOA.RName)
+	case layers.DNSTypeTXT:
+		txts := make([]string, len(rr.TXTs))
+		for i, txt := range rr.TXTs {
+			txts[i] = string(txt)
+		}
+		return strings.Join(txts, " ")
+	}
+	return ""
+}
+
+// stream collects the length prefixed DNS messages of one direction from the tcp payload
+type stream struct {
+	payload features.TCPPayload
+	data    []byte // unparsed data
+}
+
+func (s *stream) reset() {
+	s.payload.Reset()
+	s.data = nil
+}
+
+// push adds a tcp segment and calls message for every complete DNS message
+func (s *stream) push(tcp *layers.TCP, message func(data []byte)) {
+	s.payload.Push(tcp, func(payload []byte) {
+		s.data = append(s.data, payload...)
+	})
+	for len(s.data) >= 2 {
+		length := int(binary.BigEndian.Uint16(s.data))
+		if len(s.data) < 2+length {
+			break
+		}
+		message(s.data[2 : 2+length])
+		s.data = s.data[2+length:]
+	}
+	if len(s.data) == 0 {
+		// don't keep the backing array around between messages
+		s.data = nil
+	}
+}
@@ -7,6 +7,8 @@ Features are split according to
  * operations: features that carry out operations (https://nta-meta-analysis.readthedocs.io/en/latest/features.html)
  * custom: features that don't fit the above categories
  * staging: experimental features
+ * dns: features from dns messages
+ * tls: features from the tls handshake
 
 And inside those directories into the layer or general.
 
@@ -1,9 +1,12 @@
 package iana
 
 import (
+	"errors"
 	"net"
 	"testing"
 
+	"github.com/CN-TU/go-flows/flows"
+	_ "github.com/CN-TU/go-flows/modules/features/operations"
 	"github.com/CN-TU/go-flows/packet"
 	"github.com/CN-TU/go-flows/packet_test"
 	"github.com/google/gopacket/layers"
@@ -95,3 +98,152 @@ func TestDestinationIPAddress(t *testing.T) {
 		{When: 0, Features: []packet_test.FeatureResult{{Name: "destinationIPv6Address", Value: net.IP{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}}}},
 	})
 }
+
+func TestResumeIdleTimeout(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, []string{"packetTotalCount", "flowEndReason"}, flows.FlowFeature, flows.FlowOptions{IdleTimeout: 10})
+	table.EventLayers(0, &layers.UDP{SrcPort: 80, DstPort: 80})
+	table.EventLayers(5, &layers.UDP{SrcPort: 80, DstPort: 81})
+	table.EventLayers(6, &layers.UDP{SrcPort: 80, DstPort: 80})
+	table.Resume(7)
+	table.EventLayers(12, &layers.UDP{SrcPort: 80, DstPort: 80})
+	table.EventLayers(20, &layers.UDP{SrcPort: 80, DstPort: 81})
+	table.Finish(30)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 20, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonIdle)}}},
+		{When: 30, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(3)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonIdle)}}},
+		{When: 30, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonForcedEnd)}}},
+	})
+}
+
+func TestResumeTimeoutProfile(t *testing.T) {
+	table := packet_test.MakeFeatureTest(t, []string{"packetTotalCount", "flowEndReason"}, flows.FlowFeature, flows.FlowOptions{
+		IdleTimeout:     100,
+		TimeoutProfiles: []flows.TimeoutProfile{{Name: "dns", IdleTimeout: 10}},
+		SelectTimeouts:  packet.MakeTimeoutSelector([]packet.TimeoutRule{{Ports: []packet.PortRange{{Low: 53, High: 53}}}}),
+	})
+	table.EventLayers(0, &layers.UDP{SrcPort: 1234, DstPort: 53})
+	table.EventLayers(5, &layers.UDP{SrcPort: 80, DstPort: 80})
+	table.EventLayers(6, &layers.UDP{SrcPort: 1234, DstPort: 53})
+	table.Resume(7)
+	table.EventLayers(12, &layers.UDP{SrcPort: 1234, DstPort: 53})
+	table.EventLayers(30, &layers.UDP{SrcPort: 1234, DstPort: 53})
+	table.Finish(50)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 30, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(3)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonIdle)}}},
+		{When: 50, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonIdle)}}},
+		{When: 50, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonForcedEnd)}}},
+	})
+}
+
+// failingWriter fails after the given number of writes
+type failingWriter int
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if *w == 0 {
+		return 0, errors.New("disk full")
+	}
+	*w--
+	return len(p), nil
+}
+
+func TestCheckpointFailure(t *testing.T) {
+	failedCommit := func() error { return errors.New("rename failed") }
+	for writes := 0; writes <= 4; writes++ {
+		for _, commit := range []func() error{nil, failedCommit} {
+			w := failingWriter(writes)
+			table := packet_test.MakeFeatureTest(t, []string{"packetTotalCount", "flowEndReason"}, flows.FlowFeature, flows.FlowOptions{})
+			table.EventLayers(0, &layers.UDP{SrcPort: 80, DstPort: 80})
+			table.EventLayers(5, &layers.UDP{SrcPort: 80, DstPort: 81})
+			table.EventLayers(6, &layers.UDP{SrcPort: 80, DstPort: 80})
+			if _, err := table.Checkpoint(7, &w, commit); err == nil {
+				if commit != nil || w == 0 {
+					t.Fatalf("checkpoint with %d writes succeeded", writes)
+				}
+				// the checkpoint fitted, so the flows are saved and must neither be exported nor stay in the table
+				table.EventLayers(20, &layers.UDP{SrcPort: 80, DstPort: 82})
+				table.Finish(30)
+				table.AssertFeatureList([]packet_test.FeatureLine{
+					{When: 30, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonForcedEnd)}}},
+				})
+				continue
+			}
+			table.Finish(30)
+			table.AssertFeatureList([]packet_test.FeatureLine{
+				{When: 7, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(2)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonForcedEnd)}}},
+				{When: 7, Features: []packet_test.FeatureResult{{Name: "packetTotalCount", Value: uint64(1)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonForcedEnd)}}},
+			})
+		}
+	}
+}
+
+func TestEviction(t *testing.T) {
+	for _, test := range []struct {
+		policy flows.EvictionPolicy
+		victim layers.UDPPort
+	}{
+		{flows.EvictOldest, 1},
+		{flows.EvictLRU, 2},
+		{flows.EvictSmallest, 3},
+	} {
+		table := packet_test.MakeFeatureTest(t, []string{"destinationTransportPort", "flowEndReason"}, flows.FlowFeature, flows.FlowOptions{MaxFlows: 3, Eviction: test.policy})
+		// oldest: 1, least recently used: 2, least packets: 3
+		for i, port := range []layers.UDPPort{1, 2, 2, 3, 1, 4} {
+			table.EventLayers(flows.DateTimeNanoseconds(i), &layers.UDP{SrcPort: 80, DstPort: port})
+		}
+		table.Finish(10)
+		table.AssertFeatureList([]packet_test.FeatureLine{
+			{When: 5, Features: []packet_test.FeatureResult{{Name: "destinationTransportPort", Value: uint16(test.victim)}, {Name: "flowEndReason", Value: uint16(flows.FlowEndReasonLackOfResources)}}},
+		})
+	}
+}
+
+func TestSampling(t *testing.T) {
+	features := []interface{}{"samplingInterval", "samplingAlgorithm", "selectorAlgorithm", "samplingPacketInterval",
+		"samplingPacketSpace", "samplingProbability", []interface{}{"scaleSampling", "packetTotalCount"}}
+	run := func(sampling flows.Sampling) packet_test.TestTable {
+		table := packet_test.MakeSpecFeatureTest(t, features, flows.FlowOptions{Sampling: sampling})
+		table.EventLayers(0, &layers.UDP{SrcPort: 80, DstPort: 80})
+		table.EventLayers(1, &layers.UDP{SrcPort: 80, DstPort: 80})
+		table.Finish(10)
+		return table
+	}
+
+	table := run(flows.Sampling{})
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 10, Features: []packet_test.FeatureResult{
+			{Name: "samplingInterval", Value: nil},
+			{Name: "samplingAlgorithm", Value: nil},
+			{Name: "selectorAlgorithm", Value: nil},
+			{Name: "samplingPacketInterval", Value: nil},
+			{Name: "samplingPacketSpace", Value: nil},
+			{Name: "samplingProbability", Value: nil},
+			{Name: "scaleSampling(packetTotalCount)", Value: uint64(2)},
+		}},
+	})
+
+	table = run(flows.Sampling{Algorithm: flows.SelectorSystematicCount, Rate: 100})
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 10, Features: []packet_test.FeatureResult{
+			{Name: "samplingInterval", Value: uint32(100)},
+			{Name: "samplingAlgorithm", Value: uint8(1)},
+			{Name: "selectorAlgorithm", Value: flows.SelectorSystematicCount},
+			{Name: "samplingPacketInterval", Value: uint32(1)},
+			{Name: "samplingPacketSpace", Value: uint32(99)},
+			{Name: "samplingProbability", Value: nil},
+			{Name: "scaleSampling(packetTotalCount)", Value: uint64(200)},
+		}},
+	})
+
+	table = run(flows.Sampling{Algorithm: flows.SelectorUniformProbabilistic, Rate: 4})
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: 10, Features: []packet_test.FeatureResult{
+			{Name: "samplingInterval", Value: uint32(4)},
+			{Name: "samplingAlgorithm", Value: uint8(2)},
+			{Name: "selectorAlgorithm", Value: flows.SelectorUniformProbabilistic},
+			{Name: "samplingPacketInterval", Value: nil},
+			{Name: "samplingPacketSpace", Value: nil},
+			{Name: "samplingProbability", Value: 0.25},
+			{Name: "scaleSampling(packetTotalCount)", Value: uint64(8)},
+		}},
+	})
+}
@@ -1,6 +1,8 @@
 package iana
 
 import (
+	"encoding/gob"
+
 	"github.com/CN-TU/go-flows/flows"
 	"github.com/CN-TU/go-flows/packet"
 	"github.com/CN-TU/go-ipfix"
@@ -10,6 +12,9 @@ type flowEndReason struct {
 	flows.BaseFeature
 }
 
+func (f *flowEndReason) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *flowEndReason) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *flowEndReason) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
 	f.SetValue(uint16(reason), context, f)
 }
@@ -25,6 +30,14 @@ type flowEndNanoseconds struct {
 	lastTime flows.DateTimeNanoseconds
 }
 
+func (f *flowEndNanoseconds) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.lastTime)
+}
+
+func (f *flowEndNanoseconds) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.lastTime)
+}
+
 func (f *flowEndNanoseconds) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	f.lastTime = context.When()
 }
@@ -46,6 +59,9 @@ type flowStartNanoseconds struct {
 	flows.BaseFeature
 }
 
+func (f *flowStartNanoseconds) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *flowStartNanoseconds) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *flowStartNanoseconds) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.SetValue(context.When(), context, f)
@@ -64,6 +80,9 @@ type flowDirection struct {
 	flows.BaseFeature
 }
 
+func (f *flowDirection) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *flowDirection) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *flowDirection) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		f.SetValue(new.(packet.Buffer).LowToHigh(), context, f)
@@ -74,6 +93,9 @@ type flowDirectionPacket struct {
 	flows.BaseFeature
 }
 
+func (f *flowDirectionPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *flowDirectionPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *flowDirectionPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	f.SetValue(context.Forward(), context, f)
 }
@@ -89,6 +111,9 @@ type flowID struct {
 	flows.BaseFeature
 }
 
+func (f *flowID) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *flowID) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *flowID) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		// flowId is a per table flow counter ored with the tableId in the highest byte
@@ -110,6 +135,14 @@ type packetTotalCount struct {
 	count uint64
 }
 
+func (f *packetTotalCount) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.count)
+}
+
+func (f *packetTotalCount) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.count)
+}
+
 func (f *packetTotalCount) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -135,6 +168,14 @@ type flowDurationNanoseconds struct {
 	lastTime flows.DateTimeNanoseconds
 }
 
+func (f *flowDurationNanoseconds) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.start, f.lastTime)
+}
+
+func (f *flowDurationNanoseconds) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.start, &f.lastTime)
+}
+
 func (f *flowDurationNanoseconds) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.start = context.When()
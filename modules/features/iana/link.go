@@ -1,8 +1,10 @@
 package iana
 
 import (
+	"encoding/gob"
 	"net"
 
+	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 
 	"github.com/CN-TU/go-flows/flows"
@@ -13,6 +15,14 @@ type layer2OctetTotalCountPacket struct {
 	flows.BaseFeature
 }
 
+func (f *layer2OctetTotalCountPacket) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc)
+}
+
+func (f *layer2OctetTotalCountPacket) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec)
+}
+
 func (f *layer2OctetTotalCountPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	f.SetValue(new.(packet.Buffer).LinkLayerLength(), context, f)
 }
@@ -26,6 +36,14 @@ type layer2OctetTotalCountFlow struct {
 	total uint64
 }
 
+func (f *layer2OctetTotalCountFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.total)
+}
+
+func (f *layer2OctetTotalCountFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.total)
+}
+
 func (f *layer2OctetTotalCountFlow) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.total = 0
@@ -51,6 +69,9 @@ type ethernetType struct {
 	flows.BaseFeature
 }
 
+func (f *ethernetType) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *ethernetType) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *ethernetType) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		f.SetValue(uint16(new.(packet.Buffer).EtherType()), context, f)
@@ -63,15 +84,39 @@ func init() {
 
 ////////////////////////////////////////////////////////////////////////////////
 
+// linkAddresses returns the source and destination mac address of the link layer. Linux cooked captures only
+// contain the source address.
+func linkAddresses(link gopacket.LinkLayer) (src, dst net.HardwareAddr) {
+	switch link := link.(type) {
+	case *layers.Ethernet:
+		return link.SrcMAC, link.DstMAC
+	case *packet.Dot11:
+		return link.Source(), link.Destination()
+	case *layers.LinuxSLL:
+		if link.AddrLen == 6 {
+			return link.Addr, nil
+		}
+	case *packet.LinuxSLL2:
+		if len(link.Addr) == 6 {
+			return link.Addr, nil
+		}
+	}
+	return nil, nil
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
 type sourceMacAddress struct {
 	flows.BaseFeature
 }
 
+func (f *sourceMacAddress) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *sourceMacAddress) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *sourceMacAddress) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
-		link, ok := new.(packet.Buffer).LinkLayer().(*layers.Ethernet)
-		if ok {
-			f.SetValue(append(net.HardwareAddr(nil), link.SrcMAC...), context, f)
+		if src, _ := linkAddresses(new.(packet.Buffer).LinkLayer()); src != nil {
+			f.SetValue(append(net.HardwareAddr(nil), src...), context, f)
 		}
 	}
 }
@@ -86,11 +131,13 @@ type destinationMacAddress struct {
 	flows.BaseFeature
 }
 
+func (f *destinationMacAddress) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *destinationMacAddress) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *destinationMacAddress) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
-		link, ok := new.(packet.Buffer).LinkLayer().(*layers.Ethernet)
-		if ok {
-			f.SetValue(append(net.HardwareAddr(nil), link.DstMAC...), context, f)
+		if _, dst := linkAddresses(new.(packet.Buffer).LinkLayer()); dst != nil {
+			f.SetValue(append(net.HardwareAddr(nil), dst...), context, f)
 		}
 	}
 }
@@ -105,6 +152,9 @@ type dot1qVlanID struct {
 	flows.BaseFeature
 }
 
+func (f *dot1qVlanID) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *dot1qVlanID) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *dot1qVlanID) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		dot1q := new.(packet.Buffer).Dot1QLayers()
@@ -124,6 +174,9 @@ type dot1qPriority struct {
 	flows.BaseFeature
 }
 
+func (f *dot1qPriority) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *dot1qPriority) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *dot1qPriority) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		dot1q := new.(packet.Buffer).Dot1QLayers()
@@ -136,3 +189,81 @@ func (f *dot1qPriority) Event(new interface{}, context *flows.EventContext, src
 func init() {
 	flows.RegisterStandardFeature("dot1qPriority", flows.FlowFeature, func() flows.Feature { return &dot1qPriority{} }, flows.RawPacket)
 }
+
+////////////////////////////////////////////////////////////////////////////////
+
+type staMacAddress struct {
+	flows.BaseFeature
+}
+
+func (f *staMacAddress) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *staMacAddress) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
+func (f *staMacAddress) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() == nil {
+		if dot11, ok := new.(packet.Buffer).LinkLayer().(*packet.Dot11); ok {
+			// only frames between a station and an access point
+			var sta net.HardwareAddr
+			switch {
+			case dot11.Flags.ToDS() && dot11.Flags.FromDS():
+			case dot11.Flags.ToDS():
+				sta = dot11.Address2
+			case dot11.Flags.FromDS():
+				sta = dot11.Address1
+			}
+			if sta != nil {
+				f.SetValue(append(net.HardwareAddr(nil), sta...), context, f)
+			}
+		}
+	}
+}
+
+func init() {
+	flows.RegisterStandardFeature("staMacAddress", flows.FlowFeature, func() flows.Feature { return &staMacAddress{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type wtpMacAddress struct {
+	flows.BaseFeature
+}
+
+func (f *wtpMacAddress) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *wtpMacAddress) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
+func (f *wtpMacAddress) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() == nil {
+		if dot11, ok := new.(packet.Buffer).LinkLayer().(*packet.Dot11); ok {
+			if bssid := dot11.BSSID(); bssid != nil {
+				f.SetValue(append(net.HardwareAddr(nil), bssid...), context, f)
+			}
+		}
+	}
+}
+
+func init() {
+	flows.RegisterStandardFeature("wtpMacAddress", flows.FlowFeature, func() flows.Feature { return &wtpMacAddress{} }, flows.RawPacket)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+type wlanChannelID struct {
+	flows.BaseFeature
+}
+
+func (f *wlanChannelID) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *wlanChannelID) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
+func (f *wlanChannelID) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() == nil {
+		if radiotap, ok := new.(packet.Buffer).Layer(layers.LayerTypeRadioTap).(*packet.RadioTap); ok && radiotap.Present.Channel() {
+			if channel := radiotap.Channel(); channel != 0 {
+				f.SetValue(channel, context, f)
+			}
+		}
+	}
+}
+
+func init() {
+	flows.RegisterStandardFeature("wlanChannelId", flows.FlowFeature, func() flows.Feature { return &wlanChannelID{} }, flows.RawPacket)
+}
@@ -2,6 +2,7 @@ package iana
 
 import (
 	"encoding/binary"
+	"encoding/gob"
 	"log"
 	"net"
 
@@ -18,6 +19,9 @@ type sourceIPAddressFlow struct {
 	flows.BaseFeature
 }
 
+func (f *sourceIPAddressFlow) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *sourceIPAddressFlow) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *sourceIPAddressFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		network := new.(packet.Buffer).NetworkLayer()
@@ -60,6 +64,9 @@ type sourceIPAddressPacket struct {
 	flows.BaseFeature
 }
 
+func (f *sourceIPAddressPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *sourceIPAddressPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *sourceIPAddressPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	network := new.(packet.Buffer).NetworkLayer()
 	if network != nil {
@@ -100,6 +107,14 @@ type destinationIPAddressFlow struct {
 	flows.BaseFeature
 }
 
+func (f *destinationIPAddressFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc)
+}
+
+func (f *destinationIPAddressFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec)
+}
+
 func (f *destinationIPAddressFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		network := new.(packet.Buffer).NetworkLayer()
@@ -142,6 +157,14 @@ type destinationIPAddressPacket struct {
 	flows.BaseFeature
 }
 
+func (f *destinationIPAddressPacket) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc)
+}
+
+func (f *destinationIPAddressPacket) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec)
+}
+
 func (f *destinationIPAddressPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	network := new.(packet.Buffer).NetworkLayer()
 	if network != nil {
@@ -182,6 +205,9 @@ type protocolIdentifierFlow struct {
 	flows.BaseFeature
 }
 
+func (f *protocolIdentifierFlow) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *protocolIdentifierFlow) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *protocolIdentifierFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		f.SetValue(new.(packet.Buffer).Proto(), context, f)
@@ -198,6 +224,14 @@ type protocolIdentifierPacket struct {
 	flows.BaseFeature
 }
 
+func (f *protocolIdentifierPacket) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc)
+}
+
+func (f *protocolIdentifierPacket) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec)
+}
+
 func (f *protocolIdentifierPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	f.SetValue(new.(packet.Buffer).Proto(), context, f)
 }
@@ -212,6 +246,9 @@ type octetTotalCountPacket struct {
 	flows.BaseFeature
 }
 
+func (f *octetTotalCountPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *octetTotalCountPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *octetTotalCountPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	f.SetValue(new.(packet.Buffer).NetworkLayerLength(), context, f)
 }
@@ -227,6 +264,14 @@ type octetTotalCountFlow struct {
 	total uint64
 }
 
+func (f *octetTotalCountFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.total)
+}
+
+func (f *octetTotalCountFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.total)
+}
+
 func (f *octetTotalCountFlow) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.total = 0
@@ -250,6 +295,9 @@ type ipTotalLengthPacket struct {
 	flows.BaseFeature
 }
 
+func (f *ipTotalLengthPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *ipTotalLengthPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *ipTotalLengthPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	network := new.(packet.Buffer).NetworkLayer()
 	if ip, ok := network.(*layers.IPv4); ok {
@@ -286,6 +334,14 @@ type ipTotalLengthFlow struct {
 	total uint64
 }
 
+func (f *ipTotalLengthFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.total)
+}
+
+func (f *ipTotalLengthFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.total)
+}
+
 func (f *ipTotalLengthFlow) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.total = 0
@@ -334,6 +390,9 @@ type ipTTL struct {
 	flows.BaseFeature
 }
 
+func (f *ipTTL) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *ipTTL) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *ipTTL) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	network := new.(packet.Buffer).NetworkLayer()
 	if ip, ok := network.(*layers.IPv4); ok {
@@ -356,6 +415,9 @@ type ipClassOfService struct {
 	flows.BaseFeature
 }
 
+func (f *ipClassOfService) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *ipClassOfService) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *ipClassOfService) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	network := new.(packet.Buffer).NetworkLayer()
 	if ip, ok := network.(*layers.IPv4); ok {
@@ -0,0 +1,64 @@
+package iana
+
+import (
+	"encoding/gob"
+
+	"github.com/CN-TU/go-flows/flows"
+)
+
+// samplingFeature exports a property of the sampling done by the filters (see flows.FlowOptions.Sampling); without
+// sampling nothing is exported
+type samplingFeature struct {
+	flows.BaseFeature
+	value func(flows.Sampling) interface{}
+}
+
+func (f *samplingFeature) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *samplingFeature) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
+func (f *samplingFeature) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	if sampling := context.Flow().Table().Sampling; sampling.Sampled() {
+		if value := f.value(sampling); value != nil {
+			f.SetValue(value, context, f)
+		}
+	}
+}
+
+func registerSamplingFeature(name string, value func(flows.Sampling) interface{}) {
+	flows.RegisterStandardFeature(name, flows.FlowFeature, func() flows.Feature { return &samplingFeature{value: value} }, flows.RawPacket)
+}
+
+func init() {
+	registerSamplingFeature("samplingInterval", func(s flows.Sampling) interface{} {
+		return s.Rate
+	})
+	// deterministic (1) or random (2) sampling
+	registerSamplingFeature("samplingAlgorithm", func(s flows.Sampling) interface{} {
+		if s.Algorithm == flows.SelectorUniformProbabilistic {
+			return uint8(2)
+		}
+		return uint8(1)
+	})
+	registerSamplingFeature("selectorAlgorithm", func(s flows.Sampling) interface{} {
+		return s.Algorithm
+	})
+	registerSamplingFeature("samplingPacketInterval", func(s flows.Sampling) interface{} {
+		if s.Algorithm == flows.SelectorSystematicCount {
+			return uint32(1)
+		}
+		return nil
+	})
+	registerSamplingFeature("samplingPacketSpace", func(s flows.Sampling) interface{} {
+		if s.Algorithm == flows.SelectorSystematicCount {
+			return s.Rate - 1
+		}
+		return nil
+	})
+	registerSamplingFeature("samplingProbability", func(s flows.Sampling) interface{} {
+		if s.Algorithm == flows.SelectorSystematicCount {
+			return nil
+		}
+		return 1 / float64(s.Rate)
+	})
+}
@@ -2,6 +2,7 @@ package iana
 
 import (
 	"encoding/binary"
+	"encoding/gob"
 
 	"github.com/CN-TU/go-flows/flows"
 	"github.com/CN-TU/go-flows/modules/features"
@@ -12,6 +13,14 @@ type sourceTransportPortFlow struct {
 	flows.BaseFeature
 }
 
+func (f *sourceTransportPortFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc)
+}
+
+func (f *sourceTransportPortFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec)
+}
+
 func (f *sourceTransportPortFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		transport := new.(packet.Buffer).TransportLayer()
@@ -35,6 +44,14 @@ type sourceTransportPortPacket struct {
 	flows.BaseFeature
 }
 
+func (f *sourceTransportPortPacket) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc)
+}
+
+func (f *sourceTransportPortPacket) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec)
+}
+
 func (f *sourceTransportPortPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	transport := new.(packet.Buffer).TransportLayer()
 	if transport != nil {
@@ -56,6 +73,14 @@ type destinationTransportPortFlow struct {
 	flows.BaseFeature
 }
 
+func (f *destinationTransportPortFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc)
+}
+
+func (f *destinationTransportPortFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec)
+}
+
 func (f *destinationTransportPortFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.Value() == nil {
 		transport := new.(packet.Buffer).TransportLayer()
@@ -79,6 +104,14 @@ type destinationTransportPortPacket struct {
 	flows.BaseFeature
 }
 
+func (f *destinationTransportPortPacket) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc)
+}
+
+func (f *destinationTransportPortPacket) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec)
+}
+
 func (f *destinationTransportPortPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	transport := new.(packet.Buffer).TransportLayer()
 	if transport != nil {
@@ -100,6 +133,9 @@ type tcpControlBits struct {
 	flows.BaseFeature
 }
 
+func (f *tcpControlBits) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *tcpControlBits) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *tcpControlBits) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	var value uint16
 	tcp := features.GetTCP(new)
@@ -147,6 +183,14 @@ type tcpSynTotalCountFlow struct {
 	count uint64
 }
 
+func (f *tcpSynTotalCountFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.count)
+}
+
+func (f *tcpSynTotalCountFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.count)
+}
+
 func (f *tcpSynTotalCountFlow) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -174,6 +218,9 @@ type tcpSynTotalCountPacket struct {
 	flows.BaseFeature
 }
 
+func (f *tcpSynTotalCountPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *tcpSynTotalCountPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *tcpSynTotalCountPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	tcp := features.GetTCP(new)
 	if tcp == nil {
@@ -193,6 +240,14 @@ type tcpFinTotalCountFlow struct {
 	count uint64
 }
 
+func (f *tcpFinTotalCountFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.count)
+}
+
+func (f *tcpFinTotalCountFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.count)
+}
+
 func (f *tcpFinTotalCountFlow) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -220,6 +275,9 @@ type tcpFinTotalCountPacket struct {
 	flows.BaseFeature
 }
 
+func (f *tcpFinTotalCountPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *tcpFinTotalCountPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *tcpFinTotalCountPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	tcp := features.GetTCP(new)
 	if tcp == nil {
@@ -239,6 +297,14 @@ type tcpRstTotalCountFlow struct {
 	count uint64
 }
 
+func (f *tcpRstTotalCountFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.count)
+}
+
+func (f *tcpRstTotalCountFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.count)
+}
+
 func (f *tcpRstTotalCountFlow) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -266,6 +332,9 @@ type tcpRstTotalCountPacket struct {
 	flows.BaseFeature
 }
 
+func (f *tcpRstTotalCountPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *tcpRstTotalCountPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *tcpRstTotalCountPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	tcp := features.GetTCP(new)
 	if tcp == nil {
@@ -285,6 +354,14 @@ type tcpPshTotalCountFlow struct {
 	count uint64
 }
 
+func (f *tcpPshTotalCountFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.count)
+}
+
+func (f *tcpPshTotalCountFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.count)
+}
+
 func (f *tcpPshTotalCountFlow) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -312,6 +389,9 @@ type tcpPshTotalCountPacket struct {
 	flows.BaseFeature
 }
 
+func (f *tcpPshTotalCountPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *tcpPshTotalCountPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *tcpPshTotalCountPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	tcp := features.GetTCP(new)
 	if tcp == nil {
@@ -331,6 +411,14 @@ type tcpAckTotalCountFlow struct {
 	count uint64
 }
 
+func (f *tcpAckTotalCountFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.count)
+}
+
+func (f *tcpAckTotalCountFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.count)
+}
+
 func (f *tcpAckTotalCountFlow) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -352,11 +440,14 @@ func init() {
 	flows.RegisterStandardFeature("tcpAckTotalCount", flows.FlowFeature, func() flows.Feature { return &tcpAckTotalCountFlow{} }, flows.RawPacket)
 }
 
-////////////////////////////////////////////////////////////////////////////////
+// //////////////////////////////////////////////////////////////////////////////
 type tcpAckTotalCountPacket struct {
 	flows.BaseFeature
 }
 
+func (f *tcpAckTotalCountPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *tcpAckTotalCountPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *tcpAckTotalCountPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	tcp := features.GetTCP(new)
 	if tcp == nil {
@@ -376,6 +467,14 @@ type tcpUrgTotalCountFlow struct {
 	count uint64
 }
 
+func (f *tcpUrgTotalCountFlow) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.count)
+}
+
+func (f *tcpUrgTotalCountFlow) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.count)
+}
+
 func (f *tcpUrgTotalCountFlow) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -403,6 +502,9 @@ type tcpUrgTotalCountPacket struct {
 	flows.BaseFeature
 }
 
+func (f *tcpUrgTotalCountPacket) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *tcpUrgTotalCountPacket) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
 func (f *tcpUrgTotalCountPacket) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	tcp := features.GetTCP(new)
 	if tcp == nil {
@@ -423,6 +525,14 @@ type tcpSequenceNumber struct {
 	cutoff bool
 }
 
+func (f *tcpSequenceNumber) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.isn, f.cutoff)
+}
+
+func (f *tcpSequenceNumber) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.isn, &f.cutoff)
+}
+
 func (f *tcpSequenceNumber) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.isn = features.InvalidSequence
@@ -467,6 +577,14 @@ type reverseTCPSequenceNumber struct {
 	cutoff bool
 }
 
+func (f *reverseTCPSequenceNumber) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.isn, f.cutoff)
+}
+
+func (f *reverseTCPSequenceNumber) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.isn, &f.cutoff)
+}
+
 func (f *reverseTCPSequenceNumber) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.isn = features.InvalidSequence
@@ -510,4 +628,4 @@ func init() {
 	flows.RegisterStandardReverseFeature("tcpSequenceNumber", flows.FlowFeature, func() flows.Feature { return &reverseTCPSequenceNumber{} }, flows.RawPacket)
 }
 
-////////////////////////////////////////////////////////////////////////////////
\ No newline at end of file
+////////////////////////////////////////////////////////////////////////////////
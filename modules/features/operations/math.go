@@ -1,12 +1,31 @@
 package operations
 
-import "github.com/CN-TU/go-flows/flows"
+import (
+	"encoding/gob"
+
+	"github.com/CN-TU/go-flows/flows"
+)
 
 type addPacketFlow struct {
 	flows.BaseFeature
 	current interface{}
 }
 
+func (f *addPacketFlow) Snapshot(enc *gob.Encoder) error {
+	if err := f.SnapshotValue(enc); err != nil {
+		return err
+	}
+	return flows.EncodeValue(enc, f.current)
+}
+
+func (f *addPacketFlow) Restore(dec *gob.Decoder) (err error) {
+	if err = f.RestoreValue(dec); err != nil {
+		return
+	}
+	f.current, err = flows.DecodeValue(dec)
+	return
+}
+
 func (f *addPacketFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.current == nil {
 		f.current = new
@@ -43,6 +62,21 @@ type multiplyPacketFlow struct {
 	current interface{}
 }
 
+func (f *multiplyPacketFlow) Snapshot(enc *gob.Encoder) error {
+	if err := f.SnapshotValue(enc); err != nil {
+		return err
+	}
+	return flows.EncodeValue(enc, f.current)
+}
+
+func (f *multiplyPacketFlow) Restore(dec *gob.Decoder) (err error) {
+	if err = f.RestoreValue(dec); err != nil {
+		return
+	}
+	f.current, err = flows.DecodeValue(dec)
+	return
+}
+
 func (f *multiplyPacketFlow) Event(new interface{}, context *flows.EventContext, src interface{}) {
 	if f.current == nil {
 		f.current = new
@@ -72,3 +106,36 @@ func init() {
 }
 
 ////////////////////////////////////////////////////////////////////////////////
+
+type scaleSampling struct {
+	flows.BaseFeature
+}
+
+func (f *scaleSampling) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc) }
+func (f *scaleSampling) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec) }
+
+func (f *scaleSampling) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	sampling := context.Flow().Table().Sampling
+	if !sampling.Sampled() {
+		f.SetValue(new, context, f)
+		return
+	}
+	dst, fl, a, b := flows.UpConvert(new, uint64(sampling.Rate))
+	var result interface{}
+	switch fl {
+	case flows.UIntType:
+		result = a.(uint64) * b.(uint64)
+	case flows.IntType:
+		result = a.(int64) * b.(int64)
+	case flows.FloatType:
+		result = a.(float64) * b.(float64)
+	}
+	f.SetValue(flows.FixType(result, dst), context, f)
+}
+
+func init() {
+	flows.RegisterFunction("scaleSampling", "returns a * N of the 1-in-N sampling filter", flows.PacketFeature, func() flows.Feature { return &scaleSampling{} }, flows.PacketFeature)
+	flows.RegisterFunction("scaleSampling", "returns a * N of the 1-in-N sampling filter", flows.FlowFeature, func() flows.Feature { return &scaleSampling{} }, flows.FlowFeature)
+}
+
+////////////////////////////////////////////////////////////////////////////////
@@ -1,6 +1,7 @@
 package operations
 
 import (
+	"encoding/gob"
 	"errors"
 	"math"
 	"net"
@@ -15,6 +16,9 @@ type get struct {
 	index, current int64
 }
 
+func (f *get) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc, f.current) }
+func (f *get) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec, &f.current) }
+
 func (f *get) SetArguments(arguments []int, features []flows.Feature) {
 	f.index = flows.ToInt(features[arguments[0]].Value())
 }
@@ -48,6 +52,9 @@ type count struct {
 	count uint64
 }
 
+func (f *count) Snapshot(enc *gob.Encoder) error { return f.SnapshotValue(enc, f.count) }
+func (f *count) Restore(dec *gob.Decoder) error  { return f.RestoreValue(dec, &f.count) }
+
 func (f *count) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -74,6 +81,14 @@ type mean struct {
 	count uint64
 }
 
+func (f *mean) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.total, f.count)
+}
+
+func (f *mean) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.total, &f.count)
+}
+
 func (f *mean) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.total = 0
@@ -102,6 +117,21 @@ type min struct {
 	current interface{}
 }
 
+func (f *min) Snapshot(enc *gob.Encoder) error {
+	if err := f.SnapshotValue(enc); err != nil {
+		return err
+	}
+	return flows.EncodeValue(enc, f.current)
+}
+
+func (f *min) Restore(dec *gob.Decoder) (err error) {
+	if err = f.RestoreValue(dec); err != nil {
+		return
+	}
+	f.current, err = flows.DecodeValue(dec)
+	return
+}
+
 func (f *min) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.current = nil
@@ -145,6 +175,21 @@ type max struct {
 	current interface{}
 }
 
+func (f *max) Snapshot(enc *gob.Encoder) error {
+	if err := f.SnapshotValue(enc); err != nil {
+		return err
+	}
+	return flows.EncodeValue(enc, f.current)
+}
+
+func (f *max) Restore(dec *gob.Decoder) (err error) {
+	if err = f.RestoreValue(dec); err != nil {
+		return
+	}
+	f.current, err = flows.DecodeValue(dec)
+	return
+}
+
 func (f *max) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.current = nil
@@ -190,6 +235,14 @@ type stdev struct {
 	mean, m2 float64
 }
 
+func (f *stdev) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.count, f.mean, f.m2)
+}
+
+func (f *stdev) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.count, &f.mean, &f.m2)
+}
+
 func (f *stdev) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -225,6 +278,14 @@ type variance struct {
 	mean, m2 float64
 }
 
+func (f *variance) Snapshot(enc *gob.Encoder) error {
+	return f.SnapshotValue(enc, f.count, f.mean, f.m2)
+}
+
+func (f *variance) Restore(dec *gob.Decoder) error {
+	return f.RestoreValue(dec, &f.count, &f.mean, &f.m2)
+}
+
 func (f *variance) Start(context *flows.EventContext) {
 	f.BaseFeature.Start(context)
 	f.count = 0
@@ -443,7 +504,7 @@ func init() {
 type set struct {
 	flows.BaseFeature
 	vector map[interface{}]bool
-	set []interface{}
+	set    []interface{}
 }
 
 func (f *set) Start(context *flows.EventContext) {
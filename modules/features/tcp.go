@@ -1,6 +1,8 @@
 package features
 
 import (
+	"sort"
+
 	"github.com/CN-TU/go-flows/packet"
 	"github.com/google/gopacket/layers"
 )
@@ -55,3 +57,76 @@ func (s Sequence) Add(t int) Sequence {
 }
 
 // ^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^^
+
+// maxReorderPayload is the maximum amount of out of order payload buffered by TCPPayload. If more data is buffered,
+// the missing data is skipped.
+const maxReorderPayload = 256 * 1024
+
+type payloadFragment struct {
+	seq  Sequence
+	data []byte
+}
+
+// TCPPayload reassembles the payload of one direction of a tcp connection. Reset must be called before the first
+// segment is pushed.
+type TCPPayload struct {
+	fragments []payloadFragment // sorted by sequence number
+	buffered  int
+	nextSeq   Sequence
+}
+
+// Reset drops the buffered data; the next pushed segment starts the stream
+func (p *TCPPayload) Reset() {
+	*p = TCPPayload{nextSeq: InvalidSequence}
+}
+
+// Push adds the payload of the segment tcp and calls emit for the data, which is next in sequence order. Retransmitted
+// data is skipped, and data after a gap is buffered until the gap is filled.
+func (p *TCPPayload) Push(tcp *layers.TCP, emit func([]byte)) {
+	seq := Sequence(tcp.Seq)
+	if tcp.SYN {
+		seq = seq.Add(1)
+	}
+	if p.nextSeq == InvalidSequence {
+		p.nextSeq = seq
+	}
+	data := tcp.LayerPayload()
+	if len(data) == 0 {
+		return
+	}
+	if p.nextSeq.Difference(seq) > 0 {
+		// data from the future -> store a copy for later
+		i := sort.Search(len(p.fragments), func(i int) bool { return seq.Difference(p.fragments[i].seq) > 0 })
+		p.fragments = append(p.fragments, payloadFragment{})
+		copy(p.fragments[i+1:], p.fragments[i:])
+		p.fragments[i] = payloadFragment{seq, append([]byte(nil), data...)}
+		p.buffered += len(data)
+		if p.buffered <= maxReorderPayload {
+			return
+		}
+		// too much data missing -> skip the gap
+		p.nextSeq = p.fragments[0].seq
+	} else {
+		p.emit(seq, data, emit)
+	}
+	for len(p.fragments) > 0 && p.nextSeq.Difference(p.fragments[0].seq) <= 0 {
+		fragment := p.fragments[0]
+		p.fragments = p.fragments[1:]
+		p.buffered -= len(fragment.data)
+		p.emit(fragment.seq, fragment.data, emit)
+	}
+	if len(p.fragments) == 0 {
+		p.fragments = nil
+	}
+}
+
+// emit forwards the part of data, which wasn't seen yet
+func (p *TCPPayload) emit(seq Sequence, data []byte, emit func([]byte)) {
+	seen := seq.Difference(p.nextSeq)
+	if seen >= len(data) {
+		// retransmission
+		return
+	}
+	p.nextSeq = p.nextSeq.Add(len(data) - seen)
+	emit(data[seen:])
+}
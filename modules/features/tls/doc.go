@@ -0,0 +1,6 @@
+// Package tls contains features extracted from the TLS handshake (ClientHello, ServerHello, and the server
+// certificate for TLS ≤ 1.2).
+//
+// The handshake is parsed from _tcpReorderPayload of the custom feature module, which delivers the tcp payload of each
+// direction in sequence order without retransmitted data.
+package tls
@@ -0,0 +1,142 @@
+package tls
+
+import (
+	"crypto/x509"
+	"strings"
+
+	"github.com/CN-TU/go-flows/flows"
+	ipfix "github.com/CN-TU/go-ipfix"
+)
+
+// tlsParser emits the handshake messages (*clientHello, *serverHello, *x509.Certificate) parsed from the reordered
+// tcp payload of both directions
+type tlsParser struct {
+	flows.BaseFeature
+	forward, backward stream
+}
+
+func (f *tlsParser) Start(context *flows.EventContext) {
+	f.BaseFeature.Start(context)
+	f.forward = stream{}
+	f.backward = stream{}
+}
+
+func (f *tlsParser) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	s := &f.forward
+	if !context.Forward() {
+		s = &f.backward
+	}
+	s.push(new.(string), func(typ uint8, data []byte) {
+		var msg interface{}
+		var err error
+		switch typ {
+		case handshakeTypeClientHello:
+			msg, err = parseClientHello(data)
+		case handshakeTypeServerHello:
+			msg, err = parseServerHello(data)
+		case handshakeTypeCertificate:
+			msg, err = parseCertificate(data)
+		default:
+			return
+		}
+		if err == nil {
+			f.SetValue(msg, context, f)
+		}
+	})
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("__tlsParser", "parses tls handshake messages from the tcp payload", ipfix.OctetArrayType, 0, flows.PacketFeature, func() flows.Feature { return &tlsParser{} }, flows.PacketFeature)
+	flows.RegisterTemporaryCompositeFeature("__tlsHandshake", "parsed tls handshake messages", ipfix.OctetArrayType, 0, "__tlsParser", "_tcpReorderPayload")
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+// tlsField is a flow feature, which takes the value from the first handshake message it can be computed from
+type tlsField struct {
+	flows.BaseFeature
+	get func(interface{}) interface{}
+}
+
+func (f *tlsField) Event(new interface{}, context *flows.EventContext, src interface{}) {
+	if f.Value() != nil {
+		return
+	}
+	if value := f.get(new); value != nil {
+		f.SetValue(value, context, f)
+	}
+}
+
+// registerTLSFeature registers name as a flow feature computed by get from __tlsHandshake. get must return nil, if
+// the message doesn't contain the field.
+func registerTLSFeature(name, description string, t ipfix.Type, get func(interface{}) interface{}) {
+	flows.RegisterTemporaryFeature("_"+name, description, t, 0, flows.FlowFeature, func() flows.Feature { return &tlsField{get: get} }, flows.PacketFeature)
+	flows.RegisterTemporaryCompositeFeature(name, description, t, 0, "_"+name, "__tlsHandshake")
+}
+
+func clientField(get func(*clientHello) interface{}) func(interface{}) interface{} {
+	return func(msg interface{}) interface{} {
+		if c, ok := msg.(*clientHello); ok {
+			return get(c)
+		}
+		return nil
+	}
+}
+
+func serverField(get func(*serverHello) interface{}) func(interface{}) interface{} {
+	return func(msg interface{}) interface{} {
+		if s, ok := msg.(*serverHello); ok {
+			return get(s)
+		}
+		return nil
+	}
+}
+
+func certificateField(get func(*x509.Certificate) interface{}) func(interface{}) interface{} {
+	return func(msg interface{}) interface{} {
+		if c, ok := msg.(*x509.Certificate); ok {
+			return get(c)
+		}
+		return nil
+	}
+}
+
+func nonEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func init() {
+	registerTLSFeature("_tlsServerName", "server name indication of the tls ClientHello", ipfix.StringType,
+		clientField(func(c *clientHello) interface{} { return nonEmpty(c.serverName) }))
+	registerTLSFeature("_tlsClientVersion", "highest tls version offered in the ClientHello (e.g. 0x0304 for TLS 1.3)", ipfix.Unsigned16Type,
+		clientField(func(c *clientHello) interface{} { return c.maxVersion() }))
+	registerTLSFeature("_tlsServerVersion", "tls version selected by the ServerHello", ipfix.Unsigned16Type,
+		serverField(func(s *serverHello) interface{} { return s.negotiatedVersion() }))
+	registerTLSFeature("_tlsCipherSuites", "cipher suites offered in the ClientHello (decimal, separated by -)", ipfix.StringType,
+		clientField(func(c *clientHello) interface{} { return joinUint16(c.ciphers, "-") }))
+	registerTLSFeature("_tlsCipherSuite", "cipher suite selected by the ServerHello", ipfix.Unsigned16Type,
+		serverField(func(s *serverHello) interface{} { return s.cipher }))
+	registerTLSFeature("_tlsClientExtensions", "extension types of the ClientHello (decimal, separated by -)", ipfix.StringType,
+		clientField(func(c *clientHello) interface{} { return joinUint16(c.extensions, "-") }))
+	registerTLSFeature("_tlsServerExtensions", "extension types of the ServerHello (decimal, separated by -)", ipfix.StringType,
+		serverField(func(s *serverHello) interface{} { return joinUint16(s.extensions, "-") }))
+	registerTLSFeature("_tlsClientALPN", "application protocols offered in the ClientHello (separated by ,)", ipfix.StringType,
+		clientField(func(c *clientHello) interface{} { return nonEmpty(strings.Join(c.alpn, ",")) }))
+	registerTLSFeature("_tlsServerALPN", "application protocol selected by the ServerHello", ipfix.StringType,
+		serverField(func(s *serverHello) interface{} { return nonEmpty(s.alpn) }))
+	registerTLSFeature("_tlsJA3", "JA3 fingerprint (md5) of the ClientHello", ipfix.StringType,
+		clientField(func(c *clientHello) interface{} { return md5Hex(c.ja3()) }))
+	registerTLSFeature("_tlsJA3S", "JA3S fingerprint (md5) of the ServerHello", ipfix.StringType,
+		serverField(func(s *serverHello) interface{} { return md5Hex(s.ja3s()) }))
+	registerTLSFeature("_tlsCertificateSubject", "subject of the server certificate (TLS ≤ 1.2)", ipfix.StringType,
+		certificateField(func(c *x509.Certificate) interface{} { return c.Subject.String() }))
+	registerTLSFeature("_tlsCertificateIssuer", "issuer of the server certificate (TLS ≤ 1.2)", ipfix.StringType,
+		certificateField(func(c *x509.Certificate) interface{} { return c.Issuer.String() }))
+	registerTLSFeature("_tlsCertificateNotBefore", "start of the validity of the server certificate (TLS ≤ 1.2)", ipfix.DateTimeSecondsType,
+		certificateField(func(c *x509.Certificate) interface{} { return flows.DateTimeSeconds(c.NotBefore.Unix()) }))
+	registerTLSFeature("_tlsCertificateNotAfter", "end of the validity of the server certificate (TLS ≤ 1.2)", ipfix.DateTimeSecondsType,
+		certificateField(func(c *x509.Certificate) interface{} { return flows.DateTimeSeconds(c.NotAfter.Unix()) }))
+}
@@ -0,0 +1,342 @@
+package tls
+
+import (
+	"crypto/md5"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	recordTypeHandshake = 22
+
+	handshakeTypeClientHello = 1
+	handshakeTypeServerHello = 2
+	handshakeTypeCertificate = 11
+
+	extensionServerName        = 0
+	extensionSupportedGroups   = 10
+	extensionECPointFormats    = 11
+	extensionALPN              = 16
+	extensionSupportedVersions = 43
+
+	// maxHandshake is the maximum amount of handshake data buffered per direction
+	maxHandshake = 64 * 1024
+)
+
+var errShort = errors.New("message too short")
+
+// isGREASE returns true for the reserved GREASE values (RFC 8701), which are ignored by JA3
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+// reader is a minimal bounds checked reader for handshake messages
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = errShort
+		return nil
+	}
+	ret := r.data[:n]
+	r.data = r.data[n:]
+	return ret
+}
+
+func (r *reader) u8() uint8 {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) u16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) u24() int {
+	if b := r.bytes(3); b != nil {
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	}
+	return 0
+}
+
+// vector returns a reader for a vector with a length prefix of the given size in bytes
+func (r *reader) vector(size int) *reader {
+	var n int
+	switch size {
+	case 1:
+		n = int(r.u8())
+	case 2:
+		n = int(r.u16())
+	default:
+		n = r.u24()
+	}
+	return &reader{data: r.bytes(n), err: r.err}
+}
+
+func (r *reader) empty() bool {
+	return r.err != nil || len(r.data) == 0
+}
+
+type extension struct {
+	typ  uint16
+	data []byte
+}
+
+func parseExtensions(r *reader) (ret []extension, err error) {
+	if r.empty() {
+		// extensions are optional
+		return nil, r.err
+	}
+	list := r.vector(2)
+	for !list.empty() {
+		typ := list.u16()
+		data := list.vector(2)
+		ret = append(ret, extension{typ, data.data})
+	}
+	return ret, list.err
+}
+
+// clientHello holds the fields of a ClientHello
+type clientHello struct {
+	version           uint16
+	ciphers           []uint16
+	extensions        []uint16
+	groups            []uint16
+	pointFormats      []uint8
+	supportedVersions []uint16
+	serverName        string
+	alpn              []string
+}
+
+func parseClientHello(data []byte) (*clientHello, error) {
+	r := &reader{data: data}
+	ret := &clientHello{}
+	ret.version = r.u16()
+	r.bytes(32) // random
+	r.vector(1) // session id
+	ciphers := r.vector(2)
+	for !ciphers.empty() {
+		ret.ciphers = append(ret.ciphers, ciphers.u16())
+	}
+	r.vector(1) // compression methods
+	if r.err != nil {
+		return nil, r.err
+	}
+	extensions, err := parseExtensions(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range extensions {
+		ret.extensions = append(ret.extensions, e.typ)
+		data := &reader{data: e.data}
+		switch e.typ {
+		case extensionServerName:
+			names := data.vector(2)
+			for !names.empty() {
+				typ := names.u8()
+				name := names.vector(2)
+				if typ == 0 && names.err == nil && ret.serverName == "" {
+					ret.serverName = string(name.data)
+				}
+			}
+		case extensionSupportedGroups:
+			groups := data.vector(2)
+			for !groups.empty() {
+				ret.groups = append(ret.groups, groups.u16())
+			}
+		case extensionECPointFormats:
+			formats := data.vector(1)
+			for !formats.empty() {
+				ret.pointFormats = append(ret.pointFormats, formats.u8())
+			}
+		case extensionALPN:
+			protocols := data.vector(2)
+			for !protocols.empty() {
+				if protocol := protocols.vector(1); protocols.err == nil {
+					ret.alpn = append(ret.alpn, string(protocol.data))
+				}
+			}
+		case extensionSupportedVersions:
+			versions := data.vector(1)
+			for !versions.empty() {
+				ret.supportedVersions = append(ret.supportedVersions, versions.u16())
+			}
+		}
+	}
+	return ret, nil
+}
+
+// maxVersion returns the highest offered version
+func (c *clientHello) maxVersion() uint16 {
+	ret := c.version
+	for _, v := range c.supportedVersions {
+		if !isGREASE(v) && v > ret {
+			ret = v
+		}
+	}
+	return ret
+}
+
+// ja3 returns the JA3 fingerprint string (version,ciphers,extensions,groups,point formats)
+func (c *clientHello) ja3() string {
+	formats := make([]uint16, len(c.pointFormats))
+	for i, f := range c.pointFormats {
+		formats[i] = uint16(f)
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(c.version)),
+		joinUint16(c.ciphers, "-"),
+		joinUint16(c.extensions, "-"),
+		joinUint16(c.groups, "-"),
+		joinUint16(formats, "-"),
+	}, ",")
+}
+
+// serverHello holds the fields of a ServerHello
+type serverHello struct {
+	version          uint16
+	cipher           uint16
+	extensions       []uint16
+	supportedVersion uint16
+	alpn             string
+}
+
+func parseServerHello(data []byte) (*serverHello, error) {
+	r := &reader{data: data}
+	ret := &serverHello{}
+	ret.version = r.u16()
+	r.bytes(32) // random
+	r.vector(1) // session id
+	ret.cipher = r.u16()
+	r.u8() // compression method
+	if r.err != nil {
+		return nil, r.err
+	}
+	extensions, err := parseExtensions(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range extensions {
+		ret.extensions = append(ret.extensions, e.typ)
+		data := &reader{data: e.data}
+		switch e.typ {
+		case extensionALPN:
+			protocols := data.vector(2)
+			if protocol := protocols.vector(1); protocols.err == nil {
+				ret.alpn = string(protocol.data)
+			}
+		case extensionSupportedVersions:
+			ret.supportedVersion = data.u16()
+		}
+	}
+	return ret, nil
+}
+
+// negotiatedVersion returns the version selected by the server
+func (s *serverHello) negotiatedVersion() uint16 {
+	if s.supportedVersion != 0 {
+		return s.supportedVersion
+	}
+	return s.version
+}
+
+// ja3s returns the JA3S fingerprint string (version,cipher,extensions)
+func (s *serverHello) ja3s() string {
+	return strings.Join([]string{
+		strconv.Itoa(int(s.version)),
+		strconv.Itoa(int(s.cipher)),
+		joinUint16(s.extensions, "-"),
+	}, ",")
+}
+
+// parseCertificate returns the first (i.e. the server's) certificate of a Certificate message
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	r := &reader{data: data}
+	list := r.vector(3)
+	cert := list.vector(3)
+	if cert.err != nil {
+		return nil, cert.err
+	}
+	return x509.ParseCertificate(cert.data)
+}
+
+func joinUint16(values []uint16, sep string) string {
+	var b strings.Builder
+	first := true
+	for _, v := range values {
+		if isGREASE(v) {
+			continue
+		}
+		if !first {
+			b.WriteString(sep)
+		}
+		first = false
+		b.WriteString(strconv.Itoa(int(v)))
+	}
+	return b.String()
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// stream collects the handshake messages of one direction from the reordered tcp payload
+type stream struct {
+	records   []byte // unparsed record data
+	handshake []byte // unparsed handshake data
+	done      bool   // no more handshake data can follow (encrypted or error)
+}
+
+// push adds the next part of the payload and calls message for every complete handshake message
+func (s *stream) push(payload string, message func(typ uint8, data []byte)) {
+	if s.done || len(payload) == 0 {
+		return
+	}
+	s.records = append(s.records, payload...)
+	for len(s.records) >= 5 && !s.done {
+		length := int(binary.BigEndian.Uint16(s.records[3:5]))
+		if len(s.records) < 5+length {
+			break
+		}
+		typ := s.records[0]
+		fragment := s.records[5 : 5+length]
+		if typ != recordTypeHandshake || s.records[1] != 3 {
+			// ChangeCipherSpec or anything else ends the plaintext handshake
+			s.done = true
+			break
+		}
+		s.handshake = append(s.handshake, fragment...)
+		s.records = s.records[5+length:]
+		for len(s.handshake) >= 4 {
+			length := int(s.handshake[1])<<16 | int(s.handshake[2])<<8 | int(s.handshake[3])
+			if len(s.handshake) < 4+length {
+				break
+			}
+			message(s.handshake[0], s.handshake[4:4+length])
+			s.handshake = s.handshake[4+length:]
+		}
+	}
+	if len(s.records)+len(s.handshake) > maxHandshake {
+		s.done = true
+	}
+	if s.done {
+		s.records = nil
+		s.handshake = nil
+	}
+}
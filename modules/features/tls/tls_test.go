@@ -0,0 +1,183 @@
+package tls
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CN-TU/go-flows/flows"
+	_ "github.com/CN-TU/go-flows/modules/features/custom"
+	"github.com/CN-TU/go-flows/packet_test"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	notBefore = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	notAfter  = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// recordingConn records everything written to the connection
+type recordingConn struct {
+	net.Conn
+	mutex   sync.Mutex
+	written []byte
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.mutex.Lock()
+	c.written = append(c.written, b...)
+	c.mutex.Unlock()
+	return c.Conn.Write(b)
+}
+
+func makeCertificate(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		DNSNames:     []string{"example.com"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// handshake returns the data sent by client and server during a TLS 1.2 handshake
+func handshake(t *testing.T) (client, server []byte) {
+	c, s := net.Pipe()
+	rc, rs := &recordingConn{Conn: c}, &recordingConn{Conn: s}
+	clientConn := tls.Client(rc, &tls.Config{
+		ServerName:         "example.com",
+		NextProtos:         []string{"h2", "http/1.1"},
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS12,
+	})
+	serverConn := tls.Server(rs, &tls.Config{
+		Certificates: []tls.Certificate{makeCertificate(t)},
+		NextProtos:   []string{"h2"},
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		serverConn.Handshake()
+	}()
+	if err := clientConn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	wg.Wait()
+	c.Close()
+	s.Close()
+	return rc.written, rs.written
+}
+
+func TestTLSHandshake(t *testing.T) {
+	client, server := handshake(t)
+	table := packet_test.MakeFeatureTest(t, []string{
+		"_tlsServerName", "_tlsClientVersion", "_tlsServerVersion", "_tlsCipherSuite", "_tlsClientALPN", "_tlsServerALPN",
+		"_tlsCertificateSubject", "_tlsCertificateIssuer", "_tlsCertificateNotBefore", "_tlsCertificateNotAfter",
+	}, flows.FlowFeature, flows.FlowOptions{})
+	clientIP := &layers.IPv4{SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	serverIP := &layers.IPv4{SrcIP: net.IP{10, 0, 0, 2}, DstIP: net.IP{10, 0, 0, 1}}
+	// send the data in small segments; every pair of segments arrives swapped and the first one is retransmitted. The
+	// client sequence numbers wrap around.
+	seq := [2]uint32{0xffffffc0, 5000}
+	data := [2][]byte{client, server}
+	when := flows.DateTimeNanoseconds(0)
+	send := func(dir int, seq uint32, payload []byte) {
+		tcp := &layers.TCP{SrcPort: 1234, DstPort: 443, ACK: true, Seq: seq}
+		ip := clientIP
+		if dir == 1 {
+			tcp.SrcPort, tcp.DstPort = 443, 1234
+			ip = serverIP
+		}
+		tcp.Payload = payload
+		table.EventLayers(when, ip, tcp)
+		when++
+	}
+	table.EventLayers(when, clientIP, &layers.TCP{SrcPort: 1234, DstPort: 443, SYN: true, Seq: seq[0] - 1})
+	table.EventLayers(when, serverIP, &layers.TCP{SrcPort: 443, DstPort: 1234, SYN: true, ACK: true, Seq: seq[1] - 1, Ack: seq[0]})
+	for dir := 0; dir < 2; dir++ {
+		for len(data[dir]) > 0 {
+			n := 100
+			if n > len(data[dir]) {
+				n = len(data[dir])
+			}
+			m := 100
+			if n+m > len(data[dir]) {
+				m = len(data[dir]) - n
+			}
+			if m > 0 {
+				send(dir, seq[dir]+uint32(n), data[dir][n:n+m])
+			}
+			send(dir, seq[dir], data[dir][:n])
+			send(dir, seq[dir], data[dir][:n])
+			seq[dir] += uint32(n + m)
+			data[dir] = data[dir][n+m:]
+		}
+	}
+	table.Finish(when)
+	table.AssertFeatureList([]packet_test.FeatureLine{
+		{When: when, Features: []packet_test.FeatureResult{
+			{Name: "_tlsServerName", Value: "example.com"},
+			{Name: "_tlsClientVersion", Value: uint16(tls.VersionTLS12)},
+			{Name: "_tlsServerVersion", Value: uint16(tls.VersionTLS12)},
+			{Name: "_tlsCipherSuite", Value: tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			{Name: "_tlsClientALPN", Value: "h2,http/1.1"},
+			{Name: "_tlsServerALPN", Value: "h2"},
+			{Name: "_tlsCertificateSubject", Value: "CN=example.com"},
+			{Name: "_tlsCertificateIssuer", Value: "CN=example.com"},
+			{Name: "_tlsCertificateNotBefore", Value: flows.DateTimeSeconds(notBefore.Unix())},
+			{Name: "_tlsCertificateNotAfter", Value: flows.DateTimeSeconds(notAfter.Unix())},
+		}},
+	})
+}
+
+func TestJA3(t *testing.T) {
+	hello := []byte{
+		0x03, 0x03, // version
+	}
+	hello = append(hello, make([]byte, 32)...) // random
+	hello = append(hello,
+		0,                                        // session id
+		0, 6, 0x1a, 0x1a, 0x13, 0x01, 0x13, 0x02, // ciphers with GREASE
+		1, 0, // compression
+		0, 30, // extensions
+		0x2a, 0x2a, 0, 0, // GREASE
+		0, 0, 0, 8, 0, 6, 0, 0, 3, 'a', '.', 'b', // server name
+		0, 10, 0, 4, 0, 2, 0, 29, // supported groups
+		0, 11, 0, 2, 1, 0, // point formats
+	)
+	c, err := parseClientHello(hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.serverName != "a.b" {
+		t.Errorf("server name is %q; expected a.b", c.serverName)
+	}
+	if ja3 := c.ja3(); ja3 != "771,4865-4866,0-10-11,29,0" {
+		t.Errorf("ja3 is %q", ja3)
+	}
+	if ja3 := md5Hex(c.ja3()); ja3 != "25a116fec34559b24a512bcd37ea22e3" {
+		t.Errorf("ja3 hash is %q", ja3)
+	}
+	if _, err := parseClientHello(hello[:len(hello)-1]); err == nil {
+		t.Error("truncated ClientHello was accepted")
+	}
+}
@@ -56,6 +56,8 @@ func Less(a, b interface{}) bool {
 		return v < b.(string)
 	case []byte:
 		return bytes.Compare(v, b.([]byte)) < 0
+	case fmt.Stringer:
+		return v.String() < b.(fmt.Stringer).String()
 	}
 	panic(fmt.Sprintf("%v can't be used in comparison", a))
 }
@@ -0,0 +1,79 @@
+package bpf
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/CN-TU/go-flows/util"
+	"github.com/google/gopacket"
+)
+
+type bpfFilter struct {
+	id    string
+	match matcher
+	view  view
+}
+
+func (bf *bpfFilter) ID() string {
+	return bf.id
+}
+
+func (bf *bpfFilter) Init() {
+}
+
+func (bf *bpfFilter) Matches(lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo, n uint64) bool {
+	bf.view.decode(lt, data, ci)
+	return bf.match(&bf.view)
+}
+
+func newBPFFilter(args []string) (arguments []string, ret util.Module, err error) {
+	if len(args) == 0 {
+		return nil, nil, errors.New("bpf filter needs an expression, but was given none")
+	}
+	match, err := compile(args[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't compile bpf expression '%s': %s", args[0], err)
+	}
+	ret = &bpfFilter{
+		id:    "bpf|" + args[0],
+		match: match,
+	}
+	arguments = args[1:]
+	return
+}
+
+func bpfHelp(name string) {
+	fmt.Fprintf(os.Stderr, `
+The %s filter accepts only packets matching a tcpdump-style (pcap-filter)
+expression. The expression is evaluated in go and works with every source
+and link type supported by the packet decoder (ethernet, linux cooked, raw ip).
+
+Supported primitives:
+  [src|dst|src or dst|src and dst] [host] <address or name>
+  [ip|ip6|arp] [src|dst] host <address>, ether [src|dst] host <mac>
+  [src|dst] net <network>[/<len>] | net <network> mask <mask>
+  [tcp|udp|sctp] [src|dst] port <port or service>
+  [tcp|udp|sctp] [src|dst] portrange <low>-<high>
+  ether|ip|ip6|arp|tcp|udp|icmp|icmp6|sctp
+  ip proto <n>, ip6 proto <n>, proto <n>, ether proto <n>
+  vlan [<id>], less <len>, greater <len>
+  [ether] broadcast, [ether|ip|ip6] multicast
+  <expr> <relop> <expr> with proto[offset[:size]], len, numbers, named
+    constants (e.g. tcpflags, tcp-syn, icmptype), and + - * / %% & | ^ << >>
+
+Primitives can be combined with and (&&), or (||), not (!), and parentheses.
+Qualifiers can be omitted to repeat the previous ones (e.g. port 80 or 443).
+
+Differences to libpcap: vlan tags are skipped for all primitives, and ipv6
+extension headers are skipped for transport protocol and port primitives.
+
+Usage:
+  filter %s "<expression>"
+`, name, name)
+}
+
+func init() {
+	packet.RegisterFilter("bpf", "Filter packets with a tcpdump-style expression.", newBPFFilter, bpfHelp)
+}
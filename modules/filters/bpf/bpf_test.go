@@ -0,0 +1,153 @@
+package bpf
+
+import (
+	"net"
+	"testing"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	macA = net.HardwareAddr{0, 1, 2, 3, 4, 5}
+	macB = net.HardwareAddr{0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+)
+
+func serialize(t *testing.T, l ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, l...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type testPacket struct {
+	lt   gopacket.LayerType
+	data []byte
+}
+
+func makePackets(t *testing.T) map[string]testPacket {
+	ip4 := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{192, 168, 1, 2}}
+	tcp := &layers.TCP{SrcPort: 1234, DstPort: 80, SYN: true, Seq: 1, Window: 1000}
+	tcp.SetNetworkLayerForChecksum(ip4)
+	ip6 := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolIPv6HopByHop, SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("ff02::1")}
+	// hop-by-hop options header with a single PadN option
+	hop := gopacket.Payload{byte(layers.IPProtocolUDP), 0, 1, 4, 0, 0, 0, 0}
+	udp := &layers.UDP{SrcPort: 5353, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(ip6)
+	icmp := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolICMPv4, SrcIP: net.IP{10, 0, 0, 3}, DstIP: net.IP{10, 0, 0, 4}}
+	return map[string]testPacket{
+		"tcp4": {layers.LayerTypeEthernet, serialize(t,
+			&layers.Ethernet{SrcMAC: macA, DstMAC: macB, EthernetType: layers.EthernetTypeIPv4},
+			ip4, tcp, gopacket.Payload(make([]byte, 100)))},
+		"udp6vlan": {layers.LayerTypeEthernet, serialize(t,
+			&layers.Ethernet{SrcMAC: macA, DstMAC: net.HardwareAddr{0x33, 0x33, 0, 0, 0, 1}, EthernetType: layers.EthernetTypeDot1Q},
+			&layers.Dot1Q{VLANIdentifier: 42, Type: layers.EthernetTypeIPv6},
+			ip6, hop, udp)},
+		"arp": {layers.LayerTypeEthernet, serialize(t,
+			&layers.Ethernet{SrcMAC: macA, DstMAC: macB, EthernetType: layers.EthernetTypeARP},
+			&layers.ARP{AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4,
+				Operation: layers.ARPRequest, SourceHwAddress: macA, SourceProtAddress: []byte{10, 0, 0, 1},
+				DstHwAddress: make([]byte, 6), DstProtAddress: []byte{10, 0, 0, 9}})},
+		"icmpraw": {packet.LayerTypeIPv46, serialize(t,
+			icmp, &layers.ICMPv4{TypeCode: layers.CreateICMPv4TypeCode(layers.ICMPv4TypeEchoRequest, 0)})},
+	}
+}
+
+func TestBPF(t *testing.T) {
+	packets := makePackets(t)
+	for _, test := range []struct {
+		expr    string
+		matches []string
+	}{
+		{"", []string{"tcp4", "udp6vlan", "arp", "icmpraw"}},
+		{"tcp", []string{"tcp4"}},
+		{"ip", []string{"tcp4", "icmpraw"}},
+		{"ip6", []string{"udp6vlan"}},
+		{"arp", []string{"arp"}},
+		{"icmp", []string{"icmpraw"}},
+		{"ether", []string{"tcp4", "udp6vlan", "arp"}},
+		{"udp port 53", []string{"udp6vlan"}},
+		{"src port 53", nil},
+		{"dst port 80 or 53", []string{"tcp4", "udp6vlan"}},
+		{"tcp dst port http", []string{"tcp4"}},
+		{"portrange 1000-2000", []string{"tcp4"}},
+		{"host 10.0.0.1", []string{"tcp4", "arp"}},
+		{"ip host 10.0.0.1", []string{"tcp4"}},
+		{"dst host 10.0.0.9", []string{"arp"}},
+		{"src or dst 192.168.1.2", []string{"tcp4"}},
+		{"src and dst net 10.0.0.0/24", []string{"arp", "icmpraw"}},
+		{"net 10.0", []string{"tcp4", "arp", "icmpraw"}},
+		{"net 192.168.0.0 mask 255.255.0.0", []string{"tcp4"}},
+		{"host 2001:db8::1", []string{"udp6vlan"}},
+		{"ip6 multicast", []string{"udp6vlan"}},
+		{"ether broadcast", []string{"tcp4", "arp"}},
+		{"ether src 00:01:02:03:04:05 and not arp", []string{"tcp4", "udp6vlan"}},
+		{"ether proto \\arp", []string{"arp"}},
+		{"ip proto \\tcp or ip6 proto 17", []string{"tcp4", "udp6vlan"}},
+		{"vlan 42", []string{"udp6vlan"}},
+		{"vlan and not vlan 1", []string{"udp6vlan"}},
+		{"tcp[tcpflags] & tcp-syn != 0", []string{"tcp4"}},
+		{"tcp[tcpflags] & (tcp-syn|tcp-ack) == tcp-syn && tcp[2:2] = 80", []string{"tcp4"}},
+		{"icmp[icmptype] == icmp-echo", []string{"icmpraw"}},
+		{"ip[9] = 1", []string{"icmpraw"}},
+		{"(ip[2:2] - ((ip[0] & 0xf) << 2)) > 100", []string{"tcp4"}},
+		{"greater 100", []string{"tcp4"}},
+		{"less 64", []string{"arp", "icmpraw"}},
+		{"len / 0 = 0", nil},
+		{"not (tcp or udp)", []string{"arp", "icmpraw"}},
+		{"!tcp && !udp && !arp", []string{"icmpraw"}},
+	} {
+		filter, err := compile(test.expr)
+		if err != nil {
+			t.Errorf("%q: %s", test.expr, err)
+			continue
+		}
+		expected := make(map[string]bool)
+		for _, name := range test.matches {
+			expected[name] = true
+		}
+		for name, p := range packets {
+			var v view
+			v.decode(p.lt, p.data, gopacket.CaptureInfo{})
+			if got := filter(&v); got != expected[name] {
+				t.Errorf("%q on %s: got %t, expected %t", test.expr, name, got, expected[name])
+			}
+		}
+	}
+}
+
+func TestBPFLinkTypes(t *testing.T) {
+	ip4 := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{192, 168, 1, 2}}
+	tcp := &layers.TCP{SrcPort: 1234, DstPort: 80, SYN: true}
+	tcp.SetNetworkLayerForChecksum(ip4)
+	data := serialize(t, ip4, tcp)
+	for _, p := range []testPacket{
+		{layers.LayerTypeLoopback, append([]byte{2, 0, 0, 0}, data...)},
+		{layers.LayerTypePPP, append([]byte{0xff, 0x03, 0x00, 0x21}, data...)},
+	} {
+		var v view
+		v.decode(p.lt, p.data, gopacket.CaptureInfo{})
+		for expr, expected := range map[string]bool{"tcp dst port 80 and src host 10.0.0.1": true, "ether": false, "ip6": false} {
+			filter, err := compile(expr)
+			if err != nil {
+				t.Fatalf("%q: %s", expr, err)
+			}
+			if got := filter(&v); got != expected {
+				t.Errorf("%q on %s: got %t, expected %t", expr, p.lt, got, expected)
+			}
+		}
+	}
+}
+
+func TestBPFErrors(t *testing.T) {
+	for _, expr := range []string{
+		"tcp and", "port", "(tcp", "tcp[0:3] = 1", "ip host 2001:db8::1", "icmp port 80", "ether proto foo",
+		"tcp[0] ~ 1", "net 1.2.3.4.5",
+	} {
+		if _, err := compile(expr); err == nil {
+			t.Errorf("%q was accepted", expr)
+		}
+	}
+}
@@ -0,0 +1,868 @@
+package bpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// matcher returns true if the packet matches
+type matcher func(*view) bool
+
+// value returns the value of an arithmetic expression or false if it can't be computed (e.g. out of bounds)
+type value func(*view) (uint32, bool)
+
+// tokenize splits an expression into words, numbers, and operators. Outside of brackets '-', ':', '/', and '.' are
+// part of words to allow addresses, port ranges, and names like tcp-syn.
+func tokenize(expr string) ([]string, error) {
+	var tokens []string
+	depth := 0
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case isWordChar(c, depth):
+			j := i + 1
+			for j < len(expr) && isWordChar(expr[j], depth) {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			op := ""
+			for _, candidate := range []string{"&&", "||", "<<", ">>", "<=", ">=", "==", "!=", "(", ")", "[", "]", ":", "!", "&", "|", "^", "+", "-", "*", "/", "%", "<", ">", "="} {
+				if strings.HasPrefix(expr[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+			}
+			switch op {
+			case "[":
+				depth++
+			case "]":
+				depth--
+			}
+			tokens = append(tokens, op)
+			i += len(op)
+		}
+	}
+	return tokens, nil
+}
+
+func isWordChar(c byte, depth int) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '\\', c == '.':
+		return true
+	case depth == 0 && (c == '-' || c == ':' || c == '/'):
+		return true
+	}
+	return false
+}
+
+const (
+	dirAny = iota
+	dirSrc
+	dirDst
+	dirBoth // src and dst
+)
+
+// qualifiers are the keywords in front of an id (e.g. "tcp dst port 80")
+type qualifiers struct {
+	proto string
+	dir   int
+	typ   string
+}
+
+var protocols = map[string]bool{
+	"ether": true, "link": true, "ip": true, "ip6": true, "arp": true, "tcp": true, "udp": true, "icmp": true,
+	"icmp6": true, "sctp": true,
+}
+
+var types = map[string]bool{"host": true, "net": true, "port": true, "portrange": true}
+
+// constants are the named values of pcap-filter for arithmetic expressions
+var constants = map[string]uint32{
+	"tcpflags": 13, "tcp-fin": 0x01, "tcp-syn": 0x02, "tcp-rst": 0x04, "tcp-push": 0x08, "tcp-ack": 0x10,
+	"tcp-urg": 0x20, "tcp-ece": 0x40, "tcp-cwr": 0x80,
+	"icmptype": 0, "icmpcode": 1, "icmp-echoreply": 0, "icmp-unreach": 3, "icmp-sourcequench": 4,
+	"icmp-redirect": 5, "icmp-echo": 8, "icmp-routeradvert": 9, "icmp-routersolicit": 10, "icmp-timxceed": 11,
+	"icmp-paramprob": 12, "icmp-tstamp": 13, "icmp-tstampreply": 14, "icmp-ireq": 15, "icmp-ireqreply": 16,
+	"icmp-maskreq": 17, "icmp-maskreply": 18,
+	"icmp6type": 0, "icmp6code": 1, "icmp6-destinationunreach": 1, "icmp6-packettoobig": 2,
+	"icmp6-timeexceeded": 3, "icmp6-parameterproblem": 4, "icmp6-echo": 128, "icmp6-echoreply": 129,
+	"icmp6-routersolicit": 133, "icmp6-routeradvert": 134, "icmp6-neighborsolicit": 135,
+	"icmp6-neighboradvert": 136,
+}
+
+// protocolNumbers are the names allowed after "proto"
+var protocolNumbers = map[string]int{
+	"icmp": protoICMP, "tcp": protoTCP, "udp": protoUDP, "icmp6": protoICMPv6, "sctp": protoSCTP,
+	"igmp": 2, "gre": 47, "esp": 50, "ah": 51, "pim": 103,
+}
+
+// etherTypes are the names allowed after "ether proto"
+var etherTypes = map[string]int{"ip": etherTypeIPv4, "ip6": etherTypeIPv6, "arp": etherTypeARP}
+
+type parser struct {
+	tokens []string
+	pos    int
+	last   *qualifiers // qualifiers of the last primitive for abbreviations like "port 80 or 443"
+}
+
+// compile returns a matcher for the given pcap-filter expression
+func compile(expr string) (matcher, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return func(*view) bool { return true }, nil
+	}
+	p := &parser{tokens: tokens}
+	m, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected '%s'", p.peek())
+	}
+	return m, nil
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() string {
+	ret := p.peek()
+	p.pos++
+	return ret
+}
+
+func (p *parser) accept(tokens ...string) bool {
+	for _, t := range tokens {
+		if p.peek() == t {
+			p.pos++
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) expect(token string) error {
+	if !p.accept(token) {
+		if p.done() {
+			return fmt.Errorf("expected '%s', but expression ended", token)
+		}
+		return fmt.Errorf("expected '%s', but got '%s'", token, p.peek())
+	}
+	return nil
+}
+
+func (p *parser) or() (matcher, error) {
+	a, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("or", "||") {
+		b, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left := a
+		a = func(v *view) bool { return left(v) || b(v) }
+	}
+	return a, nil
+}
+
+func (p *parser) and() (matcher, error) {
+	a, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("and", "&&") {
+		b, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left := a
+		a = func(v *view) bool { return left(v) && b(v) }
+	}
+	return a, nil
+}
+
+func (p *parser) not() (matcher, error) {
+	if p.accept("not", "!") {
+		m, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return func(v *view) bool { return !m(v) }, nil
+	}
+	if p.peek() == "(" {
+		// either a parenthesized expression or an arithmetic expression in parentheses
+		start := p.pos
+		if m, err := p.relation(); err == nil {
+			return m, nil
+		}
+		p.pos = start + 1
+		m, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+	if p.isRelation() {
+		return p.relation()
+	}
+	return p.primitive()
+}
+
+// isRelation returns true if the next tokens start an arithmetic expression
+func (p *parser) isRelation() bool {
+	t := p.peek()
+	if t == "len" || t == "-" {
+		return true
+	}
+	if _, err := parseNumber(t); err == nil {
+		// a lone number after and/or is an abbreviated primitive (e.g. "port 80 or 443")
+		if p.pos+1 < len(p.tokens) {
+			switch p.tokens[p.pos+1] {
+			case "and", "&&", "or", "||", ")":
+				return p.last == nil
+			}
+			return true
+		}
+		return p.last == nil
+	}
+	if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == "[" {
+		return protocols[t]
+	}
+	return false
+}
+
+func (p *parser) relation() (matcher, error) {
+	a, err := p.arith()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	b, err := p.arith()
+	if err != nil {
+		return nil, err
+	}
+	var cmp func(a, b uint32) bool
+	switch op {
+	case ">":
+		cmp = func(a, b uint32) bool { return a > b }
+	case "<":
+		cmp = func(a, b uint32) bool { return a < b }
+	case ">=":
+		cmp = func(a, b uint32) bool { return a >= b }
+	case "<=":
+		cmp = func(a, b uint32) bool { return a <= b }
+	case "=", "==":
+		cmp = func(a, b uint32) bool { return a == b }
+	case "!=":
+		cmp = func(a, b uint32) bool { return a != b }
+	default:
+		return nil, fmt.Errorf("expected a comparison operator, but got '%s'", op)
+	}
+	return func(v *view) bool {
+		x, ok := a(v)
+		if !ok {
+			return false
+		}
+		y, ok := b(v)
+		return ok && cmp(x, y)
+	}, nil
+}
+
+// binary operators from lowest to highest precedence
+var arithLevels = [][]string{{"|", "^"}, {"&"}, {"<<", ">>"}, {"+", "-"}, {"*", "/", "%"}}
+
+func (p *parser) arith() (value, error) {
+	return p.arithLevel(0)
+}
+
+func (p *parser) arithLevel(level int) (value, error) {
+	if level == len(arithLevels) {
+		return p.unaryArith()
+	}
+	a, err := p.arithLevel(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peek()
+		found := false
+		for _, candidate := range arithLevels[level] {
+			if op == candidate {
+				found = true
+			}
+		}
+		if !found {
+			return a, nil
+		}
+		p.pos++
+		b, err := p.arithLevel(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		a = binaryOp(op, a, b)
+	}
+}
+
+func binaryOp(op string, a, b value) value {
+	var f func(x, y uint32) (uint32, bool)
+	switch op {
+	case "|":
+		f = func(x, y uint32) (uint32, bool) { return x | y, true }
+	case "^":
+		f = func(x, y uint32) (uint32, bool) { return x ^ y, true }
+	case "&":
+		f = func(x, y uint32) (uint32, bool) { return x & y, true }
+	case "<<":
+		f = func(x, y uint32) (uint32, bool) { return x << y, true }
+	case ">>":
+		f = func(x, y uint32) (uint32, bool) { return x >> y, true }
+	case "+":
+		f = func(x, y uint32) (uint32, bool) { return x + y, true }
+	case "-":
+		f = func(x, y uint32) (uint32, bool) { return x - y, true }
+	case "*":
+		f = func(x, y uint32) (uint32, bool) { return x * y, true }
+	case "/":
+		f = func(x, y uint32) (uint32, bool) { return safeDiv(x, y, false) }
+	case "%":
+		f = func(x, y uint32) (uint32, bool) { return safeDiv(x, y, true) }
+	}
+	return func(v *view) (uint32, bool) {
+		x, ok := a(v)
+		if !ok {
+			return 0, false
+		}
+		y, ok := b(v)
+		if !ok {
+			return 0, false
+		}
+		return f(x, y)
+	}
+}
+
+func safeDiv(x, y uint32, mod bool) (uint32, bool) {
+	if y == 0 {
+		// like bpf: division by zero rejects the packet
+		return 0, false
+	}
+	if mod {
+		return x % y, true
+	}
+	return x / y, true
+}
+
+func (p *parser) unaryArith() (value, error) {
+	t := p.next()
+	switch {
+	case t == "-":
+		a, err := p.unaryArith()
+		if err != nil {
+			return nil, err
+		}
+		return func(v *view) (uint32, bool) {
+			x, ok := a(v)
+			return -x, ok
+		}, nil
+	case t == "(":
+		a, err := p.arith()
+		if err != nil {
+			return nil, err
+		}
+		return a, p.expect(")")
+	case t == "len":
+		return func(v *view) (uint32, bool) { return v.length, true }, nil
+	case protocols[t] && p.peek() == "[":
+		return p.load(t)
+	}
+	if c, ok := constants[t]; ok {
+		return func(*view) (uint32, bool) { return c, true }, nil
+	}
+	n, err := parseNumber(t)
+	if err != nil {
+		if t == "" {
+			return nil, errors.New("expected a value, but expression ended")
+		}
+		return nil, fmt.Errorf("expected a value, but got '%s'", t)
+	}
+	return func(*view) (uint32, bool) { return n, true }, nil
+}
+
+// load parses proto[offset] or proto[offset:size]
+func (p *parser) load(proto string) (value, error) {
+	p.next() // [
+	offset, err := p.arith()
+	if err != nil {
+		return nil, err
+	}
+	size := 1
+	if p.accept(":") {
+		switch p.next() {
+		case "1":
+		case "2":
+			size = 2
+		case "4":
+			size = 4
+		default:
+			return nil, errors.New("size of a load must be 1, 2, or 4")
+		}
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	base := headerOffset(proto)
+	return func(v *view) (uint32, bool) {
+		b, ok := base(v)
+		if !ok {
+			return 0, false
+		}
+		o, ok := offset(v)
+		if !ok {
+			return 0, false
+		}
+		start := b + int(o)
+		if start < b || start+size > len(v.data) {
+			return 0, false
+		}
+		switch size {
+		case 2:
+			return uint32(binary.BigEndian.Uint16(v.data[start:])), true
+		case 4:
+			return binary.BigEndian.Uint32(v.data[start:]), true
+		}
+		return uint32(v.data[start]), true
+	}, nil
+}
+
+// headerOffset returns a function returning the start of the given protocol header
+func headerOffset(proto string) func(*view) (int, bool) {
+	switch proto {
+	case "ether":
+		return func(v *view) (int, bool) { return 0, v.ether >= 0 }
+	case "link":
+		return func(v *view) (int, bool) { return 0, true }
+	case "ip":
+		return func(v *view) (int, bool) { return v.network, v.isIPv4() }
+	case "ip6":
+		return func(v *view) (int, bool) { return v.network, v.isIPv6() }
+	case "arp":
+		return func(v *view) (int, bool) { return v.network, v.network >= 0 && v.ethertype == etherTypeARP }
+	}
+	number := protocolNumbers[proto]
+	return func(v *view) (int, bool) {
+		return v.transport, v.transport >= 0 && v.proto == number && (number != protoICMP || v.isIPv4())
+	}
+}
+
+func parseNumber(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 0, 32)
+	return uint32(n), err
+}
+
+func (p *parser) primitive() (matcher, error) {
+	switch t := p.peek(); t {
+	case "less", "greater":
+		p.next()
+		n, err := parseNumber(p.next())
+		if err != nil {
+			return nil, fmt.Errorf("%s needs a length", t)
+		}
+		if t == "less" {
+			return func(v *view) bool { return v.length <= n }, nil
+		}
+		return func(v *view) bool { return v.length >= n }, nil
+	case "vlan":
+		p.next()
+		if n, err := parseNumber(p.peek()); err == nil {
+			p.next()
+			return func(v *view) bool { return v.vlans > 0 && uint32(v.vlanID) == n }, nil
+		}
+		return func(v *view) bool { return v.vlans > 0 }, nil
+	case "broadcast", "multicast":
+		return p.special("ether")
+	case "proto":
+		p.next()
+		return p.proto("")
+	}
+
+	var q qualifiers
+	explicit := false
+	if protocols[p.peek()] {
+		q.proto = p.next()
+		explicit = true
+		switch p.peek() {
+		case "proto":
+			p.next()
+			return p.proto(q.proto)
+		case "broadcast", "multicast":
+			return p.special(q.proto)
+		case "host", "net", "port", "portrange", "src", "dst":
+		default:
+			// protocol only
+			p.last = nil
+			return protocolMatcher(q.proto)
+		}
+	}
+	if first := p.peek(); first == "src" || first == "dst" {
+		p.next()
+		explicit = true
+		q.dir = dirSrc
+		other := "dst"
+		if first == "dst" {
+			q.dir = dirDst
+			other = "src"
+		}
+		// "src or dst" and "src and dst"
+		if p.pos+1 < len(p.tokens) && p.tokens[p.pos+1] == other {
+			switch p.next() {
+			case "or":
+				q.dir = dirAny
+			case "and":
+				q.dir = dirBoth
+			default:
+				return nil, fmt.Errorf("unexpected '%s' after %s", p.tokens[p.pos-1], first)
+			}
+			p.next()
+		}
+	}
+	if types[p.peek()] {
+		q.typ = p.next()
+		explicit = true
+	}
+	if !explicit && p.last != nil {
+		q = *p.last
+	}
+	if q.typ == "" {
+		q.typ = "host"
+	}
+	id := p.next()
+	if id == "" {
+		return nil, errors.New("expected an id, but expression ended")
+	}
+	p.last = &q
+	switch q.typ {
+	case "host":
+		return p.host(q, id)
+	case "net":
+		return p.net(q, id)
+	case "port":
+		port, err := parsePort(id, q.proto)
+		if err != nil {
+			return nil, err
+		}
+		return portMatcher(q, port, port)
+	default:
+		r := strings.SplitN(id, "-", 2)
+		if len(r) != 2 {
+			return nil, fmt.Errorf("invalid port range '%s'", id)
+		}
+		low, err := parsePort(r[0], q.proto)
+		if err != nil {
+			return nil, err
+		}
+		high, err := parsePort(r[1], q.proto)
+		if err != nil {
+			return nil, err
+		}
+		if low > high {
+			low, high = high, low
+		}
+		return portMatcher(q, low, high)
+	}
+}
+
+// proto parses the argument of [ether|ip|ip6] proto
+func (p *parser) proto(qualifier string) (matcher, error) {
+	p.last = nil
+	id := strings.TrimPrefix(p.next(), "\\")
+	if qualifier == "ether" {
+		n, ok := etherTypes[id]
+		if !ok {
+			number, err := parseNumber(id)
+			if err != nil {
+				return nil, fmt.Errorf("unknown ether protocol '%s'", id)
+			}
+			n = int(number)
+		}
+		return func(v *view) bool { return v.ethertype == n }, nil
+	}
+	n, ok := protocolNumbers[id]
+	if !ok {
+		number, err := parseNumber(id)
+		if err != nil || number > 255 {
+			return nil, fmt.Errorf("unknown protocol '%s'", id)
+		}
+		n = int(number)
+	}
+	switch qualifier {
+	case "ip":
+		return func(v *view) bool { return v.isIPv4() && v.proto == n }, nil
+	case "ip6":
+		return func(v *view) bool { return v.isIPv6() && v.proto == n }, nil
+	case "":
+		return func(v *view) bool { return v.proto == n }, nil
+	}
+	return nil, fmt.Errorf("proto can't be used with %s", qualifier)
+}
+
+// special parses broadcast and multicast
+func (p *parser) special(qualifier string) (matcher, error) {
+	p.last = nil
+	switch t := p.next(); {
+	case qualifier == "ether" && t == "broadcast":
+		return func(v *view) bool {
+			_, dst := v.etherAddresses()
+			return dst != nil && bytes.Equal(dst, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+		}, nil
+	case qualifier == "ether" && t == "multicast":
+		return func(v *view) bool {
+			_, dst := v.etherAddresses()
+			return dst != nil && dst[0]&1 != 0
+		}, nil
+	case qualifier == "ip" && t == "multicast":
+		return func(v *view) bool {
+			_, dst := v.addresses()
+			return v.isIPv4() && dst[0] >= 224 && dst[0] < 240
+		}, nil
+	case qualifier == "ip6" && t == "multicast":
+		return func(v *view) bool {
+			_, dst := v.addresses()
+			return v.isIPv6() && dst[0] == 0xff
+		}, nil
+	default:
+		return nil, fmt.Errorf("%s %s is not supported", qualifier, t)
+	}
+}
+
+func protocolMatcher(proto string) (matcher, error) {
+	switch proto {
+	case "ether", "link":
+		return func(v *view) bool { return v.ether >= 0 }, nil
+	case "ip":
+		return func(v *view) bool { return v.isIPv4() }, nil
+	case "ip6":
+		return func(v *view) bool { return v.isIPv6() }, nil
+	case "arp":
+		return func(v *view) bool { return v.network >= 0 && v.ethertype == etherTypeARP }, nil
+	case "icmp":
+		return func(v *view) bool { return v.isIPv4() && v.proto == protoICMP }, nil
+	case "icmp6":
+		return func(v *view) bool { return v.isIPv6() && v.proto == protoICMPv6 }, nil
+	}
+	n := protocolNumbers[proto]
+	return func(v *view) bool { return (v.isIPv4() || v.isIPv6()) && v.proto == n }, nil
+}
+
+// matchDirection applies match to the source and/or destination according to dir
+func matchDirection(dir int, src, dst func() bool) bool {
+	switch dir {
+	case dirSrc:
+		return src()
+	case dirDst:
+		return dst()
+	case dirBoth:
+		return src() && dst()
+	}
+	return src() || dst()
+}
+
+// networkAllowed returns a matcher checking the network protocol qualifier for host and net
+func networkAllowed(proto string, ipv4 bool) (func(*view) bool, error) {
+	switch proto {
+	case "":
+		if ipv4 {
+			return func(v *view) bool { return v.isIPv4() || v.ethertype == etherTypeARP }, nil
+		}
+		return func(v *view) bool { return v.isIPv6() }, nil
+	case "ip":
+		if ipv4 {
+			return func(v *view) bool { return v.isIPv4() }, nil
+		}
+	case "ip6":
+		if !ipv4 {
+			return func(v *view) bool { return v.isIPv6() }, nil
+		}
+	case "arp":
+		if ipv4 {
+			return func(v *view) bool { return v.ethertype == etherTypeARP }, nil
+		}
+	}
+	return nil, fmt.Errorf("address family doesn't match the protocol %s", proto)
+}
+
+func (p *parser) host(q qualifiers, id string) (matcher, error) {
+	if q.proto == "ether" || q.proto == "link" {
+		mac, err := net.ParseMAC(id)
+		if err != nil {
+			return nil, err
+		}
+		return func(v *view) bool {
+			src, dst := v.etherAddresses()
+			if src == nil {
+				return false
+			}
+			return matchDirection(q.dir, func() bool { return bytes.Equal(src, mac) }, func() bool { return bytes.Equal(dst, mac) })
+		}, nil
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(id); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		var err error
+		if ips, err = net.LookupIP(id); err != nil {
+			return nil, fmt.Errorf("couldn't resolve host '%s': %s", id, err)
+		}
+	}
+	var matchers []matcher
+	for _, ip := range ips {
+		m, err := addressMatcher(q, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ipBytes(ip))*8, len(ipBytes(ip))*8)})
+		if err != nil {
+			if len(ips) == 1 {
+				return nil, err
+			}
+			continue
+		}
+		matchers = append(matchers, m)
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("host '%s' has no address usable with %s", id, q.proto)
+	}
+	return func(v *view) bool {
+		for _, m := range matchers {
+			if m(v) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func (p *parser) net(q qualifiers, id string) (matcher, error) {
+	var network *net.IPNet
+	if p.accept("mask") {
+		mask := net.ParseIP(p.next())
+		ip := net.ParseIP(id)
+		if ip == nil || mask == nil || ip.To4() == nil || mask.To4() == nil {
+			return nil, errors.New("net with mask needs an ipv4 address and mask")
+		}
+		network = &net.IPNet{IP: ip.To4(), Mask: net.IPMask(mask.To4())}
+	} else if strings.Contains(id, "/") {
+		_, n, err := net.ParseCIDR(id)
+		if err != nil {
+			return nil, err
+		}
+		network = n
+	} else if ip := net.ParseIP(id); ip != nil {
+		network = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ipBytes(ip))*8, len(ipBytes(ip))*8)}
+	} else {
+		// abbreviated ipv4 network (e.g. 10.1)
+		parts := strings.Split(id, ".")
+		if len(parts) > 3 {
+			return nil, fmt.Errorf("invalid network '%s'", id)
+		}
+		ip := make(net.IP, 4)
+		for i, part := range parts {
+			n, err := strconv.ParseUint(part, 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network '%s'", id)
+			}
+			ip[i] = byte(n)
+		}
+		network = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(parts)*8, 32)}
+	}
+	return addressMatcher(q, network)
+}
+
+func ipBytes(ip net.IP) net.IP {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func addressMatcher(q qualifiers, network *net.IPNet) (matcher, error) {
+	network.IP = ipBytes(network.IP)
+	allowed, err := networkAllowed(q.proto, len(network.IP) == 4)
+	if err != nil {
+		return nil, err
+	}
+	return func(v *view) bool {
+		if !allowed(v) {
+			return false
+		}
+		src, dst := v.addresses()
+		if src == nil {
+			return false
+		}
+		return matchDirection(q.dir, func() bool { return network.Contains(src) }, func() bool { return network.Contains(dst) })
+	}, nil
+}
+
+func parsePort(id, proto string) (uint16, error) {
+	if n, err := strconv.ParseUint(id, 10, 16); err == nil {
+		return uint16(n), nil
+	}
+	network := proto
+	if network != "udp" {
+		network = "tcp"
+	}
+	n, err := net.LookupPort(network, id)
+	if err != nil {
+		return 0, fmt.Errorf("unknown port '%s'", id)
+	}
+	return uint16(n), nil
+}
+
+func portMatcher(q qualifiers, low, high uint16) (matcher, error) {
+	var proto func(*view) bool
+	switch q.proto {
+	case "":
+		proto = func(v *view) bool { return true }
+	case "ip":
+		proto = func(v *view) bool { return v.isIPv4() }
+	case "ip6":
+		proto = func(v *view) bool { return v.isIPv6() }
+	case "tcp", "udp", "sctp":
+		n := protocolNumbers[q.proto]
+		proto = func(v *view) bool { return v.proto == n }
+	default:
+		return nil, fmt.Errorf("port can't be used with %s", q.proto)
+	}
+	return func(v *view) bool {
+		if !proto(v) {
+			return false
+		}
+		src, dst, ok := v.ports()
+		if !ok {
+			return false
+		}
+		return matchDirection(q.dir, func() bool { return src >= low && src <= high }, func() bool { return dst >= low && dst <= high })
+	}, nil
+}
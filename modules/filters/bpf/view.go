@@ -0,0 +1,191 @@
+package bpf
+
+import (
+	"encoding/binary"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+
+	protoICMP   = 1
+	protoTCP    = 6
+	protoUDP    = 17
+	protoICMPv6 = 58
+	protoSCTP   = 132
+)
+
+// view holds the header offsets of a packet. Offsets are -1 if the header is not present.
+type view struct {
+	data      []byte
+	length    uint32 // length on the wire
+	ether     int    // ethernet header
+	ethertype int    // ethertype after vlan tags; -1 if unknown
+	vlans     int    // number of vlan tags
+	vlanID    uint16 // id of the outermost vlan tag
+	network   int    // ipv4, ipv6, or arp header
+	proto     int    // transport protocol (ipv4 protocol or last ipv6 next header); -1 if unknown
+	transport int    // transport header; -1 also for non-first fragments
+}
+
+// decode fills v with the headers of data, which starts with a layer of type lt
+func (v *view) decode(lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo) {
+	*v = view{
+		data:      data,
+		length:    uint32(ci.Length),
+		ether:     -1,
+		ethertype: -1,
+		network:   -1,
+		proto:     -1,
+		transport: -1,
+	}
+	if v.length == 0 {
+		v.length = uint32(len(data))
+	}
+	off := 0
+	switch lt {
+	case layers.LayerTypeEthernet:
+		if len(data) < 14 {
+			return
+		}
+		v.ether = 0
+		v.ethertype = int(binary.BigEndian.Uint16(data[12:]))
+		off = 14
+	case layers.LayerTypeLinuxSLL:
+		if len(data) < 16 {
+			return
+		}
+		v.ethertype = int(binary.BigEndian.Uint16(data[14:]))
+		off = 16
+	case packet.LayerTypeIPv46, layers.LayerTypeIPv4, layers.LayerTypeIPv6:
+		if len(data) < 1 {
+			return
+		}
+		switch data[0] >> 4 {
+		case 4:
+			v.ethertype = etherTypeIPv4
+		case 6:
+			v.ethertype = etherTypeIPv6
+		}
+	default:
+		// loopback, ppp, sll2, and 802.11 carry no ethernet header
+		ethertype, network, ok := packet.NetworkLayer(lt, data)
+		if !ok {
+			return
+		}
+		v.ethertype = int(ethertype)
+		off = cap(data) - cap(network)
+	}
+	for v.ethertype == etherTypeVLAN || v.ethertype == etherTypeQinQ {
+		if len(data) < off+4 {
+			v.ethertype = -1
+			return
+		}
+		if v.vlans == 0 {
+			v.vlanID = binary.BigEndian.Uint16(data[off:]) & 0xfff
+		}
+		v.vlans++
+		v.ethertype = int(binary.BigEndian.Uint16(data[off+2:]))
+		off += 4
+	}
+	switch v.ethertype {
+	case etherTypeIPv4:
+		if len(data) < off+20 {
+			return
+		}
+		v.network = off
+		v.proto = int(data[off+9])
+		if binary.BigEndian.Uint16(data[off+6:])&0x1fff == 0 {
+			v.transport = off + int(data[off]&0xf)*4
+		}
+	case etherTypeIPv6:
+		if len(data) < off+40 {
+			return
+		}
+		v.network = off
+		next := int(data[off+6])
+		off += 40
+		for {
+			switch next {
+			case 0, 43, 60: // hop-by-hop, routing, destination options
+				if len(data) < off+2 {
+					return
+				}
+				next, off = int(data[off]), off+(int(data[off+1])+1)*8
+				continue
+			case 51: // authentication header
+				if len(data) < off+2 {
+					return
+				}
+				next, off = int(data[off]), off+(int(data[off+1])+2)*4
+				continue
+			case 44: // fragment
+				if len(data) < off+8 {
+					return
+				}
+				v.proto = int(data[off])
+				if binary.BigEndian.Uint16(data[off+2:])>>3 == 0 {
+					v.transport = off + 8
+				}
+				return
+			}
+			break
+		}
+		v.proto = next
+		v.transport = off
+	case etherTypeARP:
+		if len(data) >= off+8 {
+			v.network = off
+		}
+	}
+}
+
+func (v *view) isIPv4() bool { return v.network >= 0 && v.ethertype == etherTypeIPv4 }
+func (v *view) isIPv6() bool { return v.network >= 0 && v.ethertype == etherTypeIPv6 }
+
+// addresses returns the source and destination network addresses (ipv4, ipv6, or arp with ipv4 addresses)
+func (v *view) addresses() (src, dst []byte) {
+	n := v.network
+	switch {
+	case v.isIPv4():
+		return v.data[n+12 : n+16], v.data[n+16 : n+20]
+	case v.isIPv6():
+		return v.data[n+8 : n+24], v.data[n+24 : n+40]
+	case v.network >= 0 && v.ethertype == etherTypeARP:
+		hlen, plen := int(v.data[n+4]), int(v.data[n+5])
+		if plen != 4 || len(v.data) < n+8+2*hlen+8 {
+			return nil, nil
+		}
+		spa := n + 8 + hlen
+		tpa := spa + 4 + hlen
+		return v.data[spa : spa+4], v.data[tpa : tpa+4]
+	}
+	return nil, nil
+}
+
+// ports returns the source and destination ports of tcp, udp, and sctp
+func (v *view) ports() (src, dst uint16, ok bool) {
+	if v.transport < 0 || len(v.data) < v.transport+4 {
+		return
+	}
+	switch v.proto {
+	case protoTCP, protoUDP, protoSCTP:
+		return binary.BigEndian.Uint16(v.data[v.transport:]), binary.BigEndian.Uint16(v.data[v.transport+2:]), true
+	}
+	return
+}
+
+// etherAddresses returns the source and destination mac addresses
+func (v *view) etherAddresses() (src, dst []byte) {
+	if v.ether < 0 {
+		return nil, nil
+	}
+	return v.data[6:12], v.data[0:6]
+}
@@ -0,0 +1,179 @@
+package cidr
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/CN-TU/go-flows/util"
+	"github.com/google/gopacket"
+)
+
+type fileList []string
+
+func (f *fileList) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *fileList) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+type cidrFilter struct {
+	id       string
+	files    []string
+	prefixes []string
+	src, dst bool
+	exclude  bool
+	list     atomic.Value // *prefixList
+}
+
+func (cf *cidrFilter) ID() string {
+	return cf.id
+}
+
+// Init reloads the list on SIGHUP, if it was read from files
+func (cf *cidrFilter) Init() {
+	if len(cf.files) == 0 {
+		return
+	}
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			list, err := cf.load()
+			if err != nil {
+				log.Println("Couldn't reload cidr list, keeping the old one: ", err)
+				continue
+			}
+			cf.list.Store(list)
+			log.Printf("Reloaded cidr list with %d prefixes\n", list.n)
+		}
+	}()
+}
+
+func (cf *cidrFilter) load() (*prefixList, error) {
+	list := &prefixList{}
+	for _, prefix := range cf.prefixes {
+		if err := list.add(prefix); err != nil {
+			return nil, err
+		}
+	}
+	for _, file := range cf.files {
+		if err := list.addFile(file); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+func (cf *cidrFilter) Matches(lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo, n uint64) bool {
+	src, dst := addresses(lt, data)
+	matched := false
+	if src != nil {
+		list := cf.list.Load().(*prefixList)
+		matched = (cf.src && list.contains(src)) || (cf.dst && list.contains(dst))
+	}
+	return matched != cf.exclude
+}
+
+func newCIDRFilter(args []string) (arguments []string, ret util.Module, err error) {
+	var files fileList
+
+	set := flag.NewFlagSet("cidr", flag.ExitOnError)
+	set.Usage = func() { cidrHelp("cidr") }
+	set.Var(&files, "file", "File with one prefix per line (can be given multiple times)")
+	match := set.String("match", "any", "Address to match: src, dst, or any")
+	exclude := set.Bool("exclude", false, "Drop matching packets instead of keeping them")
+
+	set.Parse(args)
+
+	arguments = set.Args()
+	var prefixes []string
+	for len(arguments) > 0 {
+		if arguments[0] == "--" {
+			arguments = arguments[1:]
+			break
+		}
+		if !strings.ContainsAny(arguments[0], ".:") {
+			break
+		}
+		prefixes = append(prefixes, arguments[0])
+		arguments = arguments[1:]
+	}
+
+	if len(files) == 0 && len(prefixes) == 0 {
+		return nil, nil, errors.New("cidr filter needs at least one prefix or list file")
+	}
+
+	cf := &cidrFilter{
+		files:    files,
+		prefixes: prefixes,
+		exclude:  *exclude,
+	}
+	switch *match {
+	case "src":
+		cf.src = true
+	case "dst":
+		cf.dst = true
+	case "any":
+		cf.src = true
+		cf.dst = true
+	default:
+		return nil, nil, fmt.Errorf("cidr filter -match must be src, dst, or any, but was given '%s'", *match)
+	}
+
+	list, err := cf.load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("couldn't load cidr list: %s", err)
+	}
+	cf.list.Store(list)
+
+	mode := "include"
+	if cf.exclude {
+		mode = "exclude"
+	}
+	cf.id = fmt.Sprint("cidr|", mode, "|", *match, "|", strings.Join(append(append([]string{}, files...), prefixes...), ";"))
+	ret = cf
+	return
+}
+
+func cidrHelp(name string) {
+	fmt.Fprintf(os.Stderr, `
+The %s filter accepts or drops packets based on their ip addresses. The
+prefixes (ipv4 and ipv6 in CIDR notation or single addresses) can be given
+inline or in list files with one prefix per line. Empty lines and everything
+after # are ignored in list files. The prefixes are stored in a radix trie,
+which allows lists with a large number of prefixes.
+
+On SIGHUP the list files are read again and replace the current list. If a
+file can't be read, the current list is kept.
+
+Packets without an ip header never match, i.e., they are dropped in include
+mode and kept in exclude mode. The inline prefix list ends at the first
+argument that is not an address or at "--".
+
+Flags:
+  -file <file>
+    File with prefixes (can be given multiple times)
+  -match src|dst|any
+    Address that must be covered by a prefix (default any)
+  -exclude
+    Drop matching packets instead of keeping only matching packets
+
+Usage:
+  filter %s [-file list.txt] [-match src|dst|any] [-exclude] [10.0.0.0/8] [2001:db8::/32] [..] [--]
+`, name, name)
+}
+
+func init() {
+	packet.RegisterFilter("cidr", "Filter packets based on ip address prefix lists.", newCIDRFilter, cidrHelp)
+}
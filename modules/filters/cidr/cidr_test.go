@@ -0,0 +1,161 @@
+package cidr
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestTrie(t *testing.T) {
+	list := &prefixList{}
+	for _, prefix := range []string{"10.1.2.0/24", "10.0.0.0/8", "192.168.1.1", "192.168.1.128/25", "172.16.0.0/12", "2001:db8::/32", "2001:db8:1::1"} {
+		if err := list.add(prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for addr, expected := range map[string]bool{
+		"10.0.0.1":      true,
+		"10.255.1.1":    true,
+		"11.0.0.1":      false,
+		"192.168.1.1":   true,
+		"192.168.1.2":   false,
+		"192.168.1.200": true,
+		"172.31.0.1":    true,
+		"172.32.0.1":    false,
+		"2001:db8::5":   true,
+		"2001:db9::1":   false,
+		"::1":           false,
+	} {
+		ip := net.ParseIP(addr)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		if got := list.contains(ip); got != expected {
+			t.Errorf("%s: got %t, expected %t", addr, got, expected)
+		}
+	}
+	list.add("0.0.0.0/0")
+	if !list.contains(net.IP{11, 0, 0, 1}) {
+		t.Error("default route didn't match")
+	}
+	if err := list.add("10.0.0.0/33"); err == nil {
+		t.Error("invalid prefix was accepted")
+	}
+}
+
+func TestTrieMappedPrefixes(t *testing.T) {
+	list := &prefixList{}
+	for _, prefix := range []string{"::ffff:10.0.0.0/104", "::ffff:192.168.1.1", "2001:db8::/32"} {
+		if err := list.add(prefix); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for addr, expected := range map[string]bool{
+		"10.0.0.1":    true,
+		"11.0.0.1":    false,
+		"192.168.1.1": true,
+		"192.168.1.2": false,
+		"2001:db8::1": true,
+		"::1":         false,
+	} {
+		ip := net.ParseIP(addr)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip = ip4
+		}
+		if got := list.contains(ip); got != expected {
+			t.Errorf("%s: got %t, expected %t", addr, got, expected)
+		}
+	}
+	if list.v4 == nil || list.v4.bits > 32 {
+		t.Error("mapped prefixes must be added as ipv4 prefixes")
+	}
+}
+
+func makePacket(t *testing.T, src, dst net.IP) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	var ip gopacket.SerializableLayer
+	if src.To4() != nil {
+		ip = &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolUDP, SrcIP: src, DstIP: dst}
+	} else {
+		ip = &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: src, DstIP: dst}
+	}
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ip, &layers.UDP{SrcPort: 1, DstPort: 2}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestCIDRFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cidr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "list.txt")
+	if err := ioutil.WriteFile(file, []byte("# scanners\n10.0.0.0/8\n\n2001:db8::/32 # lab\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	inside, outside := net.IP{10, 1, 1, 1}, net.IP{192, 168, 0, 1}
+	inside6, outside6 := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db9::1")
+	packets := [][]byte{
+		makePacket(t, inside, outside),
+		makePacket(t, outside, inside),
+		makePacket(t, outside, outside),
+		makePacket(t, outside6, inside6),
+	}
+	for _, test := range []struct {
+		args     []string
+		expected []bool
+	}{
+		{[]string{"-file", file}, []bool{true, true, false, true}},
+		{[]string{"-file", file, "-match", "src"}, []bool{true, false, false, false}},
+		{[]string{"-file", file, "-match", "dst"}, []bool{false, true, false, true}},
+		{[]string{"-file", file, "-exclude"}, []bool{false, false, true, false}},
+		{[]string{"-match", "dst", "-exclude", "192.168.0.0/16", "--"}, []bool{false, true, false, true}},
+	} {
+		args, filter, err := newCIDRFilter(test.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(args) != 0 {
+			t.Errorf("%v: unused arguments %v", test.args, args)
+		}
+		for i, data := range packets {
+			if got := filter.(packet.Filter).Matches(packet.LayerTypeIPv46, data, gopacket.CaptureInfo{}, 0); got != test.expected[i] {
+				t.Errorf("%v: packet %d: got %t, expected %t", test.args, i, got, test.expected[i])
+			}
+		}
+	}
+
+	// the list is read again on reload
+	_, filter, err := newCIDRFilter([]string{"-file", file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf := filter.(*cidrFilter)
+	if err := ioutil.WriteFile(file, []byte("192.168.0.0/16\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	list, err := cf.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cf.list.Store(list)
+	if cf.Matches(packet.LayerTypeIPv46, packets[3], gopacket.CaptureInfo{}, 0) || !cf.Matches(packet.LayerTypeIPv46, packets[2], gopacket.CaptureInfo{}, 0) {
+		t.Error("reloaded list wasn't used")
+	}
+
+	if err := ioutil.WriteFile(file, []byte("no prefix\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := newCIDRFilter([]string{"-file", file}); err == nil {
+		t.Error("invalid list file was accepted")
+	}
+}
@@ -0,0 +1,108 @@
+package cidr
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// prefixList holds the ipv4 and ipv6 prefixes of a list
+type prefixList struct {
+	v4, v6 *node
+	n      int
+}
+
+// add parses a prefix in CIDR notation or a single address and adds it to the list. IPv4-mapped IPv6 prefixes
+// (::ffff:a.b.c.d/n with n >= 96) are added as IPv4 prefixes, since packets carry the plain IPv4 address.
+func (l *prefixList) add(prefix string) error {
+	if !strings.Contains(prefix, "/") {
+		if net.ParseIP(prefix) == nil {
+			return fmt.Errorf("invalid address '%s'", prefix)
+		}
+		if strings.Contains(prefix, ":") {
+			prefix += "/128"
+		} else {
+			prefix += "/32"
+		}
+	}
+	_, network, err := net.ParseCIDR(prefix)
+	if err != nil {
+		return err
+	}
+	ones, size := network.Mask.Size()
+	trie, key := &l.v6, network.IP.To16()
+	if ip4 := network.IP.To4(); ip4 != nil {
+		switch {
+		case size == 32:
+			trie, key = &l.v4, ip4
+		case ones >= 96:
+			trie, key, ones = &l.v4, ip4, ones-96
+		}
+	}
+	if key == nil || ones > len(key)*8 {
+		return fmt.Errorf("invalid prefix '%s'", prefix)
+	}
+	insert(trie, key, ones)
+	l.n++
+	return nil
+}
+
+// addFile adds all the prefixes in the given file. Every line holds one prefix; empty lines and everything after # is
+// ignored.
+func (l *prefixList) addFile(name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if err := l.add(text); err != nil {
+			return fmt.Errorf("%s:%d: %s", name, line, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func (l *prefixList) contains(addr []byte) bool {
+	if len(addr) == 4 {
+		return contains(l.v4, addr)
+	}
+	return contains(l.v6, addr)
+}
+
+// addresses returns the source and destination ip addresses of a packet starting with a layer of type lt, or nil if
+// the packet is not an ip packet
+func addresses(lt gopacket.LayerType, data []byte) (src, dst []byte) {
+	ethertype, data, ok := packet.NetworkLayer(lt, data)
+	if !ok {
+		return
+	}
+	switch ethertype {
+	case layers.EthernetTypeIPv4:
+		if len(data) >= 20 {
+			return data[12:16], data[16:20]
+		}
+	case layers.EthernetTypeIPv6:
+		if len(data) >= 40 {
+			return data[8:24], data[24:40]
+		}
+	}
+	return
+}
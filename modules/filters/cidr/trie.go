@@ -0,0 +1,83 @@
+package cidr
+
+import "math/bits"
+
+// node is a node of a path compressed binary trie (radix trie) holding network prefixes. Only the first bits of key
+// are valid.
+type node struct {
+	key   []byte
+	bits  int
+	set   bool // true if this node is a prefix of the list and not only an inner node
+	child [2]*node
+}
+
+func bit(key []byte, i int) int {
+	return int(key[i/8]>>(7-uint(i%8))) & 1
+}
+
+// commonBits returns the number of leading bits a and b have in common, but at most max and at most the length of the
+// shorter one
+func commonBits(a, b []byte, max int) int {
+	n := 0
+	for i := 0; n < max && i < len(a) && i < len(b); i++ {
+		if x := a[i] ^ b[i]; x != 0 {
+			n += bits.LeadingZeros8(x)
+			break
+		}
+		n += 8
+	}
+	if n > max {
+		return max
+	}
+	return n
+}
+
+// insert adds the prefix key/ones to the trie rooted at n
+func insert(n **node, key []byte, ones int) {
+	for {
+		cur := *n
+		if cur == nil {
+			*n = &node{key: key, bits: ones, set: true}
+			return
+		}
+		max := cur.bits
+		if ones < max {
+			max = ones
+		}
+		common := commonBits(cur.key, key, max)
+		if common == cur.bits {
+			if ones == cur.bits {
+				cur.set = true
+				return
+			}
+			n = &cur.child[bit(key, cur.bits)]
+			continue
+		}
+		split := &node{key: key, bits: common}
+		split.child[bit(cur.key, common)] = cur
+		if common == ones {
+			split.set = true
+		} else {
+			split.child[bit(key, common)] = &node{key: key, bits: ones, set: true}
+		}
+		*n = split
+		return
+	}
+}
+
+// contains returns true if addr is covered by a prefix in the trie rooted at n
+func contains(n *node, addr []byte) bool {
+	for n != nil {
+		if commonBits(n.key, addr, n.bits) != n.bits {
+			return false
+		}
+		if n.set {
+			return true
+		}
+		if n.bits == len(addr)*8 {
+			return false
+		}
+		n = n.child[bit(addr, n.bits)]
+	}
+	return false
+}
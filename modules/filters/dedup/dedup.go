@@ -0,0 +1,160 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/CN-TU/go-flows/util"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const fnvBasis = 14695981039346656037
+const fnvPrime = 1099511628211
+
+func fnvHash(h uint64, data []byte) uint64 {
+	for _, b := range data {
+		h ^= uint64(b)
+		h *= fnvPrime
+	}
+	return h
+}
+
+// packetHash hashes the network layer of a packet without the fields that change on the way between two capture
+// points (link layer, ipv4 ttl and header checksum, ipv6 hop limit). Non-ip packets are hashed completely.
+func packetHash(lt gopacket.LayerType, data []byte) uint64 {
+	ethertype, network, ok := packet.NetworkLayer(lt, data)
+	if !ok {
+		return fnvHash(fnvBasis, data)
+	}
+	h := fnvHash(fnvBasis, []byte{byte(ethertype >> 8), byte(ethertype)})
+	switch ethertype {
+	case layers.EthernetTypeIPv4:
+		if len(network) < 20 {
+			break
+		}
+		// cut off ethernet padding
+		if length := int(binary.BigEndian.Uint16(network[2:])); length >= 20 && length < len(network) {
+			network = network[:length]
+		}
+		h = fnvHash(h, network[:8])
+		h = fnvHash(h, network[9:10])
+		return fnvHash(h, network[12:])
+	case layers.EthernetTypeIPv6:
+		if len(network) < 40 {
+			break
+		}
+		if length := int(binary.BigEndian.Uint16(network[4:])) + 40; length > 40 && length < len(network) {
+			network = network[:length]
+		}
+		h = fnvHash(h, network[:7])
+		return fnvHash(h, network[8:])
+	}
+	return fnvHash(h, network)
+}
+
+type seenPacket struct {
+	hash uint64
+	time int64
+}
+
+type dedupFilter struct {
+	id         string
+	window     int64
+	seen       map[uint64]int64 // hash -> time the packet was last accepted
+	queue      []seenPacket     // accepted packets in arrival order for expiring seen
+	head       int
+	suppressed uint64
+}
+
+func (df *dedupFilter) ID() string {
+	return df.id
+}
+
+func (df *dedupFilter) Init() {
+}
+
+func (df *dedupFilter) expire(now int64) {
+	for df.head < len(df.queue) && now-df.queue[df.head].time > df.window {
+		old := df.queue[df.head]
+		if df.seen[old.hash] == old.time {
+			delete(df.seen, old.hash)
+		}
+		df.head++
+	}
+	if df.head > 1024 && df.head*2 > len(df.queue) {
+		n := copy(df.queue, df.queue[df.head:])
+		df.queue = df.queue[:n]
+		df.head = 0
+	}
+}
+
+func (df *dedupFilter) Matches(lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo, n uint64) bool {
+	now := ci.Timestamp.UnixNano()
+	df.expire(now)
+	h := packetHash(lt, data)
+	if _, ok := df.seen[h]; ok {
+		df.suppressed++
+		return false
+	}
+	df.seen[h] = now
+	df.queue = append(df.queue, seenPacket{h, now})
+	return true
+}
+
+// PrintStats writes the number of suppressed duplicates to w
+func (df *dedupFilter) PrintStats(w io.Writer) {
+	fmt.Fprintf(w,
+		`Duplicate statistics:
+	suppressed: %d
+`, df.suppressed)
+}
+
+func newDedupFilter(args []string) (arguments []string, ret util.Module, err error) {
+	set := flag.NewFlagSet("dedup", flag.ExitOnError)
+	set.Usage = func() { dedupHelp("dedup") }
+	window := set.Duration("window", time.Millisecond, "Time window in which identical packets are considered duplicates")
+
+	set.Parse(args)
+
+	if *window <= 0 {
+		return nil, nil, fmt.Errorf("dedup filter needs a positive window, but was given %s", *window)
+	}
+
+	ret = &dedupFilter{
+		id:     fmt.Sprint("dedup|", *window),
+		window: int64(*window),
+		seen:   make(map[uint64]int64),
+	}
+	arguments = set.Args()
+	return
+}
+
+func dedupHelp(name string) {
+	fmt.Fprintf(os.Stderr, `
+The %s filter drops duplicate packets, as seen in captures from SPAN ports or
+multiple taps. A packet is a duplicate, if an identical packet was accepted
+within the time window before it. The link layer, the ipv4 ttl and header
+checksum, and the ipv6 hop limit are ignored for the comparison, since those
+change between capture points. Packets are compared with a 64 bit hash.
+
+The number of suppressed packets is part of the statistics printed with
+run -stats (they are also counted as filtered).
+
+Flags:
+  -window <duration>
+    Time window for duplicates, e.g. 500us or 10ms (default 1ms)
+
+Usage:
+  filter %s [-window 1ms]
+`, name, name)
+}
+
+func init() {
+	packet.RegisterFilter("dedup", "Drop duplicate packets within a time window.", newDedupFilter, dedupHelp)
+}
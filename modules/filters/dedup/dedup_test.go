@@ -0,0 +1,78 @@
+package dedup
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func makePacket(t *testing.T, ttl uint8, srcMAC net.HardwareAddr, vlan bool, payload byte) []byte {
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: ttl, Protocol: layers.IPProtocolUDP, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}}
+	udp := &layers.UDP{SrcPort: 1000, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(ip)
+	eth := &layers.Ethernet{SrcMAC: srcMAC, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4}
+	l := []gopacket.SerializableLayer{eth}
+	if vlan {
+		eth.EthernetType = layers.EthernetTypeDot1Q
+		l = append(l, &layers.Dot1Q{VLANIdentifier: 5, Type: layers.EthernetTypeIPv4})
+	}
+	l = append(l, ip, udp, gopacket.Payload{payload})
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, l...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDedup(t *testing.T) {
+	args, filter, err := newDedupFilter([]string{"-window", "1ms", "source"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 1 || args[0] != "source" {
+		t.Fatalf("wrong remaining arguments %v", args)
+	}
+	df := filter.(*dedupFilter)
+
+	macA, macB := net.HardwareAddr{0, 0, 0, 0, 0, 1}, net.HardwareAddr{0, 0, 0, 0, 0, 3}
+	base := time.Unix(0, 0)
+	for i, test := range []struct {
+		when     time.Duration
+		data     []byte
+		expected bool
+	}{
+		{0, makePacket(t, 64, macA, false, 1), true},
+		// same packet after a router hop and on another vlan
+		{10 * time.Microsecond, makePacket(t, 63, macB, true, 1), false},
+		{20 * time.Microsecond, makePacket(t, 64, macA, false, 2), true},
+		// ethernet padding is ignored
+		{30 * time.Microsecond, append(makePacket(t, 64, macA, false, 2), 0, 0, 0), false},
+		// outside of the window of the first packet
+		{1100 * time.Microsecond, makePacket(t, 64, macA, false, 1), true},
+		{1200 * time.Microsecond, makePacket(t, 64, macA, false, 1), false},
+		{5 * time.Millisecond, makePacket(t, 64, macA, false, 2), true},
+	} {
+		got := df.Matches(layers.LayerTypeEthernet, test.data, gopacket.CaptureInfo{Timestamp: base.Add(test.when)}, uint64(i+1))
+		if got != test.expected {
+			t.Errorf("packet %d: got %t, expected %t", i, got, test.expected)
+		}
+	}
+	if df.suppressed != 3 {
+		t.Errorf("expected 3 suppressed packets, but got %d", df.suppressed)
+	}
+	if len(df.seen) != 1 {
+		t.Errorf("expected 1 remembered packet, but got %d", len(df.seen))
+	}
+
+	var buf bytes.Buffer
+	packet.Filters{df}.PrintStats(&buf)
+	if !strings.Contains(buf.String(), "suppressed: 3") {
+		t.Errorf("statistics are missing the suppressed packets: %q", buf.String())
+	}
+}
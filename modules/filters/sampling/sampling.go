@@ -0,0 +1,201 @@
+package sampling
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/CN-TU/go-flows/util"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type samplingFilter struct {
+	id       string
+	sampling flows.Sampling
+	count    uint64
+	random   *rand.Rand
+	seed     uint32
+	ports    bool
+	key      []byte
+}
+
+func (sf *samplingFilter) ID() string {
+	return sf.id
+}
+
+func (sf *samplingFilter) Init() {
+}
+
+func (sf *samplingFilter) Sampling() flows.Sampling {
+	return sf.sampling
+}
+
+func (sf *samplingFilter) Matches(lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo, n uint64) bool {
+	rate := uint64(sf.sampling.Rate)
+	switch sf.sampling.Algorithm {
+	case flows.SelectorSystematicCount:
+		sf.count++
+		return (sf.count-1)%rate == 0
+	case flows.SelectorUniformProbabilistic:
+		return sf.random.Int63n(int64(rate)) == 0
+	case flows.SelectorHashBOB:
+		sf.key = flowKey(sf.key[:0], lt, data, sf.ports)
+		return uint64(bobHash(sf.key, sf.seed))*rate < 1<<32
+	}
+	return true
+}
+
+// flowKey appends the direction independent flow key (addresses, protocol, and optionally ports) of a packet to key.
+// Non-ip packets result in an empty key. Ports are zero for non-first fragments and protocols without ports.
+func flowKey(key []byte, lt gopacket.LayerType, data []byte, ports bool) []byte {
+	ethertype, network, ok := packet.NetworkLayer(lt, data)
+	if !ok {
+		return key
+	}
+	var src, dst, transport []byte
+	var proto byte
+	switch ethertype {
+	case layers.EthernetTypeIPv4:
+		if len(network) < 20 {
+			return key
+		}
+		src, dst, proto = network[12:16], network[16:20], network[9]
+		if ihl := int(network[0]&0xf) * 4; binary.BigEndian.Uint16(network[6:])&0x1fff == 0 && ihl <= len(network) {
+			transport = network[ihl:]
+		}
+	case layers.EthernetTypeIPv6:
+		if len(network) < 40 {
+			return key
+		}
+		src, dst, proto = network[8:24], network[24:40], network[6]
+		transport = network[40:]
+		// skip hop-by-hop, routing, destination options, and fragment headers
+		for proto == 0 || proto == 43 || proto == 60 || proto == 44 {
+			if len(transport) < 8 {
+				transport = nil
+				break
+			}
+			next, length := transport[0], (int(transport[1])+1)*8
+			if proto == 44 {
+				if binary.BigEndian.Uint16(transport[2:])>>3 != 0 {
+					transport = nil
+				}
+				length = 8
+			}
+			proto = next
+			if len(transport) < length {
+				transport = nil
+				break
+			}
+			transport = transport[length:]
+		}
+	default:
+		return key
+	}
+	var srcPort, dstPort []byte
+	if ports && len(transport) >= 4 {
+		switch proto {
+		case 6, 17, 132:
+			srcPort, dstPort = transport[:2], transport[2:4]
+		}
+	}
+	if srcPort == nil {
+		srcPort, dstPort = []byte{0, 0}, []byte{0, 0}
+	}
+	// order the endpoints to get the same key in both directions
+	if cmp := bytes.Compare(src, dst); cmp > 0 || (cmp == 0 && bytes.Compare(srcPort, dstPort) > 0) {
+		src, dst, srcPort, dstPort = dst, src, dstPort, srcPort
+	}
+	key = append(key, src...)
+	key = append(key, dst...)
+	key = append(key, proto)
+	key = append(key, srcPort...)
+	return append(key, dstPort...)
+}
+
+func newSamplingFilter(args []string) (arguments []string, ret util.Module, err error) {
+	set := flag.NewFlagSet("sample", flag.ExitOnError)
+	set.Usage = func() { samplingHelp("sample") }
+	seed := set.Int64("seed", 0, "Seed for random sampling and initial value for the hash function of flow sampling")
+	noPorts := set.Bool("noports", false, "Flow sampling: hash only addresses and protocol")
+
+	set.Parse(args)
+	args = set.Args()
+
+	if len(args) < 2 {
+		return nil, nil, errors.New("sample filter needs a method (systematic, random, flow) and a rate")
+	}
+	rate, err := strconv.ParseUint(args[1], 10, 32)
+	if err != nil || rate == 0 {
+		return nil, nil, fmt.Errorf("sample filter needs a rate N > 0 for 1-in-N sampling, but was given '%s'", args[1])
+	}
+
+	sf := &samplingFilter{
+		seed:  uint32(*seed),
+		ports: !*noPorts,
+	}
+	sf.sampling.Rate = uint32(rate)
+	switch args[0] {
+	case "systematic":
+		sf.sampling.Algorithm = flows.SelectorSystematicCount
+	case "random":
+		sf.sampling.Algorithm = flows.SelectorUniformProbabilistic
+		sf.random = rand.New(rand.NewSource(*seed))
+	case "flow":
+		sf.sampling.Algorithm = flows.SelectorHashBOB
+	default:
+		return nil, nil, fmt.Errorf("sample filter needs a method (systematic, random, flow), but was given '%s'", args[0])
+	}
+
+	sf.id = fmt.Sprint("sample|", args[0], "|", rate)
+	ret = sf
+	arguments = args[2:]
+	return
+}
+
+func samplingHelp(name string) {
+	fmt.Fprintf(os.Stderr, `
+The %s filter selects packets according to RFC 5475 for 1-in-N sampling.
+
+Methods:
+  systematic
+    Systematic count-based sampling: the first of every N packets is selected.
+  random
+    Uniform probabilistic sampling: every packet is selected with probability
+    1/N.
+  flow
+    Hash-based flow sampling: the BOB hash of addresses, protocol, and ports
+    selects 1/N of all flows with all their packets. The hash is independent of
+    the direction. Non-first ip fragments are hashed with zero ports; use
+    -noports to keep fragmented flows complete (selection by host pair).
+
+The sampling method and rate can be exported with the features samplingInterval,
+samplingAlgorithm, selectorAlgorithm, samplingPacketInterval,
+samplingPacketSpace, and samplingProbability. Counts can be scaled up with the
+scaleSampling operation, e.g., {"scaleSampling": ["packetTotalCount"]}.
+Multiple %s filters with the same method select 1-in-(N*M) packets; methods
+can't be mixed.
+
+Flags:
+  -seed <n>
+    Seed of the random number generator and initial value of the hash function
+    (default 0)
+  -noports
+    Flow sampling hashes only addresses and protocol
+
+Usage:
+  filter %s [-seed n] [-noports] systematic|random|flow N
+`, name, name, name)
+}
+
+func init() {
+	packet.RegisterFilter("sample", "Sample packets or flows (1-in-N).", newSamplingFilter, samplingHelp)
+}
@@ -0,0 +1,119 @@
+package sampling
+
+import (
+	"net"
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func TestBOBHash(t *testing.T) {
+	for _, test := range []struct {
+		key     string
+		initval uint32
+		hash    uint32
+	}{
+		{"Four score and seven years ago", 0, 0x50f2424b},
+		{"Four score and seven years ago", 1, 0x89deae7e},
+		{"abc", 7, 0x2f61dcab},
+	} {
+		if h := bobHash([]byte(test.key), test.initval); h != test.hash {
+			t.Errorf("%q/%d: expected %#x, but got %#x", test.key, test.initval, test.hash, h)
+		}
+	}
+}
+
+func makePacket(t *testing.T, src, dst net.IP, sport, dport uint16) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: src, DstIP: dst}
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, ip, &layers.TCP{SrcPort: layers.TCPPort(sport), DstPort: layers.TCPPort(dport)}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func makeFilter(t *testing.T, args ...string) *samplingFilter {
+	rest, filter, err := newSamplingFilter(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 0 {
+		t.Fatalf("unused arguments %v", rest)
+	}
+	return filter.(*samplingFilter)
+}
+
+func TestSampling(t *testing.T) {
+	data := makePacket(t, net.IP{10, 0, 0, 1}, net.IP{10, 0, 0, 2}, 1000, 80)
+
+	sf := makeFilter(t, "systematic", "10")
+	if s := sf.Sampling(); s.Algorithm != flows.SelectorSystematicCount || s.Rate != 10 {
+		t.Errorf("wrong sampling %v", s)
+	}
+	selected := 0
+	for i := 0; i < 100; i++ {
+		if sf.Matches(packet.LayerTypeIPv46, data, gopacket.CaptureInfo{}, uint64(i)) {
+			if i%10 != 0 {
+				t.Errorf("packet %d was selected", i)
+			}
+			selected++
+		}
+	}
+	if selected != 10 {
+		t.Errorf("expected 10 selected packets, but got %d", selected)
+	}
+
+	sf = makeFilter(t, "-seed", "5", "random", "4")
+	selected = 0
+	for i := 0; i < 10000; i++ {
+		if sf.Matches(packet.LayerTypeIPv46, data, gopacket.CaptureInfo{}, uint64(i)) {
+			selected++
+		}
+	}
+	if selected < 2300 || selected > 2700 {
+		t.Errorf("expected about 2500 selected packets, but got %d", selected)
+	}
+
+	sf = makeFilter(t, "flow", "4")
+	selectedFlows := 0
+	for i := 0; i < 1000; i++ {
+		client := net.IP{10, 0, byte(i >> 8), byte(i)}
+		server := net.IP{192, 168, 0, 1}
+		forward := sf.Matches(packet.LayerTypeIPv46, makePacket(t, client, server, uint16(1024+i), 443), gopacket.CaptureInfo{}, 0)
+		backward := sf.Matches(packet.LayerTypeIPv46, makePacket(t, server, client, 443, uint16(1024+i)), gopacket.CaptureInfo{}, 0)
+		if forward != backward {
+			t.Errorf("flow %d: directions were sampled differently", i)
+		}
+		if forward {
+			selectedFlows++
+		}
+	}
+	if selectedFlows < 200 || selectedFlows > 300 {
+		t.Errorf("expected about 250 selected flows, but got %d", selectedFlows)
+	}
+
+	for _, args := range [][]string{{"systematic"}, {"systematic", "0"}, {"every", "10"}} {
+		if _, _, err := newSamplingFilter(args); err == nil {
+			t.Errorf("%v was accepted", args)
+		}
+	}
+}
+
+func TestCombinedSampling(t *testing.T) {
+	sampling, err := packet.Filters{makeFilter(t, "systematic", "10"), makeFilter(t, "systematic", "4")}.Sampling()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sampling.Algorithm != flows.SelectorSystematicCount || sampling.Rate != 40 {
+		t.Errorf("wrong sampling %v", sampling)
+	}
+	if _, err := (packet.Filters{makeFilter(t, "systematic", "10"), makeFilter(t, "flow", "2")}).Sampling(); err == nil {
+		t.Error("different sample methods were combined")
+	}
+	if sampling, err := (packet.Filters{}).Sampling(); err != nil || sampling.Sampled() {
+		t.Errorf("sampling without sample filters %v (%v)", sampling, err)
+	}
+}
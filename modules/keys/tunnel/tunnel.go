@@ -0,0 +1,60 @@
+package tunnel
+
+import (
+	"encoding/binary"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/google/gopacket/layers"
+)
+
+func tunnelSourceIPAddressKey(packet packet.Buffer, scratch, scratchNoSort []byte) (int, int) {
+	network := packet.OuterNetworkLayer()
+	if network == nil {
+		return 0, 0
+	}
+	return copy(scratch, network.NetworkFlow().Src().Raw()), 0
+}
+
+func tunnelDestinationIPAddressKey(packet packet.Buffer, scratch, scratchNoSort []byte) (int, int) {
+	network := packet.OuterNetworkLayer()
+	if network == nil {
+		return 0, 0
+	}
+	return copy(scratch, network.NetworkFlow().Dst().Raw()), 0
+}
+
+func init() {
+	packet.RegisterKeyPair(
+		packet.RegisterStringsKey([]string{"_tunnelSourceIPv4Address", "_tunnelSourceIPv6Address", "_tunnelSourceIPAddress"},
+			"source address of the outer network layer of decapsulated packets",
+			packet.KeyTypeSource, packet.KeyLayerNetwork, func(string) packet.KeyFunc { return tunnelSourceIPAddressKey }),
+		packet.RegisterStringsKey([]string{"_tunnelDestinationIPv4Address", "_tunnelDestinationIPv6Address", "_tunnelDestinationIPAddress"},
+			"destination address of the outer network layer of decapsulated packets",
+			packet.KeyTypeDestination, packet.KeyLayerNetwork, func(string) packet.KeyFunc { return tunnelDestinationIPAddressKey }),
+	)
+}
+
+////////////////////////////////////////////////////////////////////////////////
+
+func tunnelIDKey(packet packet.Buffer, scratch, scratchNoSort []byte) (int, int) {
+	switch tunnel := packet.TunnelLayer().(type) {
+	case *layers.VXLAN:
+		binary.BigEndian.PutUint32(scratch, tunnel.VNI)
+	case *layers.Geneve:
+		binary.BigEndian.PutUint32(scratch, tunnel.VNI)
+	case *layers.GRE:
+		if !tunnel.KeyPresent {
+			return 0, 0
+		}
+		binary.BigEndian.PutUint32(scratch, tunnel.Key)
+	default:
+		return 0, 0
+	}
+	return 4, 0
+}
+
+func init() {
+	packet.RegisterStringKey("_tunnelID",
+		"VNI (VXLAN, GENEVE) or key (GRE) of decapsulated packets",
+		packet.KeyTypeUnidirectional, packet.KeyLayerLink, func(string) packet.KeyFunc { return tunnelIDKey })
+}
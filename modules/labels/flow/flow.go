@@ -0,0 +1,476 @@
+package flow
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/CN-TU/go-flows/util"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	colSource = iota
+	colDestination
+	colProtocol
+	colSourcePort
+	colDestinationPort
+	colStart
+	colEnd
+	numMatchColumns
+)
+
+var matchColumns = [numMatchColumns]string{
+	"sourceIPAddress",
+	"destinationIPAddress",
+	"protocolIdentifier",
+	"sourceTransportPort",
+	"destinationTransportPort",
+	"start",
+	"end",
+}
+
+const wildcard = -1
+
+// rule holds the match fields and the label of a single csv line. nil networks and wildcard numbers match everything.
+type rule struct {
+	source, destination *net.IPNet
+	protocol            int
+	sourcePort          int
+	destinationPort     int
+	start, end          flows.DateTimeNanoseconds
+	label               interface{}
+	index               int
+}
+
+// exact returns true if the rule contains no wildcards/networks and can be looked up by key
+func (r *rule) exact() bool {
+	return isHost(r.source) && isHost(r.destination) && r.protocol != wildcard && r.sourcePort != wildcard && r.destinationPort != wildcard
+}
+
+func isHost(n *net.IPNet) bool {
+	if n == nil {
+		return false
+	}
+	ones, bits := n.Mask.Size()
+	return ones == bits
+}
+
+func matchNet(n *net.IPNet, ip net.IP) bool {
+	return n == nil || n.Contains(ip)
+}
+
+func matchNumber(rule, value int) bool {
+	return rule == wildcard || rule == value
+}
+
+func (r *rule) matches(src, dst net.IP, proto, sport, dport int, when flows.DateTimeNanoseconds) bool {
+	return when >= r.start && when <= r.end &&
+		matchNumber(r.protocol, proto) &&
+		matchNumber(r.sourcePort, sport) && matchNumber(r.destinationPort, dport) &&
+		matchNet(r.source, src) && matchNet(r.destination, dst)
+}
+
+func makeKey(buf []byte, src, dst net.IP, proto, sport, dport int) []byte {
+	buf = append(buf[:0], src.To16()...)
+	buf = append(buf, dst.To16()...)
+	return append(buf, byte(proto), byte(sport>>8), byte(sport), byte(dport>>8), byte(dport))
+}
+
+// Values is the label of a line with multiple label columns. Lines with the same values share the same Values, which
+// makes labels comparable (e.g. for the mode function).
+type Values struct {
+	values []interface{}
+	text   string
+}
+
+// Get returns the typed label values in column order
+func (v *Values) Get() []interface{} {
+	return v.values
+}
+
+// String returns the label values separated by ';'
+func (v *Values) String() string {
+	return v.text
+}
+
+type column struct {
+	name string
+	kind string
+}
+
+type flowLabels struct {
+	id            string
+	files         []string
+	bidirectional bool
+	exact         map[string][]*rule
+	wildcard      []*rule
+	key           []byte
+	columns       []column
+	values        map[string]*Values
+}
+
+func (fl *flowLabels) ID() string {
+	return fl.id
+}
+
+func (fl *flowLabels) Init() {
+}
+
+func parseNet(s string) (*net.IPNet, error) {
+	if s == "" || s == "*" {
+		return nil, nil
+	}
+	if strings.Contains(s, "/") {
+		_, n, err := net.ParseCIDR(s)
+		return n, err
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid ip address '%s'", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
+
+var protocolNames = map[string]int{
+	"icmp":   int(layers.IPProtocolICMPv4),
+	"tcp":    int(layers.IPProtocolTCP),
+	"udp":    int(layers.IPProtocolUDP),
+	"icmpv6": int(layers.IPProtocolICMPv6),
+	"sctp":   int(layers.IPProtocolSCTP),
+}
+
+func parseNumber(s string, max int) (int, error) {
+	if s == "" || s == "*" {
+		return wildcard, nil
+	}
+	if proto, ok := protocolNames[strings.ToLower(s)]; ok && max == math.MaxUint8 {
+		return proto, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > max {
+		return 0, fmt.Errorf("value %d out of range", n)
+	}
+	return n, nil
+}
+
+// parseTime parses s as unix time in seconds (with optional fraction) or RFC3339
+func parseTime(s string, def flows.DateTimeNanoseconds) (flows.DateTimeNanoseconds, error) {
+	if s == "" || s == "*" {
+		return def, nil
+	}
+	parts := strings.SplitN(s, ".", 2)
+	if sec, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+		ret := flows.DateTimeNanoseconds(sec) * flows.SecondsInNanoseconds
+		if len(parts) == 2 {
+			frac := (parts[1] + "000000000")[:9]
+			ns, err := strconv.ParseInt(frac, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid time '%s'", s)
+			}
+			ret += flows.DateTimeNanoseconds(ns)
+		}
+		return ret, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time '%s' (must be unix time in seconds or RFC3339)", s)
+	}
+	return flows.DateTimeNanoseconds(t.UnixNano()), nil
+}
+
+var labelTypes = map[string]bool{
+	"string": true,
+	"int":    true,
+	"uint":   true,
+	"float":  true,
+	"bool":   true,
+}
+
+func parseValue(s string, kind string) (interface{}, error) {
+	switch kind {
+	case "string":
+		return s, nil
+	case "int":
+		return strconv.ParseInt(s, 10, 64)
+	case "uint":
+		return strconv.ParseUint(s, 10, 64)
+	case "float":
+		return strconv.ParseFloat(s, 64)
+	case "bool":
+		return strconv.ParseBool(s)
+	}
+	return nil, fmt.Errorf("unknown label type '%s'", kind)
+}
+
+// parseHeader returns the column number of every match column (or -1 if missing) and the label columns
+func parseHeader(header []string) (match [numMatchColumns]int, labels []int, columns []column, err error) {
+	for i := range match {
+		match[i] = -1
+	}
+HEADER:
+	for i, name := range header {
+		name = strings.TrimSpace(name)
+		for j, m := range matchColumns {
+			if name == m {
+				match[j] = i
+				continue HEADER
+			}
+		}
+		kind := "string"
+		if pos := strings.LastIndexByte(name, ':'); pos != -1 {
+			name, kind = name[:pos], name[pos+1:]
+			if !labelTypes[kind] {
+				err = fmt.Errorf("unknown label type '%s' of column %s", kind, name)
+				return
+			}
+		}
+		labels = append(labels, i)
+		columns = append(columns, column{name, kind})
+	}
+	if len(labels) == 0 {
+		err = errors.New("at least one label column is needed")
+	}
+	return
+}
+
+func (fl *flowLabels) addRule(r *rule) {
+	if !r.exact() {
+		fl.wildcard = append(fl.wildcard, r)
+		return
+	}
+	fl.key = makeKey(fl.key, r.source.IP, r.destination.IP, r.protocol, r.sourcePort, r.destinationPort)
+	fl.exact[string(fl.key)] = append(fl.exact[string(fl.key)], r)
+}
+
+func (fl *flowLabels) load(name string, index int) (int, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return index, err
+	}
+	defer f.Close()
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return index, fmt.Errorf("couldn't read header of '%s': %s", name, err)
+	}
+	match, labels, columns, err := parseHeader(header)
+	if err != nil {
+		return index, fmt.Errorf("%s: %s", name, err)
+	}
+	if fl.columns == nil {
+		fl.columns = columns
+	} else if fmt.Sprint(fl.columns) != fmt.Sprint(columns) {
+		return index, fmt.Errorf("%s: label columns differ from previous files", name)
+	}
+	get := func(record []string, col int) string {
+		if match[col] < 0 || match[col] >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[match[col]])
+	}
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return index, err
+		}
+		rule := &rule{index: index}
+		index++
+		fail := func(err error) (int, error) {
+			return index, fmt.Errorf("%s:%d: %s", name, line, err)
+		}
+		if rule.source, err = parseNet(get(record, colSource)); err != nil {
+			return fail(err)
+		}
+		if rule.destination, err = parseNet(get(record, colDestination)); err != nil {
+			return fail(err)
+		}
+		if rule.protocol, err = parseNumber(get(record, colProtocol), math.MaxUint8); err != nil {
+			return fail(err)
+		}
+		if rule.sourcePort, err = parseNumber(get(record, colSourcePort), math.MaxUint16); err != nil {
+			return fail(err)
+		}
+		if rule.destinationPort, err = parseNumber(get(record, colDestinationPort), math.MaxUint16); err != nil {
+			return fail(err)
+		}
+		if rule.start, err = parseTime(get(record, colStart), 0); err != nil {
+			return fail(err)
+		}
+		if rule.end, err = parseTime(get(record, colEnd), math.MaxInt64); err != nil {
+			return fail(err)
+		}
+		values := make([]interface{}, len(labels))
+		text := make([]string, len(labels))
+		for i, col := range labels {
+			if col >= len(record) {
+				return fail(errors.New("missing label column"))
+			}
+			text[i] = strings.TrimSpace(record[col])
+			if values[i], err = parseValue(text[i], columns[i].kind); err != nil {
+				return fail(fmt.Errorf("column %s: %s", columns[i].name, err))
+			}
+		}
+		if len(values) == 1 {
+			rule.label = values[0]
+		} else {
+			key := strings.Join(text, ";")
+			label, ok := fl.values[key]
+			if !ok {
+				label = &Values{values, key}
+				fl.values[key] = label
+			}
+			rule.label = label
+		}
+		fl.addRule(rule)
+	}
+}
+
+// lookup returns the first matching rule (lowest index) or best, if best has a lower index
+func (fl *flowLabels) lookup(best *rule, src, dst net.IP, proto, sport, dport int, when flows.DateTimeNanoseconds) *rule {
+	fl.key = makeKey(fl.key, src, dst, proto, sport, dport)
+	for _, r := range fl.exact[string(fl.key)] {
+		if best != nil && r.index > best.index {
+			break
+		}
+		if r.matches(src, dst, proto, sport, dport, when) {
+			best = r
+			break
+		}
+	}
+	for _, r := range fl.wildcard {
+		if best != nil && r.index > best.index {
+			break
+		}
+		if r.matches(src, dst, proto, sport, dport, when) {
+			best = r
+			break
+		}
+	}
+	return best
+}
+
+func (fl *flowLabels) GetLabel(buffer packet.Buffer) (interface{}, error) {
+	network := buffer.NetworkLayer()
+	if network == nil {
+		return nil, nil
+	}
+	src := net.IP(network.NetworkFlow().Src().Raw())
+	dst := net.IP(network.NetworkFlow().Dst().Raw())
+	proto := int(buffer.Proto())
+	var sport, dport int
+	switch transport := buffer.TransportLayer().(type) {
+	case *layers.TCP:
+		sport, dport = int(transport.SrcPort), int(transport.DstPort)
+	case *layers.UDP:
+		sport, dport = int(transport.SrcPort), int(transport.DstPort)
+	}
+	when := buffer.Timestamp()
+	best := fl.lookup(nil, src, dst, proto, sport, dport, when)
+	if fl.bidirectional {
+		best = fl.lookup(best, dst, src, proto, dport, sport, when)
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return best.label, nil
+}
+
+func newFlowLabels(args []string) (arguments []string, ret util.Module, err error) {
+	set := flag.NewFlagSet("flow", flag.ExitOnError)
+	set.Usage = func() { flowLabelsHelp("flow") }
+	bidirectional := set.Bool("bidirectional", false, "Also match packets in the reverse direction")
+	set.Parse(args)
+
+	var files []string
+	arguments = set.Args()
+	for len(arguments) > 0 {
+		if arguments[0] == "--" {
+			arguments = arguments[1:]
+			break
+		}
+		files = append(files, arguments[0])
+		arguments = arguments[1:]
+	}
+
+	if len(files) == 0 {
+		return nil, nil, errors.New("flow labels needs at least one input file")
+	}
+
+	fl := &flowLabels{
+		id:            fmt.Sprint("flowlabel|", *bidirectional, "|", strings.Join(files, ";")),
+		files:         files,
+		bidirectional: *bidirectional,
+		exact:         make(map[string][]*rule),
+		values:        make(map[string]*Values),
+	}
+	index := 0
+	for _, file := range files {
+		if index, err = fl.load(file, index); err != nil {
+			return nil, nil, err
+		}
+	}
+	ret = fl
+	return
+}
+
+func flowLabelsHelp(name string) {
+	fmt.Fprintf(os.Stderr, `
+The %s label source assigns labels to packets based on flow key fields and
+time intervals read from one or more csv files. If further commands need to be
+provided, then "--" can be used to stop the file list.
+
+The csv files must start with a header. The following columns are used for
+matching; missing columns, empty values, or * match everything:
+  sourceIPAddress, destinationIPAddress     ip address or network in CIDR notation
+  protocolIdentifier                        protocol number or tcp, udp, icmp, icmpv6, sctp
+  sourceTransportPort, destinationTransportPort
+  start, end                                unix time in seconds or RFC3339 (inclusive)
+
+Every other column is a label column. The type of a label column can be given
+with name:type, where type is one of string (default), int, uint, float, bool.
+If there is only one label column, the label is the typed value, otherwise the
+list of values, which is exported as the values separated by ';'. Labels can be
+exported with the __label feature.
+
+If multiple lines match a packet, the first one is used. Matching on exact
+5-tuples is done with a hash lookup, while lines with wildcards or networks
+are tried one after another.
+
+Example:
+  sourceIPAddress,destinationIPAddress,protocolIdentifier,sourceTransportPort,destinationTransportPort,start,end,attack,severity:int
+  10.0.0.1,10.0.0.2,tcp,1234,80,1500000000,1500000060,dos,3
+  192.168.0.0/16,*,udp,*,53,,,dns-tunnel,2
+
+Usage:
+  label %s [-bidirectional] a.csv [b.csv] [..] [--]
+
+Flags:
+  -bidirectional
+    Also match packets in the reverse direction (source and destination swapped)
+`, name, name)
+}
+
+func init() {
+	packet.RegisterLabel("flow", "Assign labels to packets based on flow keys and time intervals from a csv file.", newFlowLabels, flowLabelsHelp)
+}
@@ -0,0 +1,111 @@
+package flow
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CN-TU/go-flows/flows"
+)
+
+const rules = `sourceIPAddress,destinationIPAddress,protocolIdentifier,sourceTransportPort,destinationTransportPort,start,end,attack,severity:int
+10.0.0.1,10.0.0.2,tcp,1234,80,1500000000,1500000060.5,dos,3
+10.0.0.0/8,*,udp,,53,,,dns,2
+*,*,,,,2018-01-01T00:00:00Z,,late,1
+10.0.0.1,10.0.0.2,tcp,1234,80,,,any,0
+`
+
+func TestFlowLabels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flowlabels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "labels.csv")
+	if err := ioutil.WriteFile(name, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := net.IP{10, 0, 0, 1}
+	b := net.IP{10, 0, 0, 2}
+	c := net.IP{192, 168, 0, 1}
+	sec := flows.SecondsInNanoseconds
+	tests := []struct {
+		bidirectional bool
+		src, dst      net.IP
+		proto         int
+		sport, dport  int
+		when          flows.DateTimeNanoseconds
+		label         interface{}
+	}{
+		{false, a, b, 6, 1234, 80, 1500000010 * sec, "dos;3"},
+		{false, a, b, 6, 1234, 80, 1500000060*sec + sec/2, "dos;3"},
+		{false, a, b, 6, 1234, 80, 1500000061 * sec, "any;0"},
+		{false, a, b, 6, 1234, 80, 1600000000 * sec, "late;1"},
+		{false, b, a, 6, 80, 1234, 1500000010 * sec, nil},
+		{true, b, a, 6, 80, 1234, 1500000010 * sec, "dos;3"},
+		{false, a, c, 17, 5000, 53, 0, "dns;2"},
+		{false, c, a, 17, 53, 5000, 0, nil},
+		{true, c, a, 17, 53, 5000, 0, "dns;2"},
+	}
+	for i, test := range tests {
+		args := []string{name, "--"}
+		if test.bidirectional {
+			args = append([]string{"-bidirectional"}, args...)
+		}
+		_, module, err := newFlowLabels(args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fl := module.(*flowLabels)
+		var label interface{}
+		best := fl.lookup(nil, test.src, test.dst, test.proto, test.sport, test.dport, test.when)
+		if fl.bidirectional {
+			best = fl.lookup(best, test.dst, test.src, test.proto, test.dport, test.sport, test.when)
+		}
+		if best != nil {
+			label = best.label.(*Values).String()
+		}
+		if label != test.label {
+			t.Errorf("test %d: got label %v; expected %v", i, label, test.label)
+		}
+	}
+
+	_, module, err := newFlowLabels([]string{name, name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fl := module.(*flowLabels)
+	first := fl.lookup(nil, a, c, 17, 5000, 53, 0).label.(*Values)
+	if values := first.Get(); len(values) != 2 || values[0] != "dns" || values[1] != int64(2) {
+		t.Errorf("got typed values %#v; expected [\"dns\" 2]", values)
+	}
+	if len(fl.values) != 4 {
+		t.Errorf("got %d different labels; expected 4 (equal labels must be shared)", len(fl.values))
+	}
+}
+
+func TestFlowLabelsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flowlabels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for i, content := range []string{
+		"sourceIPAddress,destinationIPAddress\n10.0.0.1,10.0.0.2\n",
+		"sourceIPAddress,label:complex\n10.0.0.1,a\n",
+		"sourceIPAddress,label:int\n10.0.0.1,a\n",
+		"sourceIPAddress,label\n10.0.0.300,a\n",
+		"sourceTransportPort,label\n70000,a\n",
+	} {
+		name := filepath.Join(dir, "labels.csv")
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := newFlowLabels([]string{name}); err == nil {
+			t.Errorf("test %d: expected error for invalid label file", i)
+		}
+	}
+}
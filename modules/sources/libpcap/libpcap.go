@@ -10,7 +10,6 @@ import (
 	"strings"
 	"sync/atomic"
 
-	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 
 	"github.com/CN-TU/go-flows/packet"
@@ -40,14 +39,9 @@ func (ps *libpcapSource) Init() {
 }
 
 func (ps *libpcapSource) setLayerType() error {
-	switch lt := ps.currentHandle.LinkType(); lt {
-	case layers.LinkTypeEthernet:
-		ps.lt = layers.LayerTypeEthernet
-	case layers.LinkTypeRaw, layers.LinkType(12):
-		ps.lt = packet.LayerTypeIPv46
-	case layers.LinkTypeLinuxSLL:
-		ps.lt = layers.LayerTypeLinuxSLL
-	default:
+	lt := ps.currentHandle.LinkType()
+	var ok bool
+	if ps.lt, ok = packet.LinkTypeLayer(lt); !ok {
 		return fmt.Errorf("libpcap: unknown link type %s", lt)
 	}
 	return nil
@@ -159,6 +153,23 @@ RETRY:
 	return
 }
 
+// Split returns one source per file
+func (ps *libpcapSource) Split() []packet.Source {
+	if ps.live {
+		return []packet.Source{ps}
+	}
+	ret := make([]packet.Source, len(ps.files))
+	for i, file := range ps.files {
+		ret[i] = &libpcapSource{
+			id:     fmt.Sprint("libpcap|", ps.filter, "|", file),
+			files:  []string{file},
+			filter: ps.filter,
+			which:  -1,
+		}
+	}
+	return ret
+}
+
 // Stop shuts down the source
 func (ps *libpcapSource) Stop() {
 	if ps.currentHandle != nil {
@@ -226,7 +237,9 @@ func pcapHelp(name string) {
 	fmt.Fprintf(os.Stderr, `
 The %s source reads packets via libpcap. This can be either from a list of files
 or online from an interface. If files are specified, and further commands need
-to be provided, then "--" can be used to stop the file list.
+to be provided, then "--" can be used to stop the file list. Files are read one
+after another, unless run -merge is used, which reads every file at the same
+time in timestamp order.
 
 Usage:
   source %s a.pcap [b.pcapng] [..] [--]
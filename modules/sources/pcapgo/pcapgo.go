@@ -0,0 +1,211 @@
+package pcapgo
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/CN-TU/go-flows/util"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	gopcap "github.com/google/gopacket/pcapgo"
+)
+
+var magicPcapng = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+type packetReader interface {
+	ZeroCopyReadPacketData() (data []byte, ci gopacket.CaptureInfo, err error)
+}
+
+type pcapgoSource struct {
+	stopped uint64
+	id      string
+	files   []string
+	which   int
+	lt      gopacket.LayerType
+	mixed   bool
+	warned  map[layers.LinkType]bool
+	file    io.ReadCloser
+	reader  packetReader
+}
+
+func (ps *pcapgoSource) ID() string {
+	return ps.id
+}
+
+func (ps *pcapgoSource) Init() {
+}
+
+func (ps *pcapgoSource) openNext() error {
+	ps.which++
+	if ps.which > len(ps.files)-1 {
+		return io.EOF
+	}
+
+	if ps.file != nil {
+		ps.file.Close()
+		ps.file = nil
+	}
+
+	name := ps.files[ps.which]
+	file, err := util.OpenFile(name)
+	if err != nil {
+		return fmt.Errorf("couldn't open file '%s': %s", name, err)
+	}
+	ps.file = file
+
+	r := bufio.NewReader(file)
+	magic, err := r.Peek(len(magicPcapng))
+	if err != nil {
+		return fmt.Errorf("couldn't read file '%s': %s", name, err)
+	}
+
+	if string(magic) == string(magicPcapng) {
+		reader, err := gopcap.NewNgReader(r, gopcap.NgReaderOptions{
+			WantMixedLinkType:  true,
+			SkipUnknownVersion: true,
+		})
+		if err != nil {
+			return fmt.Errorf("couldn't open file '%s': %s", name, err)
+		}
+		ps.reader = reader
+		ps.mixed = true
+		return nil
+	}
+
+	reader, err := gopcap.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("couldn't open file '%s': %s", name, err)
+	}
+	ps.reader = reader
+	ps.mixed = false
+	var ok bool
+	if ps.lt, ok = packet.LinkTypeLayer(reader.LinkType()); !ok {
+		return fmt.Errorf("pcapgo: unknown link type %s in file '%s'", reader.LinkType(), name)
+	}
+	return nil
+}
+
+func (ps *pcapgoSource) ReadPacket() (lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo, skipped uint64, filtered uint64, err error) {
+	if ps.which == -1 {
+		err = ps.openNext()
+		if err != nil {
+			return
+		}
+	}
+
+RETRY:
+	data, ci, err = ps.reader.ZeroCopyReadPacketData()
+
+	if atomic.LoadUint64(&ps.stopped) == 1 {
+		err = io.EOF
+		return
+	}
+
+	if err != nil {
+		// report non-eof errors, but treat them as non-fatal
+		if err != io.EOF {
+			log.Printf("pcapgo: read error in pcap file '%s': %s\n", ps.files[ps.which], err)
+			skipped++
+		}
+		err = ps.openNext()
+		if err != nil {
+			return
+		}
+		goto RETRY
+	}
+
+	lt = ps.lt
+	if ps.mixed {
+		// pcapng: every interface can have a different link type
+		linkType := ci.AncillaryData[0].(layers.LinkType)
+		var ok bool
+		if lt, ok = packet.LinkTypeLayer(linkType); !ok {
+			if !ps.warned[linkType] {
+				log.Printf("pcapgo: skipping packets with unknown link type %s in file '%s'\n", linkType, ps.files[ps.which])
+				ps.warned[linkType] = true
+			}
+			skipped++
+			goto RETRY
+		}
+	}
+	return
+}
+
+// Split returns one source per file
+func (ps *pcapgoSource) Split() []packet.Source {
+	ret := make([]packet.Source, len(ps.files))
+	for i, file := range ps.files {
+		ret[i] = &pcapgoSource{
+			id:     fmt.Sprint("pcapgo|", file),
+			files:  []string{file},
+			which:  -1,
+			warned: make(map[layers.LinkType]bool),
+		}
+	}
+	return ret
+}
+
+// Stop shuts down the source
+func (ps *pcapgoSource) Stop() {
+	atomic.StoreUint64(&ps.stopped, 1)
+	if ps.file != nil {
+		ps.file.Close()
+	}
+}
+
+func newPcapgoSource(args []string) (arguments []string, ret util.Module, err error) {
+	var files []string
+
+	set := flag.NewFlagSet("pcapgo", flag.ExitOnError)
+	set.Usage = func() { pcapgoHelp("pcapgo") }
+
+	set.Parse(args)
+
+	arguments = set.Args()
+	for len(arguments) > 0 {
+		if arguments[0] == "--" {
+			arguments = arguments[1:]
+			break
+		}
+		files = append(files, arguments[0])
+		arguments = arguments[1:]
+	}
+
+	if len(files) == 0 {
+		return nil, nil, errors.New("pcapgo needs at least one input file")
+	}
+
+	ret = &pcapgoSource{
+		id:     fmt.Sprint("pcapgo|", strings.Join(files, ";")),
+		files:  files,
+		which:  -1,
+		warned: make(map[layers.LinkType]bool),
+	}
+	return
+}
+
+func pcapgoHelp(name string) {
+	fmt.Fprintf(os.Stderr, `
+The %s source reads packets from a list of pcap or pcapng files without
+needing libpcap (pure go). pcapng files may contain multiple interfaces with
+different link types. Files compressed with gzip, zstd, or xz are decompressed
+transparently. If further commands need to be provided, then "--" can be used
+to stop the file list. Files are read one after another, unless run -merge is
+used, which reads every file at the same time in timestamp order.
+
+Usage:
+  source %s a.pcap [b.pcapng.gz] [c.pcap.zst] [..] [--]
+`, name, name)
+}
+
+func init() {
+	packet.RegisterSource("pcapgo", "Read packets from pcap or pcapng files (pure go, no libpcap needed).", newPcapgoSource, pcapgoHelp)
+}
@@ -0,0 +1,163 @@
+package pcapgo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/CN-TU/go-flows/packet"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	gopcap "github.com/google/gopacket/pcapgo"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	ethPacket = []byte{0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 1, 0x08, 0x00, 0x45}
+	rawPacket = []byte{0x45, 0, 0, 20}
+)
+
+func writePcap(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w := gopcap.NewWriter(&buf)
+	if err := w.WriteFileHeader(65535, layers.LinkTypeEthernet); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePacket(gopacket.CaptureInfo{Timestamp: time.Unix(1, 0), CaptureLength: len(ethPacket), Length: len(ethPacket)}, ethPacket); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writePcapng(t *testing.T) []byte {
+	var buf bytes.Buffer
+	w, err := gopcap.NewNgWriterInterface(&buf, gopcap.NgInterface{LinkType: layers.LinkTypeEthernet, SnapLength: 65535}, gopcap.NgWriterOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := w.AddInterface(gopcap.NgInterface{LinkType: layers.LinkTypeRaw, SnapLength: 65535})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknown, err := w.AddInterface(gopcap.NgInterface{LinkType: layers.LinkTypeFDDI, SnapLength: 65535})
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets := []struct {
+		intf int
+		data []byte
+	}{
+		{0, ethPacket},
+		{unknown, ethPacket},
+		{raw, rawPacket},
+	}
+	for i, p := range packets {
+		ci := gopacket.CaptureInfo{Timestamp: time.Unix(int64(i+1), 0), CaptureLength: len(p.data), Length: len(p.data), InterfaceIndex: p.intf}
+		if err := w.WritePacket(ci, p.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func compress(t *testing.T, name string, data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	var err error
+	switch filepath.Ext(name) {
+	case ".gz":
+		w = gzip.NewWriter(&buf)
+	case ".zst":
+		w, err = zstd.NewWriter(&buf)
+	case ".xz":
+		w, err = xz.NewWriter(&buf)
+	default:
+		return data
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type readPacket struct {
+	lt   gopacket.LayerType
+	data []byte
+}
+
+func readAll(t *testing.T, args ...string) (ret []readPacket, skipped uint64) {
+	_, module, err := newPcapgoSource(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := module.(*pcapgoSource)
+	defer source.Stop()
+	for {
+		lt, data, _, s, _, err := source.ReadPacket()
+		skipped += s
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ret = append(ret, readPacket{lt, append([]byte{}, data...)})
+	}
+}
+
+func TestPcapgoSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pcapgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.pcap", "a.pcap.gz", "a.pcapng", "a.pcapng.gz", "a.pcapng.zst", "a.pcapng.xz"} {
+		t.Run(name, func(t *testing.T) {
+			var data []byte
+			expected := []readPacket{{layers.LayerTypeEthernet, ethPacket}}
+			var expectedSkipped uint64
+			if filepath.Ext(name) == ".pcap" || filepath.Ext(name[:len(name)-len(filepath.Ext(name))]) == ".pcap" {
+				data = writePcap(t)
+			} else {
+				data = writePcapng(t)
+				expected = append(expected, readPacket{packet.LayerTypeIPv46, rawPacket})
+				expectedSkipped = 1
+			}
+			fname := filepath.Join(dir, name)
+			if err := ioutil.WriteFile(fname, compress(t, name, data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			// file list is terminated by "--" like in the libpcap source
+			packets, skipped := readAll(t, fname, fname, "--")
+			expected = append(expected, expected...)
+			expectedSkipped *= 2
+			if skipped != expectedSkipped {
+				t.Errorf("skipped %d packets; expected %d", skipped, expectedSkipped)
+			}
+			if len(packets) != len(expected) {
+				t.Fatalf("got %d packets; expected %d", len(packets), len(expected))
+			}
+			for i := range packets {
+				if packets[i].lt != expected[i].lt || !bytes.Equal(packets[i].data, expected[i].data) {
+					t.Errorf("packet %d is %s %v; expected %s %v", i, packets[i].lt, packets[i].data, expected[i].lt, expected[i].data)
+				}
+			}
+		})
+	}
+}
@@ -22,6 +22,11 @@ type Buffer interface {
 	flows.Event
 	// Dot1QLayers returns a slice with all Dot1Q (=VLAN) headers
 	Dot1QLayers() []layers.Dot1Q
+	// OuterNetworkLayer returns the network layer of the tunnel, if this packet was decapsulated, or nil otherwise.
+	// In this case NetworkLayer and TransportLayer return the inner (tunneled) layers.
+	OuterNetworkLayer() gopacket.NetworkLayer
+	// TunnelLayer returns the tunnel header (GRE, VXLAN, or GENEVE), if this packet was decapsulated, or nil otherwise (also for IP in IP).
+	TunnelLayer() gopacket.Layer
 	//// Functions for querying additional packet attributes
 	//// ------------------------------------------------------------------
 	// EtherType returns the EthernetType of the link layer
@@ -32,6 +37,12 @@ type Buffer interface {
 	Label() interface{}
 	// PacketNr returns the the number of this packet
 	PacketNr() uint64
+	// Fragments returns the number of IP fragments this packet was reassembled from, or 0 if this packet was not fragmented
+	Fragments() int
+	// FragmentOverlaps returns the number of fragments that overlapped with other fragments of this packet during reassembly
+	FragmentOverlaps() int
+	// ReassemblyFailed returns true if this packet is the first fragment of a datagram that could not be reassembled
+	ReassemblyFailed() bool
 	//// Convenience functions for packet size calculations
 	//// ------------------------------------------------------------------
 	// LinkLayerLength returns the length of the link layer (=header + payload) or 0 if there is no link layer
@@ -62,30 +73,52 @@ type packetBuffer struct {
 	buffer      []byte
 	first       gopacket.LayerType
 	sll         layers.LinuxSLL
+	sll2        LinuxSLL2
 	eth         layers.Ethernet
+	loopback    layers.Loopback
+	ppp         layers.PPP
+	pppoe       layers.PPPoE
+	radiotap    RadioTap
+	dot11       Dot11
 	dot1q       []layers.Dot1Q
 	ip4         layers.IPv4
 	ip6         layers.IPv6
 	ip6skipper  layers.IPv6ExtensionSkipper
+	outer4      layers.IPv4
+	outer6      layers.IPv6
+	gre         layers.GRE
+	vxlan       layers.VXLAN
+	geneve      layers.Geneve
+	innerEth    layers.Ethernet
 	tcp         layers.TCP
 	udp         layers.UDP
 	icmpv4      icmpv4Flow
 	icmpv6      icmpv6Flow
 	link        gopacket.LinkLayer
+	linkHeaders []gopacket.Layer // additional link layer headers (loopback, radiotap, PPPoE, PPP after PPPoE)
 	network     gopacket.NetworkLayer
 	transport   gopacket.TransportLayer
+	outer       gopacket.NetworkLayer
+	tunnelLayer gopacket.Layer
+	fragment    fragmentInfo
 	application gopacket.ApplicationLayer
 	failure     gopacket.ErrorLayer
 	ci          gopacket.PacketMetadata
 	label       interface{}
 	ip6headers  int
+	fragments   int
+	overlaps    int
 	refcnt      int
 	packetnr    uint64
 	window      uint64
 	ethertype   layers.EthernetType
 	proto       uint8
+	tunnels     Tunnels
 	forward     bool
 	resize      bool
+	defrag      bool
+	isFragment  bool
+	failed      bool
 }
 
 // SerializableLayerType holds a packet layer, which can be serialized. This is needed for feature testing
@@ -114,6 +147,16 @@ func BufferFromLayers(when flows.DateTimeNanoseconds, layerList ...SerializableL
 			pb.link = layer.(gopacket.LinkLayer)
 		case layers.LayerTypeDot1Q:
 			pb.dot1q = append(pb.dot1q, *layer.(*layers.Dot1Q))
+		case layers.LayerTypeGRE, layers.LayerTypeVXLAN, layers.LayerTypeGeneve:
+			// everything up to now is the outer packet
+			if pb.network == nil {
+				log.Panic("Tunnel needs an outer Network Layer")
+			}
+			pb.outer = pb.network
+			pb.tunnelLayer = layer.(gopacket.Layer)
+			pb.network = nil
+			pb.transport = nil
+			pb.proto = 0
 		case layers.LayerTypeIPv4:
 			if pb.first != layers.LayerTypeEthernet {
 				pb.first = layers.LayerTypeIPv4
@@ -229,6 +272,18 @@ func (pb *packetBuffer) PacketNr() uint64 {
 	return pb.packetnr
 }
 
+func (pb *packetBuffer) Fragments() int {
+	return pb.fragments
+}
+
+func (pb *packetBuffer) FragmentOverlaps() int {
+	return pb.overlaps
+}
+
+func (pb *packetBuffer) ReassemblyFailed() bool {
+	return pb.failed
+}
+
 func (pb *packetBuffer) EventNr() uint64 {
 	return pb.packetnr
 }
@@ -238,15 +293,27 @@ func (pb *packetBuffer) Copy() Buffer {
 	return pb
 }
 
-func (pb *packetBuffer) assign(data []byte, ci gopacket.CaptureInfo, lt gopacket.LayerType, packetnr uint64) flows.DateTimeNanoseconds {
+// resetLayers removes every decoded layer
+func (pb *packetBuffer) resetLayers() {
 	pb.link = nil
+	pb.linkHeaders = pb.linkHeaders[:0]
 	pb.network = nil
 	pb.transport = nil
 	pb.application = nil
 	pb.failure = nil
+	pb.outer = nil
+	pb.tunnelLayer = nil
 	pb.tcp.Payload = nil
 	pb.proto = 0
 	pb.ip6headers = 0
+	pb.isFragment = false
+}
+
+func (pb *packetBuffer) assign(data []byte, ci gopacket.CaptureInfo, lt gopacket.LayerType, packetnr uint64) flows.DateTimeNanoseconds {
+	pb.resetLayers()
+	pb.fragments = 0
+	pb.overlaps = 0
+	pb.failed = false
 	pb.refcnt = 1
 	dlen := len(data)
 	if pb.resize && cap(pb.buffer) < dlen {
@@ -309,9 +376,16 @@ func (pb *packetBuffer) Layers() []gopacket.Layer {
 	if pb.link != nil {
 		ret = append(ret, pb.link)
 	}
+	ret = append(ret, pb.linkHeaders...)
 	for i := range pb.dot1q {
 		ret = append(ret, &pb.dot1q[i])
 	}
+	if pb.outer != nil {
+		ret = append(ret, pb.outer)
+	}
+	if pb.tunnelLayer != nil {
+		ret = append(ret, pb.tunnelLayer)
+	}
 	if pb.network != nil {
 		ret = append(ret, pb.network)
 	}
@@ -324,11 +398,19 @@ func (pb *packetBuffer) Layer(lt gopacket.LayerType) gopacket.Layer {
 	if pb.link != nil && pb.link.LayerType() == lt {
 		return pb.link
 	}
+	for _, layer := range pb.linkHeaders {
+		if layer.LayerType() == lt {
+			return layer
+		}
+	}
 	for i := range pb.dot1q {
 		if pb.dot1q[i].LayerType() == lt {
 			return &pb.dot1q[i]
 		}
 	}
+	if pb.tunnelLayer != nil && pb.tunnelLayer.LayerType() == lt {
+		return pb.tunnelLayer
+	}
 	if pb.network != nil && pb.network.LayerType() == lt {
 		return pb.network
 	}
@@ -341,6 +423,11 @@ func (pb *packetBuffer) LayerClass(lc gopacket.LayerClass) gopacket.Layer {
 	if pb.link != nil && lc.Contains(pb.link.LayerType()) {
 		return pb.link
 	}
+	for _, layer := range pb.linkHeaders {
+		if lc.Contains(layer.LayerType()) {
+			return layer
+		}
+	}
 	for i := range pb.dot1q {
 		if lc.Contains(pb.dot1q[i].LayerType()) {
 			return &pb.dot1q[i]
@@ -358,6 +445,8 @@ func (pb *packetBuffer) LinkLayer() gopacket.LinkLayer               { return pb
 func (pb *packetBuffer) NetworkLayer() gopacket.NetworkLayer         { return pb.network }
 func (pb *packetBuffer) TransportLayer() gopacket.TransportLayer     { return pb.transport }
 func (pb *packetBuffer) Dot1QLayers() []layers.Dot1Q                 { return pb.dot1q }
+func (pb *packetBuffer) OuterNetworkLayer() gopacket.NetworkLayer    { return pb.outer }
+func (pb *packetBuffer) TunnelLayer() gopacket.Layer                 { return pb.tunnelLayer }
 func (pb *packetBuffer) ApplicationLayer() gopacket.ApplicationLayer { return nil }
 func (pb *packetBuffer) ErrorLayer() gopacket.ErrorLayer             { return nil }
 func (pb *packetBuffer) Data() []byte                                { return pb.buffer }
@@ -427,23 +516,10 @@ func (pb *packetBuffer) decode() (ret bool) {
 		data = pb.eth.LayerPayload()
 		pb.ethertype = pb.eth.EthernetType
 		if typ == layers.LayerTypeLLC {
-			var l layers.LLC
-			if err := l.DecodeFromBytes(data, pb); err != nil {
+			var ok bool
+			if typ, data, ok = pb.decodeLLC(data); !ok {
 				return false
 			}
-			typ = l.NextLayerType()
-			data = l.LayerPayload()
-			//SMELL: this might be bad
-			pb.ethertype = layers.EthernetType(uint16(l.DSAP&0x7F)<<8 | uint16(l.SSAP&0x7F))
-			if typ == layers.LayerTypeSNAP {
-				var s layers.SNAP
-				if err := s.DecodeFromBytes(data, pb); err != nil {
-					return false
-				}
-				typ = s.NextLayerType()
-				data = s.LayerPayload()
-				pb.ethertype = s.Type
-			}
 		}
 	} else if typ == layers.LayerTypeLinuxSLL {
 		if err := pb.sll.DecodeFromBytes(data, pb); err != nil {
@@ -452,6 +528,52 @@ func (pb *packetBuffer) decode() (ret bool) {
 		pb.link = &pb.sll
 		typ = pb.sll.NextLayerType()
 		data = pb.sll.LayerPayload()
+		pb.ethertype = pb.sll.EthernetType
+	} else if typ == LayerTypeLinuxSLL2 {
+		if err := pb.sll2.DecodeFromBytes(data, pb); err != nil {
+			return false
+		}
+		pb.link = &pb.sll2
+		typ = pb.sll2.EthernetType.LayerType()
+		data = pb.sll2.LayerPayload()
+		pb.ethertype = pb.sll2.EthernetType
+	} else if typ == layers.LayerTypeLoopback {
+		if err := pb.loopback.DecodeFromBytes(data, pb); err != nil {
+			return false
+		}
+		pb.linkHeaders = append(pb.linkHeaders, &pb.loopback)
+		typ = pb.loopback.Family.LayerType()
+		data = pb.loopback.LayerPayload()
+		pb.ethertype = ipEtherType(typ)
+	} else if typ == layers.LayerTypePPP {
+		var ok bool
+		if typ, data, ok = pb.decodePPP(data); !ok {
+			return false
+		}
+		pb.link = &pb.ppp
+	} else if typ == layers.LayerTypeRadioTap || typ == layers.LayerTypeDot11 {
+		fcs := false
+		if typ == layers.LayerTypeRadioTap {
+			if err := pb.radiotap.DecodeFromBytes(data, pb); err != nil {
+				return false
+			}
+			pb.linkHeaders = append(pb.linkHeaders, &pb.radiotap)
+			fcs = pb.radiotap.Flags.FCS()
+			data = pb.radiotap.LayerPayload()
+		}
+		if err := pb.dot11.decode(data, fcs); err != nil {
+			return false
+		}
+		pb.link = &pb.dot11
+		pb.ethertype = 0
+		if !pb.dot11.HasData() {
+			// management, control, encrypted, and null frames
+			return true
+		}
+		var ok bool
+		if typ, data, ok = pb.decodeLLC(pb.dot11.LayerPayload()); !ok {
+			return false
+		}
 	} else if typ == LayerTypeIPv46 {
 		version := data[0] >> 4
 		switch version {
@@ -485,6 +607,98 @@ func (pb *packetBuffer) decode() (ret bool) {
 		pb.ethertype = pb.dot1q[cur].Type
 	}
 
+	if pb.ethertype == layers.EthernetTypePPPoESession && typ == layers.LayerTypePPPoE {
+		var ok bool
+		if typ, data, ok = pb.decodePPPoE(data); !ok {
+			return false
+		}
+	}
+
+	return pb.decodeNetwork(typ, data)
+}
+
+// decodeLLC decodes an LLC header with optional SNAP header and sets the ethertype accordingly
+func (pb *packetBuffer) decodeLLC(data []byte) (gopacket.LayerType, []byte, bool) {
+	var l layers.LLC
+	if err := l.DecodeFromBytes(data, pb); err != nil {
+		return gopacket.LayerTypeZero, nil, false
+	}
+	typ := l.NextLayerType()
+	data = l.LayerPayload()
+	//SMELL: this might be bad
+	pb.ethertype = layers.EthernetType(uint16(l.DSAP&0x7F)<<8 | uint16(l.SSAP&0x7F))
+	if typ == layers.LayerTypeSNAP {
+		var s layers.SNAP
+		if err := s.DecodeFromBytes(data, pb); err != nil {
+			return gopacket.LayerTypeZero, nil, false
+		}
+		typ = s.NextLayerType()
+		data = s.LayerPayload()
+		pb.ethertype = s.Type
+	}
+	return typ, data, true
+}
+
+// decodePPP decodes a PPP header and sets the ethertype for IPv4 and IPv6. Other protocols are not decoded further.
+func (pb *packetBuffer) decodePPP(data []byte) (gopacket.LayerType, []byte, bool) {
+	proto, n := pppProtocol(data)
+	if n == 0 {
+		return gopacket.LayerTypeZero, nil, false
+	}
+	pb.ppp.PPPType = proto
+	pb.ppp.BaseLayer = layers.BaseLayer{Contents: data[:n], Payload: data[n:]}
+	typ := gopacket.LayerTypePayload
+	switch proto {
+	case layers.PPPTypeIPv4:
+		typ = layers.LayerTypeIPv4
+	case layers.PPPTypeIPv6:
+		typ = layers.LayerTypeIPv6
+	}
+	pb.ethertype = ipEtherType(typ)
+	return typ, data[n:], true
+}
+
+// decodePPPoE decodes a PPPoE session header and the PPP header following it
+func (pb *packetBuffer) decodePPPoE(data []byte) (gopacket.LayerType, []byte, bool) {
+	if len(data) < 6 {
+		return gopacket.LayerTypeZero, nil, false
+	}
+	pb.pppoe.Version = data[0] >> 4
+	pb.pppoe.Type = data[0] & 0x0F
+	pb.pppoe.Code = layers.PPPoECode(data[1])
+	pb.pppoe.SessionId = binary.BigEndian.Uint16(data[2:4])
+	pb.pppoe.Length = binary.BigEndian.Uint16(data[4:6])
+	end := 6 + int(pb.pppoe.Length)
+	if end > len(data) {
+		end = len(data)
+	}
+	pb.pppoe.BaseLayer = layers.BaseLayer{Contents: data[:6], Payload: data[6:end]}
+	pb.linkHeaders = append(pb.linkHeaders, &pb.pppoe)
+	typ, data, ok := pb.decodePPP(pb.pppoe.Payload)
+	if ok {
+		pb.linkHeaders = append(pb.linkHeaders, &pb.ppp)
+	}
+	return typ, data, ok
+}
+
+// ipEtherType returns the ethertype for the given network layer type, or 0 for non-ip layers
+func ipEtherType(typ gopacket.LayerType) layers.EthernetType {
+	switch typ {
+	case layers.LayerTypeIPv4:
+		return layers.EthernetTypeIPv4
+	case layers.LayerTypeIPv6:
+		return layers.EthernetTypeIPv6
+	}
+	return 0
+}
+
+// offset returns the position of the given slice of the packet data within the buffer
+func (pb *packetBuffer) offset(data []byte) int {
+	return cap(pb.buffer) - cap(data)
+}
+
+// decodeNetwork decodes the network and transport layer
+func (pb *packetBuffer) decodeNetwork(typ gopacket.LayerType, data []byte) bool {
 	// network layer
 	if typ == layers.LayerTypeIPv4 {
 		if err := pb.ip4.DecodeFromBytes(data, pb); err != nil {
@@ -502,13 +716,27 @@ func (pb *packetBuffer) decode() (ret bool) {
 		if data[3] == 0 && data[2] == 0 && pb.ci.Truncated {
 			// ip.Length == 0; e.g. windows TSO
 			// fix length if packet is truncated...
-			newlen := pb.ci.CaptureLength
-			if pb.link != nil {
-				newlen -= len(pb.link.LayerContents())
+			pb.ip4.Length = uint16(pb.ci.CaptureLength - pb.offset(data))
+		}
+		if pb.defrag && pb.outer == nil && !pb.ci.Truncated && (pb.ip4.Flags&layers.IPv4MoreFragments != 0 || pb.ip4.FragOffset != 0) {
+			pb.isFragment = true
+			pb.fragment = fragmentInfo{
+				id:     uint32(pb.ip4.Id),
+				offset: int(pb.ip4.FragOffset) * 8,
+				start:  pb.offset(data),
+				header: pb.offset(pb.ip4.Payload),
+				data:   pb.offset(pb.ip4.Payload),
+				length: len(pb.ip4.Payload),
+				proto:  pb.proto,
+				more:   pb.ip4.Flags&layers.IPv4MoreFragments != 0,
 			}
-			pb.ip4.Length = uint16(newlen)
+			return true
 		}
 		typ = pb.ip4.NextLayerType()
+		if pb.failed && pb.ip4.FragOffset == 0 {
+			// first fragment of a datagram that couldn't be reassembled -> decode at least the transport header
+			typ = pb.ip4.Protocol.LayerType()
+		}
 		data = pb.ip4.LayerPayload()
 	} else if typ == layers.LayerTypeIPv6 {
 		if err := pb.ip6.DecodeFromBytes(data, pb); err != nil {
@@ -519,9 +747,33 @@ func (pb *packetBuffer) decode() (ret bool) {
 		if pb.proto == 0 { //fix hopbyhop
 			pb.proto = uint8(pb.ip6.HopByHop.NextHeader)
 		}
+		start := pb.offset(data)
+		end := start + 40 + int(pb.ip6.Length)
+		nextHeader := start + 6
+		if pb.ip6.HopByHop != nil {
+			nextHeader = start + 40
+		}
 		typ = pb.ip6.NextLayerType()
 		data = pb.ip6.LayerPayload()
 		for layers.LayerClassIPv6Extension.Contains(typ) {
+			if typ == layers.LayerTypeIPv6Fragment && pb.defrag && pb.outer == nil && !pb.ci.Truncated && end >= pb.offset(data)+8 && end <= len(pb.buffer) {
+				pb.isFragment = true
+				pb.proto = data[0]
+				pb.fragment = fragmentInfo{
+					id:         binary.BigEndian.Uint32(data[4:8]),
+					offset:     int(binary.BigEndian.Uint16(data[2:4]) &^ 7),
+					start:      start,
+					header:     pb.offset(data),
+					data:       pb.offset(data) + 8,
+					length:     end - pb.offset(data) - 8,
+					nextHeader: nextHeader,
+					proto:      data[0],
+					more:       data[3]&1 != 0,
+					v6:         true,
+				}
+				return true
+			}
+			nextHeader = pb.offset(data)
 			if err := pb.ip6skipper.DecodeFromBytes(data, pb); err != nil {
 				return false
 			}
@@ -543,6 +795,14 @@ func (pb *packetBuffer) decode() (ret bool) {
 			return false
 		}
 		pb.transport = &pb.udp
+		if pb.tunnels != TunnelNone {
+			switch pb.udp.DstPort {
+			case vxlanPort:
+				return pb.tunnel(layers.LayerTypeVXLAN, pb.udp.Payload)
+			case genevePort:
+				return pb.tunnel(layers.LayerTypeGeneve, pb.udp.Payload)
+			}
+		}
 		return true
 	case layers.LayerTypeTCP:
 		if err := pb.tcp.DecodeFromBytes(data, pb); err != nil {
@@ -567,6 +827,10 @@ func (pb *packetBuffer) decode() (ret bool) {
 		}
 		pb.transport = &pb.icmpv6
 		return true
+	case layers.LayerTypeIPv4, layers.LayerTypeIPv6, layers.LayerTypeGRE:
+		if pb.tunnels != TunnelNone {
+			return pb.tunnel(typ, data)
+		}
 	}
 	return true
 }
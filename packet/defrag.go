@@ -0,0 +1,345 @@
+package packet
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/CN-TU/go-flows/flows"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// maxDatagram is the maximum value of the ip length field
+	maxDatagram = 65535
+	// DefaultDefragTimeout is the default time after which incomplete datagrams are dropped (same as linux)
+	DefaultDefragTimeout = 30 * flows.SecondsInNanoseconds
+	// DefaultDefragFragments is the default number of fragments that can be held for reassembly
+	DefaultDefragFragments = 10000
+)
+
+// fragmentInfo holds the fragment header values and the position of the headers and data inside the packet buffer
+type fragmentInfo struct {
+	id         uint32
+	offset     int // offset of the fragment data in the reassembled payload
+	start      int // start of the network layer in the buffer
+	header     int // end of the unfragmentable part (start of fragment header for IPv6) in the buffer
+	data       int // start of the fragment data in the buffer
+	length     int // length of the fragment data
+	nextHeader int // position of the next header field pointing to the fragment header (IPv6 only)
+	proto      uint8
+	more       bool
+	v6         bool
+}
+
+// datagram holds the fragments of a single IP packet that is being reassembled
+type datagram struct {
+	key       string
+	fragments []*packetBuffer
+	created   flows.DateTimeNanoseconds
+	total     int // length of the reassembled payload or -1 if the last fragment is missing
+	overlaps  int
+	done      bool
+}
+
+// defragmenter reassembles IPv4 and IPv6 fragments. Fragments are held (i.e. not recycled) until either every
+// fragment of the datagram arrived, the datagram timed out, or the memory limit was hit. Reassembled packets are
+// written into the buffer of the fragment completing the datagram. If reassembly fails, only the first fragment is
+// handed on with ReassemblyFailed set (like it would without defragmentation); the other fragments get dropped. Since
+// packets after the first fragment have already been handed on, it gets the time of the newest packet seen.
+//
+// Overlapping fragments with the same content are accepted, while overlapping fragments with different content
+// (evasion attempt) cause the reassembly to fail.
+type defragmenter struct {
+	datagrams map[string]*datagram
+	queue     []*datagram // ordered by creation time
+	ready     []*packetBuffer
+	scratch   []byte
+	key       []byte
+	stats     *decodeStats
+	timeout   flows.DateTimeNanoseconds
+	now       flows.DateTimeNanoseconds // time of the newest packet seen
+	max       int
+	held      int
+}
+
+func newDefragmenter(timeout flows.DateTimeNanoseconds, max int, stats *decodeStats) *defragmenter {
+	if timeout <= 0 {
+		timeout = DefaultDefragTimeout
+	}
+	return &defragmenter{
+		datagrams: make(map[string]*datagram),
+		stats:     stats,
+		timeout:   timeout,
+		max:       max,
+	}
+}
+
+// add hands the fragment pb over to the defragmenter. Packets that are ready afterwards (reassembled or failed) are
+// appended to ready.
+func (d *defragmenter) add(pb *packetBuffer) {
+	d.stats.fragments++
+	d.expire(pb.time)
+	if d.max > 0 {
+		for d.held >= d.max && d.evict() {
+		}
+	}
+
+	f := &pb.fragment
+	d.key = append(d.key[:0], pb.network.NetworkFlow().Src().Raw()...)
+	d.key = append(d.key, pb.network.NetworkFlow().Dst().Raw()...)
+	if !f.v6 {
+		d.key = append(d.key, f.proto)
+	}
+	d.key = append(d.key, byte(f.id>>24), byte(f.id>>16), byte(f.id>>8), byte(f.id))
+
+	dg, ok := d.datagrams[string(d.key)]
+	if !ok {
+		dg = &datagram{key: string(d.key), created: pb.time, total: -1}
+		d.datagrams[dg.key] = dg
+		d.queue = append(d.queue, dg)
+	}
+
+	if f.offset == 0 && f.more && f.length < minTransportLength(f.proto) ||
+		!f.v6 && f.offset == 8 && f.proto == uint8(layers.IPProtocolTCP) {
+		// tiny first fragment or overwrite of the tcp flags (RFC 1858)
+		d.stats.evasiveFragments++
+	}
+
+	dg.fragments = append(dg.fragments, pb)
+	d.held++
+
+	end := f.offset + f.length
+	hlen := f.header - f.start
+	if f.v6 {
+		// the payload length of ipv6 doesn't include the ipv6 header
+		hlen -= 40
+	}
+	failed := end+hlen > maxDatagram || (dg.total != -1 && end > dg.total)
+	if !f.more {
+		if dg.total != -1 && dg.total != end {
+			failed = true
+		}
+		dg.total = end
+	}
+	for _, other := range dg.fragments[:len(dg.fragments)-1] {
+		o := &other.fragment
+		if o.offset >= end || f.offset >= o.offset+o.length {
+			continue
+		}
+		dg.overlaps++
+		d.stats.overlappingFragments++
+		if !overlapMatches(pb, other) {
+			d.stats.evasiveFragments++
+			failed = true
+		}
+	}
+	if failed {
+		d.fail(dg)
+		return
+	}
+
+	if dg.total != -1 && dg.complete() {
+		d.reassemble(dg, pb)
+	}
+}
+
+// minTransportLength returns the minimum size of the transport header for the given protocol
+func minTransportLength(proto uint8) int {
+	switch layers.IPProtocol(proto) {
+	case layers.IPProtocolTCP:
+		return 20
+	case layers.IPProtocolUDP, layers.IPProtocolICMPv4, layers.IPProtocolICMPv6:
+		return 8
+	}
+	return 0
+}
+
+// overlapMatches returns true if the overlapping parts of the two fragments are equal
+func overlapMatches(a, b *packetBuffer) bool {
+	fa, fb := &a.fragment, &b.fragment
+	start := fa.offset
+	if fb.offset > start {
+		start = fb.offset
+	}
+	end := fa.offset + fa.length
+	if e := fb.offset + fb.length; e < end {
+		end = e
+	}
+	da := a.buffer[fa.data+start-fa.offset : fa.data+end-fa.offset]
+	db := b.buffer[fb.data+start-fb.offset : fb.data+end-fb.offset]
+	return string(da) == string(db)
+}
+
+// complete sorts the fragments by offset and checks if the whole payload is covered
+func (dg *datagram) complete() bool {
+	sort.SliceStable(dg.fragments, func(i, j int) bool {
+		return dg.fragments[i].fragment.offset < dg.fragments[j].fragment.offset
+	})
+	end := 0
+	for _, pb := range dg.fragments {
+		if pb.fragment.offset > end {
+			return false
+		}
+		if e := pb.fragment.offset + pb.fragment.length; e > end {
+			end = e
+		}
+	}
+	return end >= dg.total
+}
+
+// remove removes the datagram from the defragmenter; the datagram gets removed from the queue lazily
+func (d *defragmenter) remove(dg *datagram) {
+	delete(d.datagrams, dg.key)
+	dg.done = true
+	d.held -= len(dg.fragments)
+}
+
+// reassemble writes the reassembled packet of the completed datagram dg into the buffer of pb
+func (d *defragmenter) reassemble(dg *datagram, pb *packetBuffer) {
+	d.remove(dg)
+	first := dg.fragments[0]
+	f := &first.fragment
+	prefix := first.buffer[:f.header]
+	n := len(prefix) + dg.total
+	if cap(d.scratch) < n {
+		d.scratch = make([]byte, n)
+	}
+	data := d.scratch[:n]
+	copy(data, prefix)
+	for _, fragment := range dg.fragments {
+		frag := &fragment.fragment
+		copy(data[len(prefix)+frag.offset:], fragment.buffer[frag.data:frag.data+frag.length])
+	}
+
+	// fix up the network header
+	header := data[f.start:]
+	if f.v6 {
+		binary.BigEndian.PutUint16(header[4:6], uint16(f.header-f.start-40+dg.total))
+		data[f.nextHeader] = f.proto
+	} else {
+		ihl := f.header - f.start
+		binary.BigEndian.PutUint16(header[2:4], uint16(ihl+dg.total))
+		header[6] &= 0x40 // keep DF; clear MF and fragment offset
+		header[7] = 0
+		header[10] = 0
+		header[11] = 0
+		binary.BigEndian.PutUint16(header[10:12], ipv4Checksum(header[:ihl]))
+	}
+
+	overlaps := dg.overlaps
+	fragments := len(dg.fragments)
+	lt := first.first
+	for _, fragment := range dg.fragments {
+		if fragment != pb {
+			fragment.Recycle()
+		}
+	}
+
+	if cap(pb.buffer) < n {
+		pb.buffer = make([]byte, n)
+	}
+	pb.buffer = pb.buffer[:n]
+	copy(pb.buffer, data)
+	pb.first = lt
+	pb.ci.CaptureLength = n
+	pb.ci.Length = n
+	pb.ci.Truncated = false
+	pb.resetLayers()
+	if !pb.decode() {
+		d.stats.decodeError++
+		d.stats.reassemblyFailures++
+		pb.Recycle()
+		return
+	}
+	pb.fragments = fragments
+	pb.overlaps = overlaps
+	d.stats.reassembled++
+	d.ready = append(d.ready, pb)
+}
+
+// fail drops every fragment of the datagram dg except for the first one, which is handed on as is
+func (d *defragmenter) fail(dg *datagram) {
+	d.remove(dg)
+	d.stats.reassemblyFailures++
+	var first *packetBuffer
+	for _, fragment := range dg.fragments {
+		if first == nil && fragment.fragment.offset == 0 {
+			first = fragment
+		} else {
+			fragment.Recycle()
+		}
+	}
+	if first == nil {
+		return
+	}
+	first.failed = true
+	if first.time < d.now {
+		// the flow table must not go back in time
+		first.time = d.now
+	}
+	first.fragments = len(dg.fragments)
+	first.overlaps = dg.overlaps
+	first.defrag = false
+	first.resetLayers()
+	ok := first.decode()
+	first.defrag = true
+	if !ok {
+		d.stats.decodeError++
+		first.Recycle()
+		return
+	}
+	d.ready = append(d.ready, first)
+}
+
+// pop removes the oldest datagram from the queue
+func (d *defragmenter) pop() {
+	d.queue[0] = nil
+	d.queue = d.queue[1:]
+}
+
+// expire fails every datagram older than the timeout. now must be the time of the newest packet.
+func (d *defragmenter) expire(now flows.DateTimeNanoseconds) {
+	if now > d.now {
+		d.now = now
+	}
+	for len(d.queue) > 0 {
+		dg := d.queue[0]
+		if !dg.done {
+			if dg.created+d.timeout > now {
+				return
+			}
+			d.fail(dg)
+		}
+		d.pop()
+	}
+}
+
+// evict fails the oldest datagram. Returns false if there was no datagram to evict.
+func (d *defragmenter) evict() bool {
+	for len(d.queue) > 0 {
+		dg := d.queue[0]
+		d.pop()
+		if !dg.done {
+			d.fail(dg)
+			return true
+		}
+	}
+	return false
+}
+
+// flush fails every remaining datagram
+func (d *defragmenter) flush() {
+	for d.evict() {
+	}
+}
+
+func ipv4Checksum(header []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(header); i += 2 {
+		sum += uint32(header[i])<<8 | uint32(header[i+1])
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
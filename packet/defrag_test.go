@@ -0,0 +1,321 @@
+package packet
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/CN-TU/go-flows/flows"
+	ipfix "github.com/CN-TU/go-ipfix"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+type fragmentSpec struct {
+	offset int
+	length int
+	more   bool
+}
+
+// fragmentIPv4 splits the ipv4 packet data into fragments
+func fragmentIPv4(data []byte, specs ...fragmentSpec) [][]byte {
+	ret := make([][]byte, 0, len(specs))
+	payload := data[20:]
+	for _, spec := range specs {
+		frag := append([]byte{}, data[:20]...)
+		frag = append(frag, payload[spec.offset:spec.offset+spec.length]...)
+		binary.BigEndian.PutUint16(frag[2:4], uint16(len(frag)))
+		flags := uint16(spec.offset / 8)
+		if spec.more {
+			flags |= 0x2000
+		}
+		binary.BigEndian.PutUint16(frag[6:8], flags)
+		ret = append(ret, frag)
+	}
+	return ret
+}
+
+// fragmentIPv6 splits the ipv6 packet data (without extension headers) into fragments
+func fragmentIPv6(data []byte, specs ...fragmentSpec) [][]byte {
+	ret := make([][]byte, 0, len(specs))
+	payload := data[40:]
+	for _, spec := range specs {
+		frag := append([]byte{}, data[:40]...)
+		frag[6] = byte(layers.IPProtocolIPv6Fragment)
+		header := []byte{data[6], 0, 0, 0, 0, 0, 0, 42}
+		flags := uint16(spec.offset)
+		if spec.more {
+			flags |= 1
+		}
+		binary.BigEndian.PutUint16(header[2:4], flags)
+		frag = append(frag, header...)
+		frag = append(frag, payload[spec.offset:spec.offset+spec.length]...)
+		binary.BigEndian.PutUint16(frag[4:6], uint16(len(frag)-40))
+		ret = append(ret, frag)
+	}
+	return ret
+}
+
+func udpPacket(t *testing.T, network gopacket.NetworkLayer, payload int) []byte {
+	udp := &layers.UDP{SrcPort: 1234, DstPort: 53}
+	udp.SetNetworkLayerForChecksum(network)
+	data := make([]byte, payload)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	return serializeTunnel(t, network.(gopacket.SerializableLayer), udp, gopacket.Payload(data))
+}
+
+type defragTest struct {
+	t       *testing.T
+	stats   decodeStats
+	defrag  *defragmenter
+	owner   *multiPacketBuffer
+	lt      gopacket.LayerType
+	packets uint64
+}
+
+func newDefragTest(t *testing.T, lt gopacket.LayerType) *defragTest {
+	ret := &defragTest{
+		t:     t,
+		owner: newMultiPacketBuffer(1, 0, true, DecodeOptions{Defragment: true}),
+		lt:    lt,
+	}
+	ret.defrag = newDefragmenter(flows.SecondsInNanoseconds, 10, &ret.stats)
+	return ret
+}
+
+// add decodes data and forwards it to the defragmenter. Returns the packets that are ready afterwards.
+func (d *defragTest) add(when flows.DateTimeNanoseconds, data []byte) []*packetBuffer {
+	d.packets++
+	pb := &packetBuffer{owner: d.owner, resize: true, defrag: true}
+	pb.assign(data, gopacket.CaptureInfo{Timestamp: time.Unix(0, int64(when)), CaptureLength: len(data), Length: len(data)}, d.lt, d.packets)
+	if !pb.decode() {
+		d.t.Fatal("decode failed")
+	}
+	if !pb.isFragment {
+		d.t.Fatal("packet is not a fragment")
+	}
+	d.defrag.add(pb)
+	ret := d.defrag.ready
+	d.defrag.ready = nil
+	return ret
+}
+
+func assertUDP(t *testing.T, pb *packetBuffer, payload int) {
+	udp, ok := pb.TransportLayer().(*layers.UDP)
+	if !ok {
+		t.Fatalf("expected udp transport layer; got %v", pb.TransportLayer())
+	}
+	if udp.SrcPort != 1234 || udp.DstPort != 53 {
+		t.Errorf("wrong ports %d -> %d", udp.SrcPort, udp.DstPort)
+	}
+	if len(udp.Payload) != payload {
+		t.Errorf("payload has length %d; expected %d", len(udp.Payload), payload)
+	}
+	for i, b := range udp.Payload {
+		if b != byte(i) {
+			t.Fatalf("payload differs at byte %d", i)
+		}
+	}
+}
+
+func TestDefragIPv4(t *testing.T) {
+	data := udpPacket(t, &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Id: 7, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}, Protocol: layers.IPProtocolUDP}, 100)
+	frags := fragmentIPv4(data, fragmentSpec{0, 40, true}, fragmentSpec{80, 28, false}, fragmentSpec{40, 40, true})
+	d := newDefragTest(t, layers.LayerTypeIPv4)
+	if ready := d.add(1, frags[0]); len(ready) != 0 {
+		t.Fatal("got packet before reassembly")
+	}
+	if ready := d.add(2, frags[1]); len(ready) != 0 {
+		t.Fatal("got packet before reassembly")
+	}
+	ready := d.add(3, frags[2])
+	if len(ready) != 1 {
+		t.Fatalf("expected one reassembled packet; got %d", len(ready))
+	}
+	pb := ready[0]
+	assertUDP(t, pb, 100)
+	if pb.Fragments() != 3 || pb.FragmentOverlaps() != 0 || pb.ReassemblyFailed() {
+		t.Errorf("wrong fragment info: fragments %d overlaps %d failed %t", pb.Fragments(), pb.FragmentOverlaps(), pb.ReassemblyFailed())
+	}
+	if pb.NetworkLayerLength() != len(data) {
+		t.Errorf("network layer length is %d; expected %d", pb.NetworkLayerLength(), len(data))
+	}
+	if pb.Timestamp() != 3 {
+		t.Errorf("timestamp of reassembled packet is %d; expected 3", pb.Timestamp())
+	}
+	if d.stats.fragments != 3 || d.stats.reassembled != 1 || d.defrag.held != 0 {
+		t.Errorf("wrong statistics %+v (held %d)", d.stats, d.defrag.held)
+	}
+}
+
+func TestDefragIPv6(t *testing.T) {
+	data := udpPacket(t, &layers.IPv6{Version: 6, HopLimit: 64, SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("2001:db8::2"), NextHeader: layers.IPProtocolUDP}, 100)
+	frags := fragmentIPv6(data, fragmentSpec{0, 56, true}, fragmentSpec{56, 52, false})
+	d := newDefragTest(t, layers.LayerTypeIPv6)
+	if ready := d.add(1, frags[1]); len(ready) != 0 {
+		t.Fatal("got packet before reassembly")
+	}
+	ready := d.add(2, frags[0])
+	if len(ready) != 1 {
+		t.Fatalf("expected one reassembled packet; got %d", len(ready))
+	}
+	pb := ready[0]
+	assertUDP(t, pb, 100)
+	if pb.Proto() != uint8(layers.IPProtocolUDP) {
+		t.Errorf("protocol is %d; expected udp", pb.Proto())
+	}
+	if pb.NetworkLayerLength() != len(data) {
+		t.Errorf("network layer length is %d; expected %d", pb.NetworkLayerLength(), len(data))
+	}
+}
+
+func TestDefragOverlap(t *testing.T) {
+	data := udpPacket(t, &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Id: 7, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}, Protocol: layers.IPProtocolUDP}, 100)
+	frags := fragmentIPv4(data, fragmentSpec{0, 48, true}, fragmentSpec{40, 68, false})
+	d := newDefragTest(t, layers.LayerTypeIPv4)
+	d.add(1, frags[0])
+	ready := d.add(2, frags[1])
+	if len(ready) != 1 {
+		t.Fatalf("expected one reassembled packet; got %d", len(ready))
+	}
+	assertUDP(t, ready[0], 100)
+	if ready[0].FragmentOverlaps() != 1 {
+		t.Errorf("expected one overlap; got %d", ready[0].FragmentOverlaps())
+	}
+
+	// overlap with different content
+	frags = fragmentIPv4(data, fragmentSpec{0, 48, true}, fragmentSpec{40, 68, false})
+	frags[1][20] ^= 0xff
+	d.add(3, frags[0])
+	ready = d.add(4, frags[1])
+	if len(ready) != 1 || !ready[0].ReassemblyFailed() {
+		t.Fatal("expected failed first fragment")
+	}
+	if ready[0].fragment.offset != 0 {
+		t.Error("expected first fragment")
+	}
+	udp, ok := ready[0].TransportLayer().(*layers.UDP)
+	if !ok || udp.DstPort != 53 {
+		t.Error("expected udp header in first fragment")
+	}
+	if d.stats.reassemblyFailures != 1 || d.stats.overlappingFragments != 2 || d.stats.evasiveFragments != 1 {
+		t.Errorf("wrong statistics %+v", d.stats)
+	}
+}
+
+func TestDefragTimeout(t *testing.T) {
+	data := udpPacket(t, &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Id: 7, SrcIP: net.IP{10, 0, 0, 1}, DstIP: net.IP{10, 0, 0, 2}, Protocol: layers.IPProtocolUDP}, 100)
+	frags := fragmentIPv4(data, fragmentSpec{0, 40, true}, fragmentSpec{40, 68, false})
+	d := newDefragTest(t, layers.LayerTypeIPv4)
+	d.add(1, frags[0])
+	ready := d.add(1+2*flows.SecondsInNanoseconds, frags[1])
+	if len(ready) != 1 || !ready[0].ReassemblyFailed() || ready[0].Fragments() != 1 {
+		t.Fatal("expected failed first fragment")
+	}
+	d.defrag.flush()
+	if len(d.defrag.ready) != 0 {
+		t.Fatal("got first fragment for datagram without first fragment")
+	}
+	if d.stats.reassemblyFailures != 2 || d.defrag.held != 0 || len(d.defrag.datagrams) != 0 {
+		t.Errorf("wrong statistics %+v (held %d)", d.stats, d.defrag.held)
+	}
+}
+
+// packetSource returns the given packets at the given times
+type packetSource struct {
+	times   []flows.DateTimeNanoseconds
+	packets [][]byte
+}
+
+func (ps *packetSource) ID() string { return "packets" }
+func (ps *packetSource) Init()      {}
+func (ps *packetSource) Stop()      {}
+
+func (ps *packetSource) ReadPacket() (lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo, skipped uint64, filtered uint64, err error) {
+	if len(ps.packets) == 0 {
+		err = io.EOF
+		return
+	}
+	data = ps.packets[0]
+	ci = gopacket.CaptureInfo{Timestamp: time.Unix(0, int64(ps.times[0])), CaptureLength: len(data), Length: len(data)}
+	ps.times, ps.packets = ps.times[1:], ps.packets[1:]
+	return layers.LayerTypeIPv4, data, ci, 0, 0, nil
+}
+
+// flowEnds records the flow end times
+type flowEnds struct {
+	times []flows.DateTimeNanoseconds
+}
+
+func (fe *flowEnds) ID() string      { return "ends" }
+func (fe *flowEnds) Init()           {}
+func (fe *flowEnds) Fields([]string) {}
+func (fe *flowEnds) Finish()         {}
+func (fe *flowEnds) Export(template flows.Template, features []interface{}, when flows.DateTimeNanoseconds) {
+	fe.times = append(fe.times, features[0].(flows.DateTimeNanoseconds))
+}
+
+// defragTestEnd is the time of the flow end as seen by the features
+type defragTestEnd struct {
+	flows.BaseFeature
+}
+
+func (f *defragTestEnd) Event(new interface{}, context *flows.EventContext, src interface{}) {}
+
+func (f *defragTestEnd) Stop(reason flows.FlowEndReason, context *flows.EventContext) {
+	f.SetValue(context.When(), context, f)
+}
+
+func init() {
+	flows.RegisterTemporaryFeature("__defragTestEnd", "time of the flow end", ipfix.DateTimeNanosecondsType, 0, flows.FlowFeature, func() flows.Feature { return &defragTestEnd{} }, flows.RawPacket)
+}
+
+func TestDefragTimeoutExportOrder(t *testing.T) {
+	second := flows.SecondsInNanoseconds
+	ip := func(src byte, id uint16) *layers.IPv4 {
+		return &layers.IPv4{Version: 4, IHL: 5, TTL: 64, Id: id, SrcIP: net.IP{10, 0, 0, src}, DstIP: net.IP{10, 0, 0, 100}, Protocol: layers.IPProtocolUDP}
+	}
+	first := fragmentIPv4(udpPacket(t, ip(1, 7), 100), fragmentSpec{0, 40, true})[0]
+	other := fragmentIPv4(udpPacket(t, ip(2, 8), 100), fragmentSpec{0, 40, true})[0]
+	source := &packetSource{
+		// the first fragment times out after another flow ended on idle timeout; the other fragment is handed on at the
+		// end after the last packet
+		times:   []flows.DateTimeNanoseconds{1 * second, 2 * second, 15 * second, 40 * second, 100 * second},
+		packets: [][]byte{first, udpPacket(t, ip(3, 0), 10), udpPacket(t, ip(3, 0), 10), other, udpPacket(t, ip(4, 0), 10)},
+	}
+
+	exporter := &flowEnds{}
+	pipe, err := flows.MakeExportPipeline([]flows.Exporter{exporter}, flows.SortTypeNone, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recordList flows.RecordListMaker
+	if err := recordList.AppendRecord([]interface{}{"__defragTestEnd"}, nil, nil, pipe, false); err != nil {
+		t.Fatal(err)
+	}
+	recordList.Init()
+	selector := MakeDynamicKeySelector([]string{"sourceIPAddress", "destinationIPAddress"}, false, false)
+	table := NewFlowTable(1, recordList, NewFlow, flows.FlowOptions{IdleTimeout: 5 * second}, second, selector, true)
+	var sources Sources
+	sources.Append(source)
+	engine := NewEngine(0, table, nil, sources, nil, DecodeOptions{Defragment: true, DefragTimeout: 10 * second})
+	stopped := engine.Run()
+	engine.Finish()
+	table.EOF(stopped)
+	pipe.Flush()
+
+	// flows end on idle timeout in order of their last packet, and at EOF
+	if len(exporter.times) != 5 {
+		t.Fatalf("got %d exports; expected 5", len(exporter.times))
+	}
+	for i := 1; i < len(exporter.times); i++ {
+		if exporter.times[i] < exporter.times[i-1] {
+			t.Errorf("flow end times not in order: %v", exporter.times)
+			break
+		}
+	}
+}
@@ -1,6 +1,11 @@
 package packet
 
 import (
+	"errors"
+	"io"
+	"math"
+
+	"github.com/CN-TU/go-flows/flows"
 	"github.com/CN-TU/go-flows/util"
 	"github.com/google/gopacket"
 )
@@ -14,6 +19,20 @@ type Filter interface {
 	Matches(lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo, n uint64) bool
 }
 
+// StatsFilter is a filter that keeps statistics, which are printed with the packet statistics
+type StatsFilter interface {
+	Filter
+	// PrintStats writes the statistics of this filter to w
+	PrintStats(w io.Writer)
+}
+
+// SamplingFilter is a filter that selects a sample of the packets (see flows.Sampling)
+type SamplingFilter interface {
+	Filter
+	// Sampling returns the packet selection done by this filter
+	Sampling() flows.Sampling
+}
+
 // Filters holds a collection of filters that are tried one after another
 type Filters []Filter
 
@@ -27,6 +46,48 @@ func (f Filters) Matches(lt gopacket.LayerType, data []byte, ci gopacket.Capture
 	return true
 }
 
+// Init initializes the filters
+func (f Filters) Init() {
+	for _, filter := range f {
+		filter.Init()
+	}
+}
+
+// PrintStats writes the statistics of every filter implementing StatsFilter to w
+func (f Filters) PrintStats(w io.Writer) {
+	for _, filter := range f {
+		if stats, ok := filter.(StatsFilter); ok {
+			stats.PrintStats(w)
+		}
+	}
+}
+
+// Sampling returns the combined packet selection of every filter implementing SamplingFilter. Since the filters are
+// applied one after another, the rates multiply. Sampling filters with different algorithms can't be combined.
+func (f Filters) Sampling() (flows.Sampling, error) {
+	var ret flows.Sampling
+	for _, filter := range f {
+		s, ok := filter.(SamplingFilter)
+		if !ok {
+			continue
+		}
+		sampling := s.Sampling()
+		if !ret.Sampled() {
+			ret = sampling
+			continue
+		}
+		if ret.Algorithm != sampling.Algorithm {
+			return flows.Sampling{}, errors.New("sample filters with different methods can't be combined")
+		}
+		rate := uint64(ret.Rate) * uint64(sampling.Rate)
+		if rate > math.MaxUint32 {
+			return flows.Sampling{}, errors.New("combined sampling rate of the sample filters is too large")
+		}
+		ret.Rate = uint32(rate)
+	}
+	return ret, nil
+}
+
 // RegisterFilter registers an filter (see module system in util)
 func RegisterFilter(name, desc string, new util.ModuleCreator, help util.ModuleHelp) {
 	util.RegisterModule(filterName, name, desc, new, help)
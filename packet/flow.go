@@ -1,13 +1,16 @@
 package packet
 
 import (
+	"encoding/gob"
+
 	"github.com/CN-TU/go-flows/flows"
 	"github.com/google/gopacket/layers"
 )
 
 type tcpFlow struct {
 	flows.BaseFlow
-	srcFIN, dstFIN, dstACK, srcACK bool
+	tracker TCPTracker
+	closing flows.DateTimeNanoseconds // export time after TIME_WAIT or RST (0 = not closing)
 }
 
 type uniFlow struct {
@@ -31,34 +34,122 @@ func NewFlow(event flows.Event, table *flows.FlowTable, key string, lowToHigh bo
 	return ret
 }
 
-func (flow *tcpFlow) Event(event flows.Event, context *flows.EventContext) {
-	flow.BaseFlow.Event(event, context)
-	if !flow.Active() {
-		return
+// RestoreFlow recreates a flow saved in a checkpoint by the Snapshot function of tcp or standard flows
+func RestoreFlow(table *flows.FlowTable, key string, context *flows.EventContext, dec *gob.Decoder) (flows.Flow, error) {
+	var tcp bool
+	if err := dec.Decode(&tcp); err != nil {
+		return nil, err
+	}
+	var ret flows.Flow
+	if tcp {
+		ret = new(tcpFlow)
+	} else {
+		ret = new(uniFlow)
+	}
+	ret.Init(table, key, true, context, 0)
+	if err := ret.(flows.Snapshotter).Restore(dec); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Snapshot writes the flow kind (read by RestoreFlow) and the flow state to enc
+func (flow *uniFlow) Snapshot(enc *gob.Encoder) error {
+	if err := enc.Encode(false); err != nil {
+		return err
+	}
+	return flow.BaseFlow.Snapshot(enc)
+}
+
+// Snapshot writes the flow kind (read by RestoreFlow), the flow state, and the tcp state to enc
+func (flow *tcpFlow) Snapshot(enc *gob.Encoder) error {
+	if err := enc.Encode(true); err != nil {
+		return err
+	}
+	if err := flow.BaseFlow.Snapshot(enc); err != nil {
+		return err
+	}
+	if err := flow.tracker.Snapshot(enc); err != nil {
+		return err
+	}
+	return enc.Encode(flow.closing)
+}
+
+// Restore reads the flow and tcp state written by Snapshot from dec
+func (flow *tcpFlow) Restore(dec *gob.Decoder) error {
+	if err := flow.BaseFlow.Restore(dec); err != nil {
+		return err
+	}
+	if err := flow.tracker.Restore(dec); err != nil {
+		return err
+	}
+	if err := dec.Decode(&flow.closing); err != nil {
+		return err
 	}
+	if flow.closing != 0 {
+		flow.AddTimer(flows.TimerIdle, flow.closeEvent, flow.closing)
+	}
+	return nil
+}
+
+func (flow *tcpFlow) idleEvent(expires, now flows.DateTimeNanoseconds) {
+	flow.ExportWithoutContext(flows.FlowEndReasonIdle, expires, now)
+}
+
+func (flow *tcpFlow) closeEvent(expires, now flows.DateTimeNanoseconds) {
+	flow.ExportWithoutContext(flows.FlowEndReasonEnd, expires, now)
+}
+
+// Event forwards the event to the features and follows the tcp connection state. The idle timeout is replaced by the
+// timeout of the current state (see flows.TCPTimeouts), and the flow ends after a RST or after both FINs have been
+// acknowledged. A new SYN after that ends the flow right away and starts a new one.
+func (flow *tcpFlow) Event(event flows.Event, context *flows.EventContext) {
 	buffer := event.(Buffer)
 	tcp := buffer.TransportLayer().(*layers.TCP)
-	if tcp.RST {
+	if flow.tracker.NewConnection(tcp, context.Forward()) {
+		// the ports are reused during the grace period -> the SYN belongs to a new flow
 		flow.Export(flows.FlowEndReasonEnd, context, context.When())
+		context.Renew()
 		return
 	}
-	if context.Forward() {
-		if tcp.FIN {
-			flow.srcFIN = true
-		}
-		if flow.dstFIN && tcp.ACK {
-			flow.dstACK = true
-		}
-	} else {
-		if tcp.FIN {
-			flow.dstFIN = true
-		}
-		if flow.srcFIN && tcp.ACK {
-			flow.srcACK = true
+	flow.BaseFlow.Event(event, context)
+	if !flow.Active() {
+		return
+	}
+	if context.Started() {
+		// a new record follows a new connection
+		flow.tracker.Reset()
+		flow.closing = 0
+	}
+	flow.tracker.Update(tcp, buffer.PayloadLength(), context.Forward())
+	timeouts := &flow.Table().TCPTimeouts
+	var timeout flows.DateTimeNanoseconds
+	switch state := flow.tracker.State(); state {
+	case TCPStateHandshake:
+		timeout = timeouts.Handshake
+	case TCPStateEstablished:
+		timeout = timeouts.Established
+	case TCPStateHalfClosed:
+		timeout = timeouts.HalfClosed
+	case TCPStateClosing:
+		timeout = timeouts.Closing
+	case TCPStateTimeWait, TCPStateReset:
+		if flow.closing == 0 {
+			grace := timeouts.TimeWait
+			if state == TCPStateReset {
+				grace = timeouts.Reset
+			}
+			if grace == 0 {
+				flow.Export(flows.FlowEndReasonEnd, context, context.When())
+				return
+			}
+			flow.closing = context.When() + grace
 		}
+		// packets during the grace period must not extend it
+		flow.AddTimer(flows.TimerIdle, flow.closeEvent, flow.closing)
+		return
 	}
-
-	if flow.srcFIN && flow.srcACK && flow.dstFIN && flow.dstACK {
-		flow.Export(flows.FlowEndReasonEnd, context, context.When())
+	if timeout != 0 {
+		flow.AddTimer(flows.TimerIdle, flow.idleEvent, context.When()+timeout)
 	}
 }
@@ -0,0 +1,257 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// LayerTypeLinuxSLL2 is the Linux "cooked" capture encapsulation v2 (e.g. tcpdump -i any)
+var LayerTypeLinuxSLL2 = gopacket.RegisterLayerType(1001, gopacket.LayerTypeMetadata{Name: "Linux SLL2"})
+
+// LinuxSLL2 holds the header of the Linux cooked capture encapsulation v2
+type LinuxSLL2 struct {
+	layers.BaseLayer
+	EthernetType   layers.EthernetType
+	InterfaceIndex uint32
+	AddrType       uint16
+	PacketType     layers.LinuxSLLPacketType
+	Addr           net.HardwareAddr
+}
+
+// LayerType returns LayerTypeLinuxSLL2
+func (sll *LinuxSLL2) LayerType() gopacket.LayerType { return LayerTypeLinuxSLL2 }
+
+// LinkFlow returns a flow with the link layer address of the sender as source
+func (sll *LinuxSLL2) LinkFlow() gopacket.Flow {
+	return gopacket.NewFlow(layers.EndpointMAC, sll.Addr, nil)
+}
+
+// DecodeFromBytes decodes the 20 byte SLL2 header
+func (sll *LinuxSLL2) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 20 {
+		return errors.New("Linux SLL2 packet too small")
+	}
+	sll.EthernetType = layers.EthernetType(binary.BigEndian.Uint16(data[0:2]))
+	sll.InterfaceIndex = binary.BigEndian.Uint32(data[4:8])
+	sll.AddrType = binary.BigEndian.Uint16(data[8:10])
+	sll.PacketType = layers.LinuxSLLPacketType(data[10])
+	addrLen := int(data[11])
+	if addrLen > 8 {
+		addrLen = 8
+	}
+	sll.Addr = net.HardwareAddr(data[12 : 12+addrLen])
+	sll.BaseLayer = layers.BaseLayer{Contents: data[:20], Payload: data[20:]}
+	return nil
+}
+
+// RadioTap holds the fields of a radiotap header that are relevant for flows. Fields after the antenna noise are not
+// decoded.
+type RadioTap struct {
+	layers.BaseLayer
+	Present          layers.RadioTapPresent
+	Flags            layers.RadioTapFlags
+	Rate             layers.RadioTapRate
+	ChannelFrequency layers.RadioTapChannelFrequency
+	DBMAntennaSignal int8
+	DBMAntennaNoise  int8
+}
+
+// LayerType returns layers.LayerTypeRadioTap
+func (r *RadioTap) LayerType() gopacket.LayerType { return layers.LayerTypeRadioTap }
+
+// Channel returns the 802.11 channel number of the channel frequency, or 0 if the frequency is unknown
+func (r *RadioTap) Channel() uint8 {
+	freq := int(r.ChannelFrequency)
+	switch {
+	case freq == 2484:
+		return 14
+	case freq >= 2412 && freq < 2484:
+		return uint8((freq - 2407) / 5)
+	case freq > 5000 && freq <= 5900:
+		return uint8((freq - 5000) / 5)
+	}
+	return 0
+}
+
+// radiotapFields holds alignment and size of the radiotap fields up to the antenna noise
+var radiotapFields = [...]struct{ align, size int }{
+	{8, 8}, // TSFT
+	{1, 1}, // flags
+	{1, 1}, // rate
+	{2, 4}, // channel
+	{1, 2}, // FHSS
+	{1, 1}, // dBm antenna signal
+	{1, 1}, // dBm antenna noise
+}
+
+// DecodeFromBytes decodes a radiotap header
+func (r *RadioTap) DecodeFromBytes(data []byte, df gopacket.DecodeFeedback) error {
+	if len(data) < 8 {
+		return errors.New("RadioTap packet too small")
+	}
+	length := int(binary.LittleEndian.Uint16(data[2:4]))
+	if length < 8 || length > len(data) {
+		return errors.New("RadioTap length invalid")
+	}
+	r.Present = layers.RadioTapPresent(binary.LittleEndian.Uint32(data[4:8]))
+	r.Flags, r.Rate, r.ChannelFrequency, r.DBMAntennaSignal, r.DBMAntennaNoise = 0, 0, 0, 0, 0
+	// skip extended present bitmaps
+	offset := 4
+	for binary.LittleEndian.Uint32(data[offset:])&0x80000000 != 0 {
+		offset += 4
+		if offset+4 > length {
+			return errors.New("RadioTap present bitmap too long")
+		}
+	}
+	offset += 4
+	for i, field := range radiotapFields {
+		if r.Present&(1<<uint(i)) == 0 {
+			continue
+		}
+		offset = (offset + field.align - 1) &^ (field.align - 1)
+		if offset+field.size > length {
+			return errors.New("RadioTap field out of bounds")
+		}
+		switch i {
+		case 1:
+			r.Flags = layers.RadioTapFlags(data[offset])
+		case 2:
+			r.Rate = layers.RadioTapRate(data[offset])
+		case 3:
+			r.ChannelFrequency = layers.RadioTapChannelFrequency(binary.LittleEndian.Uint16(data[offset:]))
+		case 5:
+			r.DBMAntennaSignal = int8(data[offset])
+		case 6:
+			r.DBMAntennaNoise = int8(data[offset])
+		}
+		offset += field.size
+	}
+	r.BaseLayer = layers.BaseLayer{Contents: data[:length], Payload: data[length:]}
+	return nil
+}
+
+// Dot11 holds the MAC header of an IEEE 802.11 frame. The payload holds the frame body without FCS.
+type Dot11 struct {
+	layers.BaseLayer
+	Type     layers.Dot11Type
+	Flags    layers.Dot11Flags
+	Address1 net.HardwareAddr
+	Address2 net.HardwareAddr
+	Address3 net.HardwareAddr
+	Address4 net.HardwareAddr
+}
+
+// LayerType returns layers.LayerTypeDot11
+func (d *Dot11) LayerType() gopacket.LayerType { return layers.LayerTypeDot11 }
+
+// LinkFlow returns a flow from the source to the destination address
+func (d *Dot11) LinkFlow() gopacket.Flow {
+	return gopacket.NewFlow(layers.EndpointMAC, d.Source(), d.Destination())
+}
+
+// Source returns the address of the station that sent the frame (SA)
+func (d *Dot11) Source() net.HardwareAddr {
+	switch {
+	case d.Flags.ToDS() && d.Flags.FromDS():
+		return d.Address4
+	case d.Flags.FromDS():
+		return d.Address3
+	}
+	return d.Address2
+}
+
+// Destination returns the address of the final recipient of the frame (DA)
+func (d *Dot11) Destination() net.HardwareAddr {
+	if d.Flags.ToDS() {
+		return d.Address3
+	}
+	return d.Address1
+}
+
+// BSSID returns the BSSID of the frame; nil for frames between access points and control frames
+func (d *Dot11) BSSID() net.HardwareAddr {
+	if d.Type.MainType() == layers.Dot11TypeCtrl {
+		return nil
+	}
+	switch {
+	case d.Flags.ToDS() && d.Flags.FromDS():
+		return nil
+	case d.Flags.ToDS():
+		return d.Address1
+	case d.Flags.FromDS():
+		return d.Address2
+	}
+	return d.Address3
+}
+
+// HasData returns true if the payload of the frame is an unencrypted LLC frame
+func (d *Dot11) HasData() bool {
+	if d.Type.MainType() != layers.Dot11TypeData || d.Flags.WEP() {
+		return false
+	}
+	switch d.Type {
+	case layers.Dot11TypeDataNull, layers.Dot11TypeDataCFAckNoData, layers.Dot11TypeDataCFPollNoData,
+		layers.Dot11TypeDataCFAckPollNoData, layers.Dot11TypeDataQOSNull, layers.Dot11TypeDataQOSCFPollNoData,
+		layers.Dot11TypeDataQOSCFAckPollNoData:
+		return false
+	}
+	return len(d.Payload) > 0
+}
+
+// decode decodes an 802.11 MAC header. If fcs is true, the frame ends with a frame check sequence.
+func (d *Dot11) decode(data []byte, fcs bool) error {
+	if fcs {
+		if len(data) < 4 {
+			return errors.New("Dot11 packet too small")
+		}
+		data = data[:len(data)-4]
+	}
+	if len(data) < 10 {
+		return errors.New("Dot11 packet too small")
+	}
+	d.Type = layers.Dot11Type(data[0]>>2) & 0x3f
+	d.Flags = layers.Dot11Flags(data[1])
+	d.Address1 = net.HardwareAddr(data[4:10])
+	d.Address2, d.Address3, d.Address4 = nil, nil, nil
+	offset := 10
+	switch d.Type.MainType() {
+	case layers.Dot11TypeCtrl:
+		switch d.Type {
+		case layers.Dot11TypeCtrlRTS, layers.Dot11TypeCtrlPowersavePoll, layers.Dot11TypeCtrlCFEnd, layers.Dot11TypeCtrlCFEndAck:
+			if len(data) < 16 {
+				return errors.New("Dot11 packet too small")
+			}
+			d.Address2 = net.HardwareAddr(data[10:16])
+			offset = 16
+		}
+	case layers.Dot11TypeMgmt, layers.Dot11TypeData:
+		if len(data) < 24 {
+			return errors.New("Dot11 packet too small")
+		}
+		d.Address2 = net.HardwareAddr(data[10:16])
+		d.Address3 = net.HardwareAddr(data[16:22])
+		offset = 24
+		if d.Type.MainType() == layers.Dot11TypeData && d.Flags.ToDS() && d.Flags.FromDS() {
+			if len(data) < 30 {
+				return errors.New("Dot11 packet too small")
+			}
+			d.Address4 = net.HardwareAddr(data[24:30])
+			offset = 30
+		}
+		if d.Type.QOS() {
+			offset += 2
+		}
+		if d.Flags.Order() && (d.Type.QOS() || d.Type.MainType() == layers.Dot11TypeMgmt) {
+			offset += 4
+		}
+		if len(data) < offset {
+			return errors.New("Dot11 packet too small")
+		}
+	}
+	d.BaseLayer = layers.BaseLayer{Contents: data[:offset], Payload: data[offset:]}
+	return nil
+}
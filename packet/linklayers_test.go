@@ -0,0 +1,160 @@
+package packet
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func decodeLink(t *testing.T, lt gopacket.LayerType, data []byte) *packetBuffer {
+	pb := &packetBuffer{buffer: make([]byte, len(data))}
+	pb.assign(data, gopacket.CaptureInfo{CaptureLength: len(data), Length: len(data)}, lt, 0)
+	if !pb.decode() {
+		t.Fatal("decode failed")
+	}
+	return pb
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func assertInner(t *testing.T, pb *packetBuffer, lt gopacket.LayerType, data []byte) {
+	if pb.EtherType() != layers.EthernetTypeIPv4 {
+		t.Errorf("ethertype is %s; expected IPv4", pb.EtherType())
+	}
+	if pb.NetworkLayer() == nil {
+		t.Fatal("network layer missing")
+	}
+	if dst := net.IP(pb.NetworkLayer().NetworkFlow().Dst().Raw()); !dst.Equal(innerDst) {
+		t.Errorf("destination address is %s; expected %s", dst, innerDst)
+	}
+	tcp, ok := pb.TransportLayer().(*layers.TCP)
+	if !ok || tcp.SrcPort != 1234 || tcp.DstPort != 80 {
+		t.Errorf("transport layer wrong: %v", pb.TransportLayer())
+	}
+	ethertype, network, ok := NetworkLayer(lt, data)
+	if !ok || ethertype != layers.EthernetTypeIPv4 || !bytes.HasPrefix(network, pb.NetworkLayer().LayerContents()) {
+		t.Errorf("NetworkLayer returned %s %v %t", ethertype, network, ok)
+	}
+}
+
+func TestLinkLoopback(t *testing.T) {
+	ip := serializeTunnel(t, innerPacket()...)
+	for _, family := range [][]byte{{2, 0, 0, 0}, {0, 0, 0, 2}} {
+		data := concat(family, ip)
+		pb := decodeLink(t, layers.LayerTypeLoopback, data)
+		assertInner(t, pb, layers.LayerTypeLoopback, data)
+		if pb.LinkLayer() != nil || pb.Layer(layers.LayerTypeLoopback) == nil {
+			t.Error("loopback header must be an additional link header")
+		}
+	}
+}
+
+func TestLinkPPP(t *testing.T) {
+	ip := serializeTunnel(t, innerPacket()...)
+	for _, header := range [][]byte{{0xff, 0x03, 0x00, 0x21}, {0x00, 0x21}, {0x21}} {
+		data := concat(header, ip)
+		pb := decodeLink(t, layers.LayerTypePPP, data)
+		assertInner(t, pb, layers.LayerTypePPP, data)
+		if ppp, ok := pb.LinkLayer().(*layers.PPP); !ok || ppp.PPPType != layers.PPPTypeIPv4 {
+			t.Errorf("link layer wrong: %v", pb.LinkLayer())
+		}
+	}
+
+	pb := decodeLink(t, layers.LayerTypePPP, []byte{0xc0, 0x21, 1, 1, 0, 4})
+	if pb.NetworkLayer() != nil || pb.EtherType() != 0 {
+		t.Error("LCP must not be decoded")
+	}
+}
+
+func TestLinkPPPoE(t *testing.T) {
+	ip := serializeTunnel(t, innerPacket()...)
+	ppp := concat([]byte{0x00, 0x21}, ip)
+	session := concat([]byte{0x11, 0x00, 0x12, 0x34, byte(len(ppp) >> 8), byte(len(ppp))}, ppp)
+	data := concat(tunEth.DstMAC, tunEth.SrcMAC, []byte{0x88, 0x64}, session)
+
+	pb := decodeLink(t, layers.LayerTypeEthernet, data)
+	assertInner(t, pb, layers.LayerTypeEthernet, data)
+	if _, ok := pb.LinkLayer().(*layers.Ethernet); !ok {
+		t.Errorf("link layer wrong: %v", pb.LinkLayer())
+	}
+	pppoe, ok := pb.Layer(layers.LayerTypePPPoE).(*layers.PPPoE)
+	if !ok || pppoe.SessionId != 0x1234 {
+		t.Errorf("PPPoE layer wrong: %v", pb.Layer(layers.LayerTypePPPoE))
+	}
+	if pb.Layer(layers.LayerTypePPP) == nil {
+		t.Error("PPP layer missing")
+	}
+}
+
+func TestLinkSLL2(t *testing.T) {
+	ip := serializeTunnel(t, innerPacket()...)
+	header := []byte{0x08, 0x00, 0, 0, 0, 0, 0, 3, 0, 1, 0, 6, 0, 0, 0, 0, 0, 1, 0, 0}
+	data := concat(header, ip)
+
+	if lt, ok := LinkTypeLayer(layers.LinkType(276 & 0xff)); !ok || lt != LayerTypeLinuxSLL2 {
+		t.Errorf("link type 276 is %s", lt)
+	}
+	pb := decodeLink(t, LayerTypeLinuxSLL2, data)
+	assertInner(t, pb, LayerTypeLinuxSLL2, data)
+	sll, ok := pb.LinkLayer().(*LinuxSLL2)
+	if !ok {
+		t.Fatalf("link layer wrong: %v", pb.LinkLayer())
+	}
+	if sll.InterfaceIndex != 3 || sll.PacketType != layers.LinuxSLLPacketTypeHost || !bytes.Equal(sll.Addr, tunEth.SrcMAC) {
+		t.Errorf("SLL2 header wrong: %+v", sll)
+	}
+}
+
+var (
+	wlanAP  = net.HardwareAddr{2, 0, 0, 0, 0, 1}
+	wlanSTA = net.HardwareAddr{2, 0, 0, 0, 0, 2}
+	wlanDst = net.HardwareAddr{2, 0, 0, 0, 0, 3}
+)
+
+func TestLinkRadioTap(t *testing.T) {
+	ip := serializeTunnel(t, innerPacket()...)
+	// flags (FCS), rate (54 Mbit/s), channel (2437 MHz), dBm antenna signal (-40)
+	radiotap := []byte{0, 0, 15, 0, 0x2e, 0, 0, 0, 0x10, 108, 0x85, 0x09, 0xa0, 0x00, 0xd8}
+	// QoS data from a station to the access point
+	dot11 := concat([]byte{0x88, 0x01, 0, 0}, wlanAP, wlanSTA, wlanDst, []byte{0, 0, 0, 0})
+	snap := []byte{0xaa, 0xaa, 0x03, 0, 0, 0, 0x08, 0x00}
+	data := concat(radiotap, dot11, snap, ip, []byte{1, 2, 3, 4})
+
+	pb := decodeLink(t, layers.LayerTypeRadioTap, data)
+	assertInner(t, pb, layers.LayerTypeRadioTap, data)
+	if payload := pb.TransportLayer().LayerPayload(); !bytes.Equal(payload, []byte{1, 2, 3}) {
+		t.Errorf("payload is %v; FCS was not removed", payload)
+	}
+	link, ok := pb.LinkLayer().(*Dot11)
+	if !ok {
+		t.Fatalf("link layer wrong: %v", pb.LinkLayer())
+	}
+	if !bytes.Equal(link.Source(), wlanSTA) || !bytes.Equal(link.Destination(), wlanDst) || !bytes.Equal(link.BSSID(), wlanAP) {
+		t.Errorf("wrong addresses: source %s destination %s bssid %s", link.Source(), link.Destination(), link.BSSID())
+	}
+	rt, ok := pb.Layer(layers.LayerTypeRadioTap).(*RadioTap)
+	if !ok {
+		t.Fatal("radiotap layer missing")
+	}
+	if rt.DBMAntennaSignal != -40 || rt.Rate != 108 || rt.ChannelFrequency != 2437 || rt.Channel() != 6 || !rt.Flags.FCS() {
+		t.Errorf("radiotap header wrong: %+v", rt)
+	}
+
+	// beacon
+	beacon := concat([]byte{0x80, 0x00, 0, 0}, layers.EthernetBroadcast, wlanAP, wlanAP, []byte{0, 0}, make([]byte, 12))
+	pb = decodeLink(t, layers.LayerTypeDot11, beacon)
+	if pb.NetworkLayer() != nil || pb.EtherType() != 0 {
+		t.Error("management frames have no network layer")
+	}
+	if link := pb.LinkLayer().(*Dot11); !bytes.Equal(link.BSSID(), wlanAP) || !bytes.Equal(link.Destination(), layers.EthernetBroadcast) {
+		t.Errorf("wrong addresses: destination %s bssid %s", link.Destination(), link.BSSID())
+	}
+	if _, _, ok := NetworkLayer(layers.LayerTypeDot11, beacon); ok {
+		t.Error("NetworkLayer accepted a beacon")
+	}
+}
@@ -0,0 +1,169 @@
+package packet
+
+import (
+	"encoding/binary"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// linkTypeLinuxSLL2 is missing from gopacket. Since layers.LinkType is only 8 bits wide, the sources hand us the
+// truncated value of 276.
+const linkTypeLinuxSLL2 = layers.LinkType(276 & 0xff)
+
+// LinkTypeLayer returns the first layer type used for decoding packets with the given link type. If the link type is
+// not supported, false is returned.
+func LinkTypeLayer(lt layers.LinkType) (gopacket.LayerType, bool) {
+	switch lt {
+	case layers.LinkTypeEthernet:
+		return layers.LayerTypeEthernet, true
+	case layers.LinkTypeRaw, layers.LinkType(12), layers.LinkTypeIPv4, layers.LinkTypeIPv6:
+		return LayerTypeIPv46, true
+	case layers.LinkTypeLinuxSLL:
+		return layers.LayerTypeLinuxSLL, true
+	case linkTypeLinuxSLL2:
+		return LayerTypeLinuxSLL2, true
+	case layers.LinkTypeNull, layers.LinkTypeLoop:
+		return layers.LayerTypeLoopback, true
+	case layers.LinkTypePPP, layers.LinkTypePPP_HDLC:
+		return layers.LayerTypePPP, true
+	case layers.LinkTypeIEEE80211Radio:
+		return layers.LayerTypeRadioTap, true
+	case layers.LinkTypeIEEE802_11:
+		return layers.LayerTypeDot11, true
+	}
+	return gopacket.LayerTypeZero, false
+}
+
+// NetworkLayer returns the ethertype and the data following the link layer header and vlan tags of a packet starting
+// with a layer of type lt (as returned by LinkTypeLayer). If the layer type is not supported or the packet is
+// truncated, false is returned.
+func NetworkLayer(lt gopacket.LayerType, data []byte) (ethertype layers.EthernetType, network []byte, ok bool) {
+	switch lt {
+	case layers.LayerTypeEthernet:
+		if len(data) < 14 {
+			return
+		}
+		ethertype = layers.EthernetType(binary.BigEndian.Uint16(data[12:]))
+		data = data[14:]
+	case layers.LayerTypeLinuxSLL:
+		if len(data) < 16 {
+			return
+		}
+		ethertype = layers.EthernetType(binary.BigEndian.Uint16(data[14:]))
+		data = data[16:]
+	case LayerTypeLinuxSLL2:
+		if len(data) < 20 {
+			return
+		}
+		ethertype = layers.EthernetType(binary.BigEndian.Uint16(data))
+		data = data[20:]
+	case layers.LayerTypeLoopback:
+		if len(data) < 4 {
+			return
+		}
+		family := binary.LittleEndian.Uint32(data)
+		if family&0xFFFF0000 != 0 {
+			family = binary.BigEndian.Uint32(data)
+		}
+		switch layers.ProtocolFamily(family).LayerType() {
+		case layers.LayerTypeIPv4:
+			ethertype = layers.EthernetTypeIPv4
+		case layers.LayerTypeIPv6:
+			ethertype = layers.EthernetTypeIPv6
+		default:
+			return
+		}
+		data = data[4:]
+	case layers.LayerTypePPP:
+		ethertype, data = pppNetworkLayer(data)
+	case layers.LayerTypeRadioTap, layers.LayerTypeDot11:
+		ethertype, data = dot11NetworkLayer(lt, data)
+	case LayerTypeIPv46, layers.LayerTypeIPv4, layers.LayerTypeIPv6:
+		if len(data) < 1 {
+			return
+		}
+		switch data[0] >> 4 {
+		case 4:
+			ethertype = layers.EthernetTypeIPv4
+		case 6:
+			ethertype = layers.EthernetTypeIPv6
+		default:
+			return
+		}
+	default:
+		return
+	}
+	for ethertype == layers.EthernetTypeDot1Q || ethertype == layers.EthernetTypeQinQ {
+		if len(data) < 4 {
+			return
+		}
+		ethertype = layers.EthernetType(binary.BigEndian.Uint16(data[2:]))
+		data = data[4:]
+	}
+	if ethertype == layers.EthernetTypePPPoESession {
+		if len(data) < 6 {
+			return 0, nil, false
+		}
+		ethertype, data = pppNetworkLayer(data[6:])
+	}
+	if ethertype == 0 {
+		return 0, nil, false
+	}
+	return ethertype, data, true
+}
+
+// pppNetworkLayer returns the ethertype and data following a PPP header with optional address and control fields.
+// Protocols other than IPv4 and IPv6 result in ethertype 0.
+func pppNetworkLayer(data []byte) (layers.EthernetType, []byte) {
+	proto, n := pppProtocol(data)
+	switch proto {
+	case layers.PPPTypeIPv4:
+		return layers.EthernetTypeIPv4, data[n:]
+	case layers.PPPTypeIPv6:
+		return layers.EthernetTypeIPv6, data[n:]
+	}
+	return 0, nil
+}
+
+// dot11NetworkLayer returns the ethertype and data following the LLC/SNAP header of an unencrypted 802.11 data frame
+// with optional radiotap header. Other frames result in ethertype 0.
+func dot11NetworkLayer(lt gopacket.LayerType, data []byte) (layers.EthernetType, []byte) {
+	var radiotap RadioTap
+	var dot11 Dot11
+	fcs := false
+	if lt == layers.LayerTypeRadioTap {
+		if err := radiotap.DecodeFromBytes(data, gopacket.NilDecodeFeedback); err != nil {
+			return 0, nil
+		}
+		fcs = radiotap.Flags.FCS()
+		data = radiotap.Payload
+	}
+	if err := dot11.decode(data, fcs); err != nil || !dot11.HasData() {
+		return 0, nil
+	}
+	data = dot11.Payload
+	if len(data) < 8 || data[0] != 0xaa || data[1] != 0xaa || data[2] != 0x03 {
+		return 0, nil
+	}
+	return layers.EthernetType(binary.BigEndian.Uint16(data[6:])), data[8:]
+}
+
+// pppProtocol returns the protocol of a PPP header and the length of the header. The protocol field may be
+// compressed to one byte and preceded by the HDLC address and control fields.
+func pppProtocol(data []byte) (layers.PPPType, int) {
+	n := 0
+	if len(data) >= 2 && data[0] == 0xff && data[1] == 0x03 {
+		n = 2
+	}
+	if len(data) < n+1 {
+		return 0, 0
+	}
+	if data[n]&1 != 0 {
+		return layers.PPPType(data[n]), n + 1
+	}
+	if len(data) < n+2 {
+		return 0, 0
+	}
+	return layers.PPPType(binary.BigEndian.Uint16(data[n:])), n + 2
+}
@@ -0,0 +1,180 @@
+package packet
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// SplittableSource is a source that consists of multiple inputs (e.g. a list of files), which can be read independently
+type SplittableSource interface {
+	Source
+	// Split returns one source per input. Used for reading every input at the same time (see Sources.Merge).
+	Split() []Source
+}
+
+type inputStats struct {
+	packets    uint64
+	skipped    uint64
+	filtered   uint64
+	outOfOrder uint64
+	first      time.Time
+	last       time.Time
+}
+
+// mergeInput holds the next packet of a single input
+type mergeInput struct {
+	source Source
+	lt     gopacket.LayerType
+	data   []byte
+	ci     gopacket.CaptureInfo
+	stats  inputStats
+	index  int
+	done   bool
+}
+
+// read fetches the next packet from the input
+func (in *mergeInput) read() (skipped, filtered uint64, err error) {
+	in.lt, in.data, in.ci, skipped, filtered, err = in.source.ReadPacket()
+	in.stats.skipped += skipped
+	in.stats.filtered += filtered
+	if err != nil {
+		return
+	}
+	in.stats.packets++
+	if in.stats.packets == 1 {
+		in.stats.first = in.ci.Timestamp
+	} else if in.ci.Timestamp.Before(in.stats.last) {
+		in.stats.outOfOrder++
+	}
+	in.stats.last = in.ci.Timestamp
+	return
+}
+
+// mergeHeap is a min-heap of inputs ordered by the timestamp of the next packet
+type mergeHeap []*mergeInput
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].ci.Timestamp.Equal(h[j].ci.Timestamp) {
+		return h[i].index < h[j].index
+	}
+	return h[i].ci.Timestamp.Before(h[j].ci.Timestamp)
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(*mergeInput)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return x
+}
+
+// mergeSource reads every input at the same time and returns the packets in timestamp order (k-way merge).
+// Packets within a single input must already be in order.
+type mergeSource struct {
+	stopped  uint64
+	inputs   []*mergeInput
+	heap     mergeHeap
+	pending  []*mergeInput
+	skipped  uint64
+	filtered uint64
+}
+
+func newMergeSource(sources []Source) *mergeSource {
+	ret := &mergeSource{}
+	for i, source := range sources {
+		in := &mergeInput{source: source, index: i}
+		ret.inputs = append(ret.inputs, in)
+		ret.pending = append(ret.pending, in)
+	}
+	return ret
+}
+
+func (m *mergeSource) ID() string {
+	ids := make([]string, len(m.inputs))
+	for i, in := range m.inputs {
+		ids[i] = in.source.ID()
+	}
+	return fmt.Sprint("merge|", strings.Join(ids, ";"))
+}
+
+func (m *mergeSource) Init() {
+	for _, in := range m.inputs {
+		in.source.Init()
+	}
+}
+
+// ReadPacket returns the packet with the lowest timestamp of all inputs
+func (m *mergeSource) ReadPacket() (lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo, skipped uint64, filtered uint64, err error) {
+	// the packet data of an input is only valid until the next ReadPacket call of this input -> refill consumed inputs now
+	for len(m.pending) > 0 {
+		in := m.pending[len(m.pending)-1]
+		s, f, rerr := in.read()
+		m.skipped += s
+		m.filtered += f
+		if atomic.LoadUint64(&m.stopped) == 1 {
+			err = io.EOF
+			return
+		}
+		if rerr == ErrTimeout {
+			// we can't know if this input will produce a packet which is older than the rest -> wait
+			ci = in.ci
+			err = rerr
+			return
+		}
+		m.pending = m.pending[:len(m.pending)-1]
+		if rerr == io.EOF {
+			in.source.Stop()
+			in.done = true
+			continue
+		}
+		if rerr != nil {
+			err = rerr
+			return
+		}
+		heap.Push(&m.heap, in)
+	}
+	if len(m.heap) == 0 {
+		err = io.EOF
+		return
+	}
+	in := heap.Pop(&m.heap).(*mergeInput)
+	m.pending = append(m.pending, in)
+	skipped, filtered = m.skipped, m.filtered
+	m.skipped, m.filtered = 0, 0
+	return in.lt, in.data, in.ci, skipped, filtered, nil
+}
+
+// Stop shuts down every input
+func (m *mergeSource) Stop() {
+	atomic.StoreUint64(&m.stopped, 1)
+	for _, in := range m.inputs {
+		if !in.done {
+			in.done = true
+			in.source.Stop()
+		}
+	}
+}
+
+// PrintStats writes the per input statistics to w
+func (m *mergeSource) PrintStats(w io.Writer) {
+	fmt.Fprintln(w, "Input statistics:")
+	for _, in := range m.inputs {
+		fmt.Fprintf(w, `	%s:
+		packets: %d
+		skipped: %d
+		filtered: %d
+		out of order: %d
+		first packet: %s
+		last packet: %s
+`, in.source.ID(), in.stats.packets, in.stats.skipped, in.stats.filtered, in.stats.outOfOrder, in.stats.first.UTC().Format(time.RFC3339Nano), in.stats.last.UTC().Format(time.RFC3339Nano))
+	}
+}
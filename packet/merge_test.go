@@ -0,0 +1,82 @@
+package packet
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+)
+
+// testSource returns one packet per timestamp with the source name as data; data is reused like in real sources
+type testSource struct {
+	name    string
+	times   []int64
+	buffer  []byte
+	stopped int
+}
+
+func (ts *testSource) ID() string { return ts.name }
+func (ts *testSource) Init()      {}
+func (ts *testSource) Stop()      { ts.stopped++ }
+
+func (ts *testSource) ReadPacket() (lt gopacket.LayerType, data []byte, ci gopacket.CaptureInfo, skipped uint64, filtered uint64, err error) {
+	if len(ts.times) == 0 {
+		err = io.EOF
+		return
+	}
+	ts.buffer = append(ts.buffer[:0], ts.name...)
+	ci.Timestamp = time.Unix(ts.times[0], 0)
+	ts.times = ts.times[1:]
+	return LayerTypeIPv46, ts.buffer, ci, 1, 0, nil
+}
+
+type splitSource struct {
+	testSource
+	parts []Source
+}
+
+func (ss *splitSource) Split() []Source { return ss.parts }
+
+func TestMergeSources(t *testing.T) {
+	a := &testSource{name: "a", times: []int64{1, 4, 5, 3}}
+	b := &testSource{name: "b", times: []int64{2, 4}}
+	c := &testSource{name: "c", times: []int64{6}}
+	var sources Sources
+	sources.Append(&splitSource{parts: []Source{a, b}})
+	sources.Append(c)
+	sources.Merge()
+	sources.Init()
+
+	var result []string
+	var skipped uint64
+	for {
+		_, data, ci, s, _, err := sources.ReadPacket()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		skipped += s
+		result = append(result, string(data)+ci.Timestamp.Format("05"))
+	}
+	expected := "a01 b02 a04 b04 a05 a03 c06"
+	if got := strings.Join(result, " "); got != expected {
+		t.Errorf("merged order is '%s'; expected '%s'", got, expected)
+	}
+	if skipped != 7 {
+		t.Errorf("got %d skipped packets; expected 7", skipped)
+	}
+	if a.stopped != 1 || b.stopped != 1 || c.stopped != 1 {
+		t.Errorf("every input must be stopped exactly once (%d, %d, %d)", a.stopped, b.stopped, c.stopped)
+	}
+
+	var buf bytes.Buffer
+	sources.PrintStats(&buf)
+	if !strings.Contains(buf.String(), "out of order: 1") {
+		t.Errorf("expected one out of order packet in statistics:\n%s", buf.String())
+	}
+}
@@ -34,15 +34,19 @@ type multiPacketBuffer struct {
 	prealloc  int
 	buffers   []*packetBuffer
 	cond      *sync.Cond
+	tunnels   Tunnels
+	defrag    bool
 	resize    bool
 }
 
-func newMultiPacketBuffer(buffers int32, prealloc int, resize bool) *multiPacketBuffer {
+func newMultiPacketBuffer(buffers int32, prealloc int, resize bool, options DecodeOptions) *multiPacketBuffer {
 	return &multiPacketBuffer{
 		numFree:   0,
 		allocSize: buffers,
 		prealloc:  prealloc,
 		resize:    resize,
+		tunnels:   options.Tunnels,
+		defrag:    options.Defragment,
 		cond:      sync.NewCond(&sync.Mutex{}),
 	}
 }
@@ -50,7 +54,7 @@ func newMultiPacketBuffer(buffers int32, prealloc int, resize bool) *multiPacket
 func (mpb *multiPacketBuffer) replenish() {
 	new := make([]*packetBuffer, mpb.allocSize)
 	for j := range new {
-		new[j] = &packetBuffer{buffer: make([]byte, mpb.prealloc), owner: mpb, resize: mpb.resize}
+		new[j] = &packetBuffer{buffer: make([]byte, mpb.prealloc), owner: mpb, resize: mpb.resize, tunnels: mpb.tunnels, defrag: mpb.defrag}
 	}
 	mpb.buffers = append(mpb.buffers, new...)
 	atomic.AddInt32(&mpb.numFree, mpb.allocSize)
@@ -45,6 +45,18 @@ type Stats struct {
 	buffersReleased  int
 }
 
+// DecodeOptions holds settings for packet decoding
+type DecodeOptions struct {
+	// Tunnels specifies which tunnel protocols get decapsulated. Keys and features work on the inner packet of decapsulated tunnels.
+	Tunnels Tunnels
+	// Defragment enables reassembly of IPv4 and IPv6 fragments before key selection
+	Defragment bool
+	// DefragTimeout is the time after which incomplete datagrams are dropped (0 = DefaultDefragTimeout)
+	DefragTimeout flows.DateTimeNanoseconds
+	// DefragFragments is the maximum number of fragments held for reassembly (0 = unlimited). If this limit is reached, the oldest datagram is dropped.
+	DefragFragments int
+}
+
 // Engine holds and manages buffers, sources, filters and forwards packets to the flowtable
 type Engine struct {
 	empty       *multiPacketBuffer
@@ -61,14 +73,14 @@ type Engine struct {
 }
 
 // NewEngine initializes a new packet handling engine.
-// Packets of plen size are handled (0 means automatic). Packets are read from sources, filtered with filter, and forwarded to flowtable. Labels are assigned to the packets from the labels provider.
-func NewEngine(plen int, flowtable EventTable, filters Filters, sources Sources, labels Labels) *Engine {
+// Packets of plen size are handled (0 means automatic). Packets are read from sources, filtered with filter, decoded according to options, and forwarded to flowtable. Labels are assigned to the packets from the labels provider.
+func NewEngine(plen int, flowtable EventTable, filters Filters, sources Sources, labels Labels, options DecodeOptions) *Engine {
 	prealloc := plen
 	if plen == 0 {
 		prealloc = 1500
 	}
 	ret := &Engine{
-		empty:     newMultiPacketBuffer(batchSize, prealloc, plen == 0),
+		empty:     newMultiPacketBuffer(batchSize, prealloc, plen == 0, options),
 		todecode:  newShallowMultiPacketBufferRing(fullBuffers, batchSize),
 		plen:      plen,
 		flowtable: flowtable,
@@ -85,9 +97,46 @@ func NewEngine(plen int, flowtable EventTable, filters Filters, sources Sources,
 		stats := flowtable.getDecodeStats()
 		selector := flowtable.getSelector()
 		labels := ret.labels
+		var defrag *defragmenter
+		if options.Defragment {
+			defrag = newDefragmenter(options.DefragTimeout, options.DefragFragments, stats)
+		}
+		selectKey := func(buffer *packetBuffer) {
+			key, fw, ok := selector.Key(buffer)
+			if ok {
+				buffer.SetInfo(key, fw)
+				if !forward.push(buffer) {
+					// only happens with defragmentation, if a lot of datagrams time out at once
+					flowtable.event(forward)
+					forward.reset()
+					forward.push(buffer)
+				}
+			} else {
+				stats.keyError++
+				if !discard.push(buffer) {
+					discard.recycle()
+					discard.push(buffer)
+				}
+			}
+		}
+		// drainDefrag hands on the packets the defragmenter is done with
+		drainDefrag := func() {
+			for _, buffer := range defrag.ready {
+				selectKey(buffer)
+			}
+			defrag.ready = defrag.ready[:0]
+		}
 		for {
 			multibuffer, ok := ret.todecode.popFull()
 			if !ok {
+				if defrag != nil {
+					// hand on the first fragment of every incomplete datagram
+					defrag.flush()
+					drainDefrag()
+					flowtable.event(forward)
+					forward.reset()
+					discard.recycle()
+				}
 				return
 			}
 			forward.setTimestamp(multibuffer.Timestamp())
@@ -96,20 +145,31 @@ func NewEngine(plen int, flowtable EventTable, filters Filters, sources Sources,
 				if buffer == nil {
 					break
 				}
+				if defrag != nil {
+					// timed out datagrams go before this packet
+					defrag.expire(buffer.time)
+					drainDefrag()
+				}
 				if !buffer.decode() {
 					stats.decodeError++
 					discard.push(buffer)
 				} else {
 					buffer.label = labels.GetLabel(buffer)
-					key, fw, ok := selector.Key(buffer)
-					if ok {
-						buffer.SetInfo(key, fw)
-						forward.push(buffer)
+					if buffer.isFragment {
+						// the defragmenter holds on to the fragment
+						defrag.add(buffer)
 					} else {
-						stats.keyError++
-						discard.push(buffer)
+						selectKey(buffer)
 					}
 				}
+				if defrag != nil && len(defrag.ready) > 0 {
+					drainDefrag()
+				}
+			}
+			if defrag != nil {
+				// the batch time moves on without packets during a timeout of a live capture
+				defrag.expire(multibuffer.Timestamp())
+				drainDefrag()
 			}
 			multibuffer.recycleEmpty()
 			flowtable.event(forward)
@@ -135,6 +195,8 @@ Buffer statistics:
 	allocated: %d
 	freed: %d
 `, input.packetStats.packets, input.packetStats.skipped, input.packetStats.filtered, input.packetStats.maxBuffers, input.packetStats.buffersAllocated, input.packetStats.buffersReleased)
+	input.filters.PrintStats(w)
+	input.sources.PrintStats(w)
 }
 
 // Finish submits eventual partially filled buffers, flushes the packet handling pipeline and waits for everything to finish.
@@ -209,6 +271,7 @@ func (input *Engine) Run() (time flows.DateTimeNanoseconds) {
 	warned := false
 
 	input.sources.Init()
+	input.filters.Init()
 
 	for {
 		lt, data, ci, skipped, filtered, err := input.sources.ReadPacket()
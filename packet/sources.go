@@ -50,6 +50,30 @@ func (s *Sources) ReadPacket() (lt gopacket.LayerType, data []byte, ci gopacket.
 	}
 }
 
+// Merge replaces the sources with a single source that reads every source (and every input of a SplittableSource)
+// at the same time and returns the packets ordered by timestamp. Must be called before Init.
+func (s *Sources) Merge() {
+	var inputs []Source
+	for _, source := range s.sources {
+		if splittable, ok := source.(SplittableSource); ok {
+			inputs = append(inputs, splittable.Split()...)
+		} else {
+			inputs = append(inputs, source)
+		}
+	}
+	s.sources = []Source{newMergeSource(inputs)}
+}
+
+// PrintStats writes per input statistics to w, if the sources are merged
+func (s *Sources) PrintStats(w io.Writer) {
+	if len(s.sources) == 0 {
+		return
+	}
+	if merge, ok := s.sources[0].(*mergeSource); ok {
+		merge.PrintStats(w)
+	}
+}
+
 // Stop all packet sources
 func (s *Sources) Stop() {
 	atomic.StoreUint64(&s.stopped, 1)
@@ -11,14 +11,42 @@ import (
 )
 
 type decodeStats struct {
-	decodeError uint64
-	keyError    uint64
+	decodeError          uint64
+	keyError             uint64
+	fragments            uint64
+	reassembled          uint64
+	reassemblyFailures   uint64
+	overlappingFragments uint64
+	evasiveFragments     uint64
+}
+
+func (ds *decodeStats) print(w io.Writer) {
+	fmt.Fprintf(w,
+		`Decode statistics:
+	decode errors: %d
+	key function rejects: %d
+`, ds.decodeError, ds.keyError)
+	if ds.fragments > 0 {
+		fmt.Fprintf(w,
+			`Defragmentation statistics:
+	fragments: %d
+	reassembled packets: %d
+	reassembly failures: %d
+	overlapping fragments: %d
+	evasive fragments: %d
+`, ds.fragments, ds.reassembled, ds.reassemblyFailures, ds.overlappingFragments, ds.evasiveFragments)
+	}
 }
 
 // EventTable represents a flow table that can handle multiple events in one go
 type EventTable interface {
 	// EOF expires all the flows in the table at the given point in time with EOF as end reason
 	EOF(flows.DateTimeNanoseconds)
+	// Checkpoint writes the active flows to w instead of ending them and returns the number of saved flows. commit
+	// must make the checkpoint permanent; if it fails, the flows are ended like with EOF (see flows.WriteCheckpoint)
+	Checkpoint(w io.Writer, now flows.DateTimeNanoseconds, commit func() error) (int, error)
+	// Restore adds the flows from a checkpoint written by Checkpoint and returns the number of restored flows
+	Restore(r io.Reader) (int, error)
 	// Print table statistics to the given writer
 	PrintStats(io.Writer)
 	usage() []bufferUsage
@@ -62,16 +90,13 @@ type singleFlowTable struct {
 }
 
 func (sft *singleFlowTable) PrintStats(w io.Writer) {
-	fmt.Fprintf(w,
-		`Decode statistics:
-	decode errors: %d
-	key function rejects: %d
-`, sft.decodeStats.decodeError, sft.decodeStats.keyError)
+	sft.decodeStats.print(w)
 	fmt.Fprintf(w,
 		`Table statistics:
 	flows: %d
 	peak flows: %d
-`, sft.table.Stats.Flows, sft.table.Stats.Maxflows)
+	evicted flows: %d
+`, sft.table.Stats.Flows, sft.table.Stats.Maxflows, sft.table.Stats.Evicted)
 }
 
 func (sft *singleFlowTable) getDecodeStats() *decodeStats {
@@ -104,6 +129,14 @@ func (sft *singleFlowTable) EOF(now flows.DateTimeNanoseconds) {
 	sft.table.EOF(now)
 }
 
+func (sft *singleFlowTable) Checkpoint(w io.Writer, now flows.DateTimeNanoseconds, commit func() error) (int, error) {
+	return flows.WriteCheckpoint(w, []*flows.FlowTable{sft.table}, now, commit)
+}
+
+func (sft *singleFlowTable) Restore(r io.Reader) (int, error) {
+	return flows.ReadCheckpoint(r, []*flows.FlowTable{sft.table}, func(string) *flows.FlowTable { return sft.table }, RestoreFlow)
+}
+
 func (sft *singleFlowTable) usage() []bufferUsage {
 	sft.usageBuffer[0] = sft.buffer.usage()
 	return sft.usageBuffer[:]
@@ -202,11 +235,7 @@ func (pft *parallelFlowTable) usage() []bufferUsage {
 }
 
 func (pft *parallelFlowTable) PrintStats(w io.Writer) {
-	fmt.Fprintf(w,
-		`Decode statistics:
-	decode errors: %d
-	key function rejects: %d
-`, pft.decodeStats.decodeError, pft.decodeStats.keyError)
+	pft.decodeStats.print(w)
 	fmt.Fprintln(w, "Table statistics:")
 	var sumPackets, sumFlows uint64
 	for _, table := range pft.tables {
@@ -218,7 +247,8 @@ func (pft *parallelFlowTable) PrintStats(w io.Writer) {
 		packets: %d (%2.2f)
 		flows: %d (%2.2f)
 		peak flows: %d
-`, i+1, table.Stats.Packets, float64(table.Stats.Packets)/float64(sumPackets)*100, table.Stats.Flows, float64(table.Stats.Flows)/float64(sumFlows)*100, table.Stats.Maxflows)
+		evicted flows: %d
+`, i+1, table.Stats.Packets, float64(table.Stats.Packets)/float64(sumPackets)*100, table.Stats.Flows, float64(table.Stats.Flows)/float64(sumFlows)*100, table.Stats.Maxflows, table.Stats.Evicted)
 	}
 }
 
@@ -283,3 +313,14 @@ func (pft *parallelFlowTable) EOF(now flows.DateTimeNanoseconds) {
 	}
 	pft.wg.Wait()
 }
+
+func (pft *parallelFlowTable) Checkpoint(w io.Writer, now flows.DateTimeNanoseconds, commit func() error) (int, error) {
+	return flows.WriteCheckpoint(w, pft.tables, now, commit)
+}
+
+// Restore distributes the flows over the tables like event does
+func (pft *parallelFlowTable) Restore(r io.Reader) (int, error) {
+	return flows.ReadCheckpoint(r, pft.tables, func(key string) *flows.FlowTable {
+		return pft.tables[fnvHash(key)%uint64(len(pft.tables))]
+	}, RestoreFlow)
+}
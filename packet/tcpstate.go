@@ -0,0 +1,223 @@
+package packet
+
+import (
+	"encoding/gob"
+
+	"github.com/google/gopacket/layers"
+)
+
+// TCPState is the state of a tcp connection as seen by TCPTracker
+type TCPState uint8
+
+const (
+	// TCPStateNone no packet seen yet
+	TCPStateNone TCPState = iota
+	// TCPStateHandshake a SYN was seen, but not both SYNs have been acknowledged yet
+	TCPStateHandshake
+	// TCPStateEstablished the handshake is complete, or the connection was picked up midstream
+	TCPStateEstablished
+	// TCPStateHalfClosed one side sent a FIN
+	TCPStateHalfClosed
+	// TCPStateClosing both sides sent a FIN, but not both FINs have been acknowledged yet
+	TCPStateClosing
+	// TCPStateTimeWait both FINs have been acknowledged
+	TCPStateTimeWait
+	// TCPStateReset a RST was seen
+	TCPStateReset
+)
+
+const (
+	tcpSYN      = 1 << iota // sent a SYN
+	tcpSYNACK               // sent a SYN with ACK
+	tcpSYNAcked             // the SYN was acknowledged by the other side
+	tcpFIN                  // sent a FIN
+	tcpFINAcked             // the FIN was acknowledged by the other side
+	tcpRST                  // sent a RST
+)
+
+// tcpSide holds the state of one direction; fields are exported for gob
+type tcpSide struct {
+	Flags uint8
+	ISN   uint32 // sequence number of the SYN
+	FIN   uint32 // sequence number of the FIN
+}
+
+func (s *tcpSide) has(flag uint8) bool { return s.Flags&flag != 0 }
+
+// seqAcked returns true if ack acknowledges the sequence number seq
+func seqAcked(seq, ack uint32) bool {
+	return int32(ack-(seq+1)) >= 0
+}
+
+// TCPTracker follows the state of a tcp connection including handshake (also simultaneous open), half-close,
+// teardown and resets. The originator is the side, which sent the first packet, unless this was a SYN-ACK.
+type TCPTracker struct {
+	side     [2]tcpSide // [0] = forward, [1] = backward
+	orig     uint8      // index of the originator in side
+	firstRST uint8      // index of the side which sent the first RST
+	seen     bool
+}
+
+// Reset clears the tracker
+func (t *TCPTracker) Reset() {
+	*t = TCPTracker{}
+}
+
+// Update advances the state with a packet of the given direction (forward = same direction as the first packet)
+func (t *TCPTracker) Update(tcp *layers.TCP, payloadLength int, forward bool) {
+	dir, other := 0, 1
+	if !forward {
+		dir, other = 1, 0
+	}
+	if !t.seen {
+		t.seen = true
+		if tcp.SYN && tcp.ACK {
+			// picked up the reply of a handshake
+			t.orig = uint8(other)
+		} else {
+			t.orig = uint8(dir)
+		}
+	}
+	s, o := &t.side[dir], &t.side[other]
+	if tcp.SYN && !s.has(tcpSYN) {
+		s.Flags |= tcpSYN
+		s.ISN = tcp.Seq
+	}
+	if tcp.SYN && tcp.ACK {
+		s.Flags |= tcpSYNACK
+	}
+	if tcp.FIN && !s.has(tcpFIN) {
+		s.Flags |= tcpFIN
+		// FIN occupies one sequence number after the payload (and the SYN)
+		s.FIN = tcp.Seq + uint32(payloadLength)
+		if tcp.SYN {
+			s.FIN++
+		}
+	}
+	if tcp.ACK {
+		if o.has(tcpSYN) && seqAcked(o.ISN, tcp.Ack) {
+			o.Flags |= tcpSYNAcked
+		}
+		if o.has(tcpFIN) && seqAcked(o.FIN, tcp.Ack) {
+			o.Flags |= tcpFINAcked
+		}
+	}
+	if tcp.RST && !s.has(tcpRST) {
+		if !o.has(tcpRST) {
+			t.firstRST = uint8(dir)
+		}
+		s.Flags |= tcpRST
+	}
+}
+
+// NewConnection returns true, if tcp is a SYN of a new connection after the tracked one was closed or reset
+func (t *TCPTracker) NewConnection(tcp *layers.TCP, forward bool) bool {
+	if !tcp.SYN || tcp.ACK {
+		return false
+	}
+	if state := t.State(); state != TCPStateTimeWait && state != TCPStateReset {
+		return false
+	}
+	s := &t.side[1]
+	if forward {
+		s = &t.side[0]
+	}
+	return !s.has(tcpSYN) || s.ISN != tcp.Seq
+}
+
+// State returns the current connection state
+func (t *TCPTracker) State() TCPState {
+	a, b := &t.side[0], &t.side[1]
+	switch {
+	case !t.seen:
+		return TCPStateNone
+	case a.has(tcpRST) || b.has(tcpRST):
+		return TCPStateReset
+	case a.has(tcpFINAcked) && b.has(tcpFINAcked):
+		return TCPStateTimeWait
+	case a.has(tcpFIN) && b.has(tcpFIN):
+		return TCPStateClosing
+	case a.has(tcpFIN) || b.has(tcpFIN):
+		return TCPStateHalfClosed
+	case !a.has(tcpSYN) && !b.has(tcpSYN):
+		// midstream
+		return TCPStateEstablished
+	case a.has(tcpSYNAcked) && b.has(tcpSYNAcked):
+		return TCPStateEstablished
+	}
+	return TCPStateHandshake
+}
+
+// ConnState returns the connection state summary as used by zeek's conn_state (S0, S1, SF, REJ, S2, S3, RSTO, RSTR,
+// RSTOS0, RSTRH, SH, SHR, OTH), or an empty string if no packet was seen.
+func (t *TCPTracker) ConnState() string {
+	if !t.seen {
+		return ""
+	}
+	o, r := &t.side[t.orig], &t.side[1-t.orig]
+	if o.has(tcpSYN) && r.has(tcpSYNACK) {
+		// established
+		switch {
+		case o.has(tcpRST) || r.has(tcpRST):
+			if t.firstRST == t.orig {
+				return "RSTO"
+			}
+			return "RSTR"
+		case o.has(tcpFIN) && r.has(tcpFIN):
+			return "SF"
+		case o.has(tcpFIN):
+			return "S2"
+		case r.has(tcpFIN):
+			return "S3"
+		}
+		return "S1"
+	}
+	if o.has(tcpSYN) {
+		switch {
+		case r.has(tcpRST):
+			return "REJ"
+		case o.has(tcpRST):
+			return "RSTOS0"
+		case o.has(tcpFIN):
+			return "SH"
+		}
+		return "S0"
+	}
+	if r.has(tcpSYNACK) {
+		switch {
+		case r.has(tcpRST):
+			return "RSTRH"
+		case r.has(tcpFIN):
+			return "SHR"
+		}
+	}
+	return "OTH"
+}
+
+// Snapshot writes the state of the tracker to enc
+func (t *TCPTracker) Snapshot(enc *gob.Encoder) error {
+	if err := enc.Encode(t.side); err != nil {
+		return err
+	}
+	return enc.Encode([3]uint8{t.orig, t.firstRST, boolToUint8(t.seen)})
+}
+
+// Restore reads the state written by Snapshot from dec
+func (t *TCPTracker) Restore(dec *gob.Decoder) error {
+	if err := dec.Decode(&t.side); err != nil {
+		return err
+	}
+	var state [3]uint8
+	if err := dec.Decode(&state); err != nil {
+		return err
+	}
+	t.orig, t.firstRST, t.seen = state[0], state[1], state[2] != 0
+	return nil
+}
+
+func boolToUint8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package packet
+
+import (
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+type tcpStep struct {
+	forward bool
+	tcp     layers.TCP
+	payload int
+}
+
+func TestTCPTracker(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		steps     []tcpStep
+		state     TCPState
+		connState string
+	}{
+		{"empty", nil, TCPStateNone, ""},
+		{"attempt", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+		}, TCPStateHandshake, "S0"},
+		{"rejected", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{false, layers.TCP{RST: true, ACK: true, Ack: 101}, 0},
+		}, TCPStateReset, "REJ"},
+		{"established", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{false, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101}, 0},
+			{true, layers.TCP{ACK: true, Seq: 101, Ack: 501}, 0},
+		}, TCPStateEstablished, "S1"},
+		{"simultaneous open", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{false, layers.TCP{SYN: true, Seq: 500}, 0},
+			{true, layers.TCP{SYN: true, ACK: true, Seq: 100, Ack: 501}, 0},
+			{false, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101}, 0},
+		}, TCPStateEstablished, "S1"},
+		{"half closed", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{false, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101}, 0},
+			{true, layers.TCP{ACK: true, FIN: true, Seq: 101, Ack: 501}, 10},
+			{false, layers.TCP{ACK: true, Seq: 501, Ack: 112}, 0},
+		}, TCPStateHalfClosed, "S2"},
+		{"closing", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{false, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101}, 0},
+			{true, layers.TCP{ACK: true, FIN: true, Seq: 101, Ack: 501}, 10},
+			{false, layers.TCP{ACK: true, FIN: true, Seq: 501, Ack: 111}, 0},
+		}, TCPStateClosing, "SF"},
+		{"closed", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{false, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101}, 0},
+			{true, layers.TCP{ACK: true, FIN: true, Seq: 101, Ack: 501}, 10},
+			{false, layers.TCP{ACK: true, FIN: true, Seq: 501, Ack: 112}, 0},
+			{true, layers.TCP{ACK: true, Seq: 112, Ack: 502}, 0},
+		}, TCPStateTimeWait, "SF"},
+		{"responder reset", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{false, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101}, 0},
+			{false, layers.TCP{RST: true, Seq: 501}, 0},
+			{true, layers.TCP{RST: true, Seq: 101}, 0},
+		}, TCPStateReset, "RSTR"},
+		{"originator reset", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{false, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101}, 0},
+			{true, layers.TCP{RST: true, Seq: 101}, 0},
+		}, TCPStateReset, "RSTO"},
+		{"syn reset", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{true, layers.TCP{RST: true, Seq: 101}, 0},
+		}, TCPStateReset, "RSTOS0"},
+		{"syn fin", []tcpStep{
+			{true, layers.TCP{SYN: true, Seq: 100}, 0},
+			{true, layers.TCP{FIN: true, Seq: 101}, 0},
+		}, TCPStateHalfClosed, "SH"},
+		{"synack reset", []tcpStep{
+			{true, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101}, 0},
+			{true, layers.TCP{RST: true, Seq: 501}, 0},
+		}, TCPStateReset, "RSTRH"},
+		{"synack fin", []tcpStep{
+			{true, layers.TCP{SYN: true, ACK: true, Seq: 500, Ack: 101}, 0},
+			{true, layers.TCP{FIN: true, ACK: true, Seq: 501, Ack: 101}, 0},
+		}, TCPStateHalfClosed, "SHR"},
+		{"midstream", []tcpStep{
+			{true, layers.TCP{ACK: true, Seq: 1000, Ack: 2000}, 100},
+			{false, layers.TCP{ACK: true, Seq: 2000, Ack: 1100}, 0},
+		}, TCPStateEstablished, "OTH"},
+	} {
+		var tracker TCPTracker
+		for i := range test.steps {
+			tracker.Update(&test.steps[i].tcp, test.steps[i].payload, test.steps[i].forward)
+		}
+		if state := tracker.State(); state != test.state {
+			t.Errorf("%s: state is %d; expected %d", test.name, state, test.state)
+		}
+		if connState := tracker.ConnState(); connState != test.connState {
+			t.Errorf("%s: conn state is %q; expected %q", test.name, connState, test.connState)
+		}
+	}
+}
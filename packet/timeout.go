@@ -0,0 +1,132 @@
+package packet
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/CN-TU/go-flows/flows"
+)
+
+// PortRange is an inclusive range of transport ports
+type PortRange struct {
+	Low, High uint16
+}
+
+// ParsePortRange parses a single port ("53") or an inclusive port range ("5000-5100")
+func ParsePortRange(s string) (PortRange, error) {
+	parts := strings.SplitN(s, "-", 2)
+	low, err := strconv.ParseUint(strings.TrimSpace(parts[0]), 10, 16)
+	if err != nil {
+		return PortRange{}, fmt.Errorf("invalid port range '%s'", s)
+	}
+	high := low
+	if len(parts) == 2 {
+		if high, err = strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 16); err != nil || high < low {
+			return PortRange{}, fmt.Errorf("invalid port range '%s'", s)
+		}
+	}
+	return PortRange{uint16(low), uint16(high)}, nil
+}
+
+func matchPorts(ranges []PortRange, port uint16) bool {
+	for _, r := range ranges {
+		if port >= r.Low && port <= r.High {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeoutRule selects the packets that start flows belonging to a timeout profile. Empty lists match everything;
+// otherwise at least one entry of every non-empty list must match. Source and destination refer to the first packet
+// of the flow.
+type TimeoutRule struct {
+	// Protocols holds the allowed protocol identifiers
+	Protocols []uint8
+	// Ports matches either the source or the destination transport port
+	Ports []PortRange
+	// SourcePorts matches the source transport port
+	SourcePorts []PortRange
+	// DestinationPorts matches the destination transport port
+	DestinationPorts []PortRange
+	// Addresses matches either the source or the destination address
+	Addresses []*net.IPNet
+}
+
+func (rule *TimeoutRule) matches(buffer Buffer) bool {
+	if len(rule.Protocols) != 0 {
+		proto := buffer.Proto()
+		found := false
+		for _, p := range rule.Protocols {
+			if p == proto {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(rule.Ports) != 0 || len(rule.SourcePorts) != 0 || len(rule.DestinationPorts) != 0 {
+		transport := buffer.TransportLayer()
+		if transport == nil {
+			return false
+		}
+		flow := transport.TransportFlow()
+		if flow.EndpointType() == icmpEndpointType {
+			return false
+		}
+		src, dst := portNumber(flow.Src().Raw()), portNumber(flow.Dst().Raw())
+		if len(rule.Ports) != 0 && !matchPorts(rule.Ports, src) && !matchPorts(rule.Ports, dst) {
+			return false
+		}
+		if len(rule.SourcePorts) != 0 && !matchPorts(rule.SourcePorts, src) {
+			return false
+		}
+		if len(rule.DestinationPorts) != 0 && !matchPorts(rule.DestinationPorts, dst) {
+			return false
+		}
+	}
+	if len(rule.Addresses) != 0 {
+		network := buffer.NetworkLayer()
+		if network == nil {
+			return false
+		}
+		flow := network.NetworkFlow()
+		src, dst := net.IP(flow.Src().Raw()), net.IP(flow.Dst().Raw())
+		found := false
+		for _, n := range rule.Addresses {
+			if n.Contains(src) || n.Contains(dst) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func portNumber(raw []byte) uint16 {
+	if len(raw) != 2 {
+		return 0
+	}
+	return uint16(raw[0])<<8 | uint16(raw[1])
+}
+
+// MakeTimeoutSelector returns a flows.TimeoutSelector, which picks the profile of the first matching rule. rules[i]
+// belongs to FlowOptions.TimeoutProfiles[i].
+func MakeTimeoutSelector(rules []TimeoutRule) flows.TimeoutSelector {
+	return func(event flows.Event) int {
+		buffer := event.(Buffer)
+		for i := range rules {
+			if rules[i].matches(buffer) {
+				return i
+			}
+		}
+		return -1
+	}
+}
@@ -0,0 +1,53 @@
+package packet
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket/layers"
+)
+
+func TestParsePortRange(t *testing.T) {
+	for _, test := range []struct {
+		in  string
+		out PortRange
+		ok  bool
+	}{
+		{"53", PortRange{53, 53}, true},
+		{"5000-5100", PortRange{5000, 5100}, true},
+		{" 1 - 2 ", PortRange{1, 2}, true},
+		{"65536", PortRange{}, false},
+		{"100-50", PortRange{}, false},
+		{"http", PortRange{}, false},
+	} {
+		r, err := ParsePortRange(test.in)
+		if (err == nil) != test.ok || r != test.out {
+			t.Errorf("ParsePortRange(%q) = %v, %v; expected %v", test.in, r, err, test.out)
+		}
+	}
+}
+
+func TestTimeoutSelector(t *testing.T) {
+	_, internal, _ := net.ParseCIDR("10.0.0.0/8")
+	selector := MakeTimeoutSelector([]TimeoutRule{
+		{Protocols: []uint8{uint8(layers.IPProtocolUDP)}, Ports: []PortRange{{53, 53}}},
+		{Protocols: []uint8{uint8(layers.IPProtocolTCP)}, DestinationPorts: []PortRange{{22, 22}, {5432, 5433}}},
+		{Addresses: []*net.IPNet{internal}},
+	})
+	for i, test := range []struct {
+		event    Buffer
+		expected int
+	}{
+		{BufferFromLayers(0, &layers.UDP{SrcPort: 1234, DstPort: 53}), 0},
+		{BufferFromLayers(0, &layers.UDP{SrcPort: 53, DstPort: 1234}), 0},
+		{BufferFromLayers(0, &layers.TCP{SrcPort: 1234, DstPort: 53}), -1},
+		{BufferFromLayers(0, &layers.TCP{SrcPort: 1234, DstPort: 5433}), 1},
+		{BufferFromLayers(0, &layers.TCP{SrcPort: 22, DstPort: 1234}), -1},
+		{BufferFromLayers(0, &layers.IPv4{SrcIP: net.IP{192, 168, 0, 1}, DstIP: net.IP{10, 1, 2, 3}}, &layers.TCP{SrcPort: 22, DstPort: 1234}), 2},
+		{BufferFromLayers(0, &layers.IPv4{SrcIP: net.IP{10, 1, 2, 3}, DstIP: net.IP{192, 168, 0, 1}}, &layers.UDP{SrcPort: 1234, DstPort: 53}), 0},
+	} {
+		if profile := selector(test.event); profile != test.expected {
+			t.Errorf("event #%d got profile %d; expected %d", i, profile, test.expected)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package packet
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Tunnels specifies which tunnel protocols should be decapsulated
+type Tunnels uint8
+
+const (
+	// TunnelGRE decapsulates GRE (IPv4, IPv6, and transparent ethernet bridging)
+	TunnelGRE Tunnels = 1 << iota
+	// TunnelVXLAN decapsulates VXLAN (UDP port 4789)
+	TunnelVXLAN
+	// TunnelGENEVE decapsulates GENEVE (UDP port 6081)
+	TunnelGENEVE
+	// TunnelIPIP decapsulates IPv4 or IPv6 packets inside IP packets (e.g. IPv4-in-IPv4, IPv6-in-IPv4)
+	TunnelIPIP
+	// TunnelNone disables decapsulation
+	TunnelNone Tunnels = 0
+	// TunnelAll decapsulates every supported tunnel protocol
+	TunnelAll = TunnelGRE | TunnelVXLAN | TunnelGENEVE | TunnelIPIP
+)
+
+const (
+	vxlanPort  = 4789
+	genevePort = 6081
+)
+
+var tunnelNames = []struct {
+	name string
+	t    Tunnels
+}{
+	{"gre", TunnelGRE},
+	{"vxlan", TunnelVXLAN},
+	{"geneve", TunnelGENEVE},
+	{"ipip", TunnelIPIP},
+}
+
+// ParseTunnels converts a comma separated list of tunnel protocols (gre, vxlan, geneve, ipip, all, or none) into Tunnels
+func ParseTunnels(s string) (ret Tunnels, err error) {
+	if s == "" {
+		return TunnelNone, nil
+	}
+MAIN:
+	for _, name := range strings.Split(s, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "all":
+			ret |= TunnelAll
+			continue
+		case "none":
+			continue
+		}
+		for _, t := range tunnelNames {
+			if t.name == name {
+				ret |= t.t
+				continue MAIN
+			}
+		}
+		return TunnelNone, fmt.Errorf("unknown tunnel protocol '%s' (must be one of gre, vxlan, geneve, ipip, all, none)", name)
+	}
+	return
+}
+
+func (t Tunnels) String() string {
+	var ret []string
+	for _, name := range tunnelNames {
+		if t&name.t != 0 {
+			ret = append(ret, name.name)
+		}
+	}
+	if len(ret) == 0 {
+		return "none"
+	}
+	return strings.Join(ret, ",")
+}
+
+// tunnel checks if the payload data of type typ is a tunnel that should be decapsulated. In this case the outer network layer
+// is saved, the tunnel header decoded, and the inner packet decoded. Only the outermost tunnel is decapsulated.
+func (pb *packetBuffer) tunnel(typ gopacket.LayerType, data []byte) bool {
+	if pb.outer != nil {
+		return true
+	}
+	var header gopacket.Layer
+	switch typ {
+	case layers.LayerTypeIPv4, layers.LayerTypeIPv6:
+		if pb.tunnels&TunnelIPIP == 0 {
+			return true
+		}
+	case layers.LayerTypeGRE:
+		if pb.tunnels&TunnelGRE == 0 {
+			return true
+		}
+		if err := pb.gre.DecodeFromBytes(data, pb); err != nil {
+			return false
+		}
+		header = &pb.gre
+		typ = pb.gre.NextLayerType()
+		data = pb.gre.LayerPayload()
+	case layers.LayerTypeVXLAN:
+		if pb.tunnels&TunnelVXLAN == 0 {
+			return true
+		}
+		if len(data) < 8 {
+			return false
+		}
+		// gopacket doesn't implement DecodeFromBytes for VXLAN
+		pb.vxlan.ValidIDFlag = data[0]&0x08 > 0
+		pb.vxlan.VNI = binary.BigEndian.Uint32(data[4:8]) >> 8
+		pb.vxlan.Contents = data[:8]
+		pb.vxlan.Payload = data[8:]
+		header = &pb.vxlan
+		typ = layers.LayerTypeEthernet
+		data = pb.vxlan.Payload
+	case layers.LayerTypeGeneve:
+		if pb.tunnels&TunnelGENEVE == 0 {
+			return true
+		}
+		if len(data) < 8 {
+			return false
+		}
+		// decoded by hand, since gopacket allocates every option and doesn't handle long options
+		hlen := 8 + int(data[0]&0x3f)*4
+		if len(data) < hlen {
+			return false
+		}
+		pb.geneve.Version = data[0] >> 6
+		pb.geneve.OptionsLength = (data[0] & 0x3f) * 4
+		pb.geneve.OAMPacket = data[1]&0x80 > 0
+		pb.geneve.CriticalOption = data[1]&0x40 > 0
+		pb.geneve.Protocol = layers.EthernetType(binary.BigEndian.Uint16(data[2:4]))
+		pb.geneve.VNI = binary.BigEndian.Uint32(data[4:8]) >> 8
+		pb.geneve.Contents = data[:hlen]
+		pb.geneve.Payload = data[hlen:]
+		header = &pb.geneve
+		typ = pb.geneve.NextLayerType()
+		data = pb.geneve.Payload
+	default:
+		return true
+	}
+
+	if typ != layers.LayerTypeEthernet && typ != layers.LayerTypeIPv4 && typ != layers.LayerTypeIPv6 {
+		// unsupported payload (e.g. PPP in GRE) -> keep outer packet
+		return true
+	}
+
+	// keep outer network layer; swap instead of copy, so that the outer and inner layer don't share slices
+	switch pb.network.(type) {
+	case *layers.IPv4:
+		pb.outer4, pb.ip4 = pb.ip4, pb.outer4
+		pb.outer = &pb.outer4
+	case *layers.IPv6:
+		pb.outer6, pb.ip6 = pb.ip6, pb.outer6
+		// the hop-by-hop header points into the inner layer after the swap
+		pb.outer6.HopByHop = nil
+		pb.outer = &pb.outer6
+	default:
+		return false
+	}
+	pb.tunnelLayer = header
+	pb.network = nil
+	pb.transport = nil
+	pb.proto = 0
+	pb.ip6headers = 0
+
+	if typ == layers.LayerTypeEthernet {
+		if err := pb.innerEth.DecodeFromBytes(data, pb); err != nil {
+			return false
+		}
+		typ = pb.innerEth.NextLayerType()
+		data = pb.innerEth.LayerPayload()
+		pb.ethertype = pb.innerEth.EthernetType
+	} else if typ == layers.LayerTypeIPv4 {
+		pb.ethertype = layers.EthernetTypeIPv4
+	} else if typ == layers.LayerTypeIPv6 {
+		pb.ethertype = layers.EthernetTypeIPv6
+	}
+
+	return pb.decodeNetwork(typ, data)
+}
@@ -0,0 +1,156 @@
+package packet
+
+import (
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+func serializeTunnel(t *testing.T, l ...gopacket.SerializableLayer) []byte {
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true}, l...); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decodeTunnel(t *testing.T, tunnels Tunnels, data []byte) *packetBuffer {
+	pb := &packetBuffer{buffer: make([]byte, len(data)), tunnels: tunnels}
+	pb.assign(data, gopacket.CaptureInfo{CaptureLength: len(data), Length: len(data)}, layers.LayerTypeEthernet, 0)
+	if !pb.decode() {
+		t.Fatal("decode failed")
+	}
+	return pb
+}
+
+var (
+	outerSrc = net.IP{10, 0, 0, 1}
+	outerDst = net.IP{10, 0, 0, 2}
+	innerSrc = net.IP{192, 168, 0, 1}
+	innerDst = net.IP{192, 168, 0, 2}
+	tunEth   = &layers.Ethernet{SrcMAC: net.HardwareAddr{0, 0, 0, 0, 0, 1}, DstMAC: net.HardwareAddr{0, 0, 0, 0, 0, 2}, EthernetType: layers.EthernetTypeIPv4}
+)
+
+func assertTunnel(t *testing.T, pb *packetBuffer, tunnel gopacket.LayerType) {
+	if pb.OuterNetworkLayer() == nil {
+		t.Fatal("packet was not decapsulated")
+	}
+	if src := net.IP(pb.OuterNetworkLayer().NetworkFlow().Src().Raw()); !src.Equal(outerSrc) {
+		t.Errorf("outer source address is %s; expected %s", src, outerSrc)
+	}
+	if src := net.IP(pb.NetworkLayer().NetworkFlow().Src().Raw()); !src.Equal(innerSrc) {
+		t.Errorf("inner source address is %s; expected %s", src, innerSrc)
+	}
+	if dst := net.IP(pb.NetworkLayer().NetworkFlow().Dst().Raw()); !dst.Equal(innerDst) {
+		t.Errorf("inner destination address is %s; expected %s", dst, innerDst)
+	}
+	tcp, ok := pb.TransportLayer().(*layers.TCP)
+	if !ok || tcp.SrcPort != 1234 || tcp.DstPort != 80 {
+		t.Errorf("inner transport layer wrong: %v", pb.TransportLayer())
+	}
+	if pb.Proto() != uint8(layers.IPProtocolTCP) {
+		t.Errorf("protocol is %d; expected tcp", pb.Proto())
+	}
+	if tunnel == gopacket.LayerTypeZero {
+		if pb.TunnelLayer() != nil {
+			t.Errorf("unexpected tunnel layer %s", pb.TunnelLayer().LayerType())
+		}
+	} else if pb.TunnelLayer() == nil || pb.TunnelLayer().LayerType() != tunnel {
+		t.Errorf("expected tunnel layer %s", tunnel)
+	}
+}
+
+func innerPacket() []gopacket.SerializableLayer {
+	ip := &layers.IPv4{Version: 4, IHL: 5, TTL: 64, SrcIP: innerSrc, DstIP: innerDst, Protocol: layers.IPProtocolTCP}
+	tcp := &layers.TCP{SrcPort: 1234, DstPort: 80, SYN: true}
+	tcp.SetNetworkLayerForChecksum(ip)
+	return []gopacket.SerializableLayer{ip, tcp, gopacket.Payload([]byte{1, 2, 3})}
+}
+
+func TestTunnelVXLAN(t *testing.T) {
+	data := serializeTunnel(t, append([]gopacket.SerializableLayer{
+		tunEth,
+		&layers.IPv4{Version: 4, IHL: 5, TTL: 64, SrcIP: outerSrc, DstIP: outerDst, Protocol: layers.IPProtocolUDP},
+		&layers.UDP{SrcPort: 5000, DstPort: vxlanPort},
+		&layers.VXLAN{ValidIDFlag: true, VNI: 42},
+		tunEth,
+	}, innerPacket()...)...)
+
+	pb := decodeTunnel(t, TunnelNone, data)
+	if pb.OuterNetworkLayer() != nil || pb.TransportLayer().(*layers.UDP).DstPort != vxlanPort {
+		t.Fatal("packet must not be decapsulated if disabled")
+	}
+
+	pb = decodeTunnel(t, TunnelVXLAN, data)
+	assertTunnel(t, pb, layers.LayerTypeVXLAN)
+	if vni := pb.TunnelLayer().(*layers.VXLAN).VNI; vni != 42 {
+		t.Errorf("VNI is %d; expected 42", vni)
+	}
+}
+
+func TestTunnelGRE(t *testing.T) {
+	data := serializeTunnel(t, append([]gopacket.SerializableLayer{
+		tunEth,
+		&layers.IPv4{Version: 4, IHL: 5, TTL: 64, SrcIP: outerSrc, DstIP: outerDst, Protocol: layers.IPProtocolGRE},
+		&layers.GRE{KeyPresent: true, Key: 1337, Protocol: layers.EthernetTypeIPv4},
+	}, innerPacket()...)...)
+
+	pb := decodeTunnel(t, TunnelAll, data)
+	assertTunnel(t, pb, layers.LayerTypeGRE)
+	if key := pb.TunnelLayer().(*layers.GRE).Key; key != 1337 {
+		t.Errorf("GRE key is %d; expected 1337", key)
+	}
+}
+
+func TestTunnelIPIP(t *testing.T) {
+	data := serializeTunnel(t, append([]gopacket.SerializableLayer{
+		tunEth,
+		&layers.IPv4{Version: 4, IHL: 5, TTL: 64, SrcIP: outerSrc, DstIP: outerDst, Protocol: layers.IPProtocolIPv4},
+	}, innerPacket()...)...)
+
+	pb := decodeTunnel(t, TunnelGRE, data)
+	if pb.OuterNetworkLayer() != nil {
+		t.Fatal("IP in IP must not be decapsulated if disabled")
+	}
+
+	pb = decodeTunnel(t, TunnelIPIP, data)
+	assertTunnel(t, pb, gopacket.LayerTypeZero)
+}
+
+func TestTunnelGENEVE(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		header gopacket.Payload
+		inner  []gopacket.SerializableLayer
+	}{
+		// no options, ip payload
+		{"plain", gopacket.Payload{0x00, 0x00, 0x08, 0x00, 0, 0, 42, 0}, innerPacket()},
+		// critical option (class 0x0102, type 0x80) with 4 bytes of data, ethernet payload
+		{"options", gopacket.Payload{0x02, 0x40, 0x65, 0x58, 0, 0, 42, 0, 0x01, 0x02, 0x80, 0x01, 1, 2, 3, 4},
+			append([]gopacket.SerializableLayer{tunEth}, innerPacket()...)},
+	} {
+		data := serializeTunnel(t, append([]gopacket.SerializableLayer{
+			tunEth,
+			&layers.IPv4{Version: 4, IHL: 5, TTL: 64, SrcIP: outerSrc, DstIP: outerDst, Protocol: layers.IPProtocolUDP},
+			&layers.UDP{SrcPort: 5000, DstPort: genevePort},
+			test.header,
+		}, test.inner...)...)
+
+		pb := decodeTunnel(t, TunnelVXLAN, data)
+		if pb.OuterNetworkLayer() != nil || pb.TransportLayer().(*layers.UDP).DstPort != genevePort {
+			t.Fatalf("%s: packet must not be decapsulated if disabled", test.name)
+		}
+
+		pb = decodeTunnel(t, TunnelGENEVE, data)
+		assertTunnel(t, pb, layers.LayerTypeGeneve)
+		geneve := pb.TunnelLayer().(*layers.Geneve)
+		if geneve.VNI != 42 {
+			t.Errorf("%s: VNI is %d; expected 42", test.name, geneve.VNI)
+		}
+		if options := int(geneve.OptionsLength); options != len(test.header)-8 || geneve.CriticalOption != (options != 0) {
+			t.Errorf("%s: options length %d, critical %t", test.name, options, geneve.CriticalOption)
+		}
+	}
+}
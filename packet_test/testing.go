@@ -2,7 +2,9 @@
 package packet_test
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
@@ -68,7 +70,30 @@ type TestTable struct {
 }
 
 // MakeFeatureTest creates a flow table for testing purposes with the given features, wanted return type, and flow options
-func MakeFeatureTest(t *testing.T, features []string, ft flows.FeatureType, opt flows.FlowOptions) (ret TestTable) {
+func MakeFeatureTest(t *testing.T, features []string, ft flows.FeatureType, opt flows.FlowOptions) TestTable {
+	return makeTest(t, features, nil, opt)
+}
+
+// MakeControlFeatureTest creates a flow table for testing purposes with the given features, control features (in call syntax), and flow options
+func MakeControlFeatureTest(t *testing.T, features []string, control []interface{}, opt flows.FlowOptions) TestTable {
+	return makeTest(t, features, control, opt)
+}
+
+// MakeSpecFeatureTest creates a flow table for testing purposes with the given features in call syntax (e.g.
+// []interface{}{"set", "feature"}) and flow options
+func MakeSpecFeatureTest(t *testing.T, features []interface{}, opt flows.FlowOptions) TestTable {
+	return makeSpecTest(t, features, nil, opt)
+}
+
+func makeTest(t *testing.T, features []string, control []interface{}, opt flows.FlowOptions) TestTable {
+	featuresI := make([]interface{}, len(features))
+	for i, feature := range features {
+		featuresI[i] = feature
+	}
+	return makeSpecTest(t, featuresI, control, opt)
+}
+
+func makeSpecTest(t *testing.T, features []interface{}, control []interface{}, opt flows.FlowOptions) (ret TestTable) {
 	ret.t = t
 	if opt.ActiveTimeout == 0 {
 		opt.ActiveTimeout = flows.SecondsInNanoseconds * 1800
@@ -77,13 +102,9 @@ func MakeFeatureTest(t *testing.T, features []string, ft flows.FeatureType, opt
 		opt.IdleTimeout = flows.SecondsInNanoseconds * 300
 	}
 	ret.exporter = makeAssertExporter()
-	featuresI := make([]interface{}, len(features))
-	for i, feature := range features {
-		featuresI[i] = feature
-	}
 	var f flows.RecordListMaker
 	ret.pipe, _ = flows.MakeExportPipeline([]flows.Exporter{ret.exporter}, flows.SortTypeNone, 1)
-	if err := f.AppendRecord(featuresI, nil, nil, ret.pipe, false); err != nil {
+	if err := f.AppendRecord(features, control, nil, ret.pipe, false); err != nil {
 		t.Fatalf("Couldn't parse features: %s", err)
 	}
 	f.Init()
@@ -123,6 +144,26 @@ func (t *TestTable) Finish(when flows.DateTimeNanoseconds) {
 	t.exporter.Finish()
 }
 
+// Checkpoint writes a checkpoint of all the flows in the table at the given point in time to w and calls commit like
+// -checkpoint does
+func (t *TestTable) Checkpoint(when flows.DateTimeNanoseconds, w io.Writer, commit func() error) (int, error) {
+	return flows.WriteCheckpoint(w, []*flows.FlowTable{t.table}, when, commit)
+}
+
+// Resume writes a checkpoint of all the flows in the table at the given point in time and restores it, which simulates
+// a restart with -resume
+func (t *TestTable) Resume(when flows.DateTimeNanoseconds) {
+	tables := []*flows.FlowTable{t.table}
+	var buf bytes.Buffer
+	if _, err := flows.WriteCheckpoint(&buf, tables, when, nil); err != nil {
+		t.t.Fatalf("Couldn't write checkpoint: %s", err)
+	}
+	pick := func(string) *flows.FlowTable { return t.table }
+	if _, err := flows.ReadCheckpoint(&buf, tables, pick, packet.RestoreFlow); err != nil {
+		t.t.Fatalf("Couldn't read checkpoint: %s", err)
+	}
+}
+
 func pprintTime(t flows.DateTimeNanoseconds) string {
 	if t == 0 {
 		return "0ns"
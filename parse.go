@@ -2,11 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
+	"net"
 	"os"
 	"strings"
 
 	"github.com/CN-TU/go-flows/flows"
+	"github.com/CN-TU/go-flows/packet"
 )
 
 func decodeOneFeature(feature interface{}) interface{} {
@@ -64,7 +67,7 @@ const (
 	jsonSimple
 )
 
-func decodeV2(decoded featureJSONv2, id int) (features []interface{}, control, filter, key []string, bidirectional, allowZero bool, opt flows.FlowOptions) {
+func decodeV2(decoded featureJSONv2, id int) (features, control []interface{}, filter, key []string, bidirectional, allowZero bool, opt flows.FlowOptions) {
 	flows := decoded.Preprocessing.Flows
 	if id < 0 || id >= len(flows) {
 		log.Fatalf("Only %d flows in the file ⇒ id must be between 0 and %d (is %d)\n", len(flows), len(flows)-1, id)
@@ -101,7 +104,135 @@ func toTimeout(decoded featureJSONsimple, name string) flows.DateTimeNanoseconds
 	return 0
 }
 
-func decodeSimple(decoded featureJSONsimple, _ int) (features []interface{}, control, filter, key []string, bidirectional, allowZero bool, opt flows.FlowOptions) {
+// toList returns value as list; single values become a list with one element
+func toList(value interface{}) []interface{} {
+	if list, ok := value.([]interface{}); ok {
+		return list
+	}
+	return []interface{}{value}
+}
+
+func toPortRanges(value interface{}, name string) []packet.PortRange {
+	list := toList(value)
+	ret := make([]packet.PortRange, len(list))
+	for i, elem := range list {
+		var s string
+		switch elem := elem.(type) {
+		case json.Number:
+			s = elem.String()
+		case string:
+			s = elem
+		default:
+			log.Fatalf("%s must be a list of ports or port ranges", name)
+		}
+		var err error
+		if ret[i], err = packet.ParsePortRange(s); err != nil {
+			log.Fatalf("%s: %s", name, err)
+		}
+	}
+	return ret
+}
+
+func decodeTimeouts(value interface{}, opt *flows.FlowOptions) {
+	profiles, ok := value.([]interface{})
+	if !ok {
+		log.Fatal("_timeouts must be an array of timeout profiles")
+	}
+	rules := make([]packet.TimeoutRule, len(profiles))
+	opt.TimeoutProfiles = make([]flows.TimeoutProfile, len(profiles))
+	for i, elem := range profiles {
+		decoded, ok := elem.(map[string]interface{})
+		if !ok {
+			log.Fatal("_timeouts must be an array of timeout profiles")
+		}
+		profile := &opt.TimeoutProfiles[i]
+		rule := &rules[i]
+		profile.Name = fmt.Sprintf("profile%d", i)
+		profile.ActiveTimeout = opt.ActiveTimeout
+		profile.IdleTimeout = opt.IdleTimeout
+		for key, val := range decoded {
+			name := fmt.Sprintf("_timeouts[%d].%s", i, key)
+			switch key {
+			case "name":
+				if profile.Name, ok = val.(string); !ok || profile.Name == flows.DefaultTimeoutProfile {
+					log.Fatalf("%s must be a string other than %s", name, flows.DefaultTimeoutProfile)
+				}
+			case "active_timeout":
+				profile.ActiveTimeout = toTimeout(decoded, key)
+			case "idle_timeout":
+				profile.IdleTimeout = toTimeout(decoded, key)
+			case "protocol":
+				for _, proto := range toList(val) {
+					num, ok := proto.(json.Number)
+					if !ok {
+						log.Fatalf("%s must be a list of protocol numbers", name)
+					}
+					p, err := num.Int64()
+					if err != nil || p < 0 || p > 255 {
+						log.Fatalf("%s must be a list of protocol numbers", name)
+					}
+					rule.Protocols = append(rule.Protocols, uint8(p))
+				}
+			case "ports":
+				rule.Ports = toPortRanges(val, name)
+			case "source_ports":
+				rule.SourcePorts = toPortRanges(val, name)
+			case "destination_ports":
+				rule.DestinationPorts = toPortRanges(val, name)
+			case "addresses":
+				for _, addr := range toList(val) {
+					s, ok := addr.(string)
+					if !ok {
+						log.Fatalf("%s must be a list of networks in CIDR notation", name)
+					}
+					_, network, err := net.ParseCIDR(s)
+					if err != nil {
+						log.Fatalf("%s: %s", name, err)
+					}
+					rule.Addresses = append(rule.Addresses, network)
+				}
+			default:
+				log.Fatalf("Unknown key %s", name)
+			}
+		}
+	}
+	names := make(map[string]bool, len(opt.TimeoutProfiles))
+	for i, profile := range opt.TimeoutProfiles {
+		if names[profile.Name] {
+			log.Fatalf("_timeouts[%d].name %s is used by another timeout profile", i, profile.Name)
+		}
+		names[profile.Name] = true
+	}
+	opt.SelectTimeouts = packet.MakeTimeoutSelector(rules)
+}
+
+func decodeTCPTimeouts(value interface{}, opt *flows.FlowOptions) {
+	decoded, ok := value.(map[string]interface{})
+	if !ok {
+		log.Fatal("_tcp_timeouts must be an object")
+	}
+	for key := range decoded {
+		timeout := toTimeout(decoded, key)
+		switch key {
+		case "handshake":
+			opt.TCPTimeouts.Handshake = timeout
+		case "established":
+			opt.TCPTimeouts.Established = timeout
+		case "half_closed":
+			opt.TCPTimeouts.HalfClosed = timeout
+		case "closing":
+			opt.TCPTimeouts.Closing = timeout
+		case "time_wait":
+			opt.TCPTimeouts.TimeWait = timeout
+		case "reset":
+			opt.TCPTimeouts.Reset = timeout
+		default:
+			log.Fatalf("Unknown key _tcp_timeouts.%s", key)
+		}
+	}
+}
+
+func decodeSimple(decoded featureJSONsimple, _ int) (features, control []interface{}, filter, key []string, bidirectional, allowZero bool, opt flows.FlowOptions) {
 	// Check if we have every required value
 	for _, val := range requiredKeys {
 		if _, ok := decoded[val]; !ok {
@@ -116,7 +247,7 @@ func decodeSimple(decoded featureJSONsimple, _ int) (features []interface{}, con
 	}
 
 	if _, ok := decoded["_control_features"]; ok {
-		control = toStringArray(decoded, "_control_features")
+		control = decodeFeatures(decoded["_control_features"])
 	}
 	if _, ok := decoded["_filter_features"]; ok {
 		filter = toStringArray(decoded, "_filter_features")
@@ -141,6 +272,10 @@ func decodeSimple(decoded featureJSONsimple, _ int) (features []interface{}, con
 	opt.ActiveTimeout = toTimeout(decoded, "active_timeout")
 	opt.IdleTimeout = toTimeout(decoded, "idle_timeout")
 
+	if timeouts, ok := decoded["_timeouts"]; ok {
+		decodeTimeouts(timeouts, &opt)
+	}
+
 	opt.TCPExpiry = true
 
 	if expiry, ok := decoded["_expire_TCP"]; ok {
@@ -151,6 +286,33 @@ func decodeSimple(decoded featureJSONsimple, _ int) (features []interface{}, con
 		}
 	}
 
+	if timeouts, ok := decoded["_tcp_timeouts"]; ok {
+		decodeTCPTimeouts(timeouts, &opt)
+	}
+
+	if max, ok := decoded["_max_flows"]; ok {
+		if val, ok := max.(json.Number); ok {
+			if val, err := val.Int64(); err == nil && val >= 0 {
+				opt.MaxFlows = int(val)
+			} else {
+				log.Fatal("_max_flows must be a non-negative integer (0 = unlimited)")
+			}
+		} else {
+			log.Fatal("_max_flows must be a non-negative integer (0 = unlimited)")
+		}
+	}
+
+	if eviction, ok := decoded["_eviction"]; ok {
+		if val, ok := eviction.(string); ok {
+			var err error
+			if opt.Eviction, err = flows.ParseEvictionPolicy(val); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			log.Fatal("_eviction must be a string")
+		}
+	}
+
 	opt.CustomSettings = decoded
 
 	return
@@ -167,12 +329,35 @@ func decodeSimple(decoded featureJSONsimple, _ int) (features []interface{}, con
 		"_filter_features": [...],
 		"_per_packet": <bool>,
 		"_allow_zero": <bool>,
-		"_expire_TCP": <bool>
+		"_expire_TCP": <bool>,
+		"_tcp_timeouts": {"handshake": <Number>, "established": <Number>, "half_closed": <Number>, "closing": <Number>, "time_wait": <Number>, "reset": <Number>},
+		"_max_flows": <Number>,
+		"_eviction": "oldest"|"lru"|"smallest",
+		"_timeouts": [
+			{
+				"name": <String>,
+				"protocol": <Number>|[<Number>, ...],
+				"ports": [<Number>|"<Number>-<Number>", ...],
+				"source_ports": [...],
+				"destination_ports": [...],
+				"addresses": ["<CIDR>", ...],
+				"active_timeout": <Number>,
+				"idle_timeout": <Number>
+			}, ...
+		]
 	}
 
 	timeouts, features, key_features and bidirectional are required
 	_per_packet, _allow_zero are assumed false if missing
 	_expire_TCP is assumed true if missing (tcp expire works only if at least the five tuple is present in the key)
+	_tcp_timeouts sets timeouts for the tcp connection states used by tcp expiry (see flows.TCPTimeouts); missing
+	values keep the idle timeout, or, for time_wait and reset, export the flow immediately
+	_max_flows limits the number of concurrent flows per table (0 or missing means unlimited); if the limit is reached,
+	a flow is exported with flowEndReason lackOfResources according to _eviction (default oldest)
+	_timeouts holds timeout profiles, which are tried in order for the first packet of every flow. The first profile,
+	where every given condition matches, provides the timeouts of the flow (missing timeouts are taken from
+	active_timeout and idle_timeout). ports match source or destination port and addresses source or destination
+	address. Flows without a matching profile use active_timeout and idle_timeout (profile name "default").
 	further keys can be queried from features
 */
 
@@ -196,7 +381,7 @@ type featureJSONv2 struct {
 	}
 }
 
-func decodeJSON(inputfile string, format jsonType, id int) (features []interface{}, control, filter, key []string, bidirectional, allowZero bool, opt flows.FlowOptions) {
+func decodeJSON(inputfile string, format jsonType, id int) (features, control []interface{}, filter, key []string, bidirectional, allowZero bool, opt flows.FlowOptions) {
 	f, err := os.Open(inputfile)
 	if err != nil {
 		log.Fatalln("Can't open ", inputfile)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"log"
@@ -11,6 +12,8 @@ import (
 	"runtime/pprof"
 	"sort"
 	"strings"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/CN-TU/go-flows/flows"
 	"github.com/CN-TU/go-flows/packet"
@@ -38,7 +41,9 @@ features specified by the preceeding feature group.
 
 If multiple sources are specified, processing starts with the first source.
 Upon EOF from the source, the next source is used, until every source is
-exhausted, after which go-flows exits.
+exhausted, after which go-flows exits. With -merge, every source (and every
+file of a source) is read at the same time and the packets are processed in
+timestamp order (e.g., for captures taken at the same time on different taps).
 
 If multiple filters are specified, those are tried in order. All filters
 must accept the packet - otherwise it is ignored. If a filter rejects a
@@ -79,7 +84,7 @@ func init() {
 	addCommand("callgraph", "Create a callgraph from a flowspecification", parseArguments)
 }
 
-func parseFeatures(cmd string, args []string) (arguments []string, features []interface{}, control, filter, key []string, bidirectional, allowZero bool, opt flows.FlowOptions) {
+func parseFeatures(cmd string, args []string) (arguments []string, features, control []interface{}, filter, key []string, bidirectional, allowZero bool, opt flows.FlowOptions) {
 	set := flag.NewFlagSet("features", flag.ExitOnError)
 	set.Usage = func() {
 		fmt.Fprint(os.Stderr, `
@@ -124,7 +129,7 @@ Args:
 
 type featureSpec struct {
 	features      []interface{}
-	control       []string
+	control       []interface{}
 	filter        []string
 	key           []string
 	bidirectional bool
@@ -233,7 +238,7 @@ func parseArguments(cmd string, args []string) {
 	set.Usage = func() { tableUsage(cmd, set) }
 	numProcessing := set.Uint("n", 4, "Number of parallel processing tables")
 	expireWindow := set.Bool("expireWindow", false, "Expire all flows after every window. Useful if flow key contains a window function")
-	flowExpire := set.Uint("expire", 100, "Check for expired timers with this period in seconds. expire↓ ⇒ memory↓, execution time↑")
+	flowExpire := set.Uint("expire", 100, "Check for expired timers with this period in seconds; only flows with due timers are touched. expire↓ ⇒ memory↓")
 	maxPacket := set.Uint("size", 9000, "Maximum packet size handled internally. 0 = automatic")
 	printStats := set.Bool("stats", false, "Output statistics")
 	autoGC := set.Bool("scantFlows", false, "If you not have many flows setting this speeds up processing speed, but might cause a huge increase in memory usage.")
@@ -242,6 +247,15 @@ Beware: Worst case performance of start/stop sorting is O(1), while expiry is O(
 Both need an additional O(flow) merge part if multiple tables are used.
 Additionally, stop might lead to very high memory usage (and longer execution times) in case one long lasting flow keeps all other flows from expiring (active/idle timeout!).`)
 	verbose := set.Bool("verbose", false, "Verbose output")
+	tunnelStr := set.String("tunnel", "none", `Decapsulate the given tunnel protocols as comma separated list of "gre", "vxlan", "geneve", "ipip", or "all".
+Keys and features use the inner headers of decapsulated packets.`)
+	merge := set.Bool("merge", false, "Read every source and input file at the same time and merge the packets by timestamp")
+	defrag := set.Bool("defrag", false, "Reassemble IPv4 and IPv6 fragments before flow key selection")
+	defragTimeout := set.Uint("defragTimeout", 30, "Drop incomplete fragmented datagrams after this many seconds")
+	defragFragments := set.Uint("defragFragments", packet.DefaultDefragFragments, "Maximum number of fragments held for reassembly; the oldest datagram is dropped if this limit is reached. 0 = unlimited")
+	checkpoint := set.String("checkpoint", "", `On SIGTERM, save the active flows to this file instead of ending them. Flows with features that don't support
+checkpoints are ended as usual.`)
+	resume := set.String("resume", "", "Restore the flows saved with -checkpoint from this file before processing. The flow specification must be the same")
 
 	set.Parse(args)
 	if set.NArg() == 0 {
@@ -277,6 +291,11 @@ Additionally, stop might lead to very high memory usage (and longer execution ti
 		log.Fatalln(err)
 	}
 
+	tunnels, err := packet.ParseTunnels(*tunnelStr)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
 	for _, featureset := range result {
 		pipeline, err := flows.MakeExportPipeline(featureset.exporter, sortOrder, *numProcessing)
 		if err != nil {
@@ -333,17 +352,52 @@ Additionally, stop might lead to very high memory usage (and longer execution ti
 
 	opts.WindowExpiry = *expireWindow
 	opts.SortOutput = sortOrder
+	opts.Sampling, err = filters.Sampling()
+	if err != nil {
+		log.Fatalln(err)
+	}
 
 	flowtable := packet.NewFlowTable(int(*numProcessing), recordList, packet.NewFlow, opts,
 		flows.DateTimeNanoseconds(*flowExpire)*flows.SecondsInNanoseconds, keyselector, *autoGC)
 
-	engine := packet.NewEngine(int(*maxPacket), flowtable, filters, sources, labels)
+	if *merge {
+		sources.Merge()
+	}
+
+	engine := packet.NewEngine(int(*maxPacket), flowtable, filters, sources, labels, packet.DecodeOptions{
+		Tunnels:         tunnels,
+		Defragment:      *defrag,
+		DefragTimeout:   flows.DateTimeNanoseconds(*defragTimeout) * flows.SecondsInNanoseconds,
+		DefragFragments: int(*defragFragments),
+	})
+
+	if *resume != "" {
+		f, err := os.Open(*resume)
+		if err != nil {
+			log.Fatalln("Couldn't open checkpoint: ", err)
+		}
+		n, err := flowtable.Restore(bufio.NewReader(f))
+		f.Close()
+		if err != nil {
+			log.Fatalln("Couldn't restore checkpoint: ", err)
+		}
+		if *verbose {
+			log.Printf("Restored %d flows from %s\n", n, *resume)
+		}
+	}
 
 	cancel := make(chan os.Signal, 1)
 	signal.Notify(cancel, os.Interrupt)
+	if *checkpoint != "" {
+		signal.Notify(cancel, syscall.SIGTERM)
+	}
+	var terminated int32
 
 	go func() {
-		<-cancel
+		sig := <-cancel
+		if sig == syscall.SIGTERM {
+			atomic.StoreInt32(&terminated, 1)
+		}
 		log.Println("Canceling...")
 		engine.Stop()
 	}()
@@ -365,7 +419,13 @@ Additionally, stop might lead to very high memory usage (and longer execution ti
 		f.Close()
 	}
 
-	flowtable.EOF(stopped)
+	if atomic.LoadInt32(&terminated) == 1 {
+		if err := writeCheckpoint(flowtable, *checkpoint, stopped, *verbose); err != nil {
+			log.Println("Couldn't write checkpoint: ", err)
+		}
+	} else {
+		flowtable.EOF(stopped)
+	}
 
 	recordList.Flush()
 
@@ -377,3 +437,33 @@ Additionally, stop might lead to very high memory usage (and longer execution ti
 		flowtable.PrintStats(os.Stderr)
 	}
 }
+
+// writeCheckpoint saves the active flows of flowtable to the file name. The file is replaced only after it was written
+// completely. If this fails, the flows are ended like with EOF.
+func writeCheckpoint(flowtable packet.EventTable, name string, now flows.DateTimeNanoseconds, verbose bool) error {
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		flowtable.EOF(now)
+		return err
+	}
+	w := bufio.NewWriter(f)
+	n, err := flowtable.Checkpoint(w, now, func() error {
+		err := w.Flush()
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(name+".tmp", name)
+		}
+		return err
+	})
+	if err != nil {
+		f.Close()
+		os.Remove(name + ".tmp")
+		return err
+	}
+	if verbose {
+		log.Printf("Saved %d flows to %s\n", n, name)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+var (
+	magicGzip = []byte{0x1f, 0x8b}
+	magicZstd = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	magicXz   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+)
+
+type decompressor struct {
+	io.Reader
+	file  *os.File
+	close func()
+}
+
+func (d *decompressor) Close() error {
+	if d.close != nil {
+		d.close()
+	}
+	return d.file.Close()
+}
+
+// OpenFile opens the named file for reading. gzip, zstd, and xz compressed files are detected by their magic number
+// and transparently decompressed.
+func OpenFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	ret, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &decompressor{Reader: ret, file: f, close: closeDecompressor(ret)}, nil
+}
+
+// Decompress returns a reader that decompresses r, if r is gzip, zstd, or xz compressed. Otherwise, the returned reader
+// returns the contents of r.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(magicXz))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	switch {
+	case bytes.HasPrefix(magic, magicGzip):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, magicZstd):
+		return zstd.NewReader(br)
+	case bytes.HasPrefix(magic, magicXz):
+		return xz.NewReader(br)
+	}
+	return br, nil
+}
+
+func closeDecompressor(r io.Reader) func() {
+	switch d := r.(type) {
+	case *gzip.Reader:
+		return func() { d.Close() }
+	case *zstd.Decoder:
+		return d.Close
+	}
+	return nil
+}
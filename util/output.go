@@ -0,0 +1,343 @@
+package util
+
+import (
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// OutputOptions holds the options for rotating and compressing output files of exporters (see AddOutputFlags)
+type OutputOptions struct {
+	Size     uint64 // rotate if a file reaches this many (uncompressed) bytes
+	Flows    uint64 // rotate after this many records
+	Interval uint64 // rotate at multiples of this many seconds
+	Clock    string // use "wall" or "packet" time for Interval and the filename pattern
+	Compress string // "none", "gzip", or "zstd"
+	Hook     string // shell command executed for every finished file
+}
+
+// AddOutputFlags adds the flags for file rotation and compression to set
+func AddOutputFlags(set *flag.FlagSet) *OutputOptions {
+	o := &OutputOptions{}
+	set.Var((*sizeValue)(&o.Size), "rotateSize", "Start a new file after this many bytes (uncompressed; suffixes k, M, G allowed)")
+	set.Uint64Var(&o.Flows, "rotateFlows", 0, "Start a new file after this many flows")
+	set.Uint64Var(&o.Interval, "rotateInterval", 0, "Start a new file at multiples of this many seconds")
+	set.StringVar(&o.Clock, "rotateClock", "wall", `Time used for -rotateInterval and the filename pattern ("wall" or "packet")`)
+	set.StringVar(&o.Compress, "compress", "none", `Compress files with "gzip" or "zstd"`)
+	set.StringVar(&o.Hook, "postRotate", "", "Shell command executed for every finished file; the filename is available as $1")
+	return o
+}
+
+// OutputHelp describes the flags added by AddOutputFlags for the help text of exporters
+const OutputHelp = `-rotateSize size
+	  Start a new file after this many bytes (uncompressed; suffixes k, M, G
+	  allowed).
+-rotateFlows int
+	  Start a new file after this many flows.
+-rotateInterval int
+	  Start a new file at multiples of this many seconds (e.g. 3600 for
+	  hourly files).
+-rotateClock string
+	  Time used for -rotateInterval and the filename pattern: "wall" (current
+	  time) or "packet" (time of the exported flow) (default "wall").
+-compress string
+	  Compress files on the fly with "gzip" or "zstd". The matching extension
+	  is added to the filename if missing.
+-postRotate string
+	  Shell command executed for every finished file (also the last one). The
+	  filename is available as $1.
+
+The output filename can contain strftime-style patterns, which are replaced
+with the time of the start of the file: %Y (year), %m (month), %d (day),
+%H (hour), %M (minute), %S (second), %s (unix time), %n (number of the
+file), and %% (%). If a filename is used more than once, the number of
+the file is added before the extension.
+`
+
+type sizeValue uint64
+
+func (s *sizeValue) String() string {
+	return strconv.FormatUint(uint64(*s), 10)
+}
+
+func (s *sizeValue) Set(value string) error {
+	mult := uint64(1)
+	switch {
+	case strings.HasSuffix(value, "k"):
+		mult = 1 << 10
+	case strings.HasSuffix(value, "M"):
+		mult = 1 << 20
+	case strings.HasSuffix(value, "G"):
+		mult = 1 << 30
+	}
+	if mult != 1 {
+		value = value[:len(value)-1]
+	}
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	*s = sizeValue(v * mult)
+	return nil
+}
+
+// Output is a file output for exporters, which can be rotated and compressed. Before every record Due must be
+// called; if it returns true, the exporter has to flush its buffers, call Rotate, and write a new file header.
+// The file is created on the first write.
+type Output struct {
+	pattern  string
+	options  OutputOptions
+	file     *os.File
+	w        io.Writer
+	closer   io.Closer
+	name     string
+	names    map[string]bool
+	files    int
+	written  uint64
+	flows    uint64
+	start    time.Time // start time of the file, which is created on the next write
+	next     time.Time // start time of the file after the next rotation
+	period   int64
+	hooks    sync.WaitGroup
+	rotating bool
+}
+
+// NewOutput creates an output for the given filename pattern. "-" is stdout, which can't be rotated.
+func NewOutput(pattern string, options OutputOptions) (*Output, error) {
+	switch options.Clock {
+	case "wall", "packet":
+	default:
+		return nil, fmt.Errorf("unknown rotation clock '%s'", options.Clock)
+	}
+	switch options.Compress {
+	case "none", "":
+	case "gzip":
+		if !strings.HasSuffix(pattern, ".gz") && pattern != "-" {
+			pattern += ".gz"
+		}
+	case "zstd":
+		if !strings.HasSuffix(pattern, ".zst") && pattern != "-" {
+			pattern += ".zst"
+		}
+	default:
+		return nil, fmt.Errorf("unknown compression '%s'", options.Compress)
+	}
+	o := &Output{
+		pattern:  pattern,
+		options:  options,
+		names:    make(map[string]bool),
+		period:   -1,
+		rotating: options.Size != 0 || options.Flows != 0 || options.Interval != 0,
+	}
+	if pattern == "-" && o.rotating {
+		return nil, errors.New("stdout can't be rotated")
+	}
+	return o, nil
+}
+
+func (o *Output) now(when int64) time.Time {
+	if o.options.Clock == "packet" {
+		return time.Unix(0, when).UTC()
+	}
+	return time.Now()
+}
+
+// Due returns true if a new file must be started before writing the next record. when is the time of the record in
+// nanoseconds and pending the number of bytes buffered by the exporter, which were not yet written.
+func (o *Output) Due(when int64, pending int) bool {
+	if !o.rotating {
+		if o.file == nil && o.start.IsZero() {
+			o.start = o.now(when)
+		}
+		return false
+	}
+	now := o.now(when)
+	if o.options.Interval != 0 {
+		// files start at multiples of the interval
+		period := now.Unix() / int64(o.options.Interval)
+		now = time.Unix(period*int64(o.options.Interval), 0).In(now.Location())
+		if o.period != period && o.period != -1 {
+			o.period = period
+			if o.file != nil || pending > 0 {
+				o.next = now
+				return true
+			}
+			o.start = now
+		}
+		o.period = period
+	}
+	if o.file == nil && o.start.IsZero() {
+		o.start = now
+	}
+	if o.options.Flows != 0 && o.flows >= o.options.Flows {
+		o.next = now
+		return true
+	}
+	if o.options.Size != 0 && o.written+uint64(pending) >= o.options.Size {
+		o.next = now
+		return true
+	}
+	o.flows++
+	return false
+}
+
+// expand replaces the strftime-style patterns in the filename
+func (o *Output) expand(t time.Time) string {
+	var b strings.Builder
+	for i := 0; i < len(o.pattern); i++ {
+		c := o.pattern[i]
+		if c != '%' || i+1 == len(o.pattern) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch o.pattern[i] {
+		case 'Y':
+			fmt.Fprintf(&b, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&b, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&b, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&b, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&b, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&b, "%02d", t.Second())
+		case 's':
+			b.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'n':
+			b.WriteString(strconv.Itoa(o.files))
+		case '%':
+			b.WriteByte('%')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(o.pattern[i])
+		}
+	}
+	name := b.String()
+	if o.names[name] {
+		// don't overwrite files from this run
+		ext := filepath.Ext(name)
+		base := strings.TrimSuffix(name, ext)
+		if ext == ".gz" || ext == ".zst" {
+			ext = filepath.Ext(base) + ext
+			base = strings.TrimSuffix(name, ext)
+		}
+		name = fmt.Sprintf("%s.%d%s", base, o.files, ext)
+	}
+	o.names[name] = true
+	return name
+}
+
+func (o *Output) open() error {
+	if o.pattern == "-" {
+		o.file = os.Stdout
+	} else {
+		if o.start.IsZero() {
+			// nothing exported yet
+			o.start = time.Now()
+		}
+		o.name = o.expand(o.start)
+		o.start = time.Time{}
+		var err error
+		if o.file, err = os.Create(o.name); err != nil {
+			return err
+		}
+	}
+	o.w = o.file
+	o.closer = nil
+	switch o.options.Compress {
+	case "gzip":
+		w := gzip.NewWriter(o.file)
+		o.w, o.closer = w, w
+	case "zstd":
+		w, err := zstd.NewWriter(o.file)
+		if err != nil {
+			return err
+		}
+		o.w, o.closer = w, w
+	}
+	o.files++
+	return nil
+}
+
+// Write writes to the current file; the file is created if needed
+func (o *Output) Write(p []byte) (int, error) {
+	if o.file == nil {
+		if err := o.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := o.w.Write(p)
+	o.written += uint64(n)
+	return n, err
+}
+
+// Flush writes data buffered by the compressor to the file
+func (o *Output) Flush() error {
+	if f, ok := o.w.(interface{ Flush() error }); ok && o.file != nil {
+		return f.Flush()
+	}
+	return nil
+}
+
+// finish closes the current file and runs the post rotate hook
+func (o *Output) finish() error {
+	if o.file == nil {
+		return nil
+	}
+	var err error
+	if o.closer != nil {
+		err = o.closer.Close()
+	}
+	if o.file != os.Stdout {
+		if cerr := o.file.Close(); err == nil {
+			err = cerr
+		}
+		if o.options.Hook != "" {
+			name := o.name
+			o.hooks.Add(1)
+			go func() {
+				defer o.hooks.Done()
+				cmd := exec.Command("/bin/sh", "-c", o.options.Hook, "sh", name)
+				cmd.Stdout = os.Stderr
+				cmd.Stderr = os.Stderr
+				if err := cmd.Run(); err != nil {
+					log.Printf("post rotate command for %s failed: %s\n", name, err)
+				}
+			}()
+		}
+	}
+	o.file = nil
+	o.written = 0
+	return err
+}
+
+// Rotate finishes the current file. The next write creates a new file.
+func (o *Output) Rotate() error {
+	// the record, which caused the rotation, belongs to the new file
+	o.flows = 1
+	err := o.finish()
+	o.start = o.next
+	return err
+}
+
+// Close finishes the current file and waits for the post rotate hooks
+func (o *Output) Close() error {
+	err := o.finish()
+	o.hooks.Wait()
+	return err
+}
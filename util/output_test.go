@@ -0,0 +1,127 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAll(t *testing.T, name string) string {
+	f, err := OpenFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// write writes the records with a header per file like an exporter
+func write(t *testing.T, o *Output, records []string, when []int64) {
+	header := true
+	for i, record := range records {
+		if o.Due(when[i], 0) {
+			if err := o.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+			header = true
+		}
+		if header {
+			o.Write([]byte("header\n"))
+			header = false
+		}
+		if _, err := o.Write([]byte(record)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOutputRotation(t *testing.T) {
+	hour := int64(time.Hour)
+	tests := []struct {
+		name    string
+		options OutputOptions
+		pattern string
+		when    []int64
+		files   map[string]string
+	}{
+		{"flows", OutputOptions{Flows: 2, Clock: "packet"}, "out-%n.txt", []int64{0, 0, 0, 0, 0},
+			map[string]string{"out-0.txt": "a\nb\n", "out-1.txt": "c\nd\n", "out-2.txt": "e\n"}},
+		{"size", OutputOptions{Size: 10, Clock: "packet"}, "out.txt", []int64{0, 0, 0, 0, 0},
+			map[string]string{"out.txt": "a\nb\n", "out.1.txt": "c\nd\n", "out.2.txt": "e\n"}},
+		{"interval", OutputOptions{Interval: 3600, Clock: "packet"}, "out-%Y%m%d-%H%M%S.txt.gz", []int64{0, 1, hour + 5, 3*hour - 1, 3 * hour},
+			map[string]string{"out-19700101-000000.txt.gz": "a\nb\n", "out-19700101-010000.txt.gz": "c\n", "out-19700101-020000.txt.gz": "d\n", "out-19700101-030000.txt.gz": "e\n"}},
+		{"zstd", OutputOptions{Flows: 3, Clock: "packet", Compress: "zstd"}, "out-%s.txt", []int64{0, 0, 0, hour, hour},
+			map[string]string{"out-0.txt.zst": "a\nb\nc\n", "out-3600.txt.zst": "d\ne\n"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "output")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			o, err := NewOutput(filepath.Join(dir, test.pattern), test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			write(t, o, []string{"a\n", "b\n", "c\n", "d\n", "e\n"}, test.when)
+			names, _ := filepath.Glob(filepath.Join(dir, "*"))
+			if len(names) != len(test.files) {
+				t.Errorf("got files %v; expected %d files", names, len(test.files))
+			}
+			for name, content := range test.files {
+				if got := readAll(t, filepath.Join(dir, name)); got != "header\n"+content {
+					t.Errorf("file %s contains %q; expected %q", name, got, "header\n"+content)
+				}
+			}
+		})
+	}
+}
+
+func TestOutputHook(t *testing.T) {
+	dir, err := ioutil.TempDir("", "output")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	o, err := NewOutput(filepath.Join(dir, "out-%n"), OutputOptions{Flows: 1, Clock: "wall", Hook: `mv "$1" "$1.done"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	write(t, o, []string{"a\n", "b\n", "c\n"}, []int64{0, 0, 0})
+	names, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(names) != 3 {
+		t.Fatalf("got files %v; expected 3 files", names)
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, ".done") {
+			t.Errorf("post rotate command wasn't executed for %s", name)
+		}
+	}
+}
+
+func TestOutputInvalid(t *testing.T) {
+	for _, options := range []OutputOptions{
+		{Clock: "cpu"},
+		{Clock: "wall", Compress: "lz4"},
+		{Clock: "wall", Flows: 10},
+	} {
+		if _, err := NewOutput("-", options); err == nil {
+			t.Errorf("options %+v should be rejected", options)
+		}
+	}
+	var size sizeValue
+	if err := size.Set("2k"); err != nil || size != 2048 {
+		t.Errorf("size 2k parsed as %d (%v); expected 2048", size, err)
+	}
+}